@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log/slog"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/alexurquhart/sp500scraper/pkg/scraper"
+	"github.com/alexurquhart/sp500scraper/pkg/store"
+)
+
+// Snapshot the positions, balances and executions of the Questrade accounts
+// of every profile into the account tables.
+//
+// Executions are fetched from the latest one stored for each account, or
+// over the last -executions-days days for accounts without any. With -every
+// the accounts are snapshotted again at that interval until interrupted,
+// building up a history of the portfolio.
+func runAccount(args []string) error {
+	fs := flag.NewFlagSet("account", flag.ExitOnError)
+	driver := fs.String("db-driver", "sqlite3", "Database driver to save to, sqlite3, postgres, mysql or duckdb")
+	dsn := fs.String("dsn", "sp500.db", "Data source name of the database, a file path for sqlite3 and duckdb")
+	fs.StringVar(dsn, "db", "sp500.db", "Database file, the same as -dsn")
+	schema := fs.String("schema", "", "Schema file to create the database with instead of the built in SQLite migrations or PostgreSQL schema")
+	executionsDays := fs.Int("executions-days", 30, "Days of executions fetched for accounts without any stored")
+	every := fs.Duration("every", 0, "Take another snapshot at this interval until interrupted, 0 for a single snapshot")
+	credentials := fs.String("credentials", "credentials.json", "File the refresh token is saved to between runs, or keyring to keep it in the OS keyring")
+	server := addServerFlags(fs)
+	profiles := fs.String("profiles", "", "Comma separated Questrade credential profiles whose accounts are snapshotted")
+	rateLimit := fs.Float64("rate-limit", 5, "Maximum number of API calls per second")
+	retries := fs.Int("retries", 3, "Maximum number of attempts for each API call")
+	retryDelay := fs.Duration("retry-delay", time.Second, "Initial delay between retries, doubled after each attempt")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	live, err := server.isLive()
+	if err != nil {
+		return err
+	}
+	if *executionsDays < 1 {
+		return errors.New("At least one day of executions is required")
+	}
+
+	st, err := store.New(*driver, *dsn, *schema, 0)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+
+	p, err := scraper.NewProvider("questrade", scraper.ProviderConfig{
+		Credentials: *credentials,
+		Live:        live,
+		Profiles:    splitList(*profiles),
+		RateLimit:   *rateLimit,
+		Retry:       scraper.RetryPolicy{MaxAttempts: *retries, BaseDelay: *retryDelay, MaxDelay: time.Minute},
+	})
+	if err != nil {
+		return err
+	}
+	ap, ok := p.(scraper.AccountProvider)
+	if !ok {
+		return errors.New("Provider doesn't report accounts")
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+	for {
+		if err := snapshotAccounts(ctx, ap, st, *executionsDays); err != nil {
+			if *every == 0 || ctx.Err() != nil {
+				return err
+			}
+			slog.Error("Account snapshot failed", "error", err)
+		}
+		if *every == 0 {
+			return nil
+		}
+		select {
+		case <-time.After(*every):
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// Snapshot and save every account.
+func snapshotAccounts(ctx context.Context, ap scraper.AccountProvider, st store.Store, executionsDays int) error {
+	since, err := st.LatestExecutions()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	snaps, err := ap.GetAccounts(ctx, since, now.AddDate(0, 0, -executionsDays), now)
+	if err != nil {
+		return err
+	}
+	for _, snap := range snaps {
+		if err := st.SaveAccount(snap); err != nil {
+			return err
+		}
+		slog.Info("Saved account snapshot", "account", snap.Account.Number, "type", snap.Account.Type,
+			"positions", len(snap.Positions), "balances", len(snap.Balances), "executions", len(snap.Executions))
+	}
+	return nil
+}
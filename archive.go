@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alexurquhart/sp500scraper/pkg/store"
+	"github.com/xitongsys/parquet-go-source/local"
+	"github.com/xitongsys/parquet-go-source/s3"
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/source"
+)
+
+// Parquet compression codecs by name
+var parquetCodecs = map[string]parquet.CompressionCodec{
+	"none":   parquet.CompressionCodec_UNCOMPRESSED,
+	"snappy": parquet.CompressionCodec_SNAPPY,
+	"gzip":   parquet.CompressionCodec_GZIP,
+	"zstd":   parquet.CompressionCodec_ZSTD,
+}
+
+// Move candles older than a number of years out of the database into
+// compressed Parquet files, on local disk or in an S3 bucket given as
+// s3://bucket/prefix.
+//
+// Files are partitioned like Parquet exports, with one file per archive run in
+// symbol=<symbol>/interval=<interval>/year=<year>. A symbol's candles are only
+// deleted once its files have been written, and the database is vacuumed at
+// the end to give the space back. SQLite databases are backed up before
+// candles are pruned.
+func runArchive(args []string) error {
+	fs := flag.NewFlagSet("archive", flag.ExitOnError)
+	driver := fs.String("db-driver", "sqlite3", "Database driver to archive from, sqlite3, postgres, mysql or duckdb")
+	dsn := fs.String("dsn", "sp500.db", "Data source name of the database, a file path for sqlite3 and duckdb")
+	fs.StringVar(dsn, "db", "sp500.db", "Database file, the same as -dsn")
+	schema := fs.String("schema", "", "Schema file to create the database with instead of the built in SQLite migrations or PostgreSQL schema")
+	years := fs.Int("older-than", 5, "Archive candles that started more than this many years ago")
+	dest := fs.String("dest", "archive", "Directory or s3://bucket/prefix to write the archived candles to")
+	compression := fs.String("compression", "zstd", "Compression of the Parquet files, none, snappy, gzip or zstd")
+	prune := fs.Bool("prune", true, "Delete archived candles from the database")
+	addBackupFlags(fs)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	codec, ok := parquetCodecs[*compression]
+	if !ok {
+		return errors.New("Invalid compression: " + *compression)
+	}
+	if *years < 1 {
+		return errors.New("Candles must be at least a year old to be archived")
+	}
+	cutoff := time.Now().AddDate(-*years, 0, 0)
+
+	st, err := store.New(*driver, *dsn, *schema, 0)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+
+	symbols, err := st.Symbols()
+	if err != nil {
+		return err
+	}
+
+	if *prune {
+		if _, err := st.Backup("archive"); err != nil {
+			return errors.New("Could not back up the database before pruning it: " + err.Error())
+		}
+	}
+
+	name := "archived-" + time.Now().Format("20060102T150405") + ".parquet"
+	archived, pruned := 0, 0
+	for _, sym := range symbols {
+		candles, err := st.Candles(sym.SymbolID, "", time.Time{}, cutoff)
+		if err != nil {
+			return err
+		}
+		if len(candles) == 0 {
+			continue
+		}
+
+		type partition struct {
+			interval string
+			year     int
+		}
+		parts := make(map[partition][]store.Candle)
+		for _, c := range candles {
+			p := partition{c.Interval, c.Start.Year()}
+			parts[p] = append(parts[p], c)
+		}
+		for p, cdls := range parts {
+			dir := path.Join("symbol="+sym.Symbol, "interval="+p.interval, "year="+strconv.Itoa(p.year))
+			if err := archiveFile(*dest, path.Join(dir, name), codec, sym.Symbol, cdls); err != nil {
+				return err
+			}
+		}
+		archived += len(candles)
+
+		if *prune {
+			n, err := st.DeleteCandles(sym.SymbolID, cutoff)
+			if err != nil {
+				return err
+			}
+			pruned += n
+		}
+		slog.Info("Archived candles", "symbol", sym.Symbol, "exchange", sym.Exchange, "candles", len(candles))
+	}
+
+	if pruned > 0 {
+		if err := st.Compact(); err != nil {
+			return err
+		}
+	}
+	slog.Info("Archive finished", "candles", archived, "pruned", pruned, "before", cutoff.Format(time.RFC3339), "dest", *dest)
+	return nil
+}
+
+// Write candles to a Parquet file at the key under the destination. S3
+// uploads complete when the file is closed, so the close error is reported.
+func archiveFile(dest, key string, codec parquet.CompressionCodec, symbol string, candles []store.Candle) error {
+	var fw source.ParquetFile
+	var err error
+	if strings.HasPrefix(dest, "s3://") {
+		bucket, prefix := splitBucket(strings.TrimPrefix(dest, "s3://"))
+		fw, err = s3.NewS3FileWriter(context.Background(), bucket, path.Join(prefix, key), "", nil)
+	} else {
+		p := filepath.Join(dest, filepath.FromSlash(key))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			return err
+		}
+		fw, err = local.NewLocalFileWriter(p)
+	}
+	if err != nil {
+		return err
+	}
+
+	err = writeParquet(fw, codec, symbol, candles)
+	if cerr := fw.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Split bucket/prefix into the bucket and the prefix, which may be empty.
+func splitBucket(s string) (string, string) {
+	if i := strings.Index(s, "/"); i >= 0 {
+		return s[:i], strings.Trim(s[i+1:], "/")
+	}
+	return s, ""
+}
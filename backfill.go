@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log/slog"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/alexurquhart/sp500scraper/pkg/scraper"
+	"github.com/alexurquhart/sp500scraper/pkg/store"
+	"github.com/alexurquhart/sp500scraper/pkg/universe"
+)
+
+// Backfill a long range of candles a month at a time rather than with a
+// single request per symbol.
+//
+// The range is split into one job per symbol, interval and month, recorded
+// in the backfill_jobs table, and the jobs not done yet are then fetched by
+// a pool of workers. Running the same backfill again after an interruption
+// or failures only fetches the windows still missing, up to -max-attempts
+// tries each. With -plan=false only jobs already planned are worked on.
+func runBackfill(args []string) error {
+	fs := flag.NewFlagSet("backfill", flag.ExitOnError)
+	driver := fs.String("db-driver", "sqlite3", "Database driver to save to, sqlite3, postgres, mysql or duckdb")
+	dsn := fs.String("dsn", "sp500.db", "Data source name of the database, a file path for sqlite3 and duckdb")
+	fs.StringVar(dsn, "db", "sp500.db", "Database file, the same as -dsn")
+	schema := fs.String("schema", "", "Schema file to create the database with instead of the built in SQLite migrations or PostgreSQL schema")
+	start := fs.String("start", "", "Start date of the backfill (YYYY-MM-DD), defaults to 5 years ago")
+	end := fs.String("end", "", "End date of the backfill (YYYY-MM-DD), defaults to today")
+	interval := fs.String("interval", "OneDay", "Comma separated candlestick intervals to backfill")
+	plan := fs.Bool("plan", true, "Add the jobs of the range before working through the pending ones")
+	maxAttempts := fs.Int("max-attempts", 3, "Number of times a failing job is tried before it is given up on")
+	workers := fs.Int("workers", 4, "Number of windows to fetch concurrently")
+	universeName := fs.String("universe", "sp500", "Index to backfill, one of sp500, nasdaq100, dow30 or russell1000")
+	symbolsFile := fs.String("symbols-file", "", "JSON file of the constituents of the universe, defaults to <universe>.json")
+	provider := fs.String("provider", "questrade", "Source of the candles, questrade or yahoo")
+	credentials := fs.String("credentials", "credentials.json", "File the refresh token is saved to between runs, or keyring to keep it in the OS keyring")
+	server := addServerFlags(fs)
+	profiles := fs.String("profiles", "", "Comma separated Questrade credential profiles to spread requests across")
+	rateLimit := fs.Float64("rate-limit", 5, "Maximum number of API calls per second")
+	retries := fs.Int("retries", 3, "Maximum number of attempts for each API call")
+	retryDelay := fs.Duration("retry-delay", time.Second, "Initial delay between retries, doubled after each attempt")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	live, err := server.isLive()
+	if err != nil {
+		return err
+	}
+
+	intervals := splitList(*interval)
+	if len(intervals) == 0 {
+		return errors.New("No intervals to backfill")
+	}
+	ranges := make([]scraper.CandleRange, len(intervals))
+	for i, iv := range intervals {
+		var err error
+		if ranges[i], err = scraper.ParseRange(*start, *end, iv); err != nil {
+			return err
+		}
+	}
+	if *workers < 1 {
+		return errors.New("At least one worker is required")
+	}
+	if *maxAttempts < 1 {
+		return errors.New("Jobs must be attempted at least once")
+	}
+
+	u, err := universe.Find(*universeName)
+	if err != nil {
+		return err
+	}
+	if *symbolsFile != "" {
+		u.File = *symbolsFile
+	}
+	symbols, err := u.Load(false)
+	if err != nil {
+		return err
+	}
+
+	st, err := store.New(*driver, *dsn, *schema, 0)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+
+	if *plan {
+		added, err := scraper.PlanBackfill(st, symbols, ranges)
+		if err != nil {
+			return err
+		}
+		slog.Info("Planned backfill", "universe", u.Name, "symbols", len(symbols), "jobs", added)
+	}
+
+	p, err := scraper.NewProvider(*provider, scraper.ProviderConfig{
+		Credentials: *credentials,
+		Live:        live,
+		Profiles:    splitList(*profiles),
+		RateLimit:   *rateLimit,
+		Retry:       scraper.RetryPolicy{MaxAttempts: *retries, BaseDelay: *retryDelay, MaxDelay: time.Minute},
+	})
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+	s := scraper.New(p, st, scraper.Config{Workers: *workers, Provider: *provider, Version: version})
+	sum, err := s.Backfill(ctx, symbols, *maxAttempts)
+	if err != nil {
+		return err
+	}
+	slog.Info("Backfill finished", "run", sum.Run, "jobs", sum.Jobs, "done", sum.Done, "failed", sum.Failed, "candles", sum.Candles, "duration", sum.Duration)
+	if sum.Interrupted {
+		slog.Warn("Backfill interrupted, run it again to continue", "done", sum.Done+sum.Failed, "jobs", sum.Jobs)
+	}
+	return nil
+}
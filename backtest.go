@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/alexurquhart/sp500scraper/pkg/store"
+)
+
+// Columns of the files of Zipline's csvdir bundle, and of Backtrader's
+// GenericCSVData feed with its default column order
+var (
+	ziplineHeader    = []string{"date", "open", "high", "low", "close", "volume", "dividend", "split"}
+	backtraderHeader = []string{"datetime", "open", "high", "low", "close", "volume", "openinterest"}
+)
+
+// Directories of Zipline's csvdir bundle the candles of each interval go
+// in, other intervals aren't exported
+var ziplineDirs = map[string]string{
+	"OneDay":    "daily",
+	"OneMinute": "minute",
+}
+
+// Backtrader's default dtformat
+const backtraderTimeFormat = "2006-01-02 15:04:05"
+
+// Write the daily and minute candles of a symbol in the layout of Zipline's
+// csvdir bundle, daily/<symbol>.csv and minute/<symbol>.csv. Days are the
+// session dates in loc and minutes are in UTC, which is how the bundle reads
+// them. Dividends and splits are left at 0 and 1, as prices aren't adjusted.
+func exportZipline(dir, symbol string, candles []store.Candle, loc *time.Location) error {
+	byDir := make(map[string][][]string)
+	for _, c := range candles {
+		sub, ok := ziplineDirs[c.Interval]
+		if !ok {
+			continue
+		}
+		var date string
+		if c.Interval == "OneDay" {
+			date = c.Start.In(loc).Format("2006-01-02")
+		} else {
+			date = c.Start.UTC().Format(backtraderTimeFormat)
+		}
+		byDir[sub] = append(byDir[sub], []string{date, formatPrice(c.Open), formatPrice(c.High), formatPrice(c.Low),
+			formatPrice(c.Close), strconv.Itoa(c.Volume), "0", "1"})
+	}
+	for sub, rows := range byDir {
+		if err := writeRows(filepath.Join(dir, sub, symbol+".csv"), ziplineHeader, rows); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Write the candles of a symbol to one file per interval,
+// <interval>/<symbol>.csv, in the default column order and time format of
+// Backtrader's GenericCSVData, with times in loc.
+func exportBacktrader(dir, symbol string, candles []store.Candle, loc *time.Location) error {
+	byInterval := make(map[string][][]string)
+	for _, c := range candles {
+		byInterval[c.Interval] = append(byInterval[c.Interval], []string{c.Start.In(loc).Format(backtraderTimeFormat),
+			formatPrice(c.Open), formatPrice(c.High), formatPrice(c.Low), formatPrice(c.Close), strconv.Itoa(c.Volume), "0"})
+	}
+	for interval, rows := range byInterval {
+		if err := writeRows(filepath.Join(dir, interval, symbol+".csv"), backtraderHeader, rows); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Write a CSV file with the header and rows, creating its directory.
+func writeRows(path string, header []string, rows [][]string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	w.Write(header)
+	w.WriteAll(rows)
+	if err := w.Error(); err != nil {
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/alexurquhart/sp500scraper/pkg/store"
+	"gopkg.in/yaml.v2"
+)
+
+// Config file read when -config isn't given. It is optional, unlike a file
+// named with -config.
+const defaultConfigFile = "sp500scraper.yaml"
+
+// Parse the flags of a command, filling in those not given on the command
+// line from the config file. The config file is a YAML map of flag names to
+// values, shared by all commands; keys that aren't flags of the command
+// being run are ignored.
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	path := fs.String("config", defaultConfigFile, "YAML file of flag values, overridden by flags on the command line")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+
+	file, err := ioutil.ReadFile(*path)
+	if os.IsNotExist(err) && !set["config"] {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	var values map[string]interface{}
+	if err := yaml.Unmarshal(file, &values); err != nil {
+		return errors.New("Invalid config file " + *path + ": " + err.Error())
+	}
+	for name, v := range values {
+		if set[name] || name == "config" || fs.Lookup(name) == nil {
+			continue
+		}
+		value := ""
+		if v != nil {
+			value = fmt.Sprint(v)
+		}
+		if err := fs.Set(name, value); err != nil {
+			return fmt.Errorf("Invalid value for %s in config file %s: %v", name, *path, err)
+		}
+	}
+	return nil
+}
+
+// Add the flags of where the database is backed up to before destructive
+// changes, setting the backup policy of the stores opened after parsing.
+func addBackupFlags(fs *flag.FlagSet) {
+	fs.StringVar(&store.Backups.Dir, "backup-dir", "", "Directory of the SQLite backups taken before migrations and pruning, backups next to the database if empty")
+	fs.IntVar(&store.Backups.Keep, "backups", store.Backups.Keep, "Number of SQLite backups to keep, 0 to take none")
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"io/ioutil"
+	"log/slog"
+	"math"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/alexurquhart/sp500scraper/pkg/scraper"
+	"github.com/alexurquhart/sp500scraper/pkg/store"
+)
+
+// Correlation matrix as exported to JSON, null where a pair has none
+type correlationJSON struct {
+	End     string       `json:"end"`
+	Window  int          `json:"window"`
+	Symbols []string     `json:"symbols"`
+	Matrix  [][]*float64 `json:"matrix"`
+}
+
+// Compute the correlation matrix of the daily returns of the stored symbols
+// over a window of trading days, write it to a CSV or JSON file and save it
+// to the correlations table.
+func runCorrelation(args []string) error {
+	fs := flag.NewFlagSet("correlation", flag.ExitOnError)
+	driver := fs.String("db-driver", "sqlite3", "Database driver to read from and write to, sqlite3, postgres, mysql or duckdb")
+	dsn := fs.String("dsn", "sp500.db", "Data source name of the database, a file path for sqlite3 and duckdb")
+	fs.StringVar(dsn, "db", "sp500.db", "Database file, the same as -dsn")
+	schema := fs.String("schema", "", "Schema file to create the database with instead of the built in SQLite migrations or PostgreSQL schema")
+	window := fs.Int("window", 252, "Number of trading days to correlate the returns over")
+	end := fs.String("end", "", "Last day of the window (YYYY-MM-DD), defaults to the latest day stored")
+	splits := fs.String("splits-file", "splits.json", "JSON file of known splits, instead of detecting them")
+	format := fs.String("format", "csv", "Output format, csv or json")
+	out := fs.String("out", "", "File to write the matrix to, defaults to correlation.<format>")
+	save := fs.Bool("save", true, "Save the correlations to the correlations table")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	if *format != "csv" && *format != "json" {
+		return errors.New("Invalid format: " + *format)
+	}
+	if *out == "" {
+		*out = "correlation." + *format
+	}
+	until := time.Now().AddDate(0, 0, 1)
+	if *end != "" {
+		day, err := time.ParseInLocation(scraper.DateFormat, *end, time.Local)
+		if err != nil {
+			return errors.New("Invalid end date: " + *end)
+		}
+		until = day.AddDate(0, 0, 1)
+	}
+
+	st, err := store.New(*driver, *dsn, *schema, 0)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+
+	m, err := scraper.Correlate(st, *splits, until, *window)
+	if err != nil {
+		return err
+	}
+	if len(m.Symbols) < 2 {
+		return errors.New("Not enough symbols with returns to correlate")
+	}
+
+	if *format == "csv" {
+		err = writeCorrelationCSV(*out, m)
+	} else {
+		err = writeCorrelationJSON(*out, m)
+	}
+	if err != nil {
+		return err
+	}
+	if *save {
+		if err := st.SaveCorrelations(m.End, m.Window, m.Pairs()); err != nil {
+			return err
+		}
+	}
+	slog.Info("Correlation matrix written", "symbols", len(m.Symbols), "end", m.End.Format(scraper.DateFormat), "window", m.Window, "file", *out)
+	return nil
+}
+
+// Write the matrix with a header row and column of symbols, leaving the
+// pairs without a correlation empty.
+func writeCorrelationCSV(path string, m scraper.CorrelationMatrix) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	header := []string{"symbol"}
+	for _, s := range m.Symbols {
+		header = append(header, s.Symbol)
+	}
+	w.Write(header)
+	for i, row := range m.Values {
+		record := []string{m.Symbols[i].Symbol}
+		for _, v := range row {
+			if math.IsNaN(v) {
+				record = append(record, "")
+			} else {
+				record = append(record, strconv.FormatFloat(v, 'f', 6, 64))
+			}
+		}
+		w.Write(record)
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func writeCorrelationJSON(path string, m scraper.CorrelationMatrix) error {
+	doc := correlationJSON{End: m.End.Format(scraper.DateFormat), Window: m.Window, Matrix: make([][]*float64, len(m.Values))}
+	for i, row := range m.Values {
+		doc.Symbols = append(doc.Symbols, m.Symbols[i].Symbol)
+		doc.Matrix[i] = make([]*float64, len(row))
+		for j := range row {
+			if !math.IsNaN(row[j]) {
+				doc.Matrix[i][j] = &row[j]
+			}
+		}
+	}
+	b, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, b, 0644)
+}
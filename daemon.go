@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/alexurquhart/sp500scraper/pkg/scraper"
+	"github.com/alexurquhart/sp500scraper/pkg/store"
+)
+
+// Run incremental updates on a schedule until the context is cancelled. The
+// session is refreshed at the start of every run since the access token
+// will have expired while idle, and the symbols are reloaded with load so
+// edits to the symbol file are picked up. With a calendar in the config,
+// runs scheduled on days the exchange is closed are skipped as there is
+// nothing new to fetch. The report file, unless empty, is rewritten after
+// every run, and the state of the daemon is kept in ds for the status
+// endpoints and reported to systemd when it supervises the daemon.
+func runDaemon(ctx context.Context, s *scraper.Scraper, sched *Schedule, pc progressConfig, load func() ([]store.Symbol, error), report string, ds *daemonStatus) {
+	s.Config.Update = true
+	s.Config.Resume = false
+	sdNotify("READY=1")
+	startWatchdog(ctx, s.Store)
+	defer sdNotify("STOPPING=1")
+
+	for {
+		next := sched.Next(time.Now())
+		if next.IsZero() {
+			slog.Warn("Schedule has no upcoming runs, stopping")
+			return
+		}
+		slog.Info("Next run scheduled", "at", next)
+		ds.scheduled(next)
+		sdNotify("STATUS=Next run at " + next.Format(time.RFC3339))
+		select {
+		case <-time.After(next.Sub(time.Now())):
+		case <-ctx.Done():
+			slog.Info("Daemon stopped")
+			return
+		}
+		if cal := s.Config.Calendar; cal != nil && !cal.IsTradingDay(next) {
+			holiday, _ := cal.Holiday(next)
+			slog.Info("Market closed, skipping run", "calendar", cal.Name, "holiday", holiday)
+			continue
+		}
+
+		ds.runStarted()
+		sdNotify("STATUS=Running")
+		if sp, ok := s.Provider.(scraper.SessionProvider); ok {
+			if err := sp.Login(); err != nil {
+				ds.runFailed(err)
+				slog.Error("Login failed, skipping run", "error", err)
+				notify(alertNotification("run_failed", "Login failed, skipping run", "error", err))
+				continue
+			}
+		}
+
+		symbols, err := load()
+		if err != nil {
+			ds.runFailed(err)
+			slog.Error("Could not load symbols, skipping run", "error", err)
+			notify(alertNotification("run_failed", "Could not load symbols, skipping run", "error", err))
+			continue
+		}
+
+		syncBeforeRun()
+		sum, err := scrape(ctx, s, symbols, pc)
+		if err != nil {
+			ds.runFailed(err)
+			slog.Error("Run failed", "error", err)
+			notify(alertNotification("run_failed", "Run failed", "error", err))
+			continue
+		}
+		logSummary(sum)
+		syncAfterRun(ctx, s.Store, sum)
+		if report != "" {
+			if err := writeReport(report, s.Store, sum, s.Config.Intervals[0]); err != nil {
+				slog.Error("Could not write report", "file", report, "error", err)
+			}
+		}
+		notify(summaryNotification(sum))
+		behind, err := behindSchedule(s.Store, symbols, s.Config.Intervals[0], s.Config.Calendar, time.Now())
+		if err != nil {
+			slog.Error("Could not check symbols behind schedule", "error", err)
+		}
+		ds.runFinished(sum, behind)
+		if sum.Interrupted {
+			return
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/alexurquhart/sp500scraper/pkg/remote"
+	"github.com/alexurquhart/sp500scraper/pkg/scraper"
+	"github.com/alexurquhart/sp500scraper/pkg/store"
+)
+
+// Copy of the SQLite database kept in object storage, so several machines
+// can share the dataset. Set with -sync, nil if the database isn't synced.
+var dbSync *databaseSync
+
+type databaseSync struct {
+	bucket remote.Bucket
+	key    string
+	file   string // Local database file
+}
+
+// Open the bucket of the -sync URL for the SQLite database at dsn.
+func newDatabaseSync(url, driver, dsn string) (*databaseSync, error) {
+	file := store.SQLiteFile(dsn)
+	if driver != "sqlite3" || file == "" {
+		return nil, errors.New("Only SQLite database files can be synced")
+	}
+	b, key, err := remote.Open(context.Background(), url)
+	if err != nil {
+		return nil, err
+	}
+	return &databaseSync{bucket: b, key: key, file: file}, nil
+}
+
+// File next to the database holding the checksum of the copy in the bucket
+// it was last pushed as, removed before each run writes to it. Without it
+// the database may have changes the bucket doesn't.
+func (ds *databaseSync) stateFile() string {
+	return ds.file + ".synced"
+}
+
+// Checksum of the copy the database was last pushed as, empty if it may
+// have changed since.
+func (ds *databaseSync) synced() string {
+	b, err := ioutil.ReadFile(ds.stateFile())
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
+
+// Replace the local database with the latest copy in the bucket, before the
+// database is opened, if it is a newer copy than the one the database was
+// last pushed or pulled as. A database changed since, such as by a run whose
+// upload failed, is never replaced. The local file is kept next to it with
+// a .prev suffix.
+func (ds *databaseSync) pull(ctx context.Context) error {
+	if _, err := os.Stat(ds.file + "-wal"); err == nil {
+		// Writes of a run that didn't close the database would be lost
+		slog.Warn("Local database has an unfinished write-ahead log, not replacing it", "file", ds.file)
+		return nil
+	}
+	sum, err := remote.ObjectChecksum(ctx, ds.bucket, ds.key)
+	if err != nil || sum == "" {
+		return err
+	}
+	if _, err := os.Stat(ds.file); err == nil {
+		switch ds.synced() {
+		case sum:
+			slog.Info("No newer copy of the database to download", "file", ds.file, "key", ds.key)
+			return nil
+		case "":
+			slog.Warn("Local database changed since it was last synced, not replacing it", "file", ds.file, "key", ds.key)
+			return nil
+		}
+	}
+	pulled, err := remote.Pull(ctx, ds.bucket, ds.key, ds.file)
+	if err != nil {
+		return err
+	}
+	if pulled {
+		slog.Info("Downloaded the latest copy of the database", "file", ds.file, "key", ds.key)
+	}
+	return ioutil.WriteFile(ds.stateFile(), []byte(sum+"\n"), 0644)
+}
+
+// Upload a consistent copy of the database after a run, unless it matches
+// the copy in the bucket.
+func (ds *databaseSync) push(ctx context.Context, st store.Store) error {
+	tmp := ds.file + ".sync"
+	os.Remove(tmp)
+	if err := st.CopyFile(tmp); err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+	sum, err := remote.Checksum(tmp)
+	if err != nil {
+		return err
+	}
+	pushed, err := remote.Push(ctx, ds.bucket, ds.key, tmp)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(ds.stateFile(), []byte(sum+"\n"), 0644); err != nil {
+		return err
+	}
+	if pushed {
+		slog.Info("Uploaded the database", "key", ds.key)
+	} else {
+		slog.Debug("Database unchanged since the last upload", "key", ds.key)
+	}
+	return nil
+}
+
+// Mark the database as changed since it was last synced before a run writes
+// to it, if it is synced, so it isn't replaced by a pull until it has been
+// pushed again.
+func syncBeforeRun() {
+	if dbSync == nil {
+		return
+	}
+	if err := os.Remove(dbSync.stateFile()); err != nil && !os.IsNotExist(err) {
+		slog.Warn("Could not mark the database as changed", "file", dbSync.stateFile(), "error", err)
+	}
+}
+
+// Upload the database after a run that finished, if it is synced. Errors
+// are logged, the run's data is safe locally.
+func syncAfterRun(ctx context.Context, st store.Store, sum scraper.Summary) {
+	if dbSync == nil || sum.Interrupted {
+		return
+	}
+	if err := dbSync.push(ctx, st); err != nil {
+		slog.Error("Could not upload the database", "key", dbSync.key, "error", err)
+		notify(alertNotification("sync_failed", "Could not upload the database", "error", err))
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log/slog"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/alexurquhart/sp500scraper/pkg/calendar"
+	"github.com/alexurquhart/sp500scraper/pkg/scraper"
+	"github.com/alexurquhart/sp500scraper/pkg/store"
+)
+
+// Snapshot the order books of a few stored symbols every -every while the
+// market is open, until interrupted.
+//
+// Snapshots are only taken during the regular session of the -calendar
+// exchange, and the command sleeps until the next open outside of it. Each
+// snapshot is written to the depth table with the time it was taken.
+func runDepth(args []string) error {
+	fs := flag.NewFlagSet("depth", flag.ExitOnError)
+	driver := fs.String("db-driver", "sqlite3", "Database driver to save to, sqlite3, postgres, mysql or duckdb")
+	dsn := fs.String("dsn", "sp500.db", "Data source name of the database, a file path for sqlite3 and duckdb")
+	fs.StringVar(dsn, "db", "sp500.db", "Database file, the same as -dsn")
+	schema := fs.String("schema", "", "Schema file to create the database with instead of the built in SQLite migrations or PostgreSQL schema")
+	symbolList := fs.String("symbols", "", "Comma separated stored symbols whose order books are snapshotted")
+	every := fs.Duration("every", 10*time.Second, "Time between snapshots")
+	calendarName := fs.String("calendar", "NYSE", "Exchange whose regular trading hours snapshots are taken during")
+	credentials := fs.String("credentials", "credentials.json", "File the refresh token is saved to between runs, or keyring to keep it in the OS keyring")
+	server := addServerFlags(fs)
+	rateLimit := fs.Float64("rate-limit", 5, "Maximum number of API calls per second")
+	retries := fs.Int("retries", 3, "Maximum number of attempts for each API call")
+	retryDelay := fs.Duration("retry-delay", time.Second, "Initial delay between retries, doubled after each attempt")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	live, err := server.isLive()
+	if err != nil {
+		return err
+	}
+	names := splitList(*symbolList)
+	if len(names) == 0 {
+		return errors.New("No symbols to snapshot, list them with -symbols")
+	}
+	if *every <= 0 {
+		return errors.New("The time between snapshots must be positive")
+	}
+	cal, err := calendar.Find(*calendarName)
+	if err != nil {
+		return err
+	}
+
+	st, err := store.New(*driver, *dsn, *schema, 0)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+
+	stored, err := st.Symbols()
+	if err != nil {
+		return err
+	}
+	byName := make(map[string]int, len(stored))
+	for _, sym := range stored {
+		byName[sym.Symbol] = sym.SymbolID
+	}
+	var ids []int
+	var missing []string
+	for _, name := range names {
+		if id, ok := byName[name]; ok {
+			ids = append(ids, id)
+		} else {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return errors.New("Symbols not stored, run a scrape first: " + strings.Join(missing, ", "))
+	}
+
+	p, err := scraper.NewProvider("questrade", scraper.ProviderConfig{
+		Credentials: *credentials,
+		Live:        live,
+		RateLimit:   *rateLimit,
+		Retry:       scraper.RetryPolicy{MaxAttempts: *retries, BaseDelay: *retryDelay, MaxDelay: time.Minute},
+	})
+	if err != nil {
+		return err
+	}
+	dp, ok := p.(scraper.DepthProvider)
+	if !ok {
+		return errors.New("Provider doesn't report market depth")
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+	slog.Info("Snapshotting market depth", "symbols", strings.Join(names, ","), "every", *every)
+	for {
+		now := time.Now()
+		wait := *every
+		if cal.IsOpen(now) {
+			levels, err := dp.GetDepth(ctx, ids, now)
+			if err == nil {
+				err = st.SaveDepth(levels)
+			}
+			if err != nil {
+				if ctx.Err() != nil {
+					break
+				}
+				slog.Error("Depth snapshot failed", "error", err)
+			} else {
+				slog.Debug("Saved depth snapshot", "levels", len(levels))
+			}
+			wait -= time.Since(now)
+		} else {
+			open := cal.NextOpen(now)
+			slog.Info("Market closed, waiting for the open", "open", open)
+			wait = time.Until(open)
+		}
+
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	slog.Info("Depth snapshots stopped")
+	return nil
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"io/ioutil"
+	"log/slog"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/alexurquhart/sp500scraper/pkg/scraper"
+	"github.com/alexurquhart/sp500scraper/pkg/store"
+)
+
+// Differences between the candles of a symbol in two databases
+type SymbolDiff struct {
+	Symbol   string       `json:"symbol"`
+	Exchange string       `json:"exchange"`
+	Added    int          `json:"added"`
+	Removed  int          `json:"removed"`
+	Changed  int          `json:"changed"`
+	Changes  []CandleDiff `json:"changes,omitempty"`
+
+	// "a" or "b" if the symbol is only in one database
+	Only string `json:"only,omitempty"`
+}
+
+// A candle that differs between the databases, nil on the side it is
+// missing from
+type CandleDiff struct {
+	Interval string        `json:"interval"`
+	Start    time.Time     `json:"start"`
+	A        *store.Candle `json:"a,omitempty"`
+	B        *store.Candle `json:"b,omitempty"`
+}
+
+// Compare the candles of two databases, such as those written before and
+// after changing provider or upgrading, and report the candles added,
+// removed and changed in the second for each symbol.
+//
+// Symbols are matched by ticker and exchange, as IDs differ between
+// providers, and candles by interval and start. Prices within -tolerance of
+// each other, relative to the first, count as the same.
+func runDiff(args []string) error {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	driverA := fs.String("a-driver", "sqlite3", "Database driver of the first database, sqlite3, postgres, mysql or duckdb")
+	dsnA := fs.String("a", "", "Data source name of the first database, a file path for sqlite3 and duckdb")
+	driverB := fs.String("b-driver", "sqlite3", "Database driver of the second database, sqlite3, postgres, mysql or duckdb")
+	dsnB := fs.String("b", "", "Data source name of the second database, a file path for sqlite3 and duckdb")
+	start := fs.String("start", "", "Only compare candles from this date (YYYY-MM-DD)")
+	end := fs.String("end", "", "Only compare candles before this date (YYYY-MM-DD)")
+	interval := fs.String("interval", "", "Only compare candles of this interval, all if empty")
+	tolerance := fs.Float64("tolerance", 0, "Relative difference below which prices are the same, e.g. 0.0001")
+	details := fs.Int("details", 0, "Number of differing candles of each symbol to log")
+	report := fs.String("report", "", "JSON file to write the differences of every symbol to")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	if *dsnA == "" || *dsnB == "" {
+		return errors.New("Two databases are needed, set -a and -b")
+	}
+	if *interval != "" && !scraper.ValidInterval(*interval) {
+		return errors.New("Invalid interval: " + *interval)
+	}
+	from, to, err := parseQueryRange(*start, *end)
+	if err != nil {
+		return err
+	}
+
+	a, err := store.New(*driverA, *dsnA, "", 0)
+	if err != nil {
+		return err
+	}
+	defer a.Close()
+	b, err := store.New(*driverB, *dsnB, "", 0)
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
+	diffs, err := diffStores(a, b, *interval, from, to, *tolerance)
+	if err != nil {
+		return err
+	}
+	var added, removed, changed int
+	for _, d := range diffs {
+		added, removed, changed = added+d.Added, removed+d.Removed, changed+d.Changed
+		if d.Only != "" {
+			slog.Info("Symbol only in one database", "symbol", d.Symbol, "exchange", d.Exchange, "database", d.Only,
+				"candles", d.Added+d.Removed)
+			continue
+		}
+		slog.Info("Candles differ", "symbol", d.Symbol, "exchange", d.Exchange, "added", d.Added, "removed", d.Removed, "changed", d.Changed)
+		for i, c := range d.Changes {
+			if i == *details {
+				break
+			}
+			slog.Info("Candle differs", "symbol", d.Symbol, "interval", c.Interval, "start", c.Start, "a", candleText(c.A), "b", candleText(c.B))
+		}
+	}
+	slog.Info("Compared databases", "symbols", len(diffs), "added", added, "removed", removed, "changed", changed)
+
+	if *report != "" {
+		if diffs == nil {
+			diffs = []SymbolDiff{}
+		}
+		out, err := json.MarshalIndent(diffs, "", "  ")
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(*report, out, 0644)
+	}
+	return nil
+}
+
+// Differences of every symbol with candles that aren't the same in both
+// stores, ordered by symbol.
+func diffStores(a, b store.Store, interval string, start, end time.Time, tolerance float64) ([]SymbolDiff, error) {
+	symA, err := a.Symbols()
+	if err != nil {
+		return nil, err
+	}
+	symB, err := b.Symbols()
+	if err != nil {
+		return nil, err
+	}
+	inB := make(map[string]store.Symbol, len(symB))
+	for _, s := range symB {
+		inB[s.Key()] = s
+	}
+
+	var diffs []SymbolDiff
+	seen := make(map[string]bool)
+	for _, sa := range symA {
+		seen[sa.Key()] = true
+		ca, err := a.Candles(sa.SymbolID, interval, start, end)
+		if err != nil {
+			return nil, err
+		}
+		var cb []store.Candle
+		sb, ok := inB[sa.Key()]
+		if ok {
+			if cb, err = b.Candles(sb.SymbolID, interval, start, end); err != nil {
+				return nil, err
+			}
+		}
+		d := diffCandles(ca, cb, tolerance)
+		d.Symbol, d.Exchange = sa.Symbol, sa.Exchange
+		if !ok {
+			// Every candle differs, so they aren't listed
+			d.Only, d.Changes = "a", nil
+		}
+		if d.Added+d.Removed+d.Changed > 0 || !ok {
+			diffs = append(diffs, d)
+		}
+	}
+	for _, sb := range symB {
+		if seen[sb.Key()] {
+			continue
+		}
+		cb, err := b.Candles(sb.SymbolID, interval, start, end)
+		if err != nil {
+			return nil, err
+		}
+		d := diffCandles(nil, cb, tolerance)
+		d.Symbol, d.Exchange, d.Only, d.Changes = sb.Symbol, sb.Exchange, "b", nil
+		diffs = append(diffs, d)
+	}
+
+	sort.Slice(diffs, func(i, j int) bool {
+		if diffs[i].Symbol != diffs[j].Symbol {
+			return diffs[i].Symbol < diffs[j].Symbol
+		}
+		return diffs[i].Exchange < diffs[j].Exchange
+	})
+	return diffs, nil
+}
+
+// Compare the candles of a symbol, matched by interval and start.
+func diffCandles(a, b []store.Candle, tolerance float64) SymbolDiff {
+	type key struct {
+		interval string
+		start    int64
+	}
+	inB := make(map[key]store.Candle, len(b))
+	for _, c := range b {
+		inB[key{c.Interval, c.Start.Unix()}] = c
+	}
+
+	var d SymbolDiff
+	for i := range a {
+		ca := a[i]
+		k := key{ca.Interval, ca.Start.Unix()}
+		cb, ok := inB[k]
+		delete(inB, k)
+		switch {
+		case !ok:
+			d.Removed++
+			d.Changes = append(d.Changes, CandleDiff{Interval: ca.Interval, Start: ca.Start, A: &ca})
+		case !sameCandle(ca, cb, tolerance):
+			d.Changed++
+			d.Changes = append(d.Changes, CandleDiff{Interval: ca.Interval, Start: ca.Start, A: &ca, B: &cb})
+		}
+	}
+	for _, c := range b {
+		if _, ok := inB[key{c.Interval, c.Start.Unix()}]; ok {
+			cb := c
+			d.Added++
+			d.Changes = append(d.Changes, CandleDiff{Interval: cb.Interval, Start: cb.Start, B: &cb})
+		}
+	}
+
+	sort.SliceStable(d.Changes, func(i, j int) bool {
+		return d.Changes[i].Start.Before(d.Changes[j].Start)
+	})
+	return d
+}
+
+// Whether two candles of the same interval and start have the same end,
+// volume and prices, the prices within the relative tolerance.
+func sameCandle(a, b store.Candle, tolerance float64) bool {
+	if !a.End.Equal(b.End) || a.Volume != b.Volume {
+		return false
+	}
+	for _, p := range [][2]float32{{a.Open, b.Open}, {a.High, b.High}, {a.Low, b.Low}, {a.Close, b.Close}} {
+		x, y := float64(p[0]), float64(p[1])
+		if math.Abs(x-y) > tolerance*math.Abs(x) {
+			return false
+		}
+	}
+	return true
+}
+
+// Prices and volume of a candle for logging, empty if missing.
+func candleText(c *store.Candle) string {
+	if c == nil {
+		return ""
+	}
+	return "O " + formatPrice(c.Open) + " H " + formatPrice(c.High) + " L " + formatPrice(c.Low) + " C " + formatPrice(c.Close) +
+		" V " + strconv.Itoa(c.Volume)
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"flag"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/alexurquhart/sp500scraper/pkg/store"
+	"github.com/xitongsys/parquet-go-source/local"
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/source"
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+// Columns written to CSV exports
+var csvHeader = []string{"symbol", "interval", "start", "end", "open", "high", "low", "close", "volume", "session", "adjclose"}
+
+// Row of a Parquet export
+type parquetCandle struct {
+	Symbol   string   `parquet:"name=symbol, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Interval string   `parquet:"name=interval, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Start    int64    `parquet:"name=start, type=INT64, convertedtype=TIMESTAMP_MILLIS"`
+	End      int64    `parquet:"name=end, type=INT64, convertedtype=TIMESTAMP_MILLIS"`
+	Open     float64  `parquet:"name=open, type=DOUBLE"`
+	High     float64  `parquet:"name=high, type=DOUBLE"`
+	Low      float64  `parquet:"name=low, type=DOUBLE"`
+	Close    float64  `parquet:"name=close, type=DOUBLE"`
+	Volume   int64    `parquet:"name=volume, type=INT64"`
+	Session  string   `parquet:"name=session, type=BYTE_ARRAY, convertedtype=UTF8"`
+	AdjClose *float64 `parquet:"name=adjclose, type=DOUBLE, repetitiontype=OPTIONAL"`
+}
+
+// Export the stored candles to CSV or Parquet files.
+//
+// CSV exports are written as one file per symbol, or a single candles.csv
+// with -combined. Parquet exports are partitioned by symbol and year in the
+// symbol=<symbol>/year=<year> layout understood by pandas and Spark. The
+// zipline and backtrader formats write the files Zipline's csvdir bundle and
+// Backtrader's generic CSV feed read, see exportZipline and
+// exportBacktrader.
+func runExport(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	driver := fs.String("db-driver", "sqlite3", "Database driver to read from, sqlite3, postgres, mysql or duckdb")
+	dsn := fs.String("dsn", "sp500.db", "Data source name of the database, a file path for sqlite3 and duckdb")
+	fs.StringVar(dsn, "db", "sp500.db", "Database file, the same as -dsn")
+	schema := fs.String("schema", "", "Schema file to create the database with instead of the built in SQLite migrations or PostgreSQL schema")
+	format := fs.String("format", "csv", "Output format, csv, parquet, zipline or backtrader")
+	out := fs.String("out", "export", "Directory to write the exported files to")
+	combined := fs.Bool("combined", false, "Write all symbols to a single CSV file")
+	timezone := fs.String("timezone", "America/New_York", "Time zone of the days and times of zipline and backtrader exports")
+	asOf := fs.String("as-of", "", "Export the candles as they were after this snapshot, a tag or run ID, rather than as they are")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	switch *format {
+	case "csv", "parquet", "zipline", "backtrader":
+	default:
+		return errors.New("Invalid export format: " + *format)
+	}
+	loc, err := time.LoadLocation(*timezone)
+	if err != nil {
+		return err
+	}
+
+	st, err := store.New(*driver, *dsn, *schema, 0)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+
+	run := 0
+	if *asOf != "" {
+		if run, err = resolveSnapshot(st, *asOf); err != nil {
+			return err
+		}
+	}
+
+	symbols, err := st.Symbols()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(*out, 0755); err != nil {
+		return err
+	}
+
+	// Shared CSV writer for combined exports
+	var cw *csv.Writer
+	if *format == "csv" && *combined {
+		f, err := os.Create(filepath.Join(*out, "candles.csv"))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		cw = csv.NewWriter(f)
+		cw.Write(csvHeader)
+	}
+
+	rows := 0
+	for _, sym := range symbols {
+		var candles []store.Candle
+		if run > 0 {
+			candles, err = st.CandlesAsOf(sym.SymbolID, "", time.Time{}, time.Now(), run)
+		} else {
+			candles, err = st.Candles(sym.SymbolID, "", time.Time{}, time.Now())
+		}
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case cw != nil:
+			err = writeCSV(cw, sym.Symbol, candles)
+		case *format == "csv":
+			err = exportCSV(filepath.Join(*out, sym.Symbol+".csv"), sym.Symbol, candles)
+		case *format == "zipline":
+			err = exportZipline(*out, sym.Symbol, candles, loc)
+		case *format == "backtrader":
+			err = exportBacktrader(*out, sym.Symbol, candles, loc)
+		default:
+			err = exportParquet(*out, sym.Symbol, candles)
+		}
+		if err != nil {
+			return err
+		}
+		rows += len(candles)
+	}
+
+	if cw != nil {
+		cw.Flush()
+		if err := cw.Error(); err != nil {
+			return err
+		}
+	}
+	slog.Info("Export finished", "candles", rows, "symbols", len(symbols), "dir", *out)
+	return nil
+}
+
+// Write the candles of a symbol to their own CSV file.
+func exportCSV(path, symbol string, candles []store.Candle) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	w.Write(csvHeader)
+	if err := writeCSV(w, symbol, candles); err != nil {
+		return err
+	}
+	w.Flush()
+	return w.Error()
+}
+
+func writeCSV(w *csv.Writer, symbol string, candles []store.Candle) error {
+	for _, c := range candles {
+		err := w.Write([]string{
+			symbol,
+			c.Interval,
+			c.Start.Format(time.RFC3339),
+			c.End.Format(time.RFC3339),
+			formatPrice(c.Open),
+			formatPrice(c.High),
+			formatPrice(c.Low),
+			formatPrice(c.Close),
+			strconv.Itoa(c.Volume),
+			c.Session,
+			adjCloseText(c.AdjClose),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Adjusted close for CSV, empty if the provider didn't report one.
+func adjCloseText(p float32) string {
+	if p == 0 {
+		return ""
+	}
+	return formatPrice(p)
+}
+
+func formatPrice(p float32) string {
+	return strconv.FormatFloat(float64(p), 'f', -1, 32)
+}
+
+// Write the candles of a symbol to one Parquet file per year.
+func exportParquet(dir, symbol string, candles []store.Candle) error {
+	years := make(map[int][]store.Candle)
+	for _, c := range candles {
+		years[c.Start.Year()] = append(years[c.Start.Year()], c)
+	}
+
+	for year, cdls := range years {
+		part := filepath.Join(dir, "symbol="+symbol, "year="+strconv.Itoa(year))
+		if err := os.MkdirAll(part, 0755); err != nil {
+			return err
+		}
+		fw, err := local.NewLocalFileWriter(filepath.Join(part, "candles.parquet"))
+		if err != nil {
+			return err
+		}
+		err = writeParquet(fw, parquet.CompressionCodec_SNAPPY, symbol, cdls)
+		if cerr := fw.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Write the candles of a symbol to a Parquet file, which the caller closes.
+func writeParquet(fw source.ParquetFile, codec parquet.CompressionCodec, symbol string, candles []store.Candle) error {
+	pw, err := writer.NewParquetWriter(fw, new(parquetCandle), 1)
+	if err != nil {
+		return err
+	}
+	pw.CompressionType = codec
+
+	for _, c := range candles {
+		var adjClose *float64
+		if c.AdjClose != 0 {
+			v := float64(c.AdjClose)
+			adjClose = &v
+		}
+		err := pw.Write(parquetCandle{
+			Symbol:   symbol,
+			Interval: c.Interval,
+			Start:    c.Start.UnixNano() / int64(time.Millisecond),
+			End:      c.End.UnixNano() / int64(time.Millisecond),
+			Open:     float64(c.Open),
+			High:     float64(c.High),
+			Low:      float64(c.Low),
+			Close:    float64(c.Close),
+			Volume:   int64(c.Volume),
+			Session:  c.Session,
+			AdjClose: adjClose,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return pw.WriteStop()
+}
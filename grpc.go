@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/alexurquhart/sp500scraper/pkg/api/sp500pb"
+	"github.com/alexurquhart/sp500scraper/pkg/scraper"
+	"github.com/alexurquhart/sp500scraper/pkg/store"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Candles service of the gRPC API, serving the same data as the JSON API
+type grpcServer struct {
+	sp500pb.UnimplementedCandlesServer
+	st store.Store
+}
+
+func (s *grpcServer) ListSymbols(ctx context.Context, req *sp500pb.ListSymbolsRequest) (*sp500pb.ListSymbolsResponse, error) {
+	symbols, err := s.st.Symbols()
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	res := &sp500pb.ListSymbolsResponse{Symbols: make([]*sp500pb.Symbol, len(symbols))}
+	for i, sym := range symbols {
+		res.Symbols[i] = &sp500pb.Symbol{
+			Symbol:      sym.Symbol,
+			Name:        sym.Name,
+			Industry:    sym.Industry,
+			SubIndustry: sym.SubIndustry,
+			Exchange:    sym.Exchange,
+			SymbolId:    int32(sym.SymbolID),
+		}
+	}
+	return res, nil
+}
+
+func (s *grpcServer) GetCandles(ctx context.Context, req *sp500pb.GetCandlesRequest) (*sp500pb.GetCandlesResponse, error) {
+	sym, candles, interval, err := s.candles(req)
+	if err != nil {
+		return nil, err
+	}
+	res := &sp500pb.GetCandlesResponse{
+		Symbol:   sym.Symbol,
+		Exchange: sym.Exchange,
+		Interval: interval,
+		Candles:  make([]*sp500pb.Candle, len(candles)),
+	}
+	for i, c := range candles {
+		res.Candles[i] = grpcCandle(c)
+	}
+	return res, nil
+}
+
+func (s *grpcServer) StreamCandles(req *sp500pb.GetCandlesRequest, stream sp500pb.Candles_StreamCandlesServer) error {
+	_, candles, _, err := s.candles(req)
+	if err != nil {
+		return err
+	}
+	for _, c := range candles {
+		if err := stream.Send(grpcCandle(c)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Look up the symbol of a request and its candles over the range, as the
+// /candles endpoint does. Errors are gRPC statuses.
+func (s *grpcServer) candles(req *sp500pb.GetCandlesRequest) (*store.Symbol, []store.Candle, string, error) {
+	if req.Interval != "" && !scraper.ValidInterval(req.Interval) {
+		return nil, nil, "", status.Error(codes.InvalidArgument, "Invalid interval: "+req.Interval)
+	}
+	start, end := time.Time{}, openEnd()
+	if req.Start != 0 {
+		start = time.Unix(req.Start, 0)
+	}
+	if req.End != 0 {
+		end = time.Unix(req.End, 0)
+	}
+
+	sym, err := lookupSymbol(s.st, req.Symbol, req.Exchange)
+	if err != nil {
+		return nil, nil, "", status.Error(codes.Internal, err.Error())
+	} else if sym == nil {
+		return nil, nil, "", status.Error(codes.NotFound, "Symbol not found: "+req.Symbol)
+	}
+	candles, interval, err := intervalCandles(s.st, sym.SymbolID, req.Interval, start, end)
+	if err != nil {
+		return nil, nil, "", status.Error(codes.Internal, err.Error())
+	}
+	return sym, candles, interval, nil
+}
+
+func grpcCandle(c store.Candle) *sp500pb.Candle {
+	return &sp500pb.Candle{
+		Start:    c.Start.Unix(),
+		End:      c.End.Unix(),
+		Open:     c.Open,
+		High:     c.High,
+		Low:      c.Low,
+		Close:    c.Close,
+		Volume:   int64(c.Volume),
+		Interval: c.Interval,
+	}
+}
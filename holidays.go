@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/alexurquhart/sp500scraper/pkg/calendar"
+	"github.com/alexurquhart/sp500scraper/pkg/scraper"
+	"github.com/alexurquhart/sp500scraper/pkg/store"
+)
+
+// Add the stored closures and early closes of the calendar's exchange to it.
+// With a Polygon.io key they are fetched again first when the last fetch is
+// more than refresh old, or none are stored. A failed fetch leaves the
+// stored days and the holiday rules in use.
+func loadHolidays(st store.Store, cal *calendar.Calendar, key string, refresh time.Duration) error {
+	holidays, err := st.Holidays(cal.Name)
+	if err != nil {
+		return err
+	}
+	var updated time.Time
+	for _, h := range holidays {
+		if h.Updated.After(updated) {
+			updated = h.Updated
+		}
+	}
+
+	if key != "" && time.Since(updated) > refresh {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		fetched, err := scraper.FetchHolidays(ctx, key, cal.Name, cal.Location)
+		if err == nil && len(fetched) == 0 {
+			err = errors.New("No days published for " + cal.Name)
+		}
+		if err == nil {
+			err = st.SaveHolidays(fetched)
+		}
+		if err != nil {
+			slog.Warn("Could not refresh the market holidays", "calendar", cal.Name, "error", err)
+		} else {
+			slog.Info("Refreshed market holidays", "calendar", cal.Name, "days", len(fetched))
+			if holidays, err = st.Holidays(cal.Name); err != nil {
+				return err
+			}
+		}
+	}
+
+	days := make([]calendar.Day, len(holidays))
+	for i, h := range holidays {
+		days[i] = calendar.Day{Date: h.Date, Name: h.Name, Close: h.Close}
+	}
+	cal.AddDays(days)
+	return nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"strconv"
+
+	"github.com/alexurquhart/sp500scraper/pkg/scraper"
+	"github.com/alexurquhart/sp500scraper/pkg/store"
+)
+
+// Parse a comma separated list of windows.
+func parseWindows(s string) ([]int, error) {
+	var windows []int
+	for _, item := range splitList(s) {
+		n, err := strconv.Atoi(item)
+		if err != nil || n <= 0 {
+			return nil, errors.New("Invalid window: " + item)
+		}
+		windows = append(windows, n)
+	}
+	return windows, nil
+}
+
+// Compute technical indicators from the stored candles of an interval and
+// replace those in the indicators table. A window of 0 leaves an indicator
+// out.
+func runIndicators(args []string) error {
+	fs := flag.NewFlagSet("indicators", flag.ExitOnError)
+	driver := fs.String("db-driver", "sqlite3", "Database driver to read from and write to, sqlite3, postgres, mysql or duckdb")
+	dsn := fs.String("dsn", "sp500.db", "Data source name of the database, a file path for sqlite3 and duckdb")
+	fs.StringVar(dsn, "db", "sp500.db", "Database file, the same as -dsn")
+	schema := fs.String("schema", "", "Schema file to create the database with instead of the built in SQLite migrations or PostgreSQL schema")
+	interval := fs.String("interval", "OneDay", "Interval of the candles to compute the indicators from")
+	splits := fs.String("splits-file", "splits.json", "JSON file of known splits, instead of detecting them")
+	smaWindows := fs.String("sma", "20,50,200", "Comma separated windows of the simple moving averages")
+	emaWindows := fs.String("ema", "12,26", "Comma separated windows of the exponential moving averages")
+	var cfg scraper.IndicatorConfig
+	fs.IntVar(&cfg.RSI, "rsi", 14, "Window of the relative strength index")
+	macd := fs.String("macd", "12,26,9", "Fast, slow and signal windows of the MACD, empty to leave it out")
+	fs.IntVar(&cfg.Bollinger, "bollinger", 20, "Window of the Bollinger bands")
+	fs.Float64Var(&cfg.BollingerWidth, "bollinger-width", 2, "Standard deviations between the middle and outer Bollinger bands")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	if !scraper.ValidInterval(*interval) {
+		return errors.New("Invalid interval: " + *interval)
+	}
+	var err error
+	if cfg.SMA, err = parseWindows(*smaWindows); err != nil {
+		return err
+	}
+	if cfg.EMA, err = parseWindows(*emaWindows); err != nil {
+		return err
+	}
+	if cfg.RSI < 0 || cfg.Bollinger < 0 {
+		return errors.New("Windows can't be negative")
+	}
+	if *macd != "" {
+		w, err := parseWindows(*macd)
+		if err != nil {
+			return err
+		}
+		if len(w) != 3 {
+			return errors.New("The MACD needs fast, slow and signal windows: " + *macd)
+		}
+		cfg.MACDFast, cfg.MACDSlow, cfg.MACDSignal = w[0], w[1], w[2]
+	}
+
+	st, err := store.New(*driver, *dsn, *schema, 0)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+
+	n, err := scraper.ComputeIndicators(st, *splits, *interval, cfg)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errors.New("No " + *interval + " candles to compute indicators from")
+	}
+	return nil
+}
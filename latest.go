@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/alexurquhart/sp500scraper/pkg/scraper"
+	"github.com/alexurquhart/sp500scraper/pkg/store"
+)
+
+// Print the latest daily close of each symbol, the change from the close
+// before it and the day's volume.
+//
+// They are read from the latest_close table, which runs rebuild once they
+// have saved candles, so the candle history isn't scanned. -refresh
+// rebuilds it first, for databases filled by older versions.
+func runLatest(args []string) error {
+	fs := flag.NewFlagSet("latest", flag.ExitOnError)
+	driver := fs.String("db-driver", "sqlite3", "Database driver, sqlite3, postgres, mysql or duckdb")
+	dsn := fs.String("dsn", "sp500.db", "Data source name of the database, a file path for sqlite3 and duckdb")
+	fs.StringVar(dsn, "db", "sp500.db", "Database file, the same as -dsn")
+	schema := fs.String("schema", "", "Schema file to create the database with instead of the built in SQLite migrations or PostgreSQL schema")
+	symbols := fs.String("symbols", "", "Comma separated symbols to print, all if empty")
+	refresh := fs.Bool("refresh", false, "Rebuild the latest closes from the candles first")
+	format := fs.String("format", "text", "Output format, text or json")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *format != "text" && *format != "json" {
+		return errors.New("Unknown format " + *format + ", use text or json")
+	}
+
+	st, err := store.New(*driver, *dsn, *schema, 0)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+
+	if *refresh {
+		if err := st.RefreshLatestCloses(); err != nil {
+			return err
+		}
+	}
+	closes, err := st.LatestCloses()
+	if err != nil {
+		return err
+	}
+	closes = filterLatest(closes, *symbols)
+
+	if *format == "json" {
+		if closes == nil {
+			closes = []store.LatestClose{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(closes)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "Symbol\tExchange\tDay\tClose\tChange\t%\tVolume\t")
+	for _, c := range closes {
+		change, pct := "", ""
+		if c.NetChange != nil {
+			change = strconv.FormatFloat(*c.NetChange, 'f', 2, 64)
+			pct = strconv.FormatFloat(*c.PctChange, 'f', 2, 64)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%.2f\t%s\t%s\t%d\t\n", c.Symbol, c.Exchange, c.Day.Format(scraper.DateFormat),
+			c.Close, change, pct, c.Volume)
+	}
+	return w.Flush()
+}
+
+// Latest closes of the comma separated symbols, all of them if the list is
+// empty.
+func filterLatest(closes []store.LatestClose, list string) []store.LatestClose {
+	symbols := splitList(list)
+	if len(symbols) == 0 {
+		return closes
+	}
+	want := make(map[string]bool, len(symbols))
+	for _, s := range symbols {
+		want[strings.ToUpper(s)] = true
+	}
+	var out []store.LatestClose
+	for _, c := range closes {
+		if want[strings.ToUpper(c.Symbol)] {
+			out = append(out, c)
+		}
+	}
+	return out
+}
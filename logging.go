@@ -0,0 +1,74 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+)
+
+// Logging flags of the main command
+type logConfig struct {
+	Format string
+	Level  string
+
+	// -v and -q, which override Level
+	Verbose bool
+	Quiet   bool
+
+	// File written to instead of stderr, and when it is rotated
+	File       string
+	MaxSize    int64 // Megabytes
+	MaxAge     time.Duration
+	MaxBackups int
+}
+
+// Replace the default logger with a leveled one writing text or JSON lines
+// to stderr, below the progress bar if there is one, or to a rotated log
+// file. Messages from the standard log package go through it as well.
+func setupLogging(lc logConfig) error {
+	level := lc.Level
+	switch {
+	case lc.Verbose && lc.Quiet:
+		return errors.New("Only one of -v and -q can be set")
+	case lc.Verbose:
+		level = "debug"
+	case lc.Quiet:
+		level = "warn"
+	}
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return errors.New("Invalid log level: " + level)
+	}
+	opts := &slog.HandlerOptions{Level: lvl}
+
+	var out io.Writer = stderr
+	if lc.File != "" {
+		f, err := openRotatingFile(lc.File, lc.MaxSize<<20, lc.MaxAge, lc.MaxBackups)
+		if err != nil {
+			return err
+		}
+		out = f
+	}
+
+	var h slog.Handler
+	switch strings.ToLower(lc.Format) {
+	case "text":
+		h = slog.NewTextHandler(out, opts)
+	case "json":
+		h = slog.NewJSONHandler(out, opts)
+	default:
+		return errors.New("Invalid log format: " + lc.Format)
+	}
+	slog.SetDefault(slog.New(h))
+	return nil
+}
+
+// Log an error, alert the notifiers and exit.
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	notify(alertNotification("fatal", msg, args...))
+	os.Exit(1)
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/alexurquhart/sp500scraper/pkg/scraper"
+	"golang.org/x/term"
+)
+
+// Log in to Questrade with a refresh token typed at the prompt and save the
+// rotated token, by default to the OS keyring, so it never has to be kept
+// in an environment variable or a shell history.
+//
+// Other commands read the saved token with -credentials keyring, or the same
+// keyring:<name> as login was given. With -profile the token is saved for
+// that profile, which -profiles then reads.
+func runLogin(args []string) error {
+	fs := flag.NewFlagSet("login", flag.ExitOnError)
+	credentials := fs.String("credentials", scraper.KeyringCredentials, "Where to save the refresh token, keyring, keyring:<name> or a credentials file")
+	profile := fs.String("profile", "", "Credential profile to save the token for")
+	server := addServerFlags(fs)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	live, err := server.isLive()
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Questrade refresh token for the %s server: ", scraper.ServerName(live))
+	var token string
+	if fd := int(os.Stdin.Fd()); term.IsTerminal(fd) {
+		b, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return err
+		}
+		token = string(b)
+	} else {
+		// Piped in, e.g. from a password manager
+		if token, err = bufio.NewReader(os.Stdin).ReadString('\n'); err != nil && token == "" {
+			return err
+		}
+	}
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return errors.New("No refresh token given")
+	}
+
+	path := scraper.ProfileCredentials(*credentials, *profile)
+	if _, err := scraper.Login(path, token, live); err != nil {
+		return err
+	}
+	slog.Info("Saved refresh token", "credentials", path, "server", scraper.ServerName(live))
+	return nil
+}
@@ -1,207 +1,657 @@
 package main
 
 import (
-	"database/sql"
-	"encoding/json"
+	"context"
 	"errors"
-	"io/ioutil"
-	"log"
+	"flag"
+	"log/slog"
 	"os"
-	"sync"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 
-	"github.com/alexurquhart/qapi"
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/alexurquhart/sp500scraper/pkg/calendar"
+	"github.com/alexurquhart/sp500scraper/pkg/scraper"
+	"github.com/alexurquhart/sp500scraper/pkg/sink"
+	"github.com/alexurquhart/sp500scraper/pkg/store"
+	"github.com/alexurquhart/sp500scraper/pkg/universe"
+	"golang.org/x/term"
 )
 
-type SP500Symbol struct {
-	Symbol      string `json:"symbol"`
-	Name        string `json:"name"`
-	Industry    string `json:"industry"`
-	SubIndustry string `json:"subindustry"`
-	Exchange    string `json:"exchange"`
-	SymbolID    int
-	Candles     []qapi.Candlestick
-}
+// Version recorded with each run, set when building with
+// -ldflags "-X main.version=<version>"
+var version = "dev"
 
-// Extract candlestick data over 5 years for a given symbol.
-func extractCandles(c *qapi.Client, t *time.Ticker, id int) ([]qapi.Candlestick, error) {
-	<-t.C
-	candles, err := c.GetCandles(id, time.Now().AddDate(-5, 0, 0), time.Now(), "OneDay")
-	if err != nil {
-		return []qapi.Candlestick{}, err
+// Split a comma separated flag into its non-empty items
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
 	}
+	return items
+}
+
+// How the progress of a run is shown, see startProgress
+type progressConfig struct {
+	Bar      bool
+	Interval time.Duration
+}
 
-	return candles, nil
+// Scrape the symbols, showing the progress of the run.
+func scrape(ctx context.Context, s *scraper.Scraper, symbols []store.Symbol, pc progressConfig) (scraper.Summary, error) {
+	prog := startProgress(len(symbols), pc.Bar, pc.Interval)
+	defer prog.Stop()
+	s.Config.Progress = prog
+	return s.Run(ctx, symbols)
 }
 
-// Find data for the symbol - first the internal symbol identifier needs to be found
-// then candlestrick data is extracted. The result should then be saved to a database
-func findSymbol(c *qapi.Client, t *time.Ticker, sym *SP500Symbol) error {
-	<-t.C
-	res, err := c.SearchSymbols(sym.Symbol, 0)
+// Load the symbols of the universe. With membership the membership history
+// of the universe is updated first, and with former the symbols that left
+// the universe after start are scraped as well so backtests over the range
+// aren't limited to the survivors.
+func loadSymbols(st store.Store, u universe.Universe, refresh, membership, former bool, start time.Time) ([]store.Symbol, error) {
+	symbols, err := u.Load(refresh)
+	if err != nil || !membership {
+		return symbols, err
+	}
+
+	ms, err := u.Memberships()
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if err := st.SaveMemberships(u.Name, ms); err != nil {
+		return nil, err
+	}
+	slog.Info("Updated membership history", "universe", u.Name, "memberships", len(ms))
+	if !former {
+		return symbols, nil
 	}
 
-	// Find the symbol and extract the symbol ID
-	for _, r := range res {
-		// If the symbol is a match - extract candles
-		if r.Symbol == sym.Symbol && r.ListingExchange == sym.Exchange {
-			candles, err := extractCandles(c, t, r.SymbolID)
-			if err != nil {
-				return err
-			}
-			sym.SymbolID = r.SymbolID
-			sym.Candles = candles
-			return nil
+	seen := make(map[string]bool)
+	for _, s := range symbols {
+		seen[s.Symbol] = true
+	}
+	for _, m := range ms {
+		if !m.To.IsZero() && m.To.After(start) && !seen[m.Symbol] {
+			seen[m.Symbol] = true
+			symbols = append(symbols, store.Symbol{Symbol: m.Symbol, Name: m.Name, Exchange: u.Exchange})
 		}
 	}
-	return errors.New("Symbol not found: " + sym.Symbol)
+	return symbols, nil
 }
 
-// Starts a goroutine that iterates over a channel of incoming
-// symbols. Returns an error channel.
-func saveData(wg *sync.WaitGroup, symChan chan SP500Symbol) chan error {
-	errChan := make(chan error)
-	go func(wg *sync.WaitGroup, errChan chan error, symChan chan SP500Symbol) {
-		defer close(errChan)
+// Subset of the universe a run is limited to, for quick refreshes and
+// debugging. Empty lists don't filter.
+type symbolFilter struct {
+	only    []string // Tickers to keep
+	exclude []string // Tickers to drop
+	sectors []string // Sectors or sub-industries to keep
+}
 
-		// Open a database connection
-		db, err := sql.Open("sqlite3", "sp500.db")
-		if err != nil {
-			errChan <- err
-			return
+// Symbols passing the filter, in their original order. Tickers and sectors
+// are matched case insensitively.
+func (f symbolFilter) apply(symbols []store.Symbol) ([]store.Symbol, error) {
+	if len(f.only) == 0 && len(f.exclude) == 0 && len(f.sectors) == 0 {
+		return symbols, nil
+	}
+	set := func(items []string) map[string]bool {
+		m := make(map[string]bool, len(items))
+		for _, item := range items {
+			m[strings.ToUpper(item)] = true
 		}
-		defer db.Close()
+		return m
+	}
+	only, exclude, sectors := set(f.only), set(f.exclude), set(f.sectors)
 
-		// Read the schema file and create the database
-		file, _ := ioutil.ReadFile("schema.sql")
-		_, err = db.Exec(string(file))
-		if err != nil {
-			errChan <- err
-			return
+	var kept []store.Symbol
+	seen := make(map[string]bool)
+	for _, sym := range symbols {
+		ticker := strings.ToUpper(sym.Symbol)
+		seen[ticker] = true
+		if len(only) > 0 && !only[ticker] || exclude[ticker] {
+			continue
 		}
-
-		// Prepare statements to insert data into the symbol and candlestick tables
-		symStmt, err := db.Prepare("insert into symbolids values (?, ?, ?, ?, ?, ?)")
-		if err != nil {
-			errChan <- err
-			return
+		if len(sectors) > 0 && !sectors[strings.ToUpper(sym.Industry)] && !sectors[strings.ToUpper(sym.SubIndustry)] {
+			continue
 		}
-		defer symStmt.Close()
-		cdlStmt, err := db.Prepare("insert into candlestick values(?, ?, ?, ?, ?, ?, ?, ?)")
-		if err != nil {
-			errChan <- err
-			return
+		kept = append(kept, sym)
+	}
+	for _, t := range f.only {
+		if !seen[strings.ToUpper(t)] {
+			slog.Warn("Symbol given with -only is not in the universe", "symbol", t)
 		}
-		defer cdlStmt.Close()
+	}
+	if len(kept) == 0 {
+		return nil, errors.New("No symbols of the universe match the filters")
+	}
+	slog.Info("Filtered symbols", "kept", len(kept), "total", len(symbols))
+	return kept, nil
+}
 
-		// Iterate over all incoming symbols
-		for sym := range symChan {
-			tx, _ := db.Begin()
-			_, err = symStmt.Exec(sym.SymbolID, sym.Symbol, sym.Exchange, sym.Name, sym.Industry, sym.SubIndustry)
-			if err != nil {
-				errChan <- err
-			}
+// Output the outcome of a run, including the list of symbols not found
+func logSummary(sum scraper.Summary) {
+	slog.Info("Run finished", "run", sum.Run, "candles", sum.Candles, "symbols", sum.Saved, "failed", len(sum.NotFound),
+		"delisted", len(sum.Delisted), "skipped", sum.Skipped, "calls", sum.Calls, "duration", sum.Duration)
+	if sum.Deferred > 0 {
+		slog.Warn("Symbols deferred to the next run to stay within the API call budget", "deferred", sum.Deferred)
+	}
+	if sum.Interrupted {
+		slog.Warn("Run interrupted, use -resume to continue", "saved", sum.Saved, "total", sum.Total)
+	}
+	if len(sum.Failures) > 0 {
+		// Classes from the most failures to the fewest
+		var attrs []interface{}
+		for _, c := range scraper.FailureClasses(sum.Failures) {
+			attrs = append(attrs, c, sum.Failures[c])
+		}
+		slog.Warn("Failures by class", attrs...)
+	}
+	for _, f := range sum.NotFound {
+		slog.Warn("Symbol not saved", "symbol", f.Symbol, "exchange", f.Exchange, "error", f.Reason)
+	}
+}
 
-			for _, cdl := range sym.Candles {
-				_, err := cdlStmt.Exec(sym.SymbolID, cdl.Start, cdl.End, cdl.Open, cdl.Close, cdl.High, cdl.Low, cdl.Volume)
-				if err != nil {
-					errChan <- err
-				}
-			}
-			err := tx.Commit()
-			if err != nil {
-				errChan <- err
-			}
+// Read the API keys of the providers that need one from the environment.
+func readProviderKeys(pc *scraper.ProviderConfig) {
+	pc.AlphaVantageKey = os.Getenv("ALPHAVANTAGE_API_KEY")
+	pc.IEXToken = os.Getenv("IEX_TOKEN")
+	pc.PolygonKey = os.Getenv("POLYGON_API_KEY")
+	pc.TiingoKey = os.Getenv("TIINGO_API_KEY")
+}
 
-		}
-		wg.Done()
-	}(wg, errChan, symChan)
-	return errChan
+// Subcommands, run as "sp500scraper <command> [flags]". Without a
+// subcommand the scraper fetches candles.
+var commands = map[string]func(args []string) error{
+	"account":     runAccount,
+	"archive":     runArchive,
+	"backfill":    runBackfill,
+	"correlation": runCorrelation,
+	"depth":       runDepth,
+	"diff":        runDiff,
+	"export":      runExport,
+	"indicators":  runIndicators,
+	"latest":      runLatest,
+	"login":       runLogin,
+	"reconcile":   runReconcile,
+	"serve":       runServe,
+	"snapshot":    runSnapshot,
+	"stream":      runStream,
+	"verify":      runVerify,
 }
 
 func main() {
-	// Read in the JSON file of S&P 500 Symbols and their exchanges
-	file, _ := ioutil.ReadFile("sp500.json")
-	var symbols []SP500Symbol
-	err := json.Unmarshal(file, &symbols)
+	if len(os.Args) > 1 {
+		if cmd, ok := commands[os.Args[1]]; ok {
+			if err := cmd(os.Args[2:]); err != nil {
+				fatal("Command failed", "command", os.Args[1], "error", err)
+			}
+			return
+		}
+	}
+
+	var rc scraper.Config
+	var pc scraper.ProviderConfig
+	var prog progressConfig
+	flag.StringVar(&rc.Start, "start", "", "Start date of the candles to fetch (YYYY-MM-DD), defaults to 5 years ago")
+	flag.StringVar(&rc.End, "end", "", "End date of the candles to fetch (YYYY-MM-DD), defaults to now")
+	interval := flag.String("interval", "OneDay", "Candle intervals, comma separated, OneMinute through OneMonth")
+	flag.BoolVar(&rc.Update, "update", false, "Only fetch candles newer than those already in the database")
+	derive := flag.String("derive", "", "Intervals to build from the saved daily candles instead of fetching, OneWeek and OneMonth, comma separated")
+	flag.BoolVar(&rc.Dividends, "dividends", false, "Also store the latest dividend declared for each symbol")
+	provider := flag.String("provider", "questrade", "Source of the candles, questrade, yahoo, alphavantage, iex, polygon, tiingo or csv, the Tiingo API key is read from TIINGO_API_KEY")
+	fallback := flag.String("fallback", "", "Provider to fetch symbols the main provider can't from, e.g. alphavantage, empty to disable")
+	alphaVantageRate := flag.Float64("alphavantage-rate-limit", 5, "Maximum number of Alpha Vantage calls per minute, the API key is read from ALPHAVANTAGE_API_KEY")
+	flag.StringVar(&pc.CSVDir, "csv-source", "", "Directory of daily CSV files, such as Stooq's bulk dumps, read by -provider csv")
+	flag.BoolVar(&pc.PolygonAdjusted, "polygon-adjusted", true, "Fetch Polygon.io prices adjusted for splits, the API key is read from POLYGON_API_KEY")
+	flag.Int64Var(&pc.IEXCreditLimit, "iex-credit-limit", 0, "Most IEX Cloud credits to use before calls stop, 0 for no limit, the token is read from IEX_TOKEN")
+	flag.BoolVar(&rc.Fundamentals, "fundamentals", false, "Also store a daily snapshot of the fundamentals of each symbol")
+	flag.BoolVar(&rc.Quotes, "quotes", false, "Also store a snapshot of the bid, ask and last trade of every symbol once the run is saved, Questrade only")
+	flag.BoolVar(&rc.Options, "options", false, "Also store the option chain of each symbol with a quote of every option")
+	flag.IntVar(&rc.OptionExpiries, "option-expiries", 4, "Number of nearest expiries fetched with -options, 0 for all")
+	earnings := flag.Bool("earnings", false, "Also store the past and upcoming earnings dates of each symbol")
+	earningsProvider := flag.String("earnings-provider", "alphavantage", "Source of the earnings dates fetched with -earnings")
+	driver := flag.String("db-driver", "sqlite3", "Database driver to store results with, sqlite3, postgres, mysql or duckdb")
+	dsn := flag.String("dsn", "sp500.db", "Data source name of the database, a file path for sqlite3 and duckdb")
+	flag.StringVar(dsn, "db", "sp500.db", "Database file, the same as -dsn")
+	schema := flag.String("schema", "", "Schema file to create the database with instead of the built in SQLite migrations or PostgreSQL schema")
+	batchSize := flag.Int("batch-size", store.DefaultBatchSize, "Number of candles written per insert statement")
+	addBackupFlags(flag.CommandLine)
+	syncURL := flag.String("sync", "", "s3://bucket/key or gs://bucket/key to upload the SQLite database to after each run")
+	syncPull := flag.Bool("sync-pull", false, "With -sync, download the latest copy of the database before opening it")
+	retries := flag.Int("retries", 3, "Maximum number of attempts for each API call")
+	retryDelay := flag.Duration("retry-delay", time.Second, "Initial delay between retries, doubled after each attempt")
+	retryMaxDelay := flag.Duration("retry-max-delay", time.Minute, "Longest delay between retries")
+	flag.IntVar(&rc.RetryPasses, "retry-passes", 1, "Passes over the symbols that failed at the end of a run, 0 to disable")
+	flag.DurationVar(&rc.RetryBackoff, "retry-pass-delay", 30*time.Second, "Wait before the first pass over failed symbols, doubled before each pass after")
+	flag.Float64Var(&pc.RateLimit, "rate-limit", 5, "Maximum number of API calls per second")
+	flag.IntVar(&pc.Burst, "burst", 1, "Number of API calls that may be made at once after a pause")
+	flag.BoolVar(&pc.Match.AssumeBest, "assume-best", false, "Resolve tickers listed on several exchanges other than the symbol's to the best scoring listing")
+	interactiveMatch := flag.Bool("interactive-match", false, "Ask which listing to use for tickers listed on several exchanges other than the symbol's")
+	throttle := flag.String("throttle", "custom", "Preset of -rate-limit, -burst and -workers, conservative, normal, aggressive or custom to use the flags alone")
+	flag.BoolVar(&rc.DeferOverBudget, "defer-over-budget", false, "Leave symbols that would exceed the hourly API call budget to the next run")
+	flag.BoolVar(&pc.ExtendedHours, "extended-hours", false, "Fetch intraday candles of the pre-market and after-hours sessions too, Yahoo and Polygon.io only")
+	flag.IntVar(&rc.Workers, "workers", 4, "Number of symbols to fetch concurrently")
+	flag.IntVar(&rc.Writers, "writers", 1, "Number of symbols to save to the database concurrently, always 1 for sqlite3 and duckdb")
+	flag.BoolVar(&rc.Resume, "resume", false, "Skip symbols saved by a previous interrupted run with the same range")
+	flag.StringVar(&rc.Checkpoint, "checkpoint", "sp500.checkpoint.json", "Path of the file recording the progress of a run")
+	universeName := flag.String("universe", "sp500", "Index to scrape, one of sp500, nasdaq100, dow30 or russell1000")
+	symbolsFile := flag.String("symbols-file", "", "JSON file of the constituents of the universe, defaults to <universe>.json")
+	watchlist := flag.String("watchlist", "", "Comma separated watchlist files to scrape instead of -universe, each FILE or NAME=FILE, JSON or a ticker per line")
+	watchlistExchange := flag.String("watchlist-exchange", "NYSE", "Exchange of the watchlist symbols that don't give one")
+	membership := flag.Bool("membership", false, "Update the membership history of the universe from the Wikipedia change log")
+	former := flag.Bool("former-members", false, "With -membership, also fetch symbols that left the universe during the range")
+	benchmarks := flag.Bool("benchmarks", false, "Also fetch benchmark series, SPY and the sector SPDR ETFs unless -benchmark-symbols lists others")
+	benchmarkSymbols := flag.String("benchmark-symbols", "", "Comma separated benchmarks fetched with -benchmarks, each TICKER or TICKER:EXCHANGE, e.g. SPY,^GSPC with Yahoo")
+	only := flag.String("only", "", "Comma separated tickers to limit the run to, e.g. AAPL,MSFT,NVDA")
+	exclude := flag.String("exclude", "", "Comma separated tickers to leave out of the run")
+	sectors := flag.String("sector", "", "Comma separated sectors or sub-industries to limit the run to, e.g. \"Information Technology\"")
+	refresh := flag.Bool("refresh-symbols", false, "Scrape the constituents of the universe from Wikipedia before fetching")
+	daemon := flag.Bool("daemon", false, "Keep running, performing an incremental update on every scheduled run")
+	serviceName := flag.String("service-name", "sp500scraper", "Name of the Windows service when the daemon is run as one")
+	schedule := flag.String("schedule", "0 18 * * 1-5", "Cron expression of when daemon runs start")
+	statusAddr := flag.String("status-addr", "", "Address to serve /healthz and /status on in daemon mode, e.g. :8081")
+	report := flag.String("report", "", "File to write a report of the run to, HTML if it ends in .html and Markdown otherwise, rewritten after every daemon run")
+	timezone := flag.String("timezone", "America/New_York", "Time zone the schedule is evaluated in")
+	calendarName := flag.String("calendar", "", "Exchange whose trading days daemon runs and completeness checks follow, defaults to the exchange of the universe, none to disable")
+	holidays := flag.Bool("holidays", false, "Keep the published closures and early closes of the calendar up to date from Polygon.io, the API key is read from POLYGON_API_KEY")
+	holidaysRefresh := flag.Duration("holidays-refresh", 365*24*time.Hour, "How often the published closures and early closes are fetched again")
+	flag.StringVar(&pc.Credentials, "credentials", "credentials.json", "File the refresh token is saved to between runs, or keyring to keep it in the OS keyring")
+	server := addServerFlags(flag.CommandLine)
+	flag.DurationVar(&rc.SymbolTTL, "symbol-cache-ttl", 30*24*time.Hour, "How long symbol IDs found by a search are reused, 0 to always search")
+	flag.BoolVar(&rc.Adjust, "adjust", false, "Store split adjusted candles alongside the raw ones after fetching")
+	flag.BoolVar(&rc.Sectors, "sectors", false, "Rebuild the daily return, volume and breadth of each sector after fetching")
+	flag.BoolVar(&rc.Returns, "returns", false, "Rebuild the daily log returns, volatility and drawdowns of each symbol after fetching")
+	flag.BoolVar(&rc.NormalizeUSD, "normalize-usd", false, "Convert the prices of candles listed in other currencies to USD at the daily rate")
+	fxCurrencies := flag.String("fx-currencies", "", "Comma separated currencies whose daily USD rates are saved on every run, e.g. CAD,EUR")
+	flag.StringVar(&rc.Splits, "splits-file", "splits.json", "JSON file of known splits, used with -adjust instead of detecting them")
+	flag.StringVar(&rc.Report, "not-found-report", "not_found.json", "JSON file listing the symbols that could not be fetched, empty to disable")
+	flag.BoolVar(&rc.RecordFailures, "record-failures", false, "Also record symbols that could not be fetched in the failures table")
+	flag.BoolVar(&rc.IncludeDelisted, "include-delisted", false, "Also fetch symbols marked as delisted, marking them as listed again if found")
+	progressBar := flag.Bool("progress", true, "Show a progress bar when running in a terminal")
+	flag.DurationVar(&prog.Interval, "progress-interval", 30*time.Second, "How often progress is logged when not running in a terminal, 0 to disable")
+	profiles := flag.String("profiles", "", "Comma separated Questrade credential profiles to spread requests across")
+	influxURL := flag.String("influx-url", "", "InfluxDB server to also write candles to, the token is read from INFLUX_TOKEN")
+	influxOrg := flag.String("influx-org", "", "InfluxDB organization of the bucket")
+	influxBucket := flag.String("influx-bucket", "sp500", "InfluxDB bucket to write candles to")
+	timescaleDSN := flag.String("timescale-dsn", "", "TimescaleDB connection string to also write candles to")
+	jsonDir := flag.String("json-dir", "", "Directory to also write one JSON file per symbol with its candles to")
+	csvDir := flag.String("csv-dir", "", "Directory to also write one CSV file per symbol with its candles to")
+	webhookURL := flag.String("webhook-url", "", "URL to also post each saved symbol with its candles to as JSON, with WEBHOOK_TOKEN as the bearer token")
+	kafkaBrokers := flag.String("kafka-brokers", "", "Comma separated Kafka brokers to also publish candles to")
+	kafkaTopic := flag.String("kafka-topic", "candles", "Kafka topic to publish candles to")
+	kafkaPerCandle := flag.Bool("kafka-per-candle", false, "Publish each candle as its own Kafka message instead of one message per symbol")
+	bigQueryProject := flag.String("bigquery-project", "", "Google Cloud project of the BigQuery dataset, found from the credentials if empty")
+	bigQueryDataset := flag.String("bigquery-dataset", "", "BigQuery dataset to also stream candles to")
+	bigQueryTable := flag.String("bigquery-table", "candles", "BigQuery table to stream candles to, created if it doesn't exist")
+	bigQueryCredentials := flag.String("bigquery-credentials", "", "Service account key file for BigQuery, the application default credentials if empty")
+	toStdout := flag.Bool("stdout", false, "Stream each saved symbol with its candles to stdout as newline delimited JSON, in an in-memory database unless -dsn is given")
+	stdoutPerCandle := flag.Bool("stdout-per-candle", false, "Stream one line per candle to stdout instead of one line per symbol, implies -stdout")
+	metricsAddr := flag.String("metrics-addr", "", "Address to serve Prometheus metrics on, e.g. :9090")
+	otlpEndpoint := flag.String("otlp-endpoint", "", "OTLP/HTTP collector to export traces of each run to, host:port, e.g. localhost:4318")
+	otlpInsecure := flag.Bool("otlp-insecure", false, "Export traces over plain HTTP rather than HTTPS")
+	var lc logConfig
+	flag.StringVar(&lc.Format, "log-format", "text", "Log output format, text or json")
+	flag.StringVar(&lc.Level, "log-level", "info", "Minimum level to log, debug, info, warn or error")
+	flag.BoolVar(&lc.Verbose, "v", false, "Verbose, log at debug level")
+	flag.BoolVar(&lc.Quiet, "q", false, "Quiet, only log warnings and errors and hide the progress bar")
+	flag.StringVar(&lc.File, "log-file", "", "File to write logs to instead of stderr, appended to and rotated")
+	flag.Int64Var(&lc.MaxSize, "log-max-size", 100, "Size in megabytes past which the log file is rotated, 0 for no limit")
+	flag.DurationVar(&lc.MaxAge, "log-max-age", 24*time.Hour, "How long the log file is written to before it is rotated, 0 for no limit")
+	flag.IntVar(&lc.MaxBackups, "log-backups", 7, "Number of rotated log files to keep, 0 to keep all")
+	notifyWebhook := flag.String("notify-webhook", "", "URL to post a JSON summary of each run and fatal errors to")
+	notifySlack := flag.String("notify-slack", "", "Slack incoming webhook URL to post run summaries and fatal errors to")
+	notifyEmail := flag.String("notify-email", "", "Comma separated addresses to email run summaries and fatal errors to")
+	var sc smtpConfig
+	flag.StringVar(&sc.Addr, "smtp-addr", "", "SMTP server to send email notifications through, host:port")
+	flag.StringVar(&sc.User, "smtp-user", "", "SMTP user name, the password is read from SMTP_PASSWORD")
+	flag.StringVar(&sc.From, "smtp-from", "", "Sender address of email notifications")
+	if err := parseFlags(flag.CommandLine, os.Args[1:]); err != nil {
+		fatal("Could not load config", "error", err)
+	}
+
+	if err := setupLogging(lc); err != nil {
+		fatal("Invalid logging flags", "error", err)
+	}
+	ns, err := newNotifiers(*notifyWebhook, *notifySlack, *notifyEmail, sc)
 	if err != nil {
-		log.Fatal(err)
+		fatal("Invalid notification flags", "error", err)
 	}
+	notifiers = ns
+	// JSON logs are for machines, which don't want a progress bar
+	prog.Bar = *progressBar && lc.Format == "text" && !lc.Quiet
 
-	// Login to the server using the refresh token stored
-	// in the environment variables
-	refresh := os.Getenv("REFRESH_TOKEN")
-	client, err := qapi.NewClient(refresh, false)
+	// Validate the range of each interval up front rather than at the first run
+	rc.Intervals = splitList(*interval)
+	if len(rc.Intervals) == 0 {
+		fatal("At least one interval is required")
+	}
+	var cr scraper.CandleRange
+	for _, i := range rc.Intervals {
+		if cr, err = scraper.ParseRange(rc.Start, rc.End, i); err != nil {
+			fatal("Invalid range", "interval", i, "error", err)
+		}
+	}
+	rc.Derive = splitList(*derive)
+	if err := scraper.ValidateDerived(rc.Derive, rc.Intervals); err != nil {
+		fatal("Invalid -derive", "error", err)
+	}
+	if *throttle != "custom" {
+		t, err := scraper.FindThrottle(*throttle)
+		if err != nil {
+			fatal("Invalid throttle", "error", err)
+		}
+		// Flags given alongside a throttle override it
+		set := make(map[string]bool)
+		flag.Visit(func(f *flag.Flag) {
+			set[f.Name] = true
+		})
+		if !set["rate-limit"] {
+			pc.RateLimit = t.Rate
+		}
+		if !set["burst"] {
+			pc.Burst = t.Burst
+		}
+		if !set["workers"] {
+			rc.Workers = t.Workers
+		}
+		slog.Debug("Using throttle", "throttle", *throttle, "rate_limit", pc.RateLimit, "burst", pc.Burst, "workers", rc.Workers)
+	}
+	if rc.Workers < 1 {
+		fatal("At least one worker is required")
+	}
+	u, err := universe.Find(*universeName)
 	if err != nil {
-		log.Fatal(err)
+		fatal("Invalid universe", "error", err)
+	}
+	if *symbolsFile != "" {
+		u.File = *symbolsFile
+	}
+	universes := []universe.Universe{u}
+	if *watchlist != "" {
+		if universes, err = parseWatchlists(*watchlist, *watchlistExchange); err != nil {
+			fatal("Invalid -watchlist", "error", err)
+		}
+		if *refresh || *membership {
+			fatal("Watchlists can't be used with -refresh-symbols or -membership")
+		}
+		u = universes[0]
+	}
+	if *calendarName == "" {
+		*calendarName = u.Exchange
+	}
+	if *calendarName != "none" {
+		if rc.Calendar, err = calendar.Find(*calendarName); err != nil {
+			fatal("Invalid calendar", "error", err)
+		}
+	}
+	rc.FXCurrencies = splitList(*fxCurrencies)
+	if pc.Live, err = server.isLive(); err != nil {
+		fatal("Invalid server flags", "error", err)
+	}
+	pc.Profiles = splitList(*profiles)
+	if *interactiveMatch {
+		if !term.IsTerminal(int(os.Stdin.Fd())) {
+			fatal("-interactive-match needs a terminal")
+		}
+		pc.Match.Choose = newMatchPrompt().choose
+	}
+	readProviderKeys(&pc)
+	pc.AlphaVantageRate = *alphaVantageRate / 60
+	rc.Provider = *provider
+	rc.Version = version
+	if pc.RateLimit <= 0 {
+		fatal("The rate limit must be positive")
 	}
-	log.Println("export REFRESH_TOKEN=" + client.Credentials.RefreshToken + "\n\n")
 
-	// Create a rate limting ticker - Questrade limits market calls to 5 per second
-	// up to 15 000 calls per hour. Lets set a delay of 250 ms - which will get us
-	// 14 400 calls per hour at 4 requests per second
-	interval := 250 * time.Millisecond
-	ticker := time.NewTicker(interval)
+	// Transient errors are retried with exponential backoff
+	pc.Retry = scraper.RetryPolicy{MaxAttempts: *retries, BaseDelay: *retryDelay, MaxDelay: *retryMaxDelay}
 
-	// Create a new wait group so that main will block until all goroutines
-	// are finished (saving to the database takes awhile)
-	var wg sync.WaitGroup
-	wg.Add(2)
+	if *metricsAddr != "" {
+		serveMetrics(*metricsAddr)
+	}
+	if *otlpEndpoint != "" {
+		flush, err := setupTracing(*otlpEndpoint, *otlpInsecure)
+		if err != nil {
+			fatal("Invalid tracing flags", "error", err)
+		}
+		defer flush()
+	}
 
-	// Create a channel for the populated symbol structs to be sent over
-	// to be saved to the database.
-	symChan := make(chan SP500Symbol)
-	errChan := saveData(&wg, symChan)
-	stopChan := make(chan bool)
+	// Open the database, creating the schema if needed. Streams to stdout
+	// don't touch the disk unless a database is given.
+	if *stdoutPerCandle {
+		*toStdout = true
+	}
+	if *toStdout {
+		set := make(map[string]bool)
+		flag.Visit(func(f *flag.Flag) {
+			set[f.Name] = true
+		})
+		if !set["dsn"] && !set["db"] && !set["db-driver"] {
+			*dsn = ":memory:"
+		}
+	}
+	if *syncURL != "" {
+		if dbSync, err = newDatabaseSync(*syncURL, *driver, *dsn); err != nil {
+			fatal("Invalid -sync", "error", err)
+		}
+		if *syncPull {
+			if err := dbSync.pull(context.Background()); err != nil {
+				fatal("Could not download the database", "key", dbSync.key, "error", err)
+			}
+		}
+	}
+	syncBeforeRun()
+	st, err := store.New(*driver, *dsn, *schema, *batchSize)
+	if err != nil {
+		fatal("Could not open database", "error", err)
+	}
+	defer st.Close()
 
-	// Create a new map that will hold symbols that could not be found
-	notFound := make([]SP500Symbol, 1)
+	// Time series databases and files the candles are also written to
+	var sinks []sink.Sink
+	if *influxURL != "" {
+		sk, err := sink.NewInflux(*influxURL, os.Getenv("INFLUX_TOKEN"), *influxOrg, *influxBucket)
+		if err != nil {
+			fatal("Invalid InfluxDB sink", "error", err)
+		}
+		sinks = append(sinks, sk)
+	}
+	if *timescaleDSN != "" {
+		sk, err := sink.NewTimescale(*timescaleDSN)
+		if err != nil {
+			fatal("Could not open TimescaleDB", "error", err)
+		}
+		defer sk.Close()
+		sinks = append(sinks, sk)
+	}
+	if *jsonDir != "" {
+		sk, err := sink.NewJSONDir(*jsonDir)
+		if err != nil {
+			fatal("Could not create JSON directory", "error", err)
+		}
+		sinks = append(sinks, sk)
+	}
+	if *csvDir != "" {
+		sk, err := sink.NewCSVDir(*csvDir)
+		if err != nil {
+			fatal("Could not create CSV directory", "error", err)
+		}
+		sinks = append(sinks, sk)
+	}
+	if *webhookURL != "" {
+		sk, err := sink.NewWebhook(*webhookURL, os.Getenv("WEBHOOK_TOKEN"))
+		if err != nil {
+			fatal("Invalid webhook sink", "error", err)
+		}
+		sinks = append(sinks, sk)
+	}
+	if *kafkaBrokers != "" {
+		sk, err := sink.NewKafka(splitList(*kafkaBrokers), *kafkaTopic, *kafkaPerCandle)
+		if err != nil {
+			fatal("Invalid Kafka sink", "error", err)
+		}
+		defer sk.Close()
+		sinks = append(sinks, sk)
+	}
+	if *bigQueryDataset != "" {
+		sk, err := sink.NewBigQuery(*bigQueryProject, *bigQueryDataset, *bigQueryTable, *bigQueryCredentials)
+		if err != nil {
+			fatal("Invalid BigQuery sink", "error", err)
+		}
+		defer sk.Close()
+		sinks = append(sinks, sk)
+	}
+	if *toStdout {
+		sk := sink.NewStream(os.Stdout, *stdoutPerCandle)
+		defer sk.Close()
+		sinks = append(sinks, sk)
+	}
 
-	// Separate goroutine to output database write errors
-	go func(wg *sync.WaitGroup, errChan chan error) {
-		for err := range errChan {
-			log.Println("DB Error: ", err)
+	// Connect to the data provider, logging in to Questrade with the
+	// refresh token stored in the environment or the credentials file
+	if pc.ExtendedHours && *provider != "yahoo" && *provider != "polygon" {
+		fatal("Provider does not support -extended-hours", "provider", *provider)
+	}
+	p, err := scraper.NewProvider(*provider, pc)
+	if err != nil {
+		fatal("Could not connect to provider", "provider", *provider, "error", err)
+	}
+	if _, ok := p.(scraper.DetailsProvider); !ok && (rc.Dividends || rc.Fundamentals) {
+		fatal("Provider does not support -dividends or -fundamentals", "provider", *provider)
+	}
+	if _, ok := p.(scraper.OptionsProvider); !ok && rc.Options {
+		fatal("Provider does not support -options", "provider", *provider)
+	}
+	var ep scraper.EarningsProvider
+	if *earnings {
+		p, err := scraper.NewProvider(*earningsProvider, pc)
+		if err != nil {
+			fatal("Could not connect to earnings provider", "provider", *earningsProvider, "error", err)
 		}
-		log.Println("DB error logging stopped.")
-		close(stopChan)
-		wg.Done()
-	}(&wg, errChan)
+		var ok bool
+		if ep, ok = p.(scraper.EarningsProvider); !ok {
+			fatal("Provider does not support -earnings", "provider", *earningsProvider)
+		}
+	}
+	var fp scraper.Provider
+	if *fallback != "" {
+		if fp, err = scraper.NewProvider(*fallback, pc); err != nil {
+			fatal("Could not connect to fallback provider", "provider", *fallback, "error", err)
+		}
+	}
 
-L:
-	for _, sym := range symbols {
-		select {
-		case <-client.SessionTimer.C: // Login to the practice server again when session expires
-			log.Println("Logging in again...")
-			client.Login(false)
-			break
-		case _, ok := <-stopChan: // Break the loop if a critical DB error occurs in the other goroutine
-			if !ok {
-				break L
+	// Cancel the run on SIGINT or SIGTERM, letting in-flight symbols finish
+	// and the database writer flush. A second signal exits immediately.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sigChan := make(chan os.Signal, 2)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sigChan
+		slog.Info("Shutting down, waiting for in-flight symbols to be saved")
+		cancel()
+		<-sigChan
+		fatal("Forced shutdown")
+	}()
+
+	s := scraper.New(p, st, rc)
+	s.Fallback = fp
+	s.Earnings = ep
+	s.Sinks = sinks
+	filter := symbolFilter{only: splitList(*only), exclude: splitList(*exclude), sectors: splitList(*sectors)}
+	// The published holidays are refreshed before each daemon run, once
+	// they are older than -holidays-refresh
+	holidaysKey := ""
+	if *holidays {
+		if pc.PolygonKey == "" {
+			fatal("-holidays needs POLYGON_API_KEY")
+		}
+		holidaysKey = pc.PolygonKey
+	}
+	// Symbol files are read again by daemon runs once they change
+	files := make(watchedFiles)
+	load := func() ([]store.Symbol, error) {
+		if rc.Calendar != nil {
+			if err := loadHolidays(st, rc.Calendar, holidaysKey, *holidaysRefresh); err != nil {
+				return nil, err
 			}
-			break
-		default:
-			err := findSymbol(client, ticker, &sym)
+		}
+		// Symbols in more than one watchlist are fetched once
+		var symbols []store.Symbol
+		seen := make(map[string]bool)
+		for _, u := range universes {
+			us, err := files.load(st, u, *refresh, *membership, *former, cr.Start)
 			if err != nil {
-				notFound = append(notFound, sym)
-				log.Printf("Could not find symbol %s\n", sym.Symbol)
-				break
+				return nil, err
+			}
+			for _, sym := range us {
+				if !seen[sym.Key()] {
+					seen[sym.Key()] = true
+					symbols = append(symbols, sym)
+				}
+			}
+		}
+		symbols, err := filter.apply(symbols)
+		if err != nil || !*benchmarks {
+			return symbols, err
+		}
+		// Benchmarks aren't filtered, and aren't added twice if the universe has them
+		seen = make(map[string]bool, len(symbols))
+		for _, sym := range symbols {
+			seen[sym.Key()] = true
+		}
+		for _, b := range universe.ParseBenchmarks(splitList(*benchmarkSymbols)) {
+			if !seen[b.Key()] {
+				symbols = append(symbols, b)
 			}
-			log.Printf("Retreived %d candles for %s\n", len(sym.Candles), sym.Symbol)
-			symChan <- sym
-			break
 		}
+		return symbols, nil
+	}
+
+	if *daemon {
+		loc, err := time.LoadLocation(*timezone)
+		if err != nil {
+			fatal("Invalid time zone", "error", err)
+		}
+		sched, err := ParseSchedule(*schedule, loc)
+		if err != nil {
+			fatal("Invalid schedule", "error", err)
+		}
+		ds := newDaemonStatus()
+		if *statusAddr != "" {
+			serveStatus(*statusAddr, ds, st, p)
+		}
+		done, err := startService(*serviceName, cancel)
+		if err != nil {
+			fatal("Could not start Windows service", "service", *serviceName, "error", err)
+		}
+		runDaemon(ctx, s, sched, prog, load, *report, ds)
+		done()
+		return
+	}
+
+	symbols, err := load()
+	if err != nil {
+		fatal("Could not load symbols", "universe", u.Name, "error", err)
 	}
-	close(symChan)
-	log.Println("Waiting for data to be saved...")
-	wg.Wait()
 
-	// Output list of symbols not found
-	log.Printf("%d Symbols Not Saved", len(notFound))
-	for _, e := range notFound {
-		log.Println(e.Symbol)
+	sum, err := scrape(ctx, s, symbols, prog)
+	if err != nil {
+		fatal("Run failed", "error", err)
+	}
+	logSummary(sum)
+	syncAfterRun(ctx, st, sum)
+	if cr, ok := p.(scraper.CreditReporter); ok {
+		slog.Info("Provider credits used", "provider", *provider, "credits", cr.Credits())
+	}
+	if *report != "" {
+		if err := writeReport(*report, st, sum, rc.Intervals[0]); err != nil {
+			slog.Error("Could not write report", "file", *report, "error", err)
+		}
 	}
-	log.Println("export REFRESH_TOKEN=" + client.Credentials.RefreshToken + "\n\n")
+	notify(summaryNotification(sum))
 }
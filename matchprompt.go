@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/alexurquhart/sp500scraper/pkg/scraper"
+	"github.com/alexurquhart/sp500scraper/pkg/store"
+)
+
+// Asks on the terminal which listing of an ambiguous ticker is meant. The
+// workers resolve symbols concurrently, so one question is asked at a time.
+type matchPrompt struct {
+	mu sync.Mutex
+	in *bufio.Reader
+}
+
+func newMatchPrompt() *matchPrompt {
+	return &matchPrompt{in: bufio.NewReader(os.Stdin)}
+}
+
+// List the matches, best first, and read the number of the one to use.
+// Enter takes the best match and s, or the end of the input, skips the
+// symbol.
+func (mp *matchPrompt) choose(sym store.Symbol, matches []scraper.Match) (scraper.Match, bool) {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+	// Logs of the other workers still go through, but the bar would be
+	// redrawn over the question
+	stderr.pause()
+	defer stderr.resume()
+
+	fmt.Fprintf(stderr, "\n%s isn't listed on %s, pick a listing:\n", sym.Symbol, sym.Exchange)
+	for i, m := range matches {
+		fmt.Fprintf(stderr, "  %d) %s on %s, %s %s, %s (score %d)\n", i+1, m.Symbol, m.Exchange, m.Currency,
+			m.SecurityType, m.Description, m.Score)
+	}
+	for {
+		fmt.Fprintf(stderr, "Listing [1-%d, enter for 1, s to skip]: ", len(matches))
+		line, err := mp.in.ReadString('\n')
+		line = strings.TrimSpace(line)
+		if line == "" && err == nil {
+			return matches[0], true
+		}
+		if line == "s" || err != nil {
+			return scraper.Match{}, false
+		}
+		if n, err := strconv.Atoi(line); err == nil && n >= 1 && n <= len(matches) {
+			return matches[n-1], true
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/smtp"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/alexurquhart/sp500scraper/pkg/scraper"
+)
+
+// Event sent to the notifiers, either the outcome of a run or an alert
+type notification struct {
+	Event string `json:"event"` // run_finished, run_interrupted, run_failed or fatal
+	Title string `json:"title"`
+	Text  string `json:"text"`
+
+	// Figures of a finished run
+	Run      int    `json:"run,omitempty"`
+	Saved    int    `json:"saved,omitempty"`
+	Total    int    `json:"total,omitempty"`
+	Failed   int    `json:"failed,omitempty"`
+	Candles  int    `json:"candles,omitempty"`
+	Duration string `json:"duration,omitempty"`
+}
+
+// Delivers notifications to the people watching the scraper
+type notifier interface {
+	notify(n notification) error
+}
+
+// Notifiers configured with the -notify flags, used by fatal to alert
+// before exiting
+var notifiers []notifier
+
+// Time allowed for each notifier to deliver a notification
+const notifyTimeout = 10 * time.Second
+
+// Send a notification to every notifier, logging failures.
+func notify(n notification) {
+	for _, nt := range notifiers {
+		if err := nt.notify(n); err != nil {
+			slog.Warn("Could not send notification", "event", n.Event, "error", err)
+		}
+	}
+}
+
+// Notification of a completed or interrupted run, listing the first few
+// symbols that failed.
+func summaryNotification(sum scraper.Summary) notification {
+	n := notification{
+		Event:    "run_finished",
+		Title:    "Run finished",
+		Run:      sum.Run,
+		Saved:    sum.Saved,
+		Total:    sum.Total,
+		Failed:   len(sum.NotFound),
+		Candles:  sum.Candles,
+		Duration: sum.Duration.Round(time.Second).String(),
+	}
+	if sum.Interrupted {
+		n.Event, n.Title = "run_interrupted", "Run interrupted"
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s: %d of %d symbols saved, %d failed, %d candles in %s", n.Title, n.Saved, n.Total, n.Failed, n.Candles, n.Duration)
+	for i, f := range sum.NotFound {
+		if i == 10 {
+			fmt.Fprintf(&b, "\n... and %d more", len(sum.NotFound)-i)
+			break
+		}
+		fmt.Fprintf(&b, "\n%s (%s): %s", f.Symbol, f.Exchange, f.Reason)
+	}
+	n.Text = b.String()
+	return n
+}
+
+// Alert about an error that stopped a run or the program, with the log
+// attributes appended to the message.
+func alertNotification(event, msg string, args ...any) notification {
+	var b strings.Builder
+	b.WriteString(msg)
+	for i := 0; i+1 < len(args); i += 2 {
+		fmt.Fprintf(&b, " %v=%v", args[i], args[i+1])
+	}
+	return notification{Event: event, Title: msg, Text: b.String()}
+}
+
+// Build the notifiers from the -notify flags. Empty settings are skipped.
+func newNotifiers(webhook, slack, email string, sc smtpConfig) ([]notifier, error) {
+	var ns []notifier
+	if webhook != "" {
+		ns = append(ns, webhookNotifier{url: webhook})
+	}
+	if slack != "" {
+		ns = append(ns, slackNotifier{url: slack})
+	}
+	if to := splitList(email); len(to) > 0 {
+		if sc.Addr == "" || sc.From == "" {
+			return nil, errors.New("Email notifications need -smtp-addr and -smtp-from")
+		}
+		ns = append(ns, emailNotifier{smtp: sc, to: to})
+	}
+	return ns, nil
+}
+
+// Notifier posting the notification as JSON to a URL
+type webhookNotifier struct {
+	url string
+}
+
+func (w webhookNotifier) notify(n notification) error {
+	return postJSON(w.url, n)
+}
+
+// Notifier posting to a Slack incoming webhook
+type slackNotifier struct {
+	url string
+}
+
+func (s slackNotifier) notify(n notification) error {
+	return postJSON(s.url, map[string]string{"text": n.Text})
+}
+
+func postJSON(url string, v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	c := http.Client{Timeout: notifyTimeout}
+	res, err := c.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		return errors.New("Webhook returned " + res.Status)
+	}
+	return nil
+}
+
+// SMTP server email notifications are sent through. The password is read
+// from the SMTP_PASSWORD environment variable.
+type smtpConfig struct {
+	Addr string // host:port
+	User string
+	From string
+}
+
+// Notifier sending an email to each address
+type emailNotifier struct {
+	smtp smtpConfig
+	to   []string
+}
+
+func (e emailNotifier) notify(n notification) error {
+	host, _, err := net.SplitHostPort(e.smtp.Addr)
+	if err != nil {
+		return err
+	}
+	var auth smtp.Auth
+	if e.smtp.User != "" {
+		auth = smtp.PlainAuth("", e.smtp.User, os.Getenv("SMTP_PASSWORD"), host)
+	}
+	msg := "From: " + e.smtp.From + "\r\n" +
+		"To: " + strings.Join(e.to, ", ") + "\r\n" +
+		"Subject: sp500scraper: " + n.Title + "\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n\r\n" +
+		strings.ReplaceAll(n.Text, "\n", "\r\n") + "\r\n"
+	return smtp.SendMail(e.smtp.Addr, auth, e.smtp.From, e.to, []byte(msg))
+}
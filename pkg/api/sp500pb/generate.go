@@ -0,0 +1,6 @@
+// Package sp500pb holds the protobuf types and gRPC service generated from
+// sp500.proto. Regenerate with go generate after editing it, which needs
+// protoc, protoc-gen-go and protoc-gen-go-grpc.
+package sp500pb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative sp500.proto
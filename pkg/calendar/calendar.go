@@ -0,0 +1,293 @@
+// Package calendar knows which days US stock exchanges are open, from the
+// rules of the NYSE holiday schedule, a list of one-off closures and any
+// published closures and early closes added to it.
+package calendar
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Closures outside the regular holiday schedule, such as national days of
+// mourning and the days after September 11
+//
+//go:embed closures.json
+var closuresJSON []byte
+
+// Date format of the closures file
+const dateFormat = "2006-01-02"
+
+// Calendar is the trading days of an exchange. Days are those of the
+// exchange's time zone.
+type Calendar struct {
+	Name     string
+	Location *time.Location
+
+	// Guards the days added by AddDays, which can be refreshed while the
+	// calendar is in use
+	mu       sync.RWMutex
+	closures map[time.Time]string
+	early    map[time.Time]time.Time // Early closing time by day
+}
+
+// Day the exchange is closed or closes early, as published by the exchange
+// or a calendar service
+type Day struct {
+	Date time.Time // Any time on the day, in the exchange's time zone
+	Name string
+
+	// When the exchange closes early, zero if it is closed all day
+	Close time.Time
+}
+
+// NYSE and NASDAQ close on the same days
+var exchanges = map[string]bool{"NYSE": true, "NASDAQ": true}
+
+// Look up the calendar of an exchange.
+func Find(exchange string) (*Calendar, error) {
+	if !exchanges[exchange] {
+		var names []string
+		for n := range exchanges {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return nil, errors.New("Unknown calendar " + exchange + ", expected one of " + strings.Join(names, ", "))
+	}
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		return nil, err
+	}
+
+	var list []struct {
+		Date string `json:"date"`
+		Name string `json:"name"`
+	}
+	if err := json.Unmarshal(closuresJSON, &list); err != nil {
+		return nil, err
+	}
+	c := &Calendar{Name: exchange, Location: loc, closures: make(map[time.Time]string, len(list)), early: make(map[time.Time]time.Time)}
+	for _, cl := range list {
+		d, err := time.Parse(dateFormat, cl.Date)
+		if err != nil {
+			return nil, errors.New("Invalid closure date: " + cl.Date)
+		}
+		c.closures[d] = cl.Name
+	}
+	return c, nil
+}
+
+// Add closures and early closes to those the calendar knows from the
+// holiday rules, such as the published schedule of coming years. A day
+// closed by the rules that a published day closes early is taken to open.
+func (c *Calendar) AddDays(days []Day) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, d := range days {
+		y, m, dd := d.Date.In(c.Location).Date()
+		day := time.Date(y, m, dd, 0, 0, 0, 0, time.UTC)
+		if d.Close.IsZero() {
+			c.closures[day] = d.Name
+			delete(c.early, day)
+		} else {
+			c.early[day] = d.Close
+			delete(c.closures, day)
+		}
+	}
+}
+
+// Name of the holiday or closure on the day of t, if the exchange is closed
+// that weekday.
+func (c *Calendar) Holiday(t time.Time) (string, bool) {
+	y, m, d := t.In(c.Location).Date()
+	day := time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+	c.mu.RLock()
+	name, ok := c.closures[day]
+	_, early := c.early[day]
+	c.mu.RUnlock()
+	if ok {
+		return name, true
+	}
+	if early {
+		return "", false
+	}
+	for _, h := range holidays(y) {
+		if h.date.Equal(day) {
+			return h.name, true
+		}
+	}
+	return "", false
+}
+
+// Whether the exchange is open on the day of t.
+func (c *Calendar) IsTradingDay(t time.Time) bool {
+	switch t.In(c.Location).Weekday() {
+	case time.Saturday, time.Sunday:
+		return false
+	}
+	_, closed := c.Holiday(t)
+	return !closed
+}
+
+// Number of trading days from the day of start up to, but not including,
+// the day of end.
+func (c *Calendar) TradingDays(start, end time.Time) int {
+	n := 0
+	for d := c.day(start); d.Before(c.day(end)); d = d.AddDate(0, 0, 1) {
+		if c.IsTradingDay(d) {
+			n++
+		}
+	}
+	return n
+}
+
+// The first trading day after the day of t, at midnight in the exchange's
+// time zone.
+func (c *Calendar) Next(t time.Time) time.Time {
+	d := c.day(t).AddDate(0, 0, 1)
+	for !c.IsTradingDay(d) {
+		d = d.AddDate(0, 0, 1)
+	}
+	return d
+}
+
+// The last trading day before the day of t, at midnight in the exchange's
+// time zone.
+func (c *Calendar) Previous(t time.Time) time.Time {
+	d := c.day(t).AddDate(0, 0, -1)
+	for !c.IsTradingDay(d) {
+		d = d.AddDate(0, 0, -1)
+	}
+	return d
+}
+
+// Regular trading hours in the exchange's time zone
+const (
+	openHour, openMinute = 9, 30
+	closeHour            = 16
+)
+
+// Opening and closing times of the regular session on the day of t, false if
+// the exchange is closed that day. Early closes are only known once added
+// with AddDays, other days close at the usual time.
+func (c *Calendar) Session(t time.Time) (time.Time, time.Time, bool) {
+	if !c.IsTradingDay(t) {
+		return time.Time{}, time.Time{}, false
+	}
+	d := c.day(t)
+	open := time.Date(d.Year(), d.Month(), d.Day(), openHour, openMinute, 0, 0, c.Location)
+	close := time.Date(d.Year(), d.Month(), d.Day(), closeHour, 0, 0, 0, c.Location)
+	c.mu.RLock()
+	if early, ok := c.early[time.Date(d.Year(), d.Month(), d.Day(), 0, 0, 0, 0, time.UTC)]; ok {
+		close = early.In(c.Location)
+	}
+	c.mu.RUnlock()
+	return open, close, true
+}
+
+// Whether the regular session is open at t.
+func (c *Calendar) IsOpen(t time.Time) bool {
+	open, close, ok := c.Session(t)
+	return ok && !t.Before(open) && t.Before(close)
+}
+
+// The next opening of the regular session after t, or t itself while the
+// session is open.
+func (c *Calendar) NextOpen(t time.Time) time.Time {
+	if c.IsOpen(t) {
+		return t
+	}
+	if open, _, ok := c.Session(t); ok && t.Before(open) {
+		return open
+	}
+	open, _, _ := c.Session(c.Next(t))
+	return open
+}
+
+// Midnight of the day of t in the exchange's time zone
+func (c *Calendar) day(t time.Time) time.Time {
+	y, m, d := t.In(c.Location).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, c.Location)
+}
+
+// A regular holiday, on the day it is observed
+type holiday struct {
+	date time.Time
+	name string
+}
+
+// The regular NYSE holidays observed in a year. Holidays on a Sunday are
+// observed the Monday after and those on a Saturday the Friday before,
+// except New Year's Day which is then not observed at all.
+func holidays(year int) []holiday {
+	date := func(m time.Month, d int) time.Time {
+		return time.Date(year, m, d, 0, 0, 0, 0, time.UTC)
+	}
+	observed := func(t time.Time) time.Time {
+		switch t.Weekday() {
+		case time.Saturday:
+			return t.AddDate(0, 0, -1)
+		case time.Sunday:
+			return t.AddDate(0, 0, 1)
+		}
+		return t
+	}
+
+	var hs []holiday
+	if ny := date(time.January, 1); ny.Weekday() != time.Saturday {
+		hs = append(hs, holiday{observed(ny), "New Year's Day"})
+	}
+	if year >= 1998 {
+		hs = append(hs, holiday{nthWeekday(year, time.January, time.Monday, 3), "Martin Luther King Jr. Day"})
+	}
+	hs = append(hs,
+		holiday{nthWeekday(year, time.February, time.Monday, 3), "Washington's Birthday"},
+		holiday{easter(year).AddDate(0, 0, -2), "Good Friday"},
+		holiday{lastWeekday(year, time.May, time.Monday), "Memorial Day"},
+	)
+	if year >= 2022 {
+		hs = append(hs, holiday{observed(date(time.June, 19)), "Juneteenth"})
+	}
+	hs = append(hs,
+		holiday{observed(date(time.July, 4)), "Independence Day"},
+		holiday{nthWeekday(year, time.September, time.Monday, 1), "Labor Day"},
+		holiday{nthWeekday(year, time.November, time.Thursday, 4), "Thanksgiving Day"},
+		holiday{observed(date(time.December, 25)), "Christmas Day"},
+	)
+	return hs
+}
+
+// The nth weekday of a month, counting from 1
+func nthWeekday(year int, month time.Month, wd time.Weekday, n int) time.Time {
+	t := time.Date(year, month, 1, 0, 0, 0, 0, time.UTC)
+	offset := (int(wd) - int(t.Weekday()) + 7) % 7
+	return t.AddDate(0, 0, offset+7*(n-1))
+}
+
+// The last weekday of a month
+func lastWeekday(year int, month time.Month, wd time.Weekday) time.Time {
+	t := time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC)
+	offset := (int(t.Weekday()) - int(wd) + 7) % 7
+	return t.AddDate(0, 0, -offset)
+}
+
+// Easter Sunday of a year in the Gregorian calendar, by the anonymous
+// Gregorian algorithm
+func easter(year int) time.Time {
+	a := year % 19
+	b, c := year/100, year%100
+	d, e := b/4, b%4
+	f := (b + 8) / 25
+	g := (b - f + 1) / 3
+	h := (19*a + b - d - g + 15) % 30
+	i, k := c/4, c%4
+	l := (32 + 2*e + 2*i - h - k) % 7
+	m := (a + 11*h + 22*l) / 451
+	month := (h + l - 7*m + 114) / 31
+	day := (h+l-7*m+114)%31 + 1
+	return time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,43 @@
+package remote
+
+import (
+	"context"
+	"io"
+
+	"cloud.google.com/go/storage"
+)
+
+// Bucket in Google Cloud Storage
+type gcsBucket struct {
+	bucket *storage.BucketHandle
+}
+
+func newGCSBucket(ctx context.Context, name string) (*gcsBucket, error) {
+	client, err := storage.NewClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &gcsBucket{bucket: client.Bucket(name)}, nil
+}
+
+func (b *gcsBucket) Put(ctx context.Context, key string, r io.Reader) error {
+	w := b.bucket.Object(key).NewWriter(ctx)
+	if _, err := io.Copy(w, r); err != nil {
+		w.Close()
+		return err
+	}
+	// The object is only written once the writer is closed
+	return w.Close()
+}
+
+func (b *gcsBucket) Get(ctx context.Context, key string, w io.Writer) error {
+	r, err := b.bucket.Object(key).NewReader(ctx)
+	if err == storage.ErrObjectNotExist {
+		return ErrNotExist
+	} else if err != nil {
+		return err
+	}
+	defer r.Close()
+	_, err = io.Copy(w, r)
+	return err
+}
@@ -0,0 +1,149 @@
+// Package remote copies files to and from object storage, Amazon S3 or
+// Google Cloud Storage, with a SHA-256 checksum kept next to each file so
+// copies can be verified and unchanged files aren't transferred again.
+package remote
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Returned by Get when there's no object at the key
+var ErrNotExist = errors.New("Object doesn't exist")
+
+// Bucket is a store of objects by key
+type Bucket interface {
+	Put(ctx context.Context, key string, r io.Reader) error
+	Get(ctx context.Context, key string, w io.Writer) error
+}
+
+// Open the bucket of a URL, s3://bucket/key or gs://bucket/key, returning
+// it with the key. S3 credentials and region are read like the AWS CLI's,
+// and Cloud Storage uses the application default credentials.
+func Open(ctx context.Context, url string) (Bucket, string, error) {
+	var scheme, rest string
+	if i := strings.Index(url, "://"); i > 0 {
+		scheme, rest = url[:i], url[i+3:]
+	}
+	i := strings.Index(rest, "/")
+	if i <= 0 || i == len(rest)-1 {
+		return nil, "", errors.New("Expected s3://bucket/key or gs://bucket/key, got " + url)
+	}
+	bucket, key := rest[:i], strings.Trim(rest[i+1:], "/")
+	switch scheme {
+	case "s3":
+		b, err := newS3Bucket(bucket)
+		return b, key, err
+	case "gs":
+		b, err := newGCSBucket(ctx, bucket)
+		return b, key, err
+	}
+	return nil, "", errors.New("Unknown storage " + scheme + ", expected s3 or gs")
+}
+
+// Key of the checksum of the object at key
+func checksumKey(key string) string {
+	return key + ".sha256"
+}
+
+// SHA-256 checksum of a file in hex.
+func Checksum(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Checksum of the object at key, empty if it has none.
+func ObjectChecksum(ctx context.Context, b Bucket, key string) (string, error) {
+	var sb strings.Builder
+	if err := b.Get(ctx, checksumKey(key), &sb); errors.Is(err, ErrNotExist) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	// Written in the format of sha256sum, checksum then file name
+	fields := strings.Fields(sb.String())
+	if len(fields) == 0 {
+		return "", nil
+	}
+	return fields[0], nil
+}
+
+// Upload the file at path to key, followed by its checksum, unless the
+// object's checksum already matches. Returns whether it was uploaded.
+func Push(ctx context.Context, b Bucket, key, path string) (bool, error) {
+	sum, err := Checksum(path)
+	if err != nil {
+		return false, err
+	}
+	current, err := ObjectChecksum(ctx, b, key)
+	if err != nil {
+		return false, err
+	}
+	if current == sum {
+		return false, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	if err := b.Put(ctx, key, f); err != nil {
+		return false, err
+	}
+	// The checksum goes last, so it never names a file that isn't there yet
+	line := sum + "  " + filepath.Base(key) + "\n"
+	return true, b.Put(ctx, checksumKey(key), strings.NewReader(line))
+}
+
+// Download the object at key to path if its checksum differs from the file
+// at path, verifying the download before replacing the file, which is kept
+// with a .prev suffix. Returns whether the file was replaced; nothing is
+// done if there is no object.
+func Pull(ctx context.Context, b Bucket, key, path string) (bool, error) {
+	sum, err := ObjectChecksum(ctx, b, key)
+	if err != nil || sum == "" {
+		return false, err
+	}
+	if local, err := Checksum(path); err == nil && local == sum {
+		return false, nil
+	} else if err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+
+	tmp := path + ".download"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return false, err
+	}
+	defer os.Remove(tmp)
+	h := sha256.New()
+	if err := b.Get(ctx, key, io.MultiWriter(f, h)); err != nil {
+		f.Close()
+		return false, err
+	}
+	if err := f.Close(); err != nil {
+		return false, err
+	}
+	if got := hex.EncodeToString(h.Sum(nil)); got != sum {
+		return false, errors.New("Checksum of " + key + " doesn't match, expected " + sum + " but got " + got)
+	}
+	if err := os.Rename(path, path+".prev"); err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+	return true, os.Rename(tmp, path)
+}
@@ -0,0 +1,46 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// Bucket in Amazon S3. Large files are uploaded in parts.
+type s3Bucket struct {
+	name     string
+	client   *s3.S3
+	uploader *s3manager.Uploader
+}
+
+func newS3Bucket(name string) (*s3Bucket, error) {
+	sess, err := session.NewSessionWithOptions(session.Options{SharedConfigState: session.SharedConfigEnable})
+	if err != nil {
+		return nil, err
+	}
+	return &s3Bucket{name: name, client: s3.New(sess), uploader: s3manager.NewUploader(sess)}, nil
+}
+
+func (b *s3Bucket) Put(ctx context.Context, key string, r io.Reader) error {
+	_, err := b.uploader.UploadWithContext(ctx, &s3manager.UploadInput{Bucket: aws.String(b.name), Key: aws.String(key), Body: r})
+	return err
+}
+
+func (b *s3Bucket) Get(ctx context.Context, key string, w io.Writer) error {
+	out, err := b.client.GetObjectWithContext(ctx, &s3.GetObjectInput{Bucket: aws.String(b.name), Key: aws.String(key)})
+	var ae awserr.Error
+	if errors.As(err, &ae) && ae.Code() == s3.ErrCodeNoSuchKey {
+		return ErrNotExist
+	} else if err != nil {
+		return err
+	}
+	defer out.Body.Close()
+	_, err = io.Copy(w, out.Body)
+	return err
+}
@@ -0,0 +1,188 @@
+package scraper
+
+import (
+	"context"
+	"net/url"
+	"time"
+
+	"github.com/alexurquhart/qapi"
+	"github.com/alexurquhart/sp500scraper/pkg/store"
+)
+
+// AccountProvider is implemented by providers that report the brokerage
+// accounts of the logged in user
+type AccountProvider interface {
+	// Snapshot every account at the snapshot time, with the executions of
+	// each account after its time in since, or after from for accounts not
+	// in since
+	GetAccounts(ctx context.Context, since map[string]time.Time, from, snapshot time.Time) ([]store.AccountSnapshot, error)
+}
+
+// Accounts as returned by /v1/accounts
+type questradeAccounts struct {
+	Accounts []struct {
+		Type   string `json:"type"`
+		Number string `json:"number"`
+		Status string `json:"status"`
+	} `json:"accounts"`
+}
+
+// Positions as returned by /v1/accounts/{id}/positions
+type questradePositions struct {
+	Positions []struct {
+		Symbol             string  `json:"symbol"`
+		SymbolID           int     `json:"symbolId"`
+		OpenQuantity       float64 `json:"openQuantity"`
+		CurrentMarketValue float64 `json:"currentMarketValue"`
+		CurrentPrice       float64 `json:"currentPrice"`
+		AverageEntryPrice  float64 `json:"averageEntryPrice"`
+		ClosedPnL          float64 `json:"closedPnl"`
+		OpenPnL            float64 `json:"openPnl"`
+		TotalCost          float64 `json:"totalCost"`
+	} `json:"positions"`
+}
+
+// Balance as returned by /v1/accounts/{id}/balances
+type questradeBalance struct {
+	Currency          string  `json:"currency"`
+	Cash              float64 `json:"cash"`
+	MarketValue       float64 `json:"marketValue"`
+	TotalEquity       float64 `json:"totalEquity"`
+	BuyingPower       float64 `json:"buyingPower"`
+	MaintenanceExcess float64 `json:"maintenanceExcess"`
+}
+
+type questradeBalances struct {
+	PerCurrencyBalances []questradeBalance `json:"perCurrencyBalances"`
+	CombinedBalances    []questradeBalance `json:"combinedBalances"`
+}
+
+// Executions as returned by /v1/accounts/{id}/executions
+type questradeExecutions struct {
+	Executions []struct {
+		Symbol               string    `json:"symbol"`
+		SymbolID             int       `json:"symbolId"`
+		Quantity             float64   `json:"quantity"`
+		Side                 string    `json:"side"`
+		Price                float64   `json:"price"`
+		ID                   int       `json:"id"`
+		OrderID              int       `json:"orderId"`
+		Timestamp            time.Time `json:"timestamp"`
+		Venue                string    `json:"venue"`
+		Commission           float64   `json:"commission"`
+		ExecutionFee         float64   `json:"executionFee"`
+		SecFee               float64   `json:"secFee"`
+		CanadianExecutionFee float64   `json:"canadianExecutionFee"`
+	} `json:"executions"`
+}
+
+// Every session is logged in to its own accounts, so all of them are
+// snapshotted.
+func (p *questradeProvider) GetAccounts(ctx context.Context, since map[string]time.Time, from, snapshot time.Time) ([]store.AccountSnapshot, error) {
+	var snaps []store.AccountSnapshot
+	for _, s := range p.sessions {
+		var accounts questradeAccounts
+		if err := accountCall(ctx, s, p.rp, "v1/accounts", &accounts); err != nil {
+			return nil, err
+		}
+		for _, a := range accounts.Accounts {
+			start, ok := since[a.Number]
+			if !ok {
+				start = from
+			}
+			snap, err := extractAccount(ctx, s, p.rp, store.Account{Number: a.Number, Type: a.Type}, start, snapshot)
+			if err != nil {
+				return nil, err
+			}
+			snaps = append(snaps, snap)
+		}
+	}
+	return snaps, nil
+}
+
+// Fetch the positions and balances of an account, and its executions after
+// since up to the snapshot time.
+func extractAccount(ctx context.Context, s *questradeSession, rp RetryPolicy, account store.Account, since, snapshot time.Time) (store.AccountSnapshot, error) {
+	snap := store.AccountSnapshot{Account: account, Time: snapshot}
+	path := "v1/accounts/" + url.PathEscape(account.Number)
+
+	var positions questradePositions
+	if err := accountCall(ctx, s, rp, path+"/positions", &positions); err != nil {
+		return snap, err
+	}
+	for _, p := range positions.Positions {
+		snap.Positions = append(snap.Positions, store.Position{
+			SymbolID:     p.SymbolID,
+			Symbol:       p.Symbol,
+			Quantity:     p.OpenQuantity,
+			Price:        p.CurrentPrice,
+			MarketValue:  p.CurrentMarketValue,
+			AveragePrice: p.AverageEntryPrice,
+			TotalCost:    p.TotalCost,
+			OpenPnL:      p.OpenPnL,
+			ClosedPnL:    p.ClosedPnL,
+		})
+	}
+
+	var balances questradeBalances
+	if err := accountCall(ctx, s, rp, path+"/balances", &balances); err != nil {
+		return snap, err
+	}
+	for _, list := range []struct {
+		balances []questradeBalance
+		combined bool
+	}{{balances.PerCurrencyBalances, false}, {balances.CombinedBalances, true}} {
+		for _, b := range list.balances {
+			snap.Balances = append(snap.Balances, store.Balance{
+				Currency:          b.Currency,
+				Combined:          list.combined,
+				Cash:              b.Cash,
+				MarketValue:       b.MarketValue,
+				TotalEquity:       b.TotalEquity,
+				BuyingPower:       b.BuyingPower,
+				MaintenanceExcess: b.MaintenanceExcess,
+			})
+		}
+	}
+
+	q := url.Values{}
+	q.Set("startTime", since.Format(time.RFC3339))
+	q.Set("endTime", snapshot.Format(time.RFC3339))
+	var executions questradeExecutions
+	if err := accountCall(ctx, s, rp, path+"/executions?"+q.Encode(), &executions); err != nil {
+		return snap, err
+	}
+	for _, e := range executions.Executions {
+		// The start time is inclusive, so the latest stored execution comes back
+		if !e.Timestamp.After(since) {
+			continue
+		}
+		snap.Executions = append(snap.Executions, store.Execution{
+			ID:         e.ID,
+			OrderID:    e.OrderID,
+			SymbolID:   e.SymbolID,
+			Symbol:     e.Symbol,
+			Side:       e.Side,
+			Quantity:   e.Quantity,
+			Price:      e.Price,
+			Commission: e.Commission,
+			Fees:       e.ExecutionFee + e.SecFee + e.CanadianExecutionFee,
+			Venue:      e.Venue,
+			Time:       e.Timestamp,
+		})
+	}
+	return snap, nil
+}
+
+// Make a GET request to an account endpoint, limited separately from market
+// data calls.
+func accountCall(ctx context.Context, s *questradeSession, rp RetryPolicy, path string, out interface{}) error {
+	return rp.Do(ctx, func() error {
+		if err := s.rl.Wait(ctx, AccountCalls); err != nil {
+			return err
+		}
+		return s.call(ctx, AccountCalls, func(c *qapi.Client) error {
+			return questradeCall(c, "GET", path, nil, out)
+		})
+	})
+}
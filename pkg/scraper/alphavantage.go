@@ -0,0 +1,195 @@
+package scraper
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/alexurquhart/sp500scraper/pkg/store"
+)
+
+// Query endpoint of the Alpha Vantage API
+const alphaVantageURL = "https://www.alphavantage.co/query"
+
+// Alpha Vantage prices are in the exchange's time zone
+const alphaVantageZone = "America/New_York"
+
+// Compact responses cover the last 100 trading days, roughly this many
+// calendar days
+const alphaVantageCompactDays = 140
+
+// Error reported by Alpha Vantage. Requests over the limit still get a 200
+// response, with a note or information instead of the series.
+type alphaVantageError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e alphaVantageError) Error() string {
+	return fmt.Sprintf("Alpha Vantage error %d: %s", e.StatusCode, e.Message)
+}
+
+// Messages Alpha Vantage responds with in place of the data
+type alphaVantageStatus struct {
+	Error       string `json:"Error Message"`
+	Note        string `json:"Note"`
+	Information string `json:"Information"`
+}
+
+// Body of a TIME_SERIES_DAILY response, prices are strings keyed by date
+type alphaVantageSeries struct {
+	Series map[string]map[string]string `json:"Time Series (Daily)"`
+}
+
+// Provider backed by the daily series of the Alpha Vantage API, mostly used
+// as a fallback for symbols the main provider can't fetch. Only daily and
+// longer candles are served, weekly and monthly ones are resampled from the
+// daily series. Prices are not adjusted.
+type alphaVantageProvider struct {
+	key    string
+	client *http.Client
+	rl     *RateLimiter
+	rp     RetryPolicy
+}
+
+func newAlphaVantageProvider(key string, rp RetryPolicy, rate float64) (*alphaVantageProvider, error) {
+	if key == "" {
+		return nil, errors.New("Alpha Vantage needs an API key")
+	}
+	if rate <= 0 {
+		return nil, errors.New("The Alpha Vantage rate limit must be positive")
+	}
+	return &alphaVantageProvider{
+		key:    key,
+		client: &http.Client{Timeout: 30 * time.Second},
+		rl:     NewRateLimiter(rate, 1),
+		rp:     rp,
+	}, nil
+}
+
+func (p *alphaVantageProvider) RateLimits() []map[string]RateLimitState {
+	return []map[string]RateLimitState{p.rl.State()}
+}
+
+// Alpha Vantage identifies symbols by ticker, with the share class after a
+// dash like Yahoo.
+func (p *alphaVantageProvider) SearchSymbol(ctx context.Context, sym store.Symbol) (int, error) {
+	return tickerID(yahooTicker(sym.Symbol)), nil
+}
+
+func (p *alphaVantageProvider) GetCandles(ctx context.Context, sym store.Symbol, cr CandleRange) ([]store.Candle, error) {
+	switch cr.Interval {
+	case "OneDay", "OneWeek", "OneMonth":
+	default:
+		return nil, fmt.Errorf("Interval %s not supported by Alpha Vantage", cr.Interval)
+	}
+
+	q := url.Values{}
+	q.Set("function", "TIME_SERIES_DAILY")
+	q.Set("symbol", yahooTicker(sym.Symbol))
+	q.Set("outputsize", "compact")
+	if time.Since(cr.Start) > alphaVantageCompactDays*24*time.Hour {
+		q.Set("outputsize", "full")
+	}
+
+	var series alphaVantageSeries
+	err := p.rp.Do(ctx, func() error {
+		p.rl.waitCandles()
+		return p.get(q, &series)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	loc, err := time.LoadLocation(alphaVantageZone)
+	if err != nil {
+		loc = time.UTC
+	}
+	var candles []store.Candle
+	for date, bar := range series.Series {
+		start, err := time.ParseInLocation(DateFormat, date, loc)
+		if err != nil || start.Before(BucketStart(cr.Start.In(loc), "OneDay")) || !start.Before(cr.End) {
+			continue
+		}
+		c := store.Candle{Start: start, End: candleEnd(start, "OneDay"), Interval: "OneDay"}
+		if c.Open, err = alphaVantagePrice(bar["1. open"]); err != nil {
+			return nil, err
+		}
+		if c.High, err = alphaVantagePrice(bar["2. high"]); err != nil {
+			return nil, err
+		}
+		if c.Low, err = alphaVantagePrice(bar["3. low"]); err != nil {
+			return nil, err
+		}
+		if c.Close, err = alphaVantagePrice(bar["4. close"]); err != nil {
+			return nil, err
+		}
+		if c.Volume, err = strconv.Atoi(bar["5. volume"]); err != nil {
+			return nil, err
+		}
+		candles = append(candles, c)
+	}
+	sort.Slice(candles, func(i, j int) bool { return candles[i].Start.Before(candles[j].Start) })
+
+	// Combines the daily candles into weekly or monthly ones
+	return Resample(candles, cr.Interval), nil
+}
+
+func alphaVantagePrice(s string) (float32, error) {
+	f, err := strconv.ParseFloat(s, 32)
+	return float32(f), err
+}
+
+// Query the API and decode the JSON response into out.
+func (p *alphaVantageProvider) get(q url.Values, out interface{}) error {
+	body, err := p.query(q)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(body, out)
+}
+
+// Query the API with the key, turning the error messages and rate limit
+// notes Alpha Vantage responds with into errors. Endpoints that return CSV
+// still report these as JSON.
+func (p *alphaVantageProvider) query(q url.Values) ([]byte, error) {
+	q.Set("apikey", p.key)
+	res, err := p.client.Get(alphaVantageURL + "?" + q.Encode())
+	if err != nil {
+		return nil, redactKey(err, "apikey")
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, alphaVantageError{StatusCode: res.StatusCode, Message: res.Status}
+	}
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	if trimmed := bytes.TrimSpace(body); len(trimmed) == 0 || trimmed[0] != '{' {
+		return body, nil
+	}
+
+	var status alphaVantageStatus
+	if err := json.Unmarshal(body, &status); err != nil {
+		return nil, err
+	}
+	switch {
+	case status.Error != "":
+		return nil, alphaVantageError{StatusCode: http.StatusNotFound, Message: status.Error}
+	case status.Note != "":
+		return nil, alphaVantageError{StatusCode: http.StatusTooManyRequests, Message: status.Note}
+	case status.Information != "":
+		// The daily limit or a premium endpoint, neither helped by retrying
+		return nil, alphaVantageError{StatusCode: http.StatusForbidden, Message: status.Information}
+	}
+	return body, nil
+}
@@ -0,0 +1,226 @@
+package scraper
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alexurquhart/sp500scraper/pkg/store"
+)
+
+// Outcome of a backfill
+type BackfillSummary struct {
+	Run      int // ID of the run in the runs table
+	Jobs     int
+	Done     int
+	Failed   int
+	Candles  int
+	Duration time.Duration
+
+	// Set when the backfill was stopped before all jobs were attempted
+	Interrupted bool
+}
+
+// Split a range into windows of a calendar month each, in the time zone of
+// the range. The first and last windows are cut to the range.
+func monthWindows(cr CandleRange) []CandleRange {
+	var windows []CandleRange
+	for start := cr.Start; start.Before(cr.End); {
+		y, m, _ := start.Date()
+		end := time.Date(y, m+1, 1, 0, 0, 0, 0, start.Location())
+		if end.After(cr.End) {
+			end = cr.End
+		}
+		windows = append(windows, CandleRange{Start: start, End: end, Interval: cr.Interval})
+		start = end
+	}
+	return windows
+}
+
+// Plan a backfill of the ranges for every symbol, adding a pending job to
+// the backfill_jobs table for each month of each range. Windows already
+// planned are left as they are, so planning the same backfill again only
+// adds what is new. Returns the number of jobs added.
+func PlanBackfill(st store.Store, symbols []store.Symbol, ranges []CandleRange) (int, error) {
+	now := time.Now()
+	var jobs []store.BackfillJob
+	for _, sym := range symbols {
+		for _, cr := range ranges {
+			for _, w := range monthWindows(cr) {
+				jobs = append(jobs, store.BackfillJob{
+					Symbol:   sym.Symbol,
+					Exchange: sym.Exchange,
+					Interval: w.Interval,
+					Start:    w.Start,
+					End:      w.End,
+					Status:   store.JobPending,
+					Updated:  now,
+				})
+			}
+		}
+	}
+	return st.AddBackfillJobs(jobs)
+}
+
+// Work through the planned backfill jobs that are not done yet and have
+// been attempted fewer than maxAttempts times, fetching and saving one
+// window at a time with a pool of workers. Each job is marked done once its
+// candles are saved, or failed with the error, so an interrupted backfill
+// carries on where it stopped. Jobs abandoned because the context was
+// cancelled stay pending.
+//
+// The name and industry of each symbol are taken from symbols, or from the
+// store for symbols that are no longer listed, so saving a window doesn't
+// blank them.
+func (s *Scraper) Backfill(ctx context.Context, symbols []store.Symbol, maxAttempts int) (BackfillSummary, error) {
+	p, st, rc := s.Provider, s.Store, s.Config
+	began := time.Now()
+	var sum BackfillSummary
+
+	jobs, err := st.PendingBackfillJobs(maxAttempts)
+	if err != nil {
+		return sum, err
+	}
+	sum.Jobs = len(jobs)
+	if len(jobs) == 0 {
+		return sum, nil
+	}
+
+	stored, err := st.Symbols()
+	if err != nil {
+		return sum, err
+	}
+	byKey := make(map[string]store.Symbol, len(stored)+len(symbols))
+	for _, sym := range stored {
+		byKey[sym.Key()] = sym
+	}
+	for _, sym := range symbols {
+		if old, ok := byKey[sym.Key()]; ok && sym.SymbolID == 0 {
+			sym.SymbolID, sym.Resolved = old.SymbolID, old.Resolved
+		}
+		byKey[sym.Key()] = sym
+	}
+
+	seen := make(map[string]bool)
+	var intervals []string
+	for _, j := range jobs {
+		if !seen[j.Interval] {
+			seen[j.Interval] = true
+			intervals = append(intervals, j.Interval)
+		}
+	}
+	run := store.Run{Started: began, Interval: strings.Join(intervals, ","), Provider: rc.Provider, Version: rc.Version, Symbols: len(jobs)}
+	if run.ID, err = st.StartRun(run); err != nil {
+		return sum, err
+	}
+	sum.Run = run.ID
+
+	// Stores with a single writer get their saves one at a time
+	single := false
+	if wl, ok := st.(store.WriterLimiter); ok && wl.MaxWriters() == 1 {
+		single = true
+	}
+
+	n := rc.Workers
+	if n < 1 {
+		n = 1
+	}
+	var mu sync.Mutex // Guards the summary and the symbols, whose IDs are found once
+	var saveMu sync.Mutex
+	var wg sync.WaitGroup
+	jobChan := make(chan store.BackfillJob)
+	wg.Add(n)
+	for i := 0; i < n; i++ {
+		go func() {
+			defer wg.Done()
+			for job := range jobChan {
+				mu.Lock()
+				sym, ok := byKey[job.Symbol+":"+job.Exchange]
+				mu.Unlock()
+				if !ok {
+					sym = store.Symbol{Symbol: job.Symbol, Exchange: job.Exchange}
+				}
+				sym.Run = run.ID
+
+				ranges := []CandleRange{{Start: job.Start, End: job.End, Interval: job.Interval}}
+				err := findSymbol(ctx, p, &sym, ranges)
+				if err == context.Canceled {
+					continue
+				}
+				if err == nil {
+					mu.Lock()
+					key := sym.Key()
+					known := byKey[key]
+					known.Symbol, known.Exchange = sym.Symbol, sym.Exchange
+					known.SymbolID, known.Resolved = sym.SymbolID, sym.Resolved
+					byKey[key] = known
+					mu.Unlock()
+
+					if sym.Candles, sym.Issues = validateCandles(sym.Candles, ranges); len(sym.Issues) > 0 {
+						candlesRejected.Add(float64(len(sym.Issues)))
+						slog.Warn("Rejected invalid candles", "symbol", sym.Symbol, "exchange", sym.Exchange, "issues", len(sym.Issues), "first", sym.Issues[0].Problem)
+					}
+					if single {
+						saveMu.Lock()
+					}
+					err = st.SaveSymbol(sym)
+					if single {
+						saveMu.Unlock()
+					}
+				}
+
+				job.Attempts++
+				job.Updated = time.Now()
+				if err != nil {
+					slog.Warn("Backfill job failed", "symbol", job.Symbol, "exchange", job.Exchange, "interval", job.Interval,
+						"start", job.Start.Format(DateFormat), "attempts", job.Attempts, "error", err)
+					job.Status, job.Error = store.JobFailed, err.Error()
+				} else {
+					writeSinks(s.Sinks, sym)
+					candlesStored.Add(float64(len(sym.Candles)))
+					slog.Info("Backfilled window", "symbol", job.Symbol, "exchange", job.Exchange, "interval", job.Interval,
+						"start", job.Start.Format(DateFormat), "candles", len(sym.Candles))
+					job.Status, job.Error = store.JobDone, ""
+				}
+				if err := st.UpdateBackfillJob(job); err != nil {
+					DBErrors.Inc()
+					slog.Error("Could not record backfill job", "symbol", job.Symbol, "exchange", job.Exchange, "error", err)
+				}
+
+				mu.Lock()
+				if job.Status == store.JobDone {
+					sum.Done++
+					sum.Candles += len(sym.Candles)
+				} else {
+					sum.Failed++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+L:
+	for _, job := range jobs {
+		select {
+		case jobChan <- job:
+		case <-ctx.Done():
+			break L
+		}
+	}
+	close(jobChan)
+	wg.Wait()
+	// Workers drop the jobs they were given after a cancel too
+	sum.Interrupted = sum.Done+sum.Failed < sum.Jobs
+
+	sum.Duration = time.Since(began)
+	run.Finished = time.Now()
+	run.Failed = sum.Failed
+	run.Candles = sum.Candles
+	if err := st.FinishRun(run); err != nil {
+		DBErrors.Inc()
+		slog.Error("Could not record run", "error", err)
+	}
+	return sum, nil
+}
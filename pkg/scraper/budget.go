@@ -0,0 +1,121 @@
+package scraper
+
+import (
+	"context"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"github.com/alexurquhart/sp500scraper/pkg/store"
+)
+
+// Market data calls Questrade allows each account per hour
+const HourlyCallBudget = 15000
+
+// CallBudgeter is implemented by providers that limit the calls made in a
+// window of time, reporting the calls left in the current window across
+// every account and when the window resets.
+type CallBudgeter interface {
+	CallBudget() (remaining int, reset time.Time)
+}
+
+// Counts the API calls made with a context, and adds them to the counter of
+// the context it was derived from, so a symbol's calls also count towards
+// those of its run
+type callCounter struct {
+	n      int64
+	parent *callCounter
+}
+
+type callCounterKey struct{}
+
+// Derive a context counting the calls made with it.
+func withCallCounter(ctx context.Context) (context.Context, *callCounter) {
+	parent, _ := ctx.Value(callCounterKey{}).(*callCounter)
+	c := &callCounter{parent: parent}
+	return context.WithValue(ctx, callCounterKey{}, c), c
+}
+
+// Count a call made with the context, retries included.
+func countCall(ctx context.Context) {
+	apiCalls.Inc()
+	c, _ := ctx.Value(callCounterKey{}).(*callCounter)
+	for ; c != nil; c = c.parent {
+		atomic.AddInt64(&c.n, 1)
+	}
+}
+
+func (c *callCounter) calls() int {
+	return int(atomic.LoadInt64(&c.n))
+}
+
+// Calls a job is expected to make: a search unless the symbol's ID is
+// known, and a request per window of each range. Retries, details and
+// options aren't counted.
+func estimateCalls(job fetchJob) int {
+	n := 0
+	if job.Symbol.SymbolID == 0 {
+		n++
+	}
+	for _, cr := range job.Ranges {
+		n += len(chunkRange(cr))
+	}
+	return n
+}
+
+func (p *questradeProvider) CallBudget() (int, time.Time) {
+	now := time.Now()
+	remaining, reset := 0, now.Add(time.Hour)
+	for _, s := range p.sessions {
+		st, ok := s.rl.State()[MarketCalls]
+		if !ok || st.Remaining == nil || !st.Reset.After(now) {
+			// No calls made yet, so the whole hour is left
+			remaining += HourlyCallBudget
+			continue
+		}
+		remaining += *st.Remaining
+		if st.Reset.Before(reset) {
+			reset = *st.Reset
+		}
+	}
+	return remaining, reset
+}
+
+// Failure queuing a symbol left out of a run to stay within the budget, so
+// the next run fetches it first
+func deferredFailure(sym store.Symbol) store.Failure {
+	return store.Failure{Symbol: sym.Symbol, Exchange: sym.Exchange, Reason: "Deferred to stay within the API call budget",
+		Time: time.Now(), Class: FailureDeferred}
+}
+
+// Weigh the calls the jobs are expected to make against the calls left in
+// the provider's window and log whether the run will fit. Over budget, the
+// jobs that don't fit are returned separately with DeferOverBudget set,
+// taken from the end so symbols queued by earlier runs still go first.
+func (s *Scraper) budget(jobs []fetchJob) ([]fetchJob, []fetchJob) {
+	cb, ok := s.Provider.(CallBudgeter)
+	if !ok {
+		return jobs, nil
+	}
+	remaining, reset := cb.CallBudget()
+	total := 0
+	fit := len(jobs)
+	for i, job := range jobs {
+		total += estimateCalls(job)
+		if total > remaining && fit == len(jobs) {
+			fit = i
+		}
+	}
+	if total <= remaining {
+		slog.Info("Run fits within the API call budget", "calls", total, "remaining", remaining, "reset", reset)
+		return jobs, nil
+	}
+	if !s.Config.DeferOverBudget {
+		slog.Warn("Run will exceed the API call budget and wait for the next window", "calls", total, "remaining", remaining,
+			"reset", reset)
+		return jobs, nil
+	}
+	slog.Warn("Run would exceed the API call budget, deferring symbols to the next run", "calls", total, "remaining", remaining,
+		"reset", reset, "deferred", len(jobs)-fit)
+	return jobs[:fit], jobs[fit:]
+}
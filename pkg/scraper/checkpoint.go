@@ -0,0 +1,79 @@
+package scraper
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sync"
+)
+
+// Checkpoint records which symbols have been saved by a run so that an
+// interrupted run can be resumed. A checkpoint only applies to runs with
+// the same range flags as the run that wrote it.
+type Checkpoint struct {
+	Key   string          `json:"key"`
+	Saved map[string]bool `json:"saved"`
+
+	path string
+	mu   sync.Mutex
+}
+
+// Load the checkpoint at path. When resume is false, or the file is missing
+// or was written for a different key, an empty checkpoint is returned.
+func loadCheckpoint(path, key string, resume bool) (*Checkpoint, error) {
+	cp := &Checkpoint{Key: key, Saved: make(map[string]bool), path: path}
+	if !resume {
+		return cp, nil
+	}
+
+	file, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return cp, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var saved Checkpoint
+	if err := json.Unmarshal(file, &saved); err != nil {
+		return nil, err
+	}
+	if saved.Key == key && saved.Saved != nil {
+		cp.Saved = saved.Saved
+	}
+	return cp, nil
+}
+
+// Whether the symbol with the key, see store.Symbol.Key, was saved by a
+// previous run.
+func (c *Checkpoint) Done(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.Saved[key]
+}
+
+// Mark the symbol with the key as saved and write the checkpoint to disk. The file is
+// replaced atomically so a crash never leaves a partial checkpoint.
+func (c *Checkpoint) Add(key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Saved[key] = true
+
+	out, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	tmp := c.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, out, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.path)
+}
+
+// Remove the checkpoint once a run has completed.
+func (c *Checkpoint) Remove() error {
+	err := os.Remove(c.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
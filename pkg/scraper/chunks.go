@@ -0,0 +1,40 @@
+package scraper
+
+import "time"
+
+// Questrade returns at most this many candles per request
+const maxCandlesPerRequest = 2000
+
+// Approximate length of a candle. Calendar intervals use their longest
+// length so that a window never holds more candles than expected.
+func intervalLength(interval string) time.Duration {
+	switch interval {
+	case "OneDay":
+		return 24 * time.Hour
+	case "OneWeek":
+		return 7 * 24 * time.Hour
+	case "OneMonth":
+		return 31 * 24 * time.Hour
+	}
+	return intervalDurations[interval]
+}
+
+// Split a range into consecutive windows that each fit in a single request.
+// Windows are measured in wall clock time, including hours the market is
+// closed, so they are conservative for intraday intervals.
+func chunkRange(cr CandleRange) []CandleRange {
+	window := intervalLength(cr.Interval) * maxCandlesPerRequest
+	if window <= 0 {
+		return []CandleRange{cr}
+	}
+
+	var chunks []CandleRange
+	for start := cr.Start; start.Before(cr.End); start = start.Add(window) {
+		end := start.Add(window)
+		if end.After(cr.End) {
+			end = cr.End
+		}
+		chunks = append(chunks, CandleRange{Start: start, End: end, Interval: cr.Interval})
+	}
+	return chunks
+}
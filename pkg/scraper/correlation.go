@@ -0,0 +1,158 @@
+package scraper
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/alexurquhart/sp500scraper/pkg/store"
+)
+
+// Fewest daily returns two symbols must share for their correlation
+const minOverlap = 20
+
+// Pairwise correlations of the daily returns of the symbols. Values[i][j] is
+// the correlation of Symbols[i] and Symbols[j], NaN when they share too few
+// days.
+type CorrelationMatrix struct {
+	End     time.Time // Last day of the window
+	Window  int
+	Symbols []store.Symbol
+	Values  [][]float64
+}
+
+// Correlate the daily log returns of every stored symbol over the last
+// window trading days before end, the days any symbol has a candle. Returns
+// are taken from the daily candles, or the finest intraday ones if there are
+// none, adjusted for splits as for AdjustSplits. Each pair is correlated over
+// the days both have returns, and symbols without a return in the window are
+// left out.
+func Correlate(st store.Store, splitsPath string, end time.Time, window int) (CorrelationMatrix, error) {
+	m := CorrelationMatrix{End: end, Window: window}
+	if window < 2 {
+		return m, errors.New("The correlation window must be at least 2 days")
+	}
+	entries, err := loadSplits(splitsPath)
+	if err != nil {
+		return m, err
+	}
+	symbols, err := st.Symbols()
+	if err != nil {
+		return m, err
+	}
+	intervals, err := st.Intervals()
+	if err != nil {
+		return m, err
+	}
+	daily := dailyInterval(intervals)
+	if daily == "" {
+		return m, errors.New("No daily or intraday candles to correlate")
+	}
+
+	// Enough calendar days to cover the window with weekends and holidays,
+	// plus the close before the first day
+	start := end.AddDate(0, 0, -(window*7/5 + 30))
+	var returns []map[time.Time]float64
+	days := make(map[time.Time]bool)
+	for _, sym := range symbols {
+		candles, err := st.Candles(sym.SymbolID, daily, start, end)
+		if err != nil {
+			return m, err
+		}
+		if splits := symbolSplits(entries, sym, candles); len(splits) > 0 {
+			candles = adjustCandles(candles, splits)
+		}
+		r := make(map[time.Time]float64)
+		for _, d := range dailyReturns(dailyBars(candles)) {
+			if d.LogReturn != nil {
+				r[d.Date] = *d.LogReturn
+				days[d.Date] = true
+			}
+		}
+		m.Symbols = append(m.Symbols, sym)
+		returns = append(returns, r)
+	}
+
+	// Keep the last window days, dropping returns before them
+	sorted := make([]time.Time, 0, len(days))
+	for d := range days {
+		sorted = append(sorted, d)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Before(sorted[j]) })
+	if len(sorted) > window {
+		sorted = sorted[len(sorted)-window:]
+	}
+	if len(sorted) > 0 {
+		m.End = sorted[len(sorted)-1]
+	}
+	var kept []store.Symbol
+	var series [][]float64 // Return of each kept symbol on each day, NaN if none
+	for i, r := range returns {
+		s := make([]float64, len(sorted))
+		found := false
+		for j, d := range sorted {
+			v, ok := r[d]
+			if !ok {
+				v = math.NaN()
+			}
+			s[j], found = v, found || ok
+		}
+		if found {
+			kept = append(kept, m.Symbols[i])
+			series = append(series, s)
+		}
+	}
+	m.Symbols = kept
+
+	m.Values = make([][]float64, len(series))
+	for i := range series {
+		m.Values[i] = make([]float64, len(series))
+		m.Values[i][i] = 1
+		for j := 0; j < i; j++ {
+			c := correlation(series[i], series[j])
+			m.Values[i][j], m.Values[j][i] = c, c
+		}
+	}
+	return m, nil
+}
+
+// Correlations of each pair of symbols, by symbol ID, leaving out the pairs
+// without one.
+func (m CorrelationMatrix) Pairs() []store.Correlation {
+	var pairs []store.Correlation
+	for i := range m.Values {
+		for j := i + 1; j < len(m.Values); j++ {
+			if v := m.Values[i][j]; !math.IsNaN(v) {
+				pairs = append(pairs, store.Correlation{A: m.Symbols[i].SymbolID, B: m.Symbols[j].SymbolID, Value: v})
+			}
+		}
+	}
+	return pairs
+}
+
+// Pearson correlation of the points where both series have a value, NaN if
+// there are fewer than minOverlap or either doesn't vary.
+func correlation(a, b []float64) float64 {
+	var n, sa, sb, saa, sbb, sab float64
+	for i := range a {
+		if math.IsNaN(a[i]) || math.IsNaN(b[i]) {
+			continue
+		}
+		n++
+		sa += a[i]
+		sb += b[i]
+		saa += a[i] * a[i]
+		sbb += b[i] * b[i]
+		sab += a[i] * b[i]
+	}
+	if n < minOverlap {
+		return math.NaN()
+	}
+	cov := sab - sa*sb/n
+	va, vb := saa-sa*sa/n, sbb-sb*sb/n
+	if va <= 0 || vb <= 0 {
+		return math.NaN()
+	}
+	return cov / math.Sqrt(va*vb)
+}
@@ -0,0 +1,186 @@
+package scraper
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/alexurquhart/qapi"
+	"github.com/zalando/go-keyring"
+)
+
+// Contents of the credentials file. Questrade refresh tokens can only be
+// used once, so the rotated token is written back after every login.
+type credentials struct {
+	RefreshToken string    `json:"refresh_token"`
+	Updated      time.Time `json:"updated"`
+}
+
+// Service the refresh tokens are saved under in the OS keyring
+const keyringService = "sp500scraper"
+
+// Credentials path that keeps the refresh token in the OS keyring instead of
+// a file: the macOS Keychain, the Secret Service on Linux or the Windows
+// Credential Manager. "keyring:<name>" saves it under another name.
+const KeyringCredentials = "keyring"
+
+// Name the token of a credentials path is saved under in the keyring, if the
+// path is a keyring one.
+func keyringAccount(path string) (string, bool) {
+	if path == KeyringCredentials {
+		return "questrade", true
+	}
+	if strings.HasPrefix(path, KeyringCredentials+":") {
+		return strings.TrimPrefix(path, KeyringCredentials+":"), true
+	}
+	return "", false
+}
+
+// Login with the refresh token in the env environment variable, falling
+// back to the one in the credentials file or keyring. The environment takes
+// precedence so a new token can be supplied when the saved one has expired.
+// The rotated token is saved back to where the saved one came from. Tokens
+// are issued for either the practice or the live server, and only work with
+// that one.
+func NewClient(path, env string, live bool) (*qapi.Client, error) {
+	var tokens []string
+	if token := os.Getenv(env); token != "" {
+		tokens = append(tokens, token)
+	}
+	token, err := readRefreshToken(path)
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		tokens = append(tokens, token)
+	}
+	if len(tokens) == 0 {
+		if _, ok := keyringAccount(path); ok {
+			return nil, errors.New("No refresh token, set " + env + " or save one with the login command")
+		}
+		return nil, errors.New("No refresh token, set " + env + " or create " + path)
+	}
+	return login(path, tokens, live)
+}
+
+// Login with the given refresh token, saving the rotated one to the
+// credentials file or keyring. Used to seed the credentials.
+func Login(path, token string, live bool) (*qapi.Client, error) {
+	return login(path, []string{token}, live)
+}
+
+// Try each token in turn until one logs in.
+func login(path string, tokens []string, live bool) (*qapi.Client, error) {
+	slog.Info("Logging in to Questrade", "server", ServerName(live))
+	var err error
+	for _, token := range tokens {
+		var c *qapi.Client
+		if c, err = qapi.NewClient(token, !live); err == nil {
+			return c, saveRefreshToken(path, c.Credentials.RefreshToken)
+		}
+	}
+	return nil, err
+}
+
+// Saved refresh token of a credentials path, empty if there isn't one.
+func readRefreshToken(path string) (string, error) {
+	var file []byte
+	if account, ok := keyringAccount(path); ok {
+		secret, err := keyring.Get(keyringService, account)
+		if err == keyring.ErrNotFound {
+			return "", nil
+		} else if err != nil {
+			return "", errors.New("Could not read the keyring: " + err.Error())
+		}
+		file = []byte(secret)
+	} else {
+		var err error
+		if file, err = ioutil.ReadFile(path); os.IsNotExist(err) {
+			return "", nil
+		} else if err != nil {
+			return "", err
+		}
+	}
+
+	var creds credentials
+	if err := json.Unmarshal(file, &creds); err != nil {
+		return "", err
+	}
+	return creds.RefreshToken, nil
+}
+
+// Credentials file and environment variable of a profile. Each profile's
+// token is kept next to the default credentials file, e.g. the token of
+// profile "backfill" is read from REFRESH_TOKEN_BACKFILL and saved to
+// credentials.backfill.json, or under questrade.backfill in the keyring. The
+// empty profile uses the default ones.
+func profileCredentials(path, profile string) (string, string) {
+	if profile == "" {
+		return path, "REFRESH_TOKEN"
+	}
+	if account, ok := keyringAccount(path); ok {
+		path = KeyringCredentials + ":" + account
+	}
+	ext := filepath.Ext(path)
+	env := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToUpper(r)
+		}
+		return '_'
+	}, profile)
+	return strings.TrimSuffix(path, ext) + "." + profile + ext, "REFRESH_TOKEN_" + env
+}
+
+// Credentials file or keyring name the token of a profile is saved to.
+func ProfileCredentials(path, profile string) string {
+	path, _ = profileCredentials(path, profile)
+	return path
+}
+
+// Write the refresh token to the credentials file, readable only by the
+// current user, or to the keyring.
+func saveRefreshToken(path, token string) error {
+	out, err := json.MarshalIndent(credentials{RefreshToken: token, Updated: time.Now()}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if account, ok := keyringAccount(path); ok {
+		if err := keyring.Set(keyringService, account, string(out)); err != nil {
+			return errors.New("Could not save to the keyring: " + err.Error())
+		}
+		return nil
+	}
+
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, out, 0600); err != nil {
+		return err
+	}
+	// WriteFile doesn't change the mode of an existing file
+	if err := os.Chmod(tmp, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Login to the same server again and save the new refresh token.
+func Relogin(c *qapi.Client, path string, live bool) error {
+	slog.Info("Logging in again", "server", ServerName(live))
+	if err := c.Login(!live); err != nil {
+		return err
+	}
+	return saveRefreshToken(path, c.Credentials.RefreshToken)
+}
+
+// Name of the Questrade server, live or practice.
+func ServerName(live bool) string {
+	if live {
+		return "live"
+	}
+	return "practice"
+}
@@ -0,0 +1,204 @@
+package scraper
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alexurquhart/sp500scraper/pkg/store"
+)
+
+// Daily dumps are dated in the exchange's time zone
+const csvZone = "America/New_York"
+
+// Date formats of the files, Stooq's bulk dumps use the first
+var csvDateFormats = []string{"20060102", DateFormat}
+
+// Provider reading daily candles from a directory of CSV files, such as
+// Stooq's bulk dumps or files downloaded from a site or exported by another
+// tool, so a database can be seeded without API access. Files are found
+// anywhere under the directory and named after their ticker, as in aapl.csv
+// or Stooq's aapl.us.txt, with any market suffix ignored. Columns are found
+// by their names in the header, with or without Stooq's angle brackets:
+// date, open, high, low and close are needed, volume and adj close are read
+// if present. Rows whose per column isn't D are skipped, so only daily
+// candles are read, which weekly and monthly ones are built from.
+type csvProvider struct {
+	files map[string]string // Path by ticker, as returned by csvTicker
+}
+
+func newCSVProvider(dir string) (*csvProvider, error) {
+	if dir == "" {
+		return nil, errors.New("The CSV provider needs a directory")
+	}
+	p := &csvProvider{files: make(map[string]string)}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".csv", ".txt":
+		default:
+			return nil
+		}
+		ticker := csvTicker(strings.SplitN(filepath.Base(path), ".", 2)[0])
+		if _, ok := p.files[ticker]; !ok {
+			p.files[ticker] = path
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(p.files) == 0 {
+		return nil, errors.New("No CSV files found in " + dir)
+	}
+	return p, nil
+}
+
+// Ticker a file is looked up by, upper case with the share class after a
+// dash like Yahoo and Stooq.
+func csvTicker(ticker string) string {
+	return strings.ToUpper(yahooTicker(ticker))
+}
+
+// The ID matches that of Yahoo, and the other providers that share it, so
+// an API provider can go on updating the seeded candles.
+func (p *csvProvider) SearchSymbol(ctx context.Context, sym store.Symbol) (int, error) {
+	if _, ok := p.files[csvTicker(sym.Symbol)]; !ok {
+		// Not ErrSymbolNotFound, which would mark the symbol delisted
+		return 0, errors.New("No CSV file for " + sym.Symbol)
+	}
+	return tickerID(yahooTicker(sym.Symbol)), nil
+}
+
+func (p *csvProvider) GetCandles(ctx context.Context, sym store.Symbol, cr CandleRange) ([]store.Candle, error) {
+	switch cr.Interval {
+	case "OneDay", "OneWeek", "OneMonth":
+	default:
+		return nil, fmt.Errorf("Interval %s not supported by CSV files", cr.Interval)
+	}
+	path, ok := p.files[csvTicker(sym.Symbol)]
+	if !ok {
+		return nil, errors.New("No CSV file for " + sym.Symbol)
+	}
+
+	loc, err := time.LoadLocation(csvZone)
+	if err != nil {
+		loc = time.UTC
+	}
+	candles, err := readDailyCSV(path, loc)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	from := BucketStart(cr.Start.In(loc), "OneDay")
+	var out []store.Candle
+	for _, c := range candles {
+		if !c.Start.Before(from) && c.Start.Before(cr.End) {
+			out = append(out, c)
+		}
+	}
+	// Combines the daily candles into weekly or monthly ones
+	return Resample(out, cr.Interval), nil
+}
+
+// Daily candles of a CSV file, oldest first.
+func readDailyCSV(path string, loc *time.Location) ([]store.Candle, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	header, err := r.Read()
+	if err != nil {
+		return nil, err
+	}
+	cols := make(map[string]int)
+	for i, name := range header {
+		cols[strings.ToLower(strings.Trim(strings.TrimSpace(name), "<>"))] = i
+	}
+	col := func(names ...string) int {
+		for _, n := range names {
+			if i, ok := cols[n]; ok {
+				return i
+			}
+		}
+		return -1
+	}
+	date, open, high, low, cls := col("date"), col("open"), col("high"), col("low"), col("close")
+	volume, adjClose, per := col("volume", "vol"), col("adj close", "adjclose", "adj_close"), col("per")
+	if date < 0 || open < 0 || high < 0 || low < 0 || cls < 0 {
+		return nil, errors.New("Missing date, open, high, low or close column")
+	}
+
+	var candles []store.Candle
+	for {
+		row, err := r.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		field := func(i int) string {
+			if i < 0 || i >= len(row) {
+				return ""
+			}
+			return strings.TrimSpace(row[i])
+		}
+		if p := field(per); p != "" && p != "D" {
+			continue
+		}
+
+		start, err := parseCSVDate(field(date), loc)
+		if err != nil {
+			return nil, err
+		}
+		c := store.Candle{Start: start, End: candleEnd(start, "OneDay"), Interval: "OneDay"}
+		for _, v := range []struct {
+			col int
+			to  *float32
+		}{{open, &c.Open}, {high, &c.High}, {low, &c.Low}, {cls, &c.Close}, {adjClose, &c.AdjClose}} {
+			if v.col < 0 {
+				continue
+			}
+			f, err := strconv.ParseFloat(field(v.col), 32)
+			if err != nil {
+				return nil, err
+			}
+			*v.to = float32(f)
+		}
+		if s := field(volume); s != "" {
+			// Some dumps write volume with a decimal point
+			v, err := strconv.ParseFloat(s, 64)
+			if err != nil {
+				return nil, err
+			}
+			c.Volume = int(v)
+		}
+		candles = append(candles, c)
+	}
+	sort.Slice(candles, func(i, j int) bool { return candles[i].Start.Before(candles[j].Start) })
+	return candles, nil
+}
+
+func parseCSVDate(s string, loc *time.Location) (time.Time, error) {
+	var err error
+	for _, layout := range csvDateFormats {
+		var t time.Time
+		if t, err = time.ParseInLocation(layout, s, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, err
+}
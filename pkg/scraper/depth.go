@@ -0,0 +1,66 @@
+package scraper
+
+import (
+	"context"
+	"time"
+
+	"github.com/alexurquhart/qapi"
+	"github.com/alexurquhart/sp500scraper/pkg/store"
+)
+
+// DepthProvider is implemented by providers that report the order book of a
+// symbol
+type DepthProvider interface {
+	// Bid and ask ladders of the symbols with the given IDs at the snapshot
+	// time
+	GetDepth(ctx context.Context, ids []int, snapshot time.Time) ([]store.DepthLevel, error)
+}
+
+// Symbols Questrade quotes per request
+const maxQuotes = 100
+
+// Questrade's API only quotes the top of the book, so its ladders have a
+// single level on each side.
+func (p *questradeProvider) GetDepth(ctx context.Context, ids []int, snapshot time.Time) ([]store.DepthLevel, error) {
+	quotes, err := p.quotes(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	var levels []store.DepthLevel
+	for _, q := range quotes {
+		if q.BidSize > 0 {
+			levels = append(levels, store.DepthLevel{SymbolID: q.SymbolID, Snapshot: snapshot, Side: "bid", Price: q.BidPrice, Size: q.BidSize})
+		}
+		if q.AskSize > 0 {
+			levels = append(levels, store.DepthLevel{SymbolID: q.SymbolID, Snapshot: snapshot, Side: "ask", Price: q.AskPrice, Size: q.AskSize})
+		}
+	}
+	return levels, nil
+}
+
+// Quotes of the symbols with the given IDs, requested maxQuotes at a time.
+func (p *questradeProvider) quotes(ctx context.Context, ids []int) ([]qapi.Quote, error) {
+	s := p.session()
+	var quotes []qapi.Quote
+	for i := 0; i < len(ids); i += maxQuotes {
+		batch := ids[i:]
+		if len(batch) > maxQuotes {
+			batch = batch[:maxQuotes]
+		}
+		var res []qapi.Quote
+		err := p.rp.Do(ctx, func() error {
+			if err := s.rl.Wait(ctx, MarketCalls); err != nil {
+				return err
+			}
+			return s.call(ctx, MarketCalls, func(c *qapi.Client) (err error) {
+				res, err = c.GetQuotes(batch...)
+				return err
+			})
+		})
+		if err != nil {
+			return nil, err
+		}
+		quotes = append(quotes, res...)
+	}
+	return quotes, nil
+}
@@ -0,0 +1,86 @@
+package scraper
+
+import (
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/alexurquhart/sp500scraper/pkg/store"
+)
+
+// Intervals that can be built from the stored daily candles instead of
+// being fetched
+var derivedIntervals = map[string]bool{"OneWeek": true, "OneMonth": true}
+
+// Check the intervals can be derived, from daily candles the run fetches.
+func ValidateDerived(derive, fetched []string) error {
+	daily := false
+	for _, i := range fetched {
+		if derivedIntervals[i] {
+			for _, d := range derive {
+				if d == i {
+					return errors.New("Interval " + i + " can't be both fetched and derived")
+				}
+			}
+		}
+		daily = daily || i == "OneDay"
+	}
+	for _, d := range derive {
+		if !derivedIntervals[d] {
+			return errors.New("Only OneWeek and OneMonth candles can be derived, not " + d)
+		}
+	}
+	if len(derive) > 0 && !daily {
+		return errors.New("Derived candles are built from daily ones, so OneDay needs to be fetched")
+	}
+	return nil
+}
+
+// Rebuild the derived candles of the intervals from the stored daily
+// candles of every symbol that saved daily candles in the run. Only the
+// buckets from the one holding the earliest daily candle the run saved are
+// rebuilt, so a new day extends the current week and month and a restated
+// day corrects the buckets it falls in. Symbols with no candles of an
+// interval yet get their whole history built.
+func DeriveCandles(st store.Store, run int, intervals []string) error {
+	starts, err := st.RunCandleStarts(run, "OneDay")
+	if err != nil || len(starts) == 0 {
+		return err
+	}
+	symbols, err := st.Symbols()
+	if err != nil {
+		return err
+	}
+	byID := make(map[int]store.Symbol, len(symbols))
+	for _, sym := range symbols {
+		byID[sym.SymbolID] = sym
+	}
+
+	for _, interval := range intervals {
+		latest, err := st.LatestCandles(interval)
+		if err != nil {
+			return err
+		}
+		derived := 0
+		for id, start := range starts {
+			from := BucketStart(start, interval)
+			if _, ok := latest[byID[id].Key()]; !ok {
+				from = time.Time{}
+			}
+			daily, err := st.Candles(id, "OneDay", from, time.Now().AddDate(1, 0, 0))
+			if err != nil {
+				return err
+			}
+			candles := Resample(daily, interval)
+			for i := range candles {
+				candles[i].Derived = true
+			}
+			if err := st.SaveDerived(id, run, candles); err != nil {
+				return err
+			}
+			derived += len(candles)
+		}
+		slog.Info("Derived candles", "interval", interval, "symbols", len(starts), "candles", derived)
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package scraper
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/alexurquhart/qapi"
+	"github.com/alexurquhart/sp500scraper/pkg/store"
+)
+
+// Dividend declared for a symbol
+type Dividend struct {
+	ExDate  time.Time `json:"exdate"`
+	PayDate time.Time `json:"paydate"`
+	Amount  float32   `json:"amount"`
+}
+
+// Snapshot of the fundamentals of a symbol on a given day
+type Fundamentals struct {
+	Date              time.Time `json:"date"`
+	MarketCap         float64   `json:"marketcap"`
+	PE                float32   `json:"pe"`
+	EPS               float32   `json:"eps"`
+	Yield             float32   `json:"yield"`
+	Dividend          float32   `json:"dividend"`
+	OutstandingShares int       `json:"outstandingshares"`
+	High52            float32   `json:"high52"`
+	Low52             float32   `json:"low52"`
+	AverageVol3Months int       `json:"averagevol3months"`
+}
+
+// Fetch the symbol detail record, which holds the latest dividend and the
+// fundamentals of a symbol.
+func extractDetails(ctx context.Context, s *questradeSession, rp RetryPolicy, id int) (qapi.Symbol, error) {
+	var details []qapi.Symbol
+	err := rp.Do(ctx, func() error {
+		if err := s.rl.Wait(ctx, MarketCalls); err != nil {
+			return err
+		}
+		return s.call(ctx, MarketCalls, func(c *qapi.Client) (err error) {
+			details, err = c.GetSymbols([]int{id}, nil)
+			return err
+		})
+	})
+	if err != nil {
+		return qapi.Symbol{}, err
+	}
+
+	for _, d := range details {
+		if d.SymbolID == id {
+			return d, nil
+		}
+	}
+	return qapi.Symbol{}, errors.New("No symbol details returned")
+}
+
+// Questrade only reports the most recent dividend of a symbol, so history
+// builds up over repeated runs. Returns nil for symbols that don't pay a
+// dividend.
+func dividendFrom(d qapi.Symbol) *store.Dividend {
+	if d.Dividend <= 0 || d.ExDate.IsZero() {
+		return nil
+	}
+	return &store.Dividend{ExDate: d.ExDate, PayDate: d.DividendDate, Amount: d.Dividend}
+}
+
+// Fundamentals of a symbol as of the given day.
+func fundamentalsFrom(d qapi.Symbol, day time.Time) *store.Fundamentals {
+	return &store.Fundamentals{
+		Date:              day,
+		MarketCap:         d.MarketCap,
+		PE:                d.PE,
+		EPS:               d.EPS,
+		Yield:             d.Yield,
+		Dividend:          d.Dividend,
+		OutstandingShares: d.OutstandingShares,
+		High52:            d.HighPrice52,
+		Low52:             d.LowPrice52,
+		AverageVol3Months: d.AverageVol3Months,
+	}
+}
+
+// Listing details of a symbol as of the given time.
+func metadataFrom(d qapi.Symbol, updated time.Time) *store.SymbolDetails {
+	return &store.SymbolDetails{
+		Currency:        d.Currency,
+		SecurityType:    d.SecurityType,
+		Description:     d.Description,
+		ListingExchange: d.ListingExchange,
+		Sector:          d.IndustrySector,
+		Group:           d.IndustryGroup,
+		SubGroup:        d.IndustrySubGroup,
+		Tradable:        d.IsTradable,
+		Quotable:        d.IsQuotable,
+		HasOptions:      d.HasOptions,
+		Updated:         updated,
+	}
+}
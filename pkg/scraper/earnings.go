@@ -0,0 +1,115 @@
+package scraper
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/alexurquhart/sp500scraper/pkg/store"
+)
+
+// EarningsProvider is implemented by providers that report the past and
+// upcoming earnings dates of a symbol
+type EarningsProvider interface {
+	GetEarnings(ctx context.Context, sym store.Symbol) ([]store.Earnings, error)
+}
+
+// Body of an EARNINGS response, figures are strings that are "None" when
+// not known
+type alphaVantageEarnings struct {
+	QuarterlyEarnings []struct {
+		FiscalDateEnding string `json:"fiscalDateEnding"`
+		ReportedDate     string `json:"reportedDate"`
+		ReportedEPS      string `json:"reportedEPS"`
+		EstimatedEPS     string `json:"estimatedEPS"`
+		Surprise         string `json:"surprise"`
+		ReportTime       string `json:"reportTime"`
+	} `json:"quarterlyEarnings"`
+}
+
+// Reported earnings come from the EARNINGS endpoint and the next report in
+// the coming three months from EARNINGS_CALENDAR, which is CSV.
+func (p *alphaVantageProvider) GetEarnings(ctx context.Context, sym store.Symbol) ([]store.Earnings, error) {
+	now := time.Now()
+	ticker := yahooTicker(sym.Symbol)
+
+	var past alphaVantageEarnings
+	err := p.rp.Do(ctx, func() error {
+		if err := p.rl.Wait(ctx, MarketCalls); err != nil {
+			return err
+		}
+		return p.get(url.Values{"function": {"EARNINGS"}, "symbol": {ticker}}, &past)
+	})
+	if err != nil {
+		return nil, err
+	}
+	var earnings []store.Earnings
+	seen := make(map[time.Time]bool)
+	for _, q := range past.QuarterlyEarnings {
+		reported, err := time.Parse(DateFormat, q.ReportedDate)
+		if err != nil {
+			continue
+		}
+		fiscal, _ := time.Parse(DateFormat, q.FiscalDateEnding)
+		seen[reported] = true
+		earnings = append(earnings, store.Earnings{
+			ReportDate: reported,
+			FiscalEnd:  fiscal,
+			ReportTime: q.ReportTime,
+			Estimate:   alphaVantageFigure(q.EstimatedEPS),
+			Reported:   alphaVantageFigure(q.ReportedEPS),
+			Surprise:   alphaVantageFigure(q.Surprise),
+			Updated:    now,
+		})
+	}
+
+	var body []byte
+	err = p.rp.Do(ctx, func() (err error) {
+		if err := p.rl.Wait(ctx, MarketCalls); err != nil {
+			return err
+		}
+		body, err = p.query(url.Values{"function": {"EARNINGS_CALENDAR"}, "symbol": {ticker}, "horizon": {"3month"}})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	// Columns are symbol, name, reportDate, fiscalDateEnding, estimate and
+	// currency
+	rows, err := csv.NewReader(bytes.NewReader(body)).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	for i, r := range rows {
+		if i == 0 || len(r) < 5 {
+			continue
+		}
+		date, err := time.Parse(DateFormat, r[2])
+		if err != nil || seen[date] {
+			continue
+		}
+		fiscal, _ := time.Parse(DateFormat, r[3])
+		earnings = append(earnings, store.Earnings{
+			ReportDate: date,
+			FiscalEnd:  fiscal,
+			Estimate:   alphaVantageFigure(r[4]),
+			Updated:    now,
+		})
+	}
+
+	sort.Slice(earnings, func(i, j int) bool { return earnings[i].ReportDate.Before(earnings[j].ReportDate) })
+	return earnings, nil
+}
+
+// Parse a figure, nil if it is missing.
+func alphaVantageFigure(s string) *float64 {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return nil
+	}
+	return &f
+}
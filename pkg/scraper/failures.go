@@ -0,0 +1,112 @@
+package scraper
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/alexurquhart/sp500scraper/pkg/store"
+)
+
+// Returned when the provider has no symbol by the ticker
+var ErrSymbolNotFound = errors.New("Symbol not found")
+
+// Returned when the ticker isn't listed on the symbol's exchange but is on
+// several others, so there's no telling which is meant
+var ErrAmbiguousMatch = errors.New("Symbol matches several listings")
+
+// Classes of failures, recorded with each failure and counted per run
+const (
+	FailureNotFound    = "not_found"
+	FailureAmbiguous   = "ambiguous_match"
+	FailureRateLimited = "rate_limited"
+	FailureAuthExpired = "auth_expired"
+	FailureProvider    = "provider"
+	FailureDatabase    = "database"
+	FailureDeferred    = "deferred"
+)
+
+func newFailure(sym store.Symbol, err error) store.Failure {
+	f := store.Failure{Symbol: sym.Symbol, Exchange: sym.Exchange, Reason: err.Error(), Time: time.Now(), NotFound: symbolNotFound(err), Class: failureClass(err)}
+	return f
+}
+
+// Class of the error a symbol failed with. Errors other than unknown or
+// ambiguous symbols, rate limiting and expired logins are the provider's.
+func failureClass(err error) string {
+	switch {
+	case symbolNotFound(err):
+		return FailureNotFound
+	case errors.Is(err, ErrAmbiguousMatch):
+		return FailureAmbiguous
+	}
+	switch errorType(err) {
+	case "rate_limited":
+		return FailureRateLimited
+	case "unauthorized":
+		return FailureAuthExpired
+	}
+	return FailureProvider
+}
+
+// Number of the failures of each class, for the runs table and summaries.
+func CountFailures(failures []store.Failure) map[string]int {
+	counts := make(map[string]int)
+	for _, f := range failures {
+		counts[f.Class]++
+	}
+	return counts
+}
+
+// Classes of the counts from the most failures to the fewest, so the first
+// is the dominant failure mode of a run.
+func FailureClasses(counts map[string]int) []string {
+	classes := make([]string, 0, len(counts))
+	for c := range counts {
+		classes = append(classes, c)
+	}
+	sort.Slice(classes, func(i, j int) bool {
+		if counts[classes[i]] != counts[classes[j]] {
+			return counts[classes[i]] > counts[classes[j]]
+		}
+		return classes[i] < classes[j]
+	})
+	return classes
+}
+
+// Whether the error means the provider doesn't know the symbol, rather than
+// that the request failed.
+func symbolNotFound(err error) bool {
+	if errors.Is(err, ErrSymbolNotFound) {
+		return true
+	}
+	switch e := err.(type) {
+	case yahooError:
+		return e.StatusCode == http.StatusNotFound
+	case alphaVantageError:
+		return e.StatusCode == http.StatusNotFound
+	case iexError:
+		return e.StatusCode == http.StatusNotFound
+	case polygonError:
+		return e.StatusCode == http.StatusNotFound
+	case tiingoError:
+		return e.StatusCode == http.StatusNotFound
+	}
+	return false
+}
+
+// Write the failures of a run to a JSON file so follow up runs or fixes can
+// be scripted. An empty list is written when every symbol was saved.
+func writeFailureReport(path string, failures []store.Failure) error {
+	if failures == nil {
+		failures = []store.Failure{}
+	}
+	out, err := json.MarshalIndent(failures, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, out, 0644)
+}
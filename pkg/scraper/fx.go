@@ -0,0 +1,160 @@
+package scraper
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/alexurquhart/sp500scraper/pkg/store"
+)
+
+// Frankfurter API, which serves the daily reference rates of the European
+// Central Bank
+const frankfurterURL = "https://api.frankfurter.app/"
+
+// Body of a time series response, the rates keyed by date and then currency
+type frankfurterSeries struct {
+	Rates map[string]map[string]float64 `json:"rates"`
+}
+
+// Currencies quoted in minor units, such as pence on the London Stock
+// Exchange, and the currency and number of units they are a fraction of
+var minorCurrencies = map[string]struct {
+	currency string
+	units    float64
+}{
+	"GBp": {"GBP", 100},
+	"ZAc": {"ZAR", 100},
+	"ILA": {"ILS", 100},
+}
+
+// Fetch the daily rates converting the currency to USD from the day of start
+// up to end. There are only rates for days the ECB publishes them.
+func fetchFXRates(ctx context.Context, client *http.Client, currency string, start, end time.Time) ([]store.FXRate, error) {
+	u := fmt.Sprintf("%s%s..%s?from=%s&to=USD", frankfurterURL, start.Format(DateFormat), end.Format(DateFormat), currency)
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, errors.New("Unexpected response from Frankfurter: " + res.Status)
+	}
+
+	var series frankfurterSeries
+	if err := json.NewDecoder(res.Body).Decode(&series); err != nil {
+		return nil, err
+	}
+	var rates []store.FXRate
+	for date, r := range series.Rates {
+		day, err := time.Parse(DateFormat, date)
+		if err != nil {
+			return nil, err
+		}
+		if rate, ok := r["USD"]; ok {
+			rates = append(rates, store.FXRate{Currency: currency, Date: day, Rate: rate})
+		}
+	}
+	sort.Slice(rates, func(i, j int) bool { return rates[i].Date.Before(rates[j].Date) })
+	return rates, nil
+}
+
+// Converts candle prices to USD with daily rates, fetched and saved once per
+// currency and run. Safe to use from several goroutines.
+type fxConverter struct {
+	st         store.Store
+	client     *http.Client
+	start, end time.Time
+
+	mu    sync.Mutex
+	rates map[string][]store.FXRate // By currency, oldest first
+	errs  map[string]error          // Currencies without rates, tried once
+}
+
+func newFXConverter(st store.Store, start, end time.Time) *fxConverter {
+	return &fxConverter{
+		st:     st,
+		client: &http.Client{Timeout: 30 * time.Second},
+		// A week earlier so candles at the start have the rate before them
+		start: start.AddDate(0, 0, -7),
+		end:   end,
+		rates: make(map[string][]store.FXRate),
+		errs:  make(map[string]error),
+	}
+}
+
+// Rates of the currency over the range of the run, fetched and saved the
+// first time they are needed. The stored rates are used if they can't be
+// fetched.
+func (f *fxConverter) series(ctx context.Context, currency string) ([]store.FXRate, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if rates, ok := f.rates[currency]; ok {
+		return rates, nil
+	}
+	if err, ok := f.errs[currency]; ok {
+		return nil, err
+	}
+
+	rates, err := fetchFXRates(ctx, f.client, currency, f.start, f.end)
+	if err == nil {
+		err = f.st.SaveFXRates(rates)
+	} else {
+		slog.Warn("Could not fetch FX rates, using stored rates", "currency", currency, "error", err)
+		rates, err = f.st.FXRates(currency, f.start, f.end)
+	}
+	if err == nil && len(rates) == 0 {
+		err = errors.New("No FX rates for " + currency)
+	}
+	if err != nil {
+		f.errs[currency] = err
+		return nil, err
+	}
+	slog.Info("Loaded FX rates", "currency", currency, "days", len(rates))
+	f.rates[currency] = rates
+	return rates, nil
+}
+
+// Convert the prices of the candles not in USD to USD in place, at the
+// latest rate published on or before the day of each candle, and record the
+// rate. Candles without a currency are taken to be in USD.
+func (f *fxConverter) convert(ctx context.Context, candles []store.Candle) error {
+	for i := range candles {
+		c := &candles[i]
+		if c.Currency == "" || c.Currency == "USD" || c.FXRate != 0 {
+			continue
+		}
+		currency, units := c.Currency, 1.0
+		if m, ok := minorCurrencies[currency]; ok {
+			currency, units = m.currency, m.units
+		}
+		rates, err := f.series(ctx, currency)
+		if err != nil {
+			return err
+		}
+
+		y, m, d := c.Start.Date()
+		day := time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+		j := sort.Search(len(rates), func(j int) bool { return rates[j].Date.After(day) })
+		if j == 0 {
+			return fmt.Errorf("No %s rate on or before %s", currency, day.Format(DateFormat))
+		}
+		rate := rates[j-1].Rate / units
+		c.Open = float32(float64(c.Open) * rate)
+		c.High = float32(float64(c.High) * rate)
+		c.Low = float32(float64(c.Low) * rate)
+		c.Close = float32(float64(c.Close) * rate)
+		c.FXRate = rate
+	}
+	return nil
+}
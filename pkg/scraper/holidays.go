@@ -0,0 +1,63 @@
+package scraper
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/alexurquhart/sp500scraper/pkg/store"
+)
+
+// Polygon.io's schedule of upcoming market holidays and early closes
+const polygonHolidaysURL = "https://api.polygon.io/v1/marketstatus/upcoming"
+
+// Fetch the closures and early closes of the exchange published by
+// Polygon.io, which covers the coming year. Days are stamped at midnight in
+// loc, the exchange's time zone.
+func FetchHolidays(ctx context.Context, key, exchange string, loc *time.Location) ([]store.Holiday, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, polygonHolidaysURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+key)
+	res, err := (&http.Client{Timeout: 30 * time.Second}).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, polygonError{StatusCode: res.StatusCode, Message: res.Status}
+	}
+
+	var days []struct {
+		Exchange string    `json:"exchange"`
+		Name     string    `json:"name"`
+		Date     string    `json:"date"`
+		Status   string    `json:"status"`
+		Close    time.Time `json:"close"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&days); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	var holidays []store.Holiday
+	for _, d := range days {
+		if d.Exchange != exchange {
+			continue
+		}
+		date, err := time.ParseInLocation(DateFormat, d.Date, loc)
+		if err != nil {
+			return nil, err
+		}
+		h := store.Holiday{Exchange: exchange, Date: date, Name: d.Name, Updated: now}
+		if d.Status == "early-close" {
+			// Early closes are at 1pm when the time isn't given
+			if h.Close = d.Close; h.Close.IsZero() {
+				h.Close = date.Add(13 * time.Hour)
+			}
+		}
+		holidays = append(holidays, h)
+	}
+	return holidays, nil
+}
@@ -0,0 +1,188 @@
+package scraper
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/alexurquhart/sp500scraper/pkg/store"
+)
+
+// Historical prices endpoint of the IEX Cloud API, followed by the ticker
+const iexURL = "https://cloud.iexapis.com/stable/time-series/HISTORICAL_PRICES/"
+
+// IEX Cloud prices are in the exchange's time zone
+const iexZone = "America/New_York"
+
+// Rows asked for per request. Longer ranges are fetched a page at a time,
+// newest first.
+const iexPageSize = 1000
+
+// Error reported by IEX Cloud, which responds with a plain text message
+type iexError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e iexError) Error() string {
+	return fmt.Sprintf("IEX Cloud error %d: %s", e.StatusCode, e.Message)
+}
+
+// Row of a historical prices response
+type iexPrice struct {
+	PriceDate string  `json:"priceDate"`
+	Open      float32 `json:"open"`
+	High      float32 `json:"high"`
+	Low       float32 `json:"low"`
+	Close     float32 `json:"close"`
+	Volume    int     `json:"volume"`
+}
+
+// Provider backed by the historical daily prices of IEX Cloud. Only daily
+// and longer candles are served, weekly and monthly ones are resampled from
+// the daily prices. Prices are not adjusted.
+//
+// Every call costs credits, reported by IEX Cloud with each response. They
+// are counted, and calls stop with an error once creditLimit is used so a
+// run can't exhaust the account's monthly credits, no limit if 0.
+type iexProvider struct {
+	token       string
+	client      *http.Client
+	rl          *RateLimiter
+	rp          RetryPolicy
+	creditLimit int64
+	credits     int64 // Used since the provider was created, updated atomically
+}
+
+func newIEXProvider(token string, rp RetryPolicy, rate float64, burst int, creditLimit int64) (*iexProvider, error) {
+	if token == "" {
+		return nil, errors.New("IEX Cloud needs an API token")
+	}
+	if rate <= 0 {
+		return nil, errors.New("The rate limit must be positive")
+	}
+	return &iexProvider{
+		token:       token,
+		client:      &http.Client{Timeout: 30 * time.Second},
+		rl:          NewRateLimiter(rate, burst),
+		rp:          rp,
+		creditLimit: creditLimit,
+	}, nil
+}
+
+func (p *iexProvider) RateLimits() []map[string]RateLimitState {
+	return []map[string]RateLimitState{p.rl.State()}
+}
+
+func (p *iexProvider) Credits() int64 {
+	return atomic.LoadInt64(&p.credits)
+}
+
+// IEX Cloud identifies symbols by ticker. The ID matches that of Yahoo so
+// either can update the same candles.
+func (p *iexProvider) SearchSymbol(ctx context.Context, sym store.Symbol) (int, error) {
+	return tickerID(yahooTicker(sym.Symbol)), nil
+}
+
+func (p *iexProvider) GetCandles(ctx context.Context, sym store.Symbol, cr CandleRange) ([]store.Candle, error) {
+	switch cr.Interval {
+	case "OneDay", "OneWeek", "OneMonth":
+	default:
+		return nil, fmt.Errorf("Interval %s not supported by IEX Cloud", cr.Interval)
+	}
+
+	loc, err := time.LoadLocation(iexZone)
+	if err != nil {
+		loc = time.UTC
+	}
+	from := BucketStart(cr.Start.In(loc), "OneDay")
+	to := cr.End.In(loc)
+
+	var candles []store.Candle
+	for !to.Before(from) {
+		q := url.Values{}
+		q.Set("from", from.Format(DateFormat))
+		q.Set("to", to.Format(DateFormat))
+		q.Set("limit", strconv.Itoa(iexPageSize))
+		var page []iexPrice
+		err := p.rp.Do(ctx, func() error {
+			p.rl.waitCandles()
+			return p.get(sym.Symbol, q, &page)
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		oldest := to
+		for _, bar := range page {
+			start, err := time.ParseInLocation(DateFormat, bar.PriceDate, loc)
+			if err != nil {
+				return nil, err
+			}
+			if start.Before(oldest) {
+				oldest = start
+			}
+			if start.Before(from) || !start.Before(cr.End) {
+				continue
+			}
+			candles = append(candles, store.Candle{
+				Start:    start,
+				End:      candleEnd(start, "OneDay"),
+				Open:     bar.Open,
+				High:     bar.High,
+				Low:      bar.Low,
+				Close:    bar.Close,
+				Volume:   bar.Volume,
+				Interval: "OneDay",
+			})
+		}
+		// A full page may have more older rows, continue from the day before
+		// the oldest
+		if len(page) < iexPageSize {
+			break
+		}
+		to = oldest.AddDate(0, 0, -1)
+	}
+	sort.Slice(candles, func(i, j int) bool { return candles[i].Start.Before(candles[j].Start) })
+
+	// Combines the daily candles into weekly or monthly ones
+	return Resample(candles, cr.Interval), nil
+}
+
+// Request the historical prices of a ticker and decode the JSON response
+// into out, counting the credits the call used.
+func (p *iexProvider) get(ticker string, q url.Values, out interface{}) error {
+	if p.creditLimit > 0 && p.Credits() >= p.creditLimit {
+		return iexError{StatusCode: http.StatusPaymentRequired, Message: "Credit limit of " + strconv.FormatInt(p.creditLimit, 10) + " reached"}
+	}
+	q.Set("token", p.token)
+	res, err := p.client.Get(iexURL + url.PathEscape(ticker) + "?" + q.Encode())
+	if err != nil {
+		return redactKey(err, "token")
+	}
+	defer res.Body.Close()
+
+	if used, err := strconv.ParseInt(res.Header.Get("iexcloud-messages-used"), 10, 64); err == nil {
+		total := atomic.AddInt64(&p.credits, used)
+		providerCredits.WithLabelValues("iex").Add(float64(used))
+		slog.Debug("IEX Cloud credits used", "ticker", ticker, "credits", used, "total", total)
+	}
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	if res.StatusCode != http.StatusOK {
+		return iexError{StatusCode: res.StatusCode, Message: strings.TrimSpace(string(body))}
+	}
+	return json.Unmarshal(body, out)
+}
@@ -0,0 +1,237 @@
+package scraper
+
+import (
+	"errors"
+	"log/slog"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/alexurquhart/sp500scraper/pkg/store"
+)
+
+// Windows of the indicators to compute. Empty lists and zero windows leave
+// the indicator out.
+type IndicatorConfig struct {
+	SMA []int
+	EMA []int
+	RSI int
+
+	// Fast and slow EMA windows of the MACD line and the window of its signal
+	// line
+	MACDFast   int
+	MACDSlow   int
+	MACDSignal int
+
+	// Window of the middle band and how many standard deviations the upper
+	// and lower bands are from it
+	Bollinger      int
+	BollingerWidth float64
+}
+
+// Compute the indicators of every stored symbol from its candles of the
+// interval and replace those stored. Prices are adjusted for splits, found as
+// for AdjustSplits, so a split doesn't show up as a crash. Each indicator is
+// stored from the first candle it has enough history for, named after the
+// indicator and its window, e.g. sma_50 or rsi_14. Returns the number of
+// symbols with candles of the interval.
+func ComputeIndicators(st store.Store, splitsPath, interval string, cfg IndicatorConfig) (int, error) {
+	if cfg.MACDFast > 0 && cfg.MACDSlow <= cfg.MACDFast {
+		return 0, errors.New("The slow MACD window must be longer than the fast one")
+	}
+	entries, err := loadSplits(splitsPath)
+	if err != nil {
+		return 0, err
+	}
+	symbols, err := st.Symbols()
+	if err != nil {
+		return 0, err
+	}
+
+	computed := 0
+	for _, sym := range symbols {
+		candles, err := st.Candles(sym.SymbolID, interval, time.Time{}, time.Now().AddDate(1, 0, 0))
+		if err != nil {
+			return computed, err
+		}
+		if len(candles) == 0 {
+			continue
+		}
+		if splits := symbolSplits(entries, sym, candles); len(splits) > 0 {
+			candles = adjustCandles(candles, splits)
+		}
+		values := indicators(candles, cfg)
+		if err := st.SaveIndicators(sym.SymbolID, interval, values); err != nil {
+			return computed, err
+		}
+		slog.Debug("Computed indicators", "symbol", sym.Symbol, "exchange", sym.Exchange, "values", len(values))
+		computed++
+	}
+	slog.Info("Computed indicators", "interval", interval, "symbols", computed)
+	return computed, nil
+}
+
+// Indicators of the candles, oldest first, dated with the start of the
+// candle they were computed at.
+func indicators(candles []store.Candle, cfg IndicatorConfig) []store.Indicator {
+	closes := make([]float64, len(candles))
+	for i, c := range candles {
+		closes[i] = float64(c.Close)
+	}
+
+	var values []store.Indicator
+	add := func(name string, series []float64) {
+		for i, v := range series {
+			if !math.IsNaN(v) {
+				values = append(values, store.Indicator{Time: candles[i].Start, Name: name, Value: v})
+			}
+		}
+	}
+	for _, n := range cfg.SMA {
+		add("sma_"+strconv.Itoa(n), sma(closes, n))
+	}
+	for _, n := range cfg.EMA {
+		add("ema_"+strconv.Itoa(n), ema(closes, n))
+	}
+	if cfg.RSI > 0 {
+		add("rsi_"+strconv.Itoa(cfg.RSI), rsi(closes, cfg.RSI))
+	}
+	if cfg.MACDFast > 0 {
+		line, signal, hist := macd(closes, cfg.MACDFast, cfg.MACDSlow, cfg.MACDSignal)
+		add("macd", line)
+		add("macd_signal", signal)
+		add("macd_histogram", hist)
+	}
+	if cfg.Bollinger > 0 {
+		upper, middle, lower := bollinger(closes, cfg.Bollinger, cfg.BollingerWidth)
+		add("bollinger_upper", upper)
+		add("bollinger_middle", middle)
+		add("bollinger_lower", lower)
+	}
+	return values
+}
+
+// Series the length of values with every item NaN, for the points an
+// indicator doesn't have enough history for.
+func nanSeries(n int) []float64 {
+	s := make([]float64, n)
+	for i := range s {
+		s[i] = math.NaN()
+	}
+	return s
+}
+
+// Simple moving average over n values.
+func sma(values []float64, n int) []float64 {
+	out := nanSeries(len(values))
+	if n <= 0 {
+		return out
+	}
+	sum := 0.0
+	for i, v := range values {
+		sum += v
+		if i >= n {
+			sum -= values[i-n]
+		}
+		if i >= n-1 {
+			out[i] = sum / float64(n)
+		}
+	}
+	return out
+}
+
+// Exponential moving average over n values, seeded with the simple average
+// of the first n. NaN values before the seed are skipped, so the average of
+// a series that starts partway through can be taken.
+func ema(values []float64, n int) []float64 {
+	out := nanSeries(len(values))
+	if n <= 0 {
+		return out
+	}
+	first := 0
+	for first < len(values) && math.IsNaN(values[first]) {
+		first++
+	}
+	if len(values)-first < n {
+		return out
+	}
+
+	k := 2 / float64(n+1)
+	sum := 0.0
+	for _, v := range values[first : first+n] {
+		sum += v
+	}
+	prev := sum / float64(n)
+	out[first+n-1] = prev
+	for i := first + n; i < len(values); i++ {
+		prev = values[i]*k + prev*(1-k)
+		out[i] = prev
+	}
+	return out
+}
+
+// Relative strength index over n changes, with Wilder's smoothing.
+func rsi(values []float64, n int) []float64 {
+	out := nanSeries(len(values))
+	if n <= 0 || len(values) <= n {
+		return out
+	}
+	index := func(gain, loss float64) float64 {
+		if loss == 0 {
+			return 100
+		}
+		return 100 - 100/(1+gain/loss)
+	}
+
+	var gain, loss float64
+	for i := 1; i <= n; i++ {
+		if d := values[i] - values[i-1]; d > 0 {
+			gain += d
+		} else {
+			loss -= d
+		}
+	}
+	gain /= float64(n)
+	loss /= float64(n)
+	out[n] = index(gain, loss)
+	for i := n + 1; i < len(values); i++ {
+		d := values[i] - values[i-1]
+		gain = (gain*float64(n-1) + math.Max(d, 0)) / float64(n)
+		loss = (loss*float64(n-1) + math.Max(-d, 0)) / float64(n)
+		out[i] = index(gain, loss)
+	}
+	return out
+}
+
+// MACD line, the fast EMA less the slow one, its signal line and the
+// histogram of the difference between the two.
+func macd(values []float64, fast, slow, signal int) ([]float64, []float64, []float64) {
+	f, s := ema(values, fast), ema(values, slow)
+	line := make([]float64, len(values))
+	for i := range values {
+		line[i] = f[i] - s[i]
+	}
+	sig := ema(line, signal)
+	hist := make([]float64, len(values))
+	for i := range values {
+		hist[i] = line[i] - sig[i]
+	}
+	return line, sig, hist
+}
+
+// Bollinger bands, the simple moving average over n values and the bands
+// width population standard deviations above and below it.
+func bollinger(values []float64, n int, width float64) ([]float64, []float64, []float64) {
+	middle := sma(values, n)
+	upper, lower := nanSeries(len(values)), nanSeries(len(values))
+	for i := n - 1; i < len(values); i++ {
+		variance := 0.0
+		for _, v := range values[i-n+1 : i+1] {
+			variance += (v - middle[i]) * (v - middle[i])
+		}
+		sd := math.Sqrt(variance / float64(n))
+		upper[i] = middle[i] + width*sd
+		lower[i] = middle[i] - width*sd
+	}
+	return upper, middle, lower
+}
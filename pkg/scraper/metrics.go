@@ -0,0 +1,119 @@
+package scraper
+
+import (
+	"net"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/alexurquhart/qapi"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	symbolsFetched = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "sp500scraper_symbols_fetched_total",
+		Help: "Symbols whose candles were fetched from the API.",
+	})
+	candlesStored = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "sp500scraper_candles_stored_total",
+		Help: "Candles saved to the database.",
+	})
+	candlesRejected = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "sp500scraper_candles_rejected_total",
+		Help: "Candles that failed validation and were recorded as data quality issues.",
+	})
+	apiCalls = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "sp500scraper_api_calls_total",
+		Help: "API calls made, including those that were retried.",
+	})
+	apiErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "sp500scraper_api_errors_total",
+		Help: "Failed API calls by type of error, including those that were retried.",
+	}, []string{"type"})
+	// Errors writing to the database, also counted by the stream command
+	DBErrors = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "sp500scraper_db_errors_total",
+		Help: "Errors writing to the database.",
+	})
+	sinkErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "sp500scraper_sink_errors_total",
+		Help: "Failed writes to sinks by kind of sink.",
+	}, []string{"sink"})
+	rateLimitWaits = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "sp500scraper_rate_limit_waits_total",
+		Help: "Times a request waited on the rate limiter.",
+	})
+	rateLimitWaitSeconds = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "sp500scraper_rate_limit_wait_seconds_total",
+		Help: "Time spent waiting on the rate limiter.",
+	})
+	rateLimitPauses = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "sp500scraper_rate_limit_pauses_total",
+		Help: "Times calls were paused after the API rejected one for exceeding the rate limit.",
+	})
+	providerCredits = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "sp500scraper_provider_credits_total",
+		Help: "Credits used by providers that charge per call, by provider.",
+	}, []string{"provider"})
+	symbolFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "sp500scraper_symbol_failures_total",
+		Help: "Symbols that runs failed to fetch or save, by class of failure.",
+	}, []string{"class"})
+	runSymbols = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "sp500scraper_run_symbols",
+		Help: "Symbols in the current run.",
+	})
+	runSymbolsDone = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "sp500scraper_run_symbols_done",
+		Help: "Symbols in the current run that have been saved, skipped or failed.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(symbolsFetched, candlesStored, candlesRejected, apiCalls, apiErrors, DBErrors, sinkErrors,
+		rateLimitWaits, rateLimitWaitSeconds, rateLimitPauses, providerCredits, symbolFailures, runSymbols, runSymbolsDone)
+}
+
+// Failed API calls since the program started
+var apiErrorCount int64
+
+// Number of failed API calls since the program started, including those
+// that were retried.
+func APIErrors() int64 {
+	return atomic.LoadInt64(&apiErrorCount)
+}
+
+// Label an API error for the error counter.
+func errorType(err error) string {
+	switch e := err.(type) {
+	case qapi.QuestradeError:
+		return statusType(e.StatusCode)
+	case *qapi.QuestradeError:
+		return statusType(e.StatusCode)
+	case yahooError:
+		return statusType(e.StatusCode)
+	case alphaVantageError:
+		return statusType(e.StatusCode)
+	case iexError:
+		return statusType(e.StatusCode)
+	case polygonError:
+		return statusType(e.StatusCode)
+	case tiingoError:
+		return statusType(e.StatusCode)
+	case net.Error:
+		return "network"
+	}
+	return "other"
+}
+
+func statusType(code int) string {
+	switch {
+	case code == http.StatusTooManyRequests:
+		return "rate_limited"
+	case code == http.StatusUnauthorized:
+		return "unauthorized"
+	case code >= 500:
+		return "server"
+	}
+	return "client"
+}
@@ -0,0 +1,185 @@
+package scraper
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alexurquhart/qapi"
+	"github.com/alexurquhart/sp500scraper/pkg/store"
+)
+
+// OptionsProvider is implemented by providers that report the option chain
+// of a symbol along with a quote of each option
+type OptionsProvider interface {
+	// Options of the nearest expiries, or all expiries if expiries is zero,
+	// quoted at the snapshot time
+	GetOptions(ctx context.Context, sym store.Symbol, expiries int, snapshot time.Time) ([]store.Option, error)
+}
+
+// Options quoted per request
+const maxOptionQuotes = 100
+
+// Option chain as returned by /v1/symbols/{id}/options
+type optionChain struct {
+	OptionChain []struct {
+		ExpiryDate         time.Time `json:"expiryDate"`
+		OptionExerciseType string    `json:"optionExerciseType"`
+		ChainPerRoot       []struct {
+			Root                string `json:"root"`
+			Multiplier          int    `json:"multiplier"`
+			ChainPerStrikePrice []struct {
+				StrikePrice  float64 `json:"strikePrice"`
+				CallSymbolID int     `json:"callSymbolId"`
+				PutSymbolID  int     `json:"putSymbolId"`
+			} `json:"chainPerStrikePrice"`
+		} `json:"chainPerRoot"`
+	} `json:"optionChain"`
+}
+
+// Quote of an option as returned by /v1/markets/quotes/options
+type optionQuote struct {
+	SymbolID       int     `json:"symbolId"`
+	Symbol         string  `json:"symbol"`
+	BidPrice       float32 `json:"bidPrice"`
+	BidSize        int     `json:"bidSize"`
+	AskPrice       float32 `json:"askPrice"`
+	AskSize        int     `json:"askSize"`
+	LastTradePrice float32 `json:"lastTradePrice"`
+	Volume         int     `json:"volume"`
+	OpenInterest   int     `json:"openInterest"`
+	Volatility     float32 `json:"volatility"`
+	Delta          float32 `json:"delta"`
+	Gamma          float32 `json:"gamma"`
+	Theta          float32 `json:"theta"`
+	Vega           float32 `json:"vega"`
+	Rho            float32 `json:"rho"`
+}
+
+func (p *questradeProvider) GetOptions(ctx context.Context, sym store.Symbol, expiries int, snapshot time.Time) ([]store.Option, error) {
+	return extractOptions(ctx, p.session(), p.rp, sym.SymbolID, expiries, snapshot)
+}
+
+// Fetch the option chain of a symbol and quote every option in it. Questrade
+// only reports greeks for some options, the rest are left at zero.
+func extractOptions(ctx context.Context, s *questradeSession, rp RetryPolicy, id, expiries int, snapshot time.Time) ([]store.Option, error) {
+	var chain optionChain
+	err := rp.Do(ctx, func() error {
+		if err := s.rl.Wait(ctx, MarketCalls); err != nil {
+			return err
+		}
+		return s.call(ctx, MarketCalls, func(c *qapi.Client) error {
+			return questradeCall(c, "GET", "v1/symbols/"+strconv.Itoa(id)+"/options", nil, &chain)
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(chain.OptionChain, func(i, j int) bool {
+		return chain.OptionChain[i].ExpiryDate.Before(chain.OptionChain[j].ExpiryDate)
+	})
+	if expiries > 0 && len(chain.OptionChain) > expiries {
+		chain.OptionChain = chain.OptionChain[:expiries]
+	}
+
+	var options []store.Option
+	for _, e := range chain.OptionChain {
+		for _, r := range e.ChainPerRoot {
+			for _, k := range r.ChainPerStrikePrice {
+				o := store.Option{Underlying: id, Root: r.Root, Expiry: e.ExpiryDate, Strike: k.StrikePrice,
+					Multiplier: r.Multiplier, Exercise: e.OptionExerciseType, Snapshot: snapshot}
+				if k.CallSymbolID != 0 {
+					o.ID, o.Type = k.CallSymbolID, "Call"
+					options = append(options, o)
+				}
+				if k.PutSymbolID != 0 {
+					o.ID, o.Type = k.PutSymbolID, "Put"
+					options = append(options, o)
+				}
+			}
+		}
+	}
+
+	byID := make(map[int]*store.Option)
+	for i := range options {
+		byID[options[i].ID] = &options[i]
+	}
+	for i := 0; i < len(options); i += maxOptionQuotes {
+		batch := options[i:]
+		if len(batch) > maxOptionQuotes {
+			batch = batch[:maxOptionQuotes]
+		}
+		ids := make([]int, len(batch))
+		for j, o := range batch {
+			ids[j] = o.ID
+		}
+
+		var res struct {
+			OptionQuotes []optionQuote `json:"optionQuotes"`
+		}
+		err := rp.Do(ctx, func() error {
+			if err := s.rl.Wait(ctx, MarketCalls); err != nil {
+				return err
+			}
+			return s.call(ctx, MarketCalls, func(c *qapi.Client) error {
+				return questradeCall(c, "POST", "v1/markets/quotes/options", map[string][]int{"optionIds": ids}, &res)
+			})
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, q := range res.OptionQuotes {
+			if o, ok := byID[q.SymbolID]; ok {
+				o.Symbol = q.Symbol
+				o.Bid, o.BidSize, o.Ask, o.AskSize = q.BidPrice, q.BidSize, q.AskPrice, q.AskSize
+				o.Last, o.Volume, o.OpenInterest = q.LastTradePrice, q.Volume, q.OpenInterest
+				o.Volatility, o.Delta, o.Gamma, o.Theta, o.Vega, o.Rho = q.Volatility, q.Delta, q.Gamma, q.Theta, q.Vega, q.Rho
+			}
+		}
+	}
+	return options, nil
+}
+
+// Call an endpoint qapi doesn't wrap with the session's access token,
+// decoding the JSON response into out.
+func questradeCall(c *qapi.Client, method, path string, body, out interface{}) error {
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequest(method, strings.TrimSuffix(c.Credentials.ApiServer, "/")+"/"+path, r)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.Credentials.AccessToken)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	// Recorded on the client like qapi does, for the rate limiter
+	if remaining, err := strconv.Atoi(res.Header.Get("X-RateLimit-Remaining")); err == nil {
+		if reset, err := strconv.ParseInt(res.Header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+			c.RateLimitRemaining, c.RateLimitReset = remaining, time.Unix(reset, 0)
+		}
+	}
+	if res.StatusCode != http.StatusOK {
+		return qapi.QuestradeError{StatusCode: res.StatusCode, Message: "Questrade request failed: " + res.Status, Endpoint: path}
+	}
+	return json.NewDecoder(res.Body).Decode(out)
+}
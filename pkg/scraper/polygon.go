@@ -0,0 +1,226 @@
+package scraper
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/alexurquhart/sp500scraper/pkg/store"
+)
+
+// Aggregates endpoint of the Polygon.io API, followed by the ticker
+const polygonURL = "https://api.polygon.io/v2/aggs/ticker/"
+
+// Polygon.io bars are stamped in UTC, candles are kept in the exchange's
+// time zone
+const polygonZone = "America/New_York"
+
+// Most bars Polygon.io returns per request, longer ranges continue on the
+// next URL of the response
+const polygonPageSize = 50000
+
+// Size and unit of the bars fetched for each interval. Hourly and longer
+// intraday intervals are built from half hour bars, as Polygon.io's hourly
+// bars start on the hour and would straddle the open, and weekly and monthly
+// ones from daily bars so weeks start on Monday.
+var polygonIntervals = map[string]struct {
+	multiplier int
+	timespan   string
+	source     string
+}{
+	"OneMinute":      {1, "minute", "OneMinute"},
+	"TwoMinutes":     {2, "minute", "TwoMinutes"},
+	"ThreeMinutes":   {3, "minute", "ThreeMinutes"},
+	"FourMinutes":    {4, "minute", "FourMinutes"},
+	"FiveMinutes":    {5, "minute", "FiveMinutes"},
+	"TenMinutes":     {10, "minute", "TenMinutes"},
+	"FifteenMinutes": {15, "minute", "FifteenMinutes"},
+	"TwentyMinutes":  {20, "minute", "TwentyMinutes"},
+	"HalfHour":       {30, "minute", "HalfHour"},
+	"OneHour":        {30, "minute", "HalfHour"},
+	"TwoHours":       {30, "minute", "HalfHour"},
+	"FourHours":      {30, "minute", "HalfHour"},
+	"OneDay":         {1, "day", "OneDay"},
+	"OneWeek":        {1, "day", "OneDay"},
+	"OneMonth":       {1, "day", "OneDay"},
+}
+
+// Error response from the Polygon.io API
+type polygonError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e polygonError) Error() string {
+	return fmt.Sprintf("Polygon.io error %d: %s", e.StatusCode, e.Message)
+}
+
+// Body of an aggregates response. Errors are reported in Error or Message
+// depending on the endpoint version.
+type polygonAggregates struct {
+	Status  string `json:"status"`
+	Error   string `json:"error"`
+	Message string `json:"message"`
+	NextURL string `json:"next_url"`
+	Results []struct {
+		Time   int64   `json:"t"`
+		Open   float32 `json:"o"`
+		High   float32 `json:"h"`
+		Low    float32 `json:"l"`
+		Close  float32 `json:"c"`
+		Volume float64 `json:"v"`
+	} `json:"results"`
+}
+
+// Provider backed by the aggregate bars of the Polygon.io API, serving every
+// interval. Prices are adjusted for splits unless adjusted is false.
+// Polygon.io includes the pre-market and after-hours sessions in intraday
+// bars, which are dropped unless extended is set.
+type polygonProvider struct {
+	key      string
+	client   *http.Client
+	rl       *RateLimiter
+	rp       RetryPolicy
+	adjusted bool
+	extended bool
+}
+
+func newPolygonProvider(key string, rp RetryPolicy, rate float64, burst int, adjusted, extended bool) (*polygonProvider, error) {
+	if key == "" {
+		return nil, errors.New("Polygon.io needs an API key")
+	}
+	if rate <= 0 {
+		return nil, errors.New("The rate limit must be positive")
+	}
+	return &polygonProvider{
+		key:      key,
+		client:   &http.Client{Timeout: 30 * time.Second},
+		rl:       NewRateLimiter(rate, burst),
+		rp:       rp,
+		adjusted: adjusted,
+		extended: extended,
+	}, nil
+}
+
+func (p *polygonProvider) RateLimits() []map[string]RateLimitState {
+	return []map[string]RateLimitState{p.rl.State()}
+}
+
+// Polygon.io identifies symbols by ticker, with the share class after a dot.
+// The ID matches that of Yahoo so either can update the same candles.
+func (p *polygonProvider) SearchSymbol(ctx context.Context, sym store.Symbol) (int, error) {
+	return tickerID(yahooTicker(sym.Symbol)), nil
+}
+
+func (p *polygonProvider) GetCandles(ctx context.Context, sym store.Symbol, cr CandleRange) ([]store.Candle, error) {
+	bars, ok := polygonIntervals[cr.Interval]
+	if !ok {
+		return nil, fmt.Errorf("Interval %s not supported by Polygon.io", cr.Interval)
+	}
+	loc, err := time.LoadLocation(polygonZone)
+	if err != nil {
+		loc = time.UTC
+	}
+	_, intraday := intervalDurations[bars.source]
+	from := cr.Start
+	if !intraday {
+		from = BucketStart(cr.Start.In(loc), "OneDay")
+	}
+
+	q := url.Values{}
+	q.Set("adjusted", strconv.FormatBool(p.adjusted))
+	q.Set("sort", "asc")
+	q.Set("limit", strconv.Itoa(polygonPageSize))
+	u := polygonURL + url.PathEscape(sym.Symbol) + "/range/" + strconv.Itoa(bars.multiplier) + "/" + bars.timespan + "/" +
+		strconv.FormatInt(from.UnixMilli(), 10) + "/" + strconv.FormatInt(cr.End.UnixMilli(), 10) + "?" + q.Encode()
+
+	var candles []store.Candle
+	for u != "" {
+		var aggs polygonAggregates
+		err := p.rp.Do(ctx, func() error {
+			p.rl.waitCandles()
+			aggs = polygonAggregates{}
+			return p.get(u, &aggs)
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, bar := range aggs.Results {
+			start := time.UnixMilli(bar.Time).In(loc)
+			if !intraday {
+				start = BucketStart(start, "OneDay")
+			}
+			if start.Before(from) || !start.Before(cr.End) {
+				continue
+			}
+			candles = append(candles, store.Candle{
+				Start:    start,
+				End:      candleEnd(start, bars.source),
+				Open:     bar.Open,
+				High:     bar.High,
+				Low:      bar.Low,
+				Close:    bar.Close,
+				Volume:   int(bar.Volume),
+				Interval: bars.source,
+			})
+		}
+		// The next page is listed without the key, which get adds
+		u = aggs.NextURL
+	}
+
+	if intraday {
+		tagSessions(nil, candles)
+		if !p.extended {
+			candles = regularSession(candles)
+		}
+	}
+	// Combines the half hour or daily candles fetched for coarser intervals,
+	// keeping the sessions apart
+	return Resample(candles, cr.Interval), nil
+}
+
+// Candles of the regular session.
+func regularSession(candles []store.Candle) []store.Candle {
+	out := candles[:0]
+	for _, c := range candles {
+		if c.Session == store.SessionRegular {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// Request a page of aggregates with the key as a bearer token, so it isn't
+// in the URL of errors, decoding the error Polygon.io reports with non-200
+// responses.
+func (p *polygonProvider) get(u string, aggs *polygonAggregates) error {
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+p.key)
+	res, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if err := json.NewDecoder(res.Body).Decode(aggs); err != nil && res.StatusCode == http.StatusOK {
+		return err
+	}
+	if res.StatusCode != http.StatusOK || aggs.Status == "ERROR" {
+		e := polygonError{StatusCode: res.StatusCode, Message: res.Status}
+		if aggs.Error != "" {
+			e.Message = aggs.Error
+		} else if aggs.Message != "" {
+			e.Message = aggs.Message
+		}
+		return e
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package scraper
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"time"
+
+	"github.com/alexurquhart/sp500scraper/pkg/store"
+)
+
+// Provider is a source of candlestick data. Providers are safe to call
+// from several goroutines.
+type Provider interface {
+	// Find the ID the symbol is stored under
+	SearchSymbol(ctx context.Context, sym store.Symbol) (int, error)
+
+	// Candles for a symbol over the range, oldest first
+	GetCandles(ctx context.Context, sym store.Symbol, cr CandleRange) ([]store.Candle, error)
+}
+
+// DetailsProvider is implemented by providers that also report the latest dividend and fundamentals of a
+// symbol. Either may be nil when the symbol has none.
+type DetailsProvider interface {
+	GetDetails(ctx context.Context, sym store.Symbol, day time.Time) (*store.Dividend, *store.Fundamentals, error)
+}
+
+// MetadataProvider is implemented by providers that report the listing
+// details of a symbol, such as its currency and security type
+type MetadataProvider interface {
+	GetMetadata(ctx context.Context, sym store.Symbol) (*store.SymbolDetails, error)
+}
+
+// SessionProvider is implemented by providers with a session that expires
+// while idle
+type SessionProvider interface {
+	Login() error
+}
+
+// RateLimitReporter is implemented by providers that can report the state
+// of their rate limiters, one per session
+type RateLimitReporter interface {
+	RateLimits() []map[string]RateLimitState
+}
+
+// CreditReporter is implemented by providers that charge credits per call,
+// reporting those used since the provider was created
+type CreditReporter interface {
+	Credits() int64
+}
+
+// Settings shared by the providers
+type ProviderConfig struct {
+	// Questrade credentials file and the profiles to spread requests
+	// across, see NewClient
+	Credentials string
+	Profiles    []string
+
+	// Log in to Questrade's live server rather than the practice server
+	Live bool
+
+	// How Questrade tickers listed on several exchanges are resolved
+	Match MatchPolicy
+
+	// Calls are limited to RateLimit per second in bursts of up to Burst,
+	// 1 if zero, and retried with Retry
+	RateLimit float64
+	Burst     int
+	Retry     RetryPolicy
+
+	// Alpha Vantage API key and its own limit of calls per second, as its
+	// limits are far stricter
+	AlphaVantageKey  string
+	AlphaVantageRate float64
+
+	// IEX Cloud API token and the most credits to use before calls stop,
+	// 0 for no limit
+	IEXToken       string
+	IEXCreditLimit int64
+
+	// Polygon.io API key, and whether its prices are adjusted for splits
+	PolygonKey      string
+	PolygonAdjusted bool
+
+	// Tiingo API key
+	TiingoKey string
+
+	// Directory of the daily CSV files read by the csv provider
+	CSVDir string
+
+	// Fetch intraday candles before and after the regular session too,
+	// only supported by Yahoo and Polygon.io
+	ExtendedHours bool
+}
+
+// Create the named provider, questrade, yahoo, alphavantage, iex, polygon,
+// tiingo or csv.
+func NewProvider(name string, cfg ProviderConfig) (Provider, error) {
+	switch name {
+	case "questrade":
+		return newQuestradeProvider(cfg.Credentials, cfg.Profiles, cfg.Live, cfg.Retry, cfg.Match, cfg.RateLimit, cfg.Burst)
+	case "yahoo":
+		return newYahooProvider(cfg.Retry, cfg.RateLimit, cfg.Burst, cfg.ExtendedHours), nil
+	case "alphavantage":
+		return newAlphaVantageProvider(cfg.AlphaVantageKey, cfg.Retry, cfg.AlphaVantageRate)
+	case "iex":
+		return newIEXProvider(cfg.IEXToken, cfg.Retry, cfg.RateLimit, cfg.Burst, cfg.IEXCreditLimit)
+	case "polygon":
+		return newPolygonProvider(cfg.PolygonKey, cfg.Retry, cfg.RateLimit, cfg.Burst, cfg.PolygonAdjusted, cfg.ExtendedHours)
+	case "tiingo":
+		return newTiingoProvider(cfg.TiingoKey, cfg.Retry, cfg.RateLimit, cfg.Burst)
+	case "csv":
+		return newCSVProvider(cfg.CSVDir)
+	}
+	return nil, errors.New("Unknown provider " + name + ", expected questrade, yahoo, alphavantage, iex, polygon, tiingo or csv")
+}
+
+// Hide the API key in the query parameter param of a request that failed
+// before a response, whose error includes the URL and is logged and stored
+// with the failures.
+func redactKey(err error, param string) error {
+	var ue *url.Error
+	if !errors.As(err, &ue) {
+		return err
+	}
+	if u, perr := url.Parse(ue.URL); perr == nil && u.Query().Get(param) != "" {
+		q := u.Query()
+		q.Set(param, "REDACTED")
+		u.RawQuery = q.Encode()
+		ue.URL = u.String()
+	}
+	return err
+}
@@ -0,0 +1,280 @@
+package scraper
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/alexurquhart/qapi"
+	"github.com/alexurquhart/sp500scraper/pkg/store"
+)
+
+// How long before the access token expires the session is refreshed
+const refreshMargin = 5 * time.Minute
+
+// How long calls are paused after being rate limited when Questrade doesn't
+// say when the limit resets
+const rateLimitPause = time.Minute
+
+// Logged in Questrade account. Each account has its own rate limits and
+// refresh token.
+type questradeSession struct {
+	client      *qapi.Client
+	rl          *RateLimiter
+	credentials string
+	live        bool
+	expires     time.Time // When the access token expires
+
+	// Calls hold a read lock so the session isn't replaced under them
+	mu sync.RWMutex
+}
+
+// Provider backed by the Questrade API. Calls are spread across the
+// sessions in turn, so each added account adds its rate limit.
+type questradeProvider struct {
+	sessions []*questradeSession
+	rp       RetryPolicy
+	mp       MatchPolicy
+	next     uint32
+}
+
+// Login to the server using the refresh token stored in the environment
+// variables or the credentials file of each profile, or the default
+// credentials when there are no profiles.
+//
+// Questrade limits market data calls to 20 per second up to 15 000 calls per
+// hour, and account calls separately. The limiter of each session keeps a
+// bucket per category that never exceeds rate requests per second and paces
+// itself within the hour using the remaining calls reported by the API. It
+// is shared by all workers so adding workers doesn't raise the request rate.
+func newQuestradeProvider(credentials string, profiles []string, live bool, rp RetryPolicy, mp MatchPolicy, rate float64, burst int) (*questradeProvider, error) {
+	p := &questradeProvider{rp: rp, mp: mp}
+	if len(profiles) == 0 {
+		profiles = []string{""}
+	}
+	for _, profile := range profiles {
+		path, env := profileCredentials(credentials, profile)
+		client, err := NewClient(path, env, live)
+		if err != nil {
+			if profile != "" {
+				err = errors.New("Profile " + profile + ": " + err.Error())
+			}
+			return nil, err
+		}
+		s := &questradeSession{
+			client:      client,
+			rl:          NewRateLimiter(rate, burst),
+			credentials: path,
+			live:        live,
+			expires:     tokenExpiry(client),
+		}
+		p.sessions = append(p.sessions, s)
+		go s.manage()
+	}
+	return p, nil
+}
+
+// Login to the server again with every session and save the new
+// refresh tokens.
+func (p *questradeProvider) Login() error {
+	for _, s := range p.sessions {
+		if err := s.login(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *questradeSession) login() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.relogin()
+}
+
+// Log in again unless the token that expires at seen has already been
+// replaced by another call.
+func (s *questradeSession) refresh(seen time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.expires.Equal(seen) {
+		return nil
+	}
+	return s.relogin()
+}
+
+// Called with the write lock held.
+func (s *questradeSession) relogin() error {
+	if err := Relogin(s.client, s.credentials, s.live); err != nil {
+		return err
+	}
+	s.expires = tokenExpiry(s.client)
+	return nil
+}
+
+func tokenExpiry(c *qapi.Client) time.Time {
+	return time.Now().Add(time.Duration(c.Credentials.ExpiresIn) * time.Second)
+}
+
+// Refresh the access token a few minutes before it expires, so calls never
+// straddle the expiry. Failed logins are tried again every minute.
+func (s *questradeSession) manage() {
+	for {
+		s.mu.RLock()
+		expires := s.expires
+		s.mu.RUnlock()
+
+		time.Sleep(time.Until(expires.Add(-refreshMargin)))
+		for {
+			err := s.refresh(expires)
+			if err == nil {
+				break
+			}
+			slog.Error("Login failed", "error", err)
+			time.Sleep(time.Minute)
+		}
+	}
+}
+
+// Make an API call with the session's client. The session is only held for
+// the call, so the token can be refreshed between the calls of a long
+// fetch. A call rejected because the token expired anyway is made again
+// after logging in.
+//
+// A call rejected for exceeding the rate limit pauses every call of the
+// session until the limit resets, and is then made again, so hitting the
+// limit holds up the run rather than failing symbols. The rate limit state
+// of each response is passed to the limiter's bucket for the category. The
+// pause ends early if ctx is cancelled.
+func (s *questradeSession) call(ctx context.Context, category string, f func(c *qapi.Client) error) error {
+	seen, reset, err := s.try(category, f)
+	if err != nil && errorType(err) == "rate_limited" {
+		err = s.pause(ctx, category, reset, f)
+	}
+	if err == nil || errorType(err) != "unauthorized" {
+		return err
+	}
+
+	slog.Warn("Access token rejected, logging in again", "error", err)
+	if err := s.refresh(seen); err != nil {
+		return err
+	}
+	_, _, err = s.try(category, f)
+	return err
+}
+
+// Make the call once with a copy of the client, which qapi records the rate
+// limit state of the response on, so concurrent calls don't share it.
+// Returns when the token used expires and when the rate limit resets.
+func (s *questradeSession) try(category string, f func(c *qapi.Client) error) (time.Time, time.Time, error) {
+	s.mu.RLock()
+	seen := s.expires
+	c := *s.client
+	c.RateLimitReset = time.Time{}
+	err := f(&c)
+	s.mu.RUnlock()
+	s.rl.Observe(category, c.RateLimitRemaining, c.RateLimitReset)
+	return seen, c.RateLimitReset, err
+}
+
+// Pause the session's calls until the rate limit resets, then make the
+// call again.
+func (s *questradeSession) pause(ctx context.Context, category string, until time.Time, f func(c *qapi.Client) error) error {
+	if !until.After(time.Now()) {
+		until = time.Now().Add(rateLimitPause)
+	}
+	rateLimitPauses.Inc()
+	slog.Warn("Rate limited by Questrade, pausing calls until the limit resets", "until", until)
+	s.rl.Pause(until)
+	t := time.NewTimer(time.Until(until))
+	defer t.Stop()
+	select {
+	case <-t.C:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	slog.Info("Rate limit reset, resuming calls")
+
+	_, _, err := s.try(category, f)
+	return err
+}
+
+// Take the next session in turn.
+func (p *questradeProvider) session() *questradeSession {
+	return p.sessions[int(atomic.AddUint32(&p.next, 1)-1)%len(p.sessions)]
+}
+
+func (p *questradeProvider) RateLimits() []map[string]RateLimitState {
+	states := make([]map[string]RateLimitState, len(p.sessions))
+	for i, s := range p.sessions {
+		states[i] = s.rl.State()
+	}
+	return states
+}
+
+func (p *questradeProvider) SearchSymbol(ctx context.Context, sym store.Symbol) (int, error) {
+	return resolveSymbol(ctx, p.session(), p.rp, p.mp, sym)
+}
+
+func (p *questradeProvider) GetCandles(ctx context.Context, sym store.Symbol, cr CandleRange) ([]store.Candle, error) {
+	return extractCandles(ctx, p.session(), p.rp, sym.SymbolID, cr)
+}
+
+func (p *questradeProvider) GetDetails(ctx context.Context, sym store.Symbol, day time.Time) (*store.Dividend, *store.Fundamentals, error) {
+	d, err := extractDetails(ctx, p.session(), p.rp, sym.SymbolID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return dividendFrom(d), fundamentalsFrom(d, day), nil
+}
+
+func (p *questradeProvider) GetMetadata(ctx context.Context, sym store.Symbol) (*store.SymbolDetails, error) {
+	d, err := extractDetails(ctx, p.session(), p.rp, sym.SymbolID)
+	if err != nil {
+		return nil, err
+	}
+	return metadataFrom(d, time.Now()), nil
+}
+
+// Extract candlestick data over the given range for a symbol. Ranges with
+// more candles than fit in one request are fetched in windows and stitched
+// back together. Once a symbol has been found its candles are fetched even
+// if the context is cancelled, unless a retry or a rate limit pause is pending,
+// see waitCandles.
+func extractCandles(ctx context.Context, s *questradeSession, rp RetryPolicy, id int, cr CandleRange) ([]store.Candle, error) {
+	var candles []store.Candle
+	for _, chunk := range chunkRange(cr) {
+		var part []qapi.Candlestick
+		err := rp.Do(ctx, func() error {
+			s.rl.waitCandles()
+			return s.call(ctx, MarketCalls, func(c *qapi.Client) (err error) {
+				part, err = c.GetCandles(id, chunk.Start, chunk.End, chunk.Interval)
+				return err
+			})
+		})
+		if err != nil {
+			return []store.Candle{}, err
+		}
+
+		// Adjacent windows can both include the candle on their boundary
+		for _, cdl := range part {
+			if n := len(candles); n > 0 && !cdl.Start.After(candles[n-1].Start) {
+				continue
+			}
+			candles = append(candles, store.Candle{
+				Start:    cdl.Start,
+				End:      cdl.End,
+				Open:     cdl.Open,
+				High:     cdl.High,
+				Low:      cdl.Low,
+				Close:    cdl.Close,
+				Volume:   cdl.Volume,
+				Interval: cr.Interval,
+			})
+		}
+	}
+
+	return candles, nil
+}
@@ -0,0 +1,64 @@
+package scraper
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/alexurquhart/sp500scraper/pkg/store"
+)
+
+// QuoteProvider is implemented by providers that quote the top of the book
+// and last trade of symbols
+type QuoteProvider interface {
+	// Quotes of the symbols with the given IDs at the snapshot time
+	GetQuotes(ctx context.Context, ids []int, snapshot time.Time) ([]store.Quote, error)
+}
+
+func (p *questradeProvider) GetQuotes(ctx context.Context, ids []int, snapshot time.Time) ([]store.Quote, error) {
+	res, err := p.quotes(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	quotes := make([]store.Quote, len(res))
+	for i, q := range res {
+		quotes[i] = store.Quote{SymbolID: q.SymbolID, Snapshot: snapshot, Bid: q.BidPrice, BidSize: q.BidSize, Ask: q.AskPrice,
+			AskSize: q.AskSize, Last: q.LastTradePrice, LastSize: q.LastTradeSize, Volume: q.Volume, Delay: q.Delay, Halted: q.IsHalted}
+	}
+	return quotes, nil
+}
+
+// Quote every stored symbol of the run at once and save the quotes with the
+// run. Symbols that were never resolved have no ID to quote.
+func snapshotQuotes(ctx context.Context, qp QuoteProvider, st store.Store, symbols []store.Symbol, run int) error {
+	stored, err := st.Symbols()
+	if err != nil {
+		return err
+	}
+	ids := make(map[string]int, len(stored))
+	for _, sym := range stored {
+		ids[sym.Key()] = sym.SymbolID
+	}
+	var batch []int
+	for _, sym := range symbols {
+		if id, ok := ids[sym.Key()]; ok {
+			batch = append(batch, id)
+		}
+	}
+	if len(batch) == 0 {
+		return nil
+	}
+
+	quotes, err := qp.GetQuotes(ctx, batch, time.Now())
+	if err != nil {
+		return err
+	}
+	for i := range quotes {
+		quotes[i].Run = run
+	}
+	if err := st.SaveQuotes(quotes); err != nil {
+		return err
+	}
+	slog.Info("Saved quote snapshot", "symbols", len(quotes))
+	return nil
+}
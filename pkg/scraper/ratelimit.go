@@ -0,0 +1,209 @@
+package scraper
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Categories of API calls. Questrade limits account calls and market data
+// calls separately, each with its own window.
+const (
+	MarketCalls  = "market"
+	AccountCalls = "account"
+)
+
+// RateLimiter keeps a token bucket per category of API call, shared by every
+// call of that category. Questrade reports the calls remaining in the current
+// window and when the window resets with each response, and the refill rate of
+// the bucket of the call's category is adjusted with Observe so the remaining
+// calls are spread evenly over what is left of the window. Rates never exceed
+// the per second limit.
+type RateLimiter struct {
+	mu      sync.Mutex
+	burst   float64 // Capacity of each bucket
+	max     float64 // Fastest refill rate of each bucket, in calls per second
+	buckets map[string]*bucket
+
+	// No calls of any category are made before this, set when the API
+	// rejects a call for exceeding the limit
+	paused time.Time
+}
+
+// Token bucket of one category of calls
+type bucket struct {
+	rate   float64   // Current refill rate, in calls per second
+	tokens float64   // Tokens in the bucket, negative when calls are queued
+	last   time.Time // When tokens was last refilled
+
+	// Rate limit state reported by the most recent response
+	remaining int
+	reset     time.Time
+}
+
+// Create a limiter allowing at most max calls per second of each category in
+// bursts of up to burst calls, at least 1.
+func NewRateLimiter(max float64, burst int) *RateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &RateLimiter{
+		burst:   float64(burst),
+		max:     max,
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// Block until a call of the category may be made or the context is
+// cancelled.
+func (l *RateLimiter) Wait(ctx context.Context, category string) error {
+	began := time.Now()
+	delay := l.reserve(category)
+	if delay > 0 {
+		_, span := tracer.Start(ctx, "rate limit wait", trace.WithAttributes(attribute.String("category", category)))
+		defer span.End()
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			l.cancel(category)
+			return ctx.Err()
+		}
+		rateLimitWaits.Inc()
+		rateLimitWaitSeconds.Add(time.Since(began).Seconds())
+	}
+	return nil
+}
+
+// Block until a market call fetching candles may be made. Once a symbol has
+// been found its candles are fetched even if the run is cancelled, so the
+// symbols in flight at a shutdown are still saved, and the wait isn't cut
+// short. Retries still stop on cancellation.
+func (l *RateLimiter) waitCandles() {
+	l.Wait(context.Background(), MarketCalls)
+}
+
+// Bucket of a category, created full on first use. Called with the lock held.
+func (l *RateLimiter) bucket(category string) *bucket {
+	b, ok := l.buckets[category]
+	if !ok {
+		b = &bucket{rate: l.max, tokens: l.burst, last: time.Now()}
+		l.buckets[category] = b
+	}
+	return b
+}
+
+// Take a token of the category, returning how long to wait for it.
+func (l *RateLimiter) reserve(category string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	b := l.bucket(category)
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > l.burst {
+		b.tokens = l.burst
+	}
+	b.last = now
+
+	if now.Before(l.paused) {
+		b.tokens = 0
+		b.last = l.paused
+		return l.paused.Sub(now)
+	}
+
+	// Nothing can be done until the window resets
+	if b.remaining == 0 && now.Before(b.reset) {
+		b.tokens = 0
+		b.last = b.reset
+		return b.reset.Sub(now)
+	}
+
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// Return a token taken by a call that was abandoned.
+func (l *RateLimiter) cancel(category string) {
+	l.mu.Lock()
+	l.bucket(category).tokens++
+	l.mu.Unlock()
+}
+
+// Hold every call of every category until the given time. Calls already
+// waiting wait for it too, as their tokens are only handed out once it has
+// passed.
+func (l *RateLimiter) Pause(until time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if until.After(l.paused) {
+		l.paused = until
+	}
+	for _, b := range l.buckets {
+		if b.last.Before(until) {
+			b.tokens, b.last = 0, until
+		}
+	}
+}
+
+// Record the rate limit state a response to a call of the category reported
+// and spread the calls remaining over the rest of the window.
+func (l *RateLimiter) Observe(category string, remaining int, reset time.Time) {
+	if reset.IsZero() {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b := l.bucket(category)
+	b.remaining, b.reset = remaining, reset
+
+	window := time.Until(b.reset).Seconds()
+	if window <= 0 {
+		b.rate = l.max
+		return
+	}
+	b.rate = float64(b.remaining) / window
+	if b.rate > l.max {
+		b.rate = l.max
+	}
+	// Keep trickling so the reset time gets refreshed
+	if min := 1 / window; b.rate < min {
+		b.rate = min
+	}
+}
+
+// Current refill rate of the category in calls per second.
+func (l *RateLimiter) Rate(category string) float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.bucket(category).rate
+}
+
+// Rate limit state of a category of calls. The calls remaining and when the
+// window resets are only known once the API has reported them.
+type RateLimitState struct {
+	Rate      float64    `json:"rate"`
+	Remaining *int       `json:"remaining,omitempty"`
+	Reset     *time.Time `json:"reset,omitempty"`
+}
+
+// State of the bucket of every category called so far.
+func (l *RateLimiter) State() map[string]RateLimitState {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	state := make(map[string]RateLimitState, len(l.buckets))
+	for category, b := range l.buckets {
+		st := RateLimitState{Rate: b.rate}
+		if !b.reset.IsZero() {
+			remaining, reset := b.remaining, b.reset
+			st.Remaining, st.Reset = &remaining, &reset
+		}
+		state[category] = st
+	}
+	return state
+}
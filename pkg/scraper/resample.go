@@ -0,0 +1,120 @@
+package scraper
+
+import (
+	"time"
+
+	"github.com/alexurquhart/sp500scraper/pkg/store"
+)
+
+// Length of the fixed size intervals, the calendar based ones are handled
+// by BucketStart
+var intervalDurations = map[string]time.Duration{
+	"OneMinute":      time.Minute,
+	"TwoMinutes":     2 * time.Minute,
+	"ThreeMinutes":   3 * time.Minute,
+	"FourMinutes":    4 * time.Minute,
+	"FiveMinutes":    5 * time.Minute,
+	"TenMinutes":     10 * time.Minute,
+	"FifteenMinutes": 15 * time.Minute,
+	"TwentyMinutes":  20 * time.Minute,
+	"HalfHour":       30 * time.Minute,
+	"OneHour":        time.Hour,
+	"TwoHours":       2 * time.Hour,
+	"FourHours":      4 * time.Hour,
+}
+
+// Interval daily figures are computed from given the stored intervals,
+// finest first: OneDay if it is stored, otherwise the finest intraday
+// interval. Empty when only weekly or monthly candles are stored.
+func dailyInterval(intervals []string) string {
+	for _, i := range intervals {
+		if i == "OneDay" {
+			return i
+		}
+	}
+	for _, i := range intervals {
+		if _, ok := intervalDurations[i]; ok {
+			return i
+		}
+	}
+	return ""
+}
+
+// Stored interval to resample into the requested one given the stored
+// intervals, finest first: the requested interval itself if stored,
+// otherwise the coarsest stored interval finer than it, falling back to the
+// finest stored. Empty if nothing is stored.
+func SourceInterval(intervals []string, interval string) string {
+	if len(intervals) == 0 {
+		return ""
+	}
+	source := intervals[0]
+	for _, i := range intervals {
+		if i == interval {
+			return i
+		}
+		if intervalLength(i) < intervalLength(interval) {
+			source = i
+		}
+	}
+	return source
+}
+
+// Candles of one interval out of candles of several.
+func filterInterval(candles []store.Candle, interval string) []store.Candle {
+	var out []store.Candle
+	for _, c := range candles {
+		if c.Interval == interval {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// Start of the interval that t falls in, in t's location.
+func BucketStart(t time.Time, interval string) time.Time {
+	y, m, d := t.Date()
+	switch interval {
+	case "OneDay":
+		return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+	case "OneWeek":
+		// Weeks start on Monday
+		offset := (int(t.Weekday()) + 6) % 7
+		return time.Date(y, m, d-offset, 0, 0, 0, 0, t.Location())
+	case "OneMonth":
+		return time.Date(y, m, 1, 0, 0, 0, 0, t.Location())
+	}
+	day := time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+	return day.Add(t.Sub(day) / intervalDurations[interval] * intervalDurations[interval])
+}
+
+// Combine candles, oldest first, into candles of a coarser interval. Candles
+// that are already as coarse as the interval are returned unchanged. Candles
+// of different trading sessions are never combined, so a bucket spanning
+// the open or close is split at it.
+func Resample(candles []store.Candle, interval string) []store.Candle {
+	var out []store.Candle
+	var bucket time.Time
+	for _, c := range candles {
+		b := BucketStart(c.Start, interval)
+		if len(out) == 0 || !b.Equal(bucket) || c.Session != out[len(out)-1].Session {
+			bucket = b
+			c.Interval = interval
+			out = append(out, c)
+			continue
+		}
+
+		cur := &out[len(out)-1]
+		cur.End = c.End
+		cur.Close = c.Close
+		cur.AdjClose = c.AdjClose
+		cur.Volume += c.Volume
+		if c.High > cur.High {
+			cur.High = c.High
+		}
+		if c.Low < cur.Low {
+			cur.Low = c.Low
+		}
+	}
+	return out
+}
@@ -0,0 +1,216 @@
+package scraper
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+
+	"github.com/alexurquhart/qapi"
+	"github.com/alexurquhart/sp500scraper/pkg/store"
+)
+
+// Characters that separate a ticker from its share class
+const classSeparators = ".-/ "
+
+// Split a ticker such as BRK.B into its base and share class. The class is
+// empty for tickers without one.
+func splitClass(ticker string) (string, string) {
+	i := strings.IndexAny(ticker, classSeparators)
+	if i <= 0 || i == len(ticker)-1 {
+		return ticker, ""
+	}
+	return ticker[:i], ticker[i+1:]
+}
+
+// Other ways a ticker with a share class may be listed, e.g. BRK.B as BRKB,
+// BRK-B or BRK/B.
+func tickerVariants(ticker string) []string {
+	base, class := splitClass(ticker)
+	if class == "" {
+		return nil
+	}
+
+	var variants []string
+	for _, v := range []string{base + "." + class, base + class, base + "-" + class, base + "/" + class} {
+		if v != ticker {
+			variants = append(variants, v)
+		}
+	}
+	return variants
+}
+
+// How a ticker listed on several exchanges other than the symbol's is
+// resolved. Without either it fails with ErrAmbiguousMatch.
+type MatchPolicy struct {
+	// Take the best scoring listing when no other scores as well
+	AssumeBest bool
+
+	// Called to pick one of the listings, best first, if set. Returns false
+	// to leave the symbol unresolved.
+	Choose func(sym store.Symbol, matches []Match) (Match, bool)
+}
+
+// Listing a ticker search returned, scored by how likely it is the one the
+// symbol means
+type Match struct {
+	SymbolID     int
+	Symbol       string
+	Exchange     string
+	Currency     string
+	SecurityType string
+	Description  string
+	Score        int
+}
+
+var (
+	// Country of each exchange Questrade lists
+	exchangeCountries = map[string]string{
+		"NYSE": "US", "NASDAQ": "US", "ARCA": "US", "AMEX": "US", "NYSEAM": "US", "BATS": "US", "OTCBB": "US", "PINX": "US",
+		"TSX": "CA", "TSXV": "CA", "CNSX": "CA", "NEO": "CA",
+	}
+	// Currency of the listings of each country
+	countryCurrencies = map[string]string{"US": "USD", "CA": "CAD"}
+)
+
+// Score a listing for a symbol: a listing in the country of the symbol's
+// exchange, in its currency, of the expected security type (an ETF for
+// benchmarks and a stock otherwise) and quotable scores higher.
+func scoreMatch(r qapi.SymbolSearchResult, sym store.Symbol) int {
+	score := 0
+	country := exchangeCountries[sym.Exchange]
+	if country != "" && exchangeCountries[r.ListingExchange] == country {
+		score += 2
+	}
+	if currency := countryCurrencies[country]; currency != "" && r.Currency == currency {
+		score += 2
+	}
+	want := "Stock"
+	if sym.Benchmark {
+		want = "ETF"
+	}
+	if r.SecurityType == want {
+		score += 2
+	}
+	if r.IsQuotable {
+		score++
+	}
+	return score
+}
+
+// Pick the listing of a ticker found on several exchanges according to the
+// policy.
+func (mp MatchPolicy) choose(sym store.Symbol, ticker string, res []qapi.SymbolSearchResult) (int, error) {
+	var matches []Match
+	for _, r := range res {
+		if r.Symbol == ticker {
+			matches = append(matches, Match{SymbolID: r.SymbolID, Symbol: r.Symbol, Exchange: r.ListingExchange, Currency: r.Currency,
+				SecurityType: r.SecurityType, Description: r.Description, Score: scoreMatch(r, sym)})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].Score > matches[j].Score
+	})
+
+	var exchanges []string
+	for _, m := range matches {
+		exchanges = append(exchanges, fmt.Sprintf("%s (score %d)", m.Exchange, m.Score))
+	}
+	ambiguous := fmt.Errorf("%w: %s is listed on %s but not %s", ErrAmbiguousMatch, ticker, strings.Join(exchanges, ", "), sym.Exchange)
+	switch {
+	case mp.Choose != nil:
+		m, ok := mp.Choose(sym, matches)
+		if !ok {
+			return 0, ambiguous
+		}
+		slog.Info("Resolved ambiguous ticker", "symbol", sym.Symbol, "exchange", sym.Exchange, "as", m.Symbol, "on", m.Exchange)
+		return m.SymbolID, nil
+	case mp.AssumeBest && matches[0].Score > matches[1].Score:
+		m := matches[0]
+		slog.Info("Resolved ambiguous ticker", "symbol", sym.Symbol, "exchange", sym.Exchange, "as", m.Symbol, "on", m.Exchange, "score", m.Score)
+		return m.SymbolID, nil
+	}
+	return 0, ambiguous
+}
+
+// Find the Questrade symbol ID of a symbol. When the ticker isn't listed
+// as given, the base ticker is searched and the results checked for
+// alternate spellings of the share class. A ticker listed on several other
+// exchanges is resolved by the match policy.
+func resolveSymbol(ctx context.Context, s *questradeSession, rp RetryPolicy, mp MatchPolicy, sym store.Symbol) (int, error) {
+	res, err := searchSymbols(ctx, s, rp, sym.Symbol)
+	if err != nil {
+		return 0, err
+	}
+	if id, _, ok := matchSymbol(res, []string{sym.Symbol}, sym.Exchange); ok {
+		return id, nil
+	}
+
+	variants := tickerVariants(sym.Symbol)
+	if t, ok := ambiguous(res, []string{sym.Symbol}); ok {
+		return mp.choose(sym, t, res)
+	}
+	if len(variants) == 0 {
+		return 0, fmt.Errorf("%w: %s", ErrSymbolNotFound, sym.Symbol)
+	}
+
+	// Results for the base ticker include every share class
+	base, _ := splitClass(sym.Symbol)
+	res, err = searchSymbols(ctx, s, rp, base)
+	if err != nil {
+		return 0, err
+	}
+	if id, match, ok := matchSymbol(res, variants, sym.Exchange); ok {
+		slog.Info("Resolved alternate ticker", "symbol", sym.Symbol, "exchange", sym.Exchange, "as", match)
+		return id, nil
+	}
+	if t, ok := ambiguous(res, variants); ok {
+		return mp.choose(sym, t, res)
+	}
+	return 0, fmt.Errorf("%w: %s (tried %s)", ErrSymbolNotFound, sym.Symbol, strings.Join(variants, ", "))
+}
+
+// The first of the tickers none of the search results matched on the
+// symbol's exchange that is listed on several other exchanges.
+func ambiguous(res []qapi.SymbolSearchResult, tickers []string) (string, bool) {
+	for _, t := range tickers {
+		seen := make(map[string]bool)
+		for _, r := range res {
+			if r.Symbol == t {
+				seen[r.ListingExchange] = true
+			}
+		}
+		if len(seen) > 1 {
+			return t, true
+		}
+	}
+	return "", false
+}
+
+func searchSymbols(ctx context.Context, s *questradeSession, rp RetryPolicy, prefix string) ([]qapi.SymbolSearchResult, error) {
+	var res []qapi.SymbolSearchResult
+	err := rp.Do(ctx, func() error {
+		if err := s.rl.Wait(ctx, MarketCalls); err != nil {
+			return err
+		}
+		return s.call(ctx, MarketCalls, func(c *qapi.Client) (err error) {
+			res, err = c.SearchSymbols(prefix, 0)
+			return err
+		})
+	})
+	return res, err
+}
+
+// Find the first search result listed on the exchange under one of the
+// tickers, returning its ID and ticker.
+func matchSymbol(res []qapi.SymbolSearchResult, tickers []string, exchange string) (int, string, bool) {
+	for _, t := range tickers {
+		for _, r := range res {
+			if r.Symbol == t && r.ListingExchange == exchange {
+				return r.SymbolID, r.Symbol, true
+			}
+		}
+	}
+	return 0, "", false
+}
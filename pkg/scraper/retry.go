@@ -0,0 +1,67 @@
+package scraper
+
+import (
+	"context"
+	"log/slog"
+	"math/rand"
+	"sync/atomic"
+	"time"
+)
+
+// Policy for retrying failed API calls with exponential backoff
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+// Call f until it succeeds, returns a permanent error, or the maximum number
+// of attempts is reached. The delay between attempts doubles each time, with
+// jitter so that retries don't line up with the rate limiter. Waiting
+// for a retry is abandoned when the context is cancelled.
+func (p RetryPolicy) Do(ctx context.Context, f func() error) error {
+	var err error
+	for attempt := 1; ; attempt++ {
+		countCall(ctx)
+		err = f()
+		if err == nil || err == context.Canceled {
+			return err
+		}
+		apiErrors.WithLabelValues(errorType(err)).Inc()
+		atomic.AddInt64(&apiErrorCount, 1)
+		if !isTransient(err) || attempt >= p.MaxAttempts {
+			return err
+		}
+
+		delay := p.Backoff(attempt)
+		slog.Warn("API call failed, retrying", "attempt", attempt, "delay", delay, "error", err)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Delay before the given attempt is retried, a random duration up to
+// BaseDelay * 2^(attempt-1) capped at MaxDelay.
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	d := p.BaseDelay << uint(attempt-1)
+	if d <= 0 || (p.MaxDelay > 0 && d > p.MaxDelay) {
+		d = p.MaxDelay
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// Rate limiting, server side and network errors are worth retrying.
+// Any other error response from the provider is a permanent failure.
+func isTransient(err error) bool {
+	switch errorType(err) {
+	case "rate_limited", "server", "network":
+		return true
+	}
+	return false
+}
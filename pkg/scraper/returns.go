@@ -0,0 +1,112 @@
+package scraper
+
+import (
+	"errors"
+	"log/slog"
+	"math"
+	"time"
+
+	"github.com/alexurquhart/sp500scraper/pkg/store"
+)
+
+// Windows, in trading days, of the rolling volatilities
+var volatilityWindows = [3]int{30, 90, 252}
+
+// Trading days in a year, used to annualize the volatilities
+const tradingDays = 252
+
+// Rebuild the daily returns of every symbol from the stored daily candles,
+// or the finest intraday candles if there are no daily ones. Each day has
+// the log return from the previous close, the annualized volatility of the
+// log returns over the last 30, 90 and 252 days, the drawdown from the
+// highest close so far and the largest drawdown so far, so the maximum
+// drawdown of a symbol is that of its last day. Closes are adjusted for
+// splits, found as for AdjustSplits.
+func ComputeReturns(st store.Store, splitsPath string) error {
+	entries, err := loadSplits(splitsPath)
+	if err != nil {
+		return err
+	}
+	symbols, err := st.Symbols()
+	if err != nil {
+		return err
+	}
+	intervals, err := st.Intervals()
+	if err != nil {
+		return err
+	}
+	daily := dailyInterval(intervals)
+	if daily == "" {
+		return errors.New("No daily or intraday candles to compute returns from")
+	}
+
+	computed := 0
+	for _, sym := range symbols {
+		candles, err := st.Candles(sym.SymbolID, daily, time.Time{}, time.Now().AddDate(1, 0, 0))
+		if err != nil {
+			return err
+		}
+		if len(candles) == 0 {
+			continue
+		}
+		if splits := symbolSplits(entries, sym, candles); len(splits) > 0 {
+			candles = adjustCandles(candles, splits)
+		}
+		if err := st.SaveReturns(sym.SymbolID, dailyReturns(dailyBars(candles))); err != nil {
+			return err
+		}
+		computed++
+	}
+	slog.Info("Computed returns", "symbols", computed)
+	return nil
+}
+
+// Returns of the daily bars, oldest first. Bars without a positive close are
+// left out, as they have no log return.
+func dailyReturns(bars []dayBar) []store.Return {
+	var days []store.Return
+	var logs []float64 // Log returns so far, for the volatilities
+	peak, worst := 0.0, 0.0
+	for _, b := range bars {
+		if b.Close <= 0 {
+			continue
+		}
+		c := float64(b.Close)
+		d := store.Return{Date: b.Date, Close: c}
+		if n := len(days); n > 0 {
+			r := math.Log(c / days[n-1].Close)
+			d.LogReturn = &r
+			logs = append(logs, r)
+		}
+		d.Volatility30 = volatility(logs, volatilityWindows[0])
+		d.Volatility90 = volatility(logs, volatilityWindows[1])
+		d.Volatility252 = volatility(logs, volatilityWindows[2])
+
+		peak = math.Max(peak, c)
+		d.Drawdown = c/peak - 1
+		worst = math.Min(worst, d.Drawdown)
+		d.MaxDrawdown = worst
+		days = append(days, d)
+	}
+	return days
+}
+
+// Annualized sample standard deviation of the last n log returns, nil until
+// there are n.
+func volatility(logs []float64, n int) *float64 {
+	if n < 2 || len(logs) < n {
+		return nil
+	}
+	window := logs[len(logs)-n:]
+	mean := 0.0
+	for _, r := range window {
+		mean += r
+	}
+	mean /= float64(n)
+	variance := 0.0
+	for _, r := range window {
+		variance += (r - mean) * (r - mean)
+	}
+	v := math.Sqrt(variance/float64(n-1)) * math.Sqrt(tradingDays)
+	return &v
+}
@@ -0,0 +1,758 @@
+// Package scraper fetches candlestick data for a list of symbols from a
+// data provider and saves it to a store.
+package scraper
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alexurquhart/sp500scraper/pkg/calendar"
+	"github.com/alexurquhart/sp500scraper/pkg/sink"
+	"github.com/alexurquhart/sp500scraper/pkg/store"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Time window and resolution of the candlestick data to request
+type CandleRange struct {
+	Start    time.Time
+	End      time.Time
+	Interval string
+}
+
+// Candlestick intervals supported by the Questrade API
+var Intervals = []string{
+	"OneMinute", "TwoMinutes", "ThreeMinutes", "FourMinutes", "FiveMinutes",
+	"TenMinutes", "FifteenMinutes", "TwentyMinutes", "HalfHour", "OneHour",
+	"TwoHours", "FourHours", "OneDay", "OneWeek", "OneMonth",
+}
+
+func ValidInterval(interval string) bool {
+	for _, i := range Intervals {
+		if i == interval {
+			return true
+		}
+	}
+	return false
+}
+
+// Date format of the start and end of a range
+const DateFormat = "2006-01-02"
+
+// Parse the start and end dates of a range, either of which may be empty.
+// Defaults to the last 5 years.
+func ParseRange(start, end, interval string) (CandleRange, error) {
+	now := time.Now()
+	r := CandleRange{Start: now.AddDate(-5, 0, 0), End: now, Interval: interval}
+
+	var err error
+	if start != "" {
+		r.Start, err = time.ParseInLocation(DateFormat, start, time.Local)
+		if err != nil {
+			return r, errors.New("Invalid start date: " + start)
+		}
+	}
+	if end != "" {
+		r.End, err = time.ParseInLocation(DateFormat, end, time.Local)
+		if err != nil {
+			return r, errors.New("Invalid end date: " + end)
+		}
+	}
+	if !r.End.After(r.Start) {
+		return r, errors.New("End date must be after start date")
+	}
+
+	if !ValidInterval(interval) {
+		return r, errors.New("Invalid interval: " + interval)
+	}
+	return r, nil
+}
+
+// Find data for the symbol - first the internal symbol identifier needs to be found
+// then candlestrick data is extracted for each range. The result should then be saved to a database.
+// The search is skipped for symbols that already have an ID from the cache.
+func findSymbol(ctx context.Context, p Provider, sym *store.Symbol, ranges []CandleRange) error {
+	if sym.SymbolID == 0 {
+		sctx, span := startSpan(ctx, "resolve symbol", sym.Symbol, sym.Exchange)
+		id, err := p.SearchSymbol(sctx, *sym)
+		endSpan(span, err)
+		if err != nil {
+			return err
+		}
+		sym.SymbolID = id
+		sym.Resolved = time.Now()
+	} else if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	var candles []store.Candle
+	for _, cr := range ranges {
+		cctx, span := startSpan(ctx, "fetch candles", sym.Symbol, sym.Exchange, attribute.String("interval", cr.Interval))
+		part, err := p.GetCandles(cctx, *sym, cr)
+		span.SetAttributes(attribute.Int("candles", len(part)))
+		endSpan(span, err)
+		if err != nil {
+			return err
+		}
+		candles = append(candles, part...)
+	}
+	sym.Candles = candles
+	return nil
+}
+
+// Starts n writer goroutines that iterate over a channel of incoming
+// symbols and save each in its own transaction to the store and then the
+// sinks, recording each saved symbol in the checkpoint and the summary, and
+// each symbol that couldn't be saved in failed. The
+// pool is cut to one writer for stores that only allow one at a time.
+// Returns an error channel, closed once every writer has finished. Sink
+// errors are logged rather than sent, so a failing sink doesn't stop the run.
+// The writers run until symChan is closed so that everything fetched before a
+// shutdown is still saved; ctx is only the parent of their spans.
+func saveData(ctx context.Context, wg *sync.WaitGroup, n int, st store.Store, sinks []sink.Sink, cp *Checkpoint, sum *Summary, failed *[]store.Failure, prog Progress, symChan chan store.Symbol) chan error {
+	if wl, ok := st.(store.WriterLimiter); ok && wl.MaxWriters() > 0 && n > wl.MaxWriters() {
+		slog.Debug("Store limits the number of writers", "writers", wl.MaxWriters(), "requested", n)
+		n = wl.MaxWriters()
+	}
+	if n < 1 {
+		n = 1
+	}
+
+	errChan := make(chan error)
+	var mu sync.Mutex // Guards the summary and failed
+	var writers sync.WaitGroup
+	writers.Add(n)
+	for i := 0; i < n; i++ {
+		go func() {
+			defer writers.Done()
+
+			// Iterate over all incoming symbols
+			for sym := range symChan {
+				_, span := startSpan(ctx, "save symbol", sym.Symbol, sym.Exchange, attribute.Int("candles", len(sym.Candles)))
+				err := st.SaveSymbol(sym)
+				endSpan(span, err)
+				if err != nil {
+					// Nothing of the symbol was saved, so it fails like one
+					// that couldn't be fetched
+					f := newFailure(sym, err)
+					f.Class = FailureDatabase
+					mu.Lock()
+					*failed = append(*failed, f)
+					mu.Unlock()
+					errChan <- errors.New("Could not save " + sym.Symbol + ": " + err.Error())
+					prog.Done(0)
+					continue
+				}
+				writeSinks(sinks, sym)
+				mu.Lock()
+				sum.Saved++
+				sum.Candles += len(sym.Candles)
+				mu.Unlock()
+				candlesStored.Add(float64(len(sym.Candles)))
+				prog.Done(len(sym.Candles))
+				if err := cp.Add(sym.Key()); err != nil {
+					errChan <- err
+				}
+			}
+		}()
+	}
+
+	go func() {
+		writers.Wait()
+		close(errChan)
+		wg.Done()
+	}()
+	return errChan
+}
+
+// Write a saved symbol to every sink. Errors are logged and counted per sink
+// so one failing sink doesn't keep the symbol from the others.
+func writeSinks(sinks []sink.Sink, sym store.Symbol) {
+	for _, sk := range sinks {
+		if err := sk.Write(sym); err != nil {
+			name := sink.Name(sk)
+			sinkErrors.WithLabelValues(name).Inc()
+			slog.Error("Could not write to sink", "sink", name, "symbol", sym.Symbol, "exchange", sym.Exchange, "error", err)
+		}
+	}
+}
+
+// Settings for a scrape
+type Config struct {
+	// Range and intervals of the candles, see ParseRange. Candles of every
+	// interval are fetched for each symbol and stored side by side.
+	Start     string
+	End       string
+	Intervals []string
+
+	// Only fetch candles newer than those already stored
+	Update bool
+
+	// Also fetch the latest dividend and a snapshot of the fundamentals
+	// of each symbol, dated with the day of the run
+	Dividends    bool
+	Fundamentals bool
+
+	// Also fetch the option chain of each symbol with a quote of every
+	// option, limited to the nearest OptionExpiries expiries unless zero
+	Options        bool
+	OptionExpiries int
+
+	// Also save a snapshot of the quotes of every symbol once the candles
+	// are saved, with providers that quote symbols
+	Quotes bool
+
+	// Number of symbols fetched concurrently
+	Workers int
+
+	// Number of passes over the symbols that failed, at the end of the run,
+	// and the wait before the first pass, doubled before each pass after
+	RetryPasses  int
+	RetryBackoff time.Duration
+
+	// Number of symbols saved concurrently, each in its own transaction.
+	// Stores that only allow one writer, such as SQLite, use one regardless.
+	Writers int
+
+	// Skip symbols saved by an interrupted run with the same range,
+	// recorded in the checkpoint file
+	Resume     bool
+	Checkpoint string
+
+	// How long cached symbol IDs are used before searching again, zero
+	// disables the cache
+	SymbolTTL time.Duration
+
+	// File to write symbols that could not be fetched to, and whether to
+	// also record them in the database
+	Report         string
+	RecordFailures bool
+
+	// Fetch symbols marked as delisted too. Symbols the provider can't find
+	// are marked as delisted either way.
+	IncludeDelisted bool
+
+	// Intervals built from the saved daily candles after saving instead of
+	// being fetched, OneWeek or OneMonth
+	Derive []string
+
+	// Rebuild the split adjusted candles after saving, using the splits
+	// listed in the splits file
+	Adjust bool
+	Splits string
+
+	// Rebuild the daily series of each sector after saving
+	Sectors bool
+
+	// Rebuild the daily returns and volatility of each symbol after saving
+	Returns bool
+
+	// Convert the prices of candles listed in other currencies to USD,
+	// recording the rate with each candle. Daily rates of the currencies
+	// found, and of FXCurrencies either way, are saved to the fx_rates table.
+	NormalizeUSD bool
+	FXCurrencies []string
+
+	// Trading days of the exchange, used to check that no daily candles are
+	// missing from what was fetched. Nil skips the check.
+	Calendar *calendar.Calendar
+
+	// Leave out the symbols that would take the run over the calls left in
+	// the provider's current window, queuing them to be fetched first by
+	// the next run. Otherwise the run slows down to wait for the next
+	// window.
+	DeferOverBudget bool
+
+	// Told about the progress of each symbol, may be nil
+	Progress Progress
+
+	// Name of the provider and version of the program, recorded with the
+	// run in the runs table
+	Provider string
+	Version  string
+}
+
+// Progress is told about each symbol of a run as it is worked on
+type Progress interface {
+	// A worker started fetching the symbol
+	Start(symbol string)
+
+	// A symbol was saved with the given number of candles, or failed
+	Done(candles int)
+
+	// A symbol didn't need fetching
+	Skip()
+}
+
+// Forwards progress, if there is anything to forward it to, and counts the
+// symbols done for the metrics
+type meteredProgress struct {
+	p Progress
+}
+
+func (m meteredProgress) Start(symbol string) {
+	if m.p != nil {
+		m.p.Start(symbol)
+	}
+}
+
+func (m meteredProgress) Done(candles int) {
+	runSymbolsDone.Inc()
+	if m.p != nil {
+		m.p.Done(candles)
+	}
+}
+
+func (m meteredProgress) Skip() {
+	runSymbolsDone.Inc()
+	if m.p != nil {
+		m.p.Skip()
+	}
+}
+
+// Outcome of a scrape
+type Summary struct {
+	Run      int // ID of the run in the runs table
+	Total    int
+	Saved    int
+	Candles  int
+	NotFound []store.Failure
+	Duration time.Duration
+
+	// Symbols skipped because they were delisted, and those found to be
+	// delisted by this run
+	Skipped  int
+	Delisted []store.Failure
+
+	// Set when the run was stopped before all symbols were fetched
+	Interrupted bool
+
+	// API calls made by the run, retries included, and the symbols left
+	// for the next run to stay within the call budget
+	Calls    int
+	Deferred int
+
+	// Number of the symbols in NotFound by class of failure
+	Failures map[string]int
+}
+
+// Scraper fetches candles from a provider and saves them to a store, and to
+// any sinks. Symbols the provider can't fetch are fetched from the fallback
+// provider if set, and the earnings of each symbol are fetched from the
+// earnings provider if set.
+type Scraper struct {
+	Provider Provider
+	Fallback Provider
+	Earnings EarningsProvider
+	Store    store.Store
+	Sinks    []sink.Sink
+	Config   Config
+}
+
+// Create a scraper saving the candles fetched from p to st.
+func New(p Provider, st store.Store, cfg Config) *Scraper {
+	return &Scraper{Provider: p, Store: st, Config: cfg}
+}
+
+// Fetch candles for all symbols and save them to the store. When the context
+// is cancelled no more symbols are started, but those in flight are
+// finished and saved.
+func (s *Scraper) Run(ctx context.Context, symbols []store.Symbol) (Summary, error) {
+	p, st, rc := s.Provider, s.Store, s.Config
+	began := time.Now()
+	ctx, span := tracer.Start(ctx, "run", trace.WithAttributes(attribute.String("provider", rc.Provider),
+		attribute.Int("symbols", len(symbols))))
+	defer span.End()
+	y, m, d := began.Date()
+	day := time.Date(y, m, d, 0, 0, 0, 0, began.Location())
+	sum := Summary{Total: len(symbols)}
+	runSymbols.Set(float64(len(symbols)))
+	runSymbolsDone.Set(0)
+	prog := meteredProgress{rc.Progress}
+
+	if len(rc.Intervals) == 0 {
+		return sum, errors.New("No intervals to fetch")
+	}
+	var err error
+	ranges := make([]CandleRange, len(rc.Intervals))
+	for i, interval := range rc.Intervals {
+		if ranges[i], err = ParseRange(rc.Start, rc.End, interval); err != nil {
+			return sum, err
+		}
+	}
+	intervals := strings.Join(rc.Intervals, ",")
+
+	// Rates over the whole range, so one request covers every symbol
+	var fx *fxConverter
+	if rc.NormalizeUSD || len(rc.FXCurrencies) > 0 {
+		start := ranges[0].Start
+		for _, cr := range ranges {
+			if cr.Start.Before(start) {
+				start = cr.Start
+			}
+		}
+		fx = newFXConverter(st, start, time.Now())
+		for _, currency := range rc.FXCurrencies {
+			if _, err := fx.series(ctx, currency); err != nil {
+				slog.Error("Could not load FX rates", "currency", currency, "error", err)
+			}
+		}
+		if !rc.NormalizeUSD {
+			fx = nil
+		}
+	}
+
+	// In update mode find where each symbol left off in each interval so
+	// only new candles are requested
+	latest := make([]map[string]time.Time, len(ranges))
+	for i, cr := range ranges {
+		latest[i] = make(map[string]time.Time)
+		if rc.Update {
+			if latest[i], err = st.LatestCandles(cr.Interval); err != nil {
+				return sum, err
+			}
+			slog.Info("Found existing candles", "interval", cr.Interval, "symbols", len(latest[i]))
+		}
+	}
+
+	// Symbol IDs found by previous runs, which saves a search per symbol
+	cached := make(map[string]store.Symbol)
+	if rc.SymbolTTL > 0 {
+		cached, err = st.CachedSymbols(time.Now().Add(-rc.SymbolTTL))
+		if err != nil {
+			return sum, err
+		}
+		slog.Info("Using cached symbol IDs", "symbols", len(cached))
+	}
+
+	// Symbols fetched by the fallback are saved under their stored IDs
+	storedIDs := make(map[string][]int)
+	if s.Fallback != nil {
+		stored, err := st.Symbols()
+		if err != nil {
+			return sum, err
+		}
+		for _, sym := range stored {
+			storedIDs[sym.Key()] = append(storedIDs[sym.Key()], sym.SymbolID)
+		}
+	}
+
+	// Delisted symbols are skipped, their candles stay in the store
+	delisted := make(map[string]time.Time)
+	if !rc.IncludeDelisted {
+		if delisted, err = st.Delisted(); err != nil {
+			return sum, err
+		}
+	}
+
+	// Symbols still failing at the end of earlier runs go first
+	queued, err := st.RetryQueue()
+	if err != nil {
+		return sum, err
+	}
+	if len(queued) > 0 {
+		first := make(map[string]bool, len(queued))
+		for _, f := range queued {
+			first[f.Symbol+":"+f.Exchange] = true
+		}
+		ordered := make([]store.Symbol, 0, len(symbols))
+		for _, sym := range symbols {
+			if first[sym.Key()] {
+				ordered = append(ordered, sym)
+			}
+		}
+		for _, sym := range symbols {
+			if !first[sym.Key()] {
+				ordered = append(ordered, sym)
+			}
+		}
+		symbols = ordered
+		slog.Info("Fetching symbols queued by earlier runs first", "symbols", len(queued))
+	}
+
+	// Load the symbols already saved by an interrupted run
+	cp, err := loadCheckpoint(rc.Checkpoint, rc.Start+"|"+rc.End+"|"+intervals, rc.Resume)
+	if err != nil {
+		return sum, err
+	}
+	if rc.Resume {
+		slog.Info("Resuming", "saved", len(cp.Saved))
+	}
+
+	// Record the run so the candles it saves can be traced back to it
+	run := store.Run{Started: began, Interval: intervals, Provider: rc.Provider, Version: rc.Version}
+	if run.ID, err = st.StartRun(run); err != nil {
+		return sum, err
+	}
+	sum.Run = run.ID
+
+	// Create a new wait group so that we block until all goroutines
+	// are finished (saving to the database takes awhile)
+	var wg sync.WaitGroup
+	wg.Add(2)
+
+	// Create a channel for the populated symbol structs to be sent over
+	// to be saved to the database.
+	symChan := make(chan store.Symbol)
+	var unsaved []store.Failure
+	errChan := saveData(ctx, &wg, rc.Writers, st, s.Sinks, cp, &sum, &unsaved, prog, symChan)
+	stopChan := make(chan bool)
+
+	// Separate goroutine to output database write errors
+	go func(wg *sync.WaitGroup, errChan chan error) {
+		for err := range errChan {
+			DBErrors.Inc()
+			slog.Error("DB error", "error", err)
+		}
+		slog.Debug("DB error logging stopped")
+		close(stopChan)
+		wg.Done()
+	}(&wg, errChan)
+
+	// Collect the symbols that could not be fetched. Stored symbols the
+	// provider no longer knows are marked as delisted instead of failing
+	// every run. Failures that get another pass are only counted as done
+	// with count set.
+	collect := func(failChan chan store.Failure, count bool) chan []store.Failure {
+		done := make(chan []store.Failure, 1)
+		go func() {
+			var failed []store.Failure
+			for f := range failChan {
+				if f.NotFound || count {
+					prog.Done(0)
+				}
+				if f.NotFound {
+					marked, err := st.MarkDelisted(f.Symbol, f.Exchange, f.Time)
+					if err != nil {
+						DBErrors.Inc()
+						slog.Error("Could not mark symbol as delisted", "symbol", f.Symbol, "exchange", f.Exchange, "error", err)
+					} else if marked {
+						slog.Warn("Marked symbol as delisted", "symbol", f.Symbol, "exchange", f.Exchange, "error", f.Reason)
+						sum.Delisted = append(sum.Delisted, f)
+						continue
+					}
+				}
+				failed = append(failed, f)
+			}
+			done <- failed
+		}()
+		return done
+	}
+
+	// Work out what each symbol needs fetching before starting, so the
+	// calls of the run can be weighed against the budget
+	var pending []fetchJob
+	for _, sym := range symbols {
+		if cp.Done(sym.Key()) {
+			prog.Skip()
+			continue
+		}
+
+		if at, ok := delisted[sym.Key()]; ok {
+			slog.Debug("Skipping delisted symbol", "symbol", sym.Symbol, "exchange", sym.Exchange, "delisted", at)
+			sum.Skipped++
+			prog.Skip()
+			continue
+		}
+
+		if c, ok := cached[sym.Key()]; ok {
+			sym.SymbolID = c.SymbolID
+			sym.Resolved = c.Resolved
+		}
+
+		var symRanges []CandleRange
+		for i, cr := range ranges {
+			if end, ok := latest[i][sym.Key()]; ok {
+				if !end.Before(cr.End) {
+					continue
+				}
+				cr.Start = end
+			}
+			symRanges = append(symRanges, cr)
+		}
+		if len(symRanges) == 0 {
+			slog.Debug("Symbol is up to date", "symbol", sym.Symbol, "exchange", sym.Exchange)
+			prog.Skip()
+			continue
+		}
+		sym.Run = run.ID
+		pending = append(pending, fetchJob{Symbol: sym, Ranges: symRanges, Dividends: rc.Dividends, Fundamentals: rc.Fundamentals,
+			Day: day, Options: rc.Options, OptionExpiries: rc.OptionExpiries, Calendar: rc.Calendar, FX: fx, StoredIDs: storedIDs[sym.Key()]})
+	}
+	pending, deferred := s.budget(pending)
+	for range deferred {
+		prog.Skip()
+	}
+	sum.Deferred = len(deferred)
+
+	// Fan the symbols out to a pool of workers, remembering the job of each
+	// so failures can be sent again
+	ctx, calls := withCallCounter(ctx)
+	jobs := make(chan fetchJob)
+	failDone := collect(fetchSymbols(ctx, rc.Workers, p, s.Fallback, s.Earnings, prog, jobs, symChan), rc.RetryPasses < 1)
+	sent := make(map[string]fetchJob)
+
+	completed := true
+L:
+	for _, job := range pending {
+		select {
+		case _, ok := <-stopChan: // Break the loop if a critical DB error occurs in the other goroutine
+			if !ok {
+				completed = false
+				break L
+			}
+		case <-ctx.Done(): // Stop starting new symbols on shutdown
+			completed = false
+			break L
+		default:
+		}
+
+		select {
+		case jobs <- job:
+			run.Symbols++
+			sent[job.Symbol.Key()] = job
+		case <-ctx.Done():
+			completed = false
+			break L
+		}
+	}
+	close(jobs)
+	notFound := <-failDone
+
+	// Symbols that failed for any reason other than being unknown get more
+	// passes at the end of the run, each after a longer wait, as the
+	// problem may have cleared. If the run is stopped before a pass its
+	// symbols stay failed, those a stopped pass didn't get to are left for a
+	// resumed run like the rest of an interrupted run.
+	delay := rc.RetryBackoff
+	for pass := 1; pass <= rc.RetryPasses && completed; pass++ {
+		var retry []fetchJob
+		var failed []store.Failure
+		for _, f := range notFound {
+			if job, ok := sent[f.Symbol+":"+f.Exchange]; ok && !f.NotFound {
+				retry = append(retry, job)
+			} else {
+				failed = append(failed, f)
+			}
+		}
+		if len(retry) == 0 {
+			break
+		}
+		slog.Info("Retrying failed symbols", "pass", pass, "symbols", len(retry), "delay", delay)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			completed = false
+			continue
+		}
+
+		retryJobs := make(chan fetchJob)
+		retryDone := collect(fetchSymbols(ctx, rc.Workers, p, s.Fallback, s.Earnings, prog, retryJobs, symChan), pass == rc.RetryPasses)
+		for _, job := range retry {
+			retryJobs <- job
+		}
+		close(retryJobs)
+		notFound = append(failed, <-retryDone...)
+		if ctx.Err() != nil {
+			completed = false
+			continue
+		}
+		delay *= 2
+	}
+	close(symChan)
+	slog.Info("Waiting for data to be saved")
+	wg.Wait()
+
+	// The checkpoint is only needed to resume an incomplete run
+	if completed {
+		if err := cp.Remove(); err != nil {
+			slog.Error("Could not remove checkpoint", "error", err)
+		}
+	}
+
+	// Symbols that failed to save are queued and reported like those that
+	// failed to fetch
+	notFound = append(notFound, unsaved...)
+	sum.NotFound = notFound
+	sum.Duration = time.Since(began)
+	sum.Interrupted = !completed
+	sum.Calls = calls.calls()
+
+	run.Finished = time.Now()
+	run.Failed = len(notFound)
+	run.Failures = CountFailures(notFound)
+	sum.Failures = run.Failures
+	for class, n := range run.Failures {
+		symbolFailures.WithLabelValues(class).Add(float64(n))
+	}
+	run.Candles = sum.Candles
+	if err := st.FinishRun(run); err != nil {
+		DBErrors.Inc()
+		slog.Error("Could not record run", "error", err)
+	}
+
+	if rc.Report != "" {
+		if err := writeFailureReport(rc.Report, notFound); err != nil {
+			slog.Error("Could not write failure report", "error", err)
+		}
+	}
+	// Symbols still failing are fetched first by the next run. A run that
+	// didn't finish leaves the symbols it didn't get to in the queue.
+	var queue []store.Failure
+	for _, f := range notFound {
+		if !f.NotFound {
+			queue = append(queue, f)
+		}
+	}
+	for _, job := range deferred {
+		queue = append(queue, deferredFailure(job.Symbol))
+	}
+	if err := st.QueueRetries(queue, completed); err != nil {
+		DBErrors.Inc()
+		slog.Error("Could not queue failed symbols for the next run", "error", err)
+	}
+	if rc.RecordFailures && len(notFound) > 0 {
+		if err := st.SaveFailures(notFound); err != nil {
+			slog.Error("Could not save failures", "error", err)
+		}
+	}
+	if rc.Quotes && ctx.Err() == nil {
+		if qp, ok := p.(QuoteProvider); !ok {
+			slog.Warn("Provider doesn't quote symbols, no quote snapshot taken", "provider", rc.Provider)
+		} else if err := snapshotQuotes(ctx, qp, st, symbols, run.ID); err != nil {
+			slog.Error("Could not save quote snapshot", "error", err)
+		}
+	}
+	// Before the splits are adjusted, so the derived candles are adjusted too
+	if len(rc.Derive) > 0 {
+		if err := DeriveCandles(st, run.ID, rc.Derive); err != nil {
+			slog.Error("Could not derive candles", "error", err)
+		}
+	}
+	if sum.Candles > 0 || len(rc.Derive) > 0 {
+		if err := st.RefreshLatestCloses(); err != nil {
+			DBErrors.Inc()
+			slog.Error("Could not refresh latest closes", "error", err)
+		}
+	}
+	if rc.Adjust {
+		if err := AdjustSplits(st, rc.Splits); err != nil {
+			slog.Error("Could not adjust candles for splits", "error", err)
+		}
+	}
+	if rc.Sectors {
+		if err := AggregateSectors(st, rc.Splits); err != nil {
+			slog.Error("Could not aggregate sectors", "error", err)
+		}
+	}
+	if rc.Returns {
+		if err := ComputeReturns(st, rc.Splits); err != nil {
+			slog.Error("Could not compute returns", "error", err)
+		}
+	}
+	return sum, nil
+}
@@ -0,0 +1,118 @@
+package scraper
+
+import (
+	"errors"
+	"log/slog"
+	"sort"
+	"time"
+
+	"github.com/alexurquhart/sp500scraper/pkg/store"
+)
+
+// Close and volume of a symbol over a day
+type dayBar struct {
+	Date   time.Time
+	Close  float32
+	Volume int
+}
+
+// Combine candles, oldest first, into one bar per day.
+func dailyBars(candles []store.Candle) []dayBar {
+	var bars []dayBar
+	for _, c := range candles {
+		d := BucketStart(c.Start, "OneDay")
+		if n := len(bars); n > 0 && bars[n-1].Date.Equal(d) {
+			bars[n-1].Close = c.Close
+			bars[n-1].Volume += c.Volume
+			continue
+		}
+		bars = append(bars, dayBar{Date: d, Close: c.Close, Volume: c.Volume})
+	}
+	return bars
+}
+
+// Rebuild the daily series of every sector from the stored daily candles, or
+// the finest intraday candles if there are no daily ones. A symbol's sector
+// is its industry, the GICS sector for the S&P 500. Returns are from one
+// day's close to the next and are adjusted for splits, found as for
+// AdjustSplits, so a split doesn't show up as a crash. The first day of each
+// symbol has no return but its volume is counted.
+func AggregateSectors(st store.Store, splitsPath string) error {
+	entries, err := loadSplits(splitsPath)
+	if err != nil {
+		return err
+	}
+	symbols, err := st.Symbols()
+	if err != nil {
+		return err
+	}
+	intervals, err := st.Intervals()
+	if err != nil {
+		return err
+	}
+	daily := dailyInterval(intervals)
+	if daily == "" {
+		return errors.New("No daily or intraday candles to aggregate")
+	}
+
+	type key struct {
+		sector string
+		date   time.Time
+	}
+	days := make(map[key]*store.SectorDay)
+	for _, sym := range symbols {
+		// Sector ETFs are benchmarks for the sector, not members of it
+		if sym.Industry == "" || sym.Benchmark {
+			continue
+		}
+		candles, err := st.Candles(sym.SymbolID, daily, time.Time{}, time.Now().AddDate(1, 0, 0))
+		if err != nil {
+			return err
+		}
+		if splits := symbolSplits(entries, sym, candles); len(splits) > 0 {
+			candles = adjustCandles(candles, splits)
+		}
+
+		bars := dailyBars(candles)
+		for i, b := range bars {
+			k := key{sym.Industry, b.Date}
+			d, ok := days[k]
+			if !ok {
+				d = &store.SectorDay{Sector: sym.Industry, Date: b.Date}
+				days[k] = d
+			}
+			d.Volume += b.Volume
+			if i == 0 || bars[i-1].Close <= 0 {
+				continue
+			}
+			r := float64(b.Close)/float64(bars[i-1].Close) - 1
+			d.Return += r
+			d.Symbols++
+			switch {
+			case r > 0:
+				d.Advancers++
+			case r < 0:
+				d.Decliners++
+			}
+		}
+	}
+
+	series := make([]store.SectorDay, 0, len(days))
+	for _, d := range days {
+		if d.Symbols > 0 {
+			d.Return /= float64(d.Symbols)
+		}
+		series = append(series, *d)
+	}
+	sort.Slice(series, func(i, j int) bool {
+		if series[i].Sector != series[j].Sector {
+			return series[i].Sector < series[j].Sector
+		}
+		return series[i].Date.Before(series[j].Date)
+	})
+	if err := st.SaveSectorDaily(series); err != nil {
+		return err
+	}
+	slog.Info("Aggregated sectors", "days", len(series))
+	return nil
+}
@@ -0,0 +1,36 @@
+package scraper
+
+import (
+	"github.com/alexurquhart/sp500scraper/pkg/calendar"
+	"github.com/alexurquhart/sp500scraper/pkg/store"
+)
+
+// Calendar sessions are taken from when the run has none
+var defaultCalendar, _ = calendar.Find("NYSE")
+
+// Tag each candle without a session with the session it starts in, by the
+// regular trading hours of the calendar. Daily and longer candles, and
+// those on days the exchange is closed, are regular.
+func tagSessions(cal *calendar.Calendar, candles []store.Candle) {
+	if cal == nil {
+		cal = defaultCalendar
+	}
+	for i := range candles {
+		c := &candles[i]
+		if c.Session != "" {
+			continue
+		}
+		c.Session = store.SessionRegular
+		if _, ok := intervalDurations[c.Interval]; !ok {
+			continue
+		}
+		open, close, ok := cal.Session(c.Start)
+		switch {
+		case !ok:
+		case c.Start.Before(open):
+			c.Session = store.SessionPre
+		case !c.Start.Before(close):
+			c.Session = store.SessionPost
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package scraper
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log/slog"
+	"math"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/alexurquhart/sp500scraper/pkg/store"
+)
+
+// Entry of the splits file, dated with DateFormat
+type splitEntry struct {
+	Symbol   string  `json:"symbol"`
+	Exchange string  `json:"exchange,omitempty"`
+	Date     string  `json:"date"`
+	Ratio    float64 `json:"ratio"`
+}
+
+// Ratios recognized as splits when the price jumps between days
+var splitRatios = []float64{2, 3, 4, 5, 10, 1.5, 1.0 / 2, 1.0 / 3, 1.0 / 4, 1.0 / 5, 1.0 / 10}
+
+// How close the jump must be to one of splitRatios
+const splitTolerance = 0.03
+
+// Read the splits file, keyed by ticker. A missing file has no splits.
+func loadSplits(path string) (map[string][]splitEntry, error) {
+	splits := make(map[string][]splitEntry)
+	file, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return splits, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var entries []splitEntry
+	if err := json.Unmarshal(file, &entries); err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if e.Ratio <= 0 {
+			return nil, errors.New("Invalid split ratio for " + e.Symbol + " in " + path)
+		}
+		if _, err := time.ParseInLocation(DateFormat, e.Date, time.Local); err != nil {
+			return nil, errors.New("Invalid split date for " + e.Symbol + " in " + path + ": " + e.Date)
+		}
+		splits[strings.ToUpper(e.Symbol)] = append(splits[strings.ToUpper(e.Symbol)], e)
+	}
+	return splits, nil
+}
+
+// Splits from the file that apply to a symbol, or false if the symbol isn't
+// listed.
+func fileSplits(entries map[string][]splitEntry, sym store.Symbol) ([]store.Split, bool) {
+	var splits []store.Split
+	listed := false
+	for _, e := range entries[sym.Symbol] {
+		if e.Exchange != "" && e.Exchange != sym.Exchange {
+			continue
+		}
+		listed = true
+		date, _ := time.ParseInLocation(DateFormat, e.Date, time.Local)
+		splits = append(splits, store.Split{Date: date, Ratio: e.Ratio, Source: "file"})
+	}
+	return splits, listed
+}
+
+// Find splits from the jump between one day's close and the next day's
+// open, oldest first. A jump is taken to be a split when it is within
+// splitTolerance of a common split ratio.
+func detectSplits(candles []store.Candle) []store.Split {
+	var splits []store.Split
+	for i := 1; i < len(candles); i++ {
+		prev, cur := candles[i-1], candles[i]
+		if prev.Close <= 0 || cur.Open <= 0 || BucketStart(prev.Start, "OneDay").Equal(BucketStart(cur.Start, "OneDay")) {
+			continue
+		}
+		jump := float64(prev.Close) / float64(cur.Open)
+		for _, r := range splitRatios {
+			if math.Abs(jump/r-1) < splitTolerance {
+				splits = append(splits, store.Split{Date: BucketStart(cur.Start, "OneDay"), Ratio: r, Source: "detected"})
+				break
+			}
+		}
+	}
+	return splits
+}
+
+// Splits of a symbol, from the splits file if it is listed there or
+// detected from its candles otherwise.
+func symbolSplits(entries map[string][]splitEntry, sym store.Symbol, candles []store.Candle) []store.Split {
+	if splits, listed := fileSplits(entries, sym); listed {
+		return splits
+	}
+	return detectSplits(candles)
+}
+
+// Adjust candles, oldest first, for the splits that happened after them so
+// prices are comparable across the splits.
+func adjustCandles(candles []store.Candle, splits []store.Split) []store.Candle {
+	adjusted := make([]store.Candle, len(candles))
+	for i, c := range candles {
+		factor := 1.0
+		for _, s := range splits {
+			if c.Start.Before(s.Date) {
+				factor *= s.Ratio
+			}
+		}
+		c.Open = float32(float64(c.Open) / factor)
+		c.High = float32(float64(c.High) / factor)
+		c.Low = float32(float64(c.Low) / factor)
+		c.Close = float32(float64(c.Close) / factor)
+		c.Volume = int(float64(c.Volume) * factor)
+		adjusted[i] = c
+	}
+	return adjusted
+}
+
+// Find the splits of every stored symbol and rebuild its adjusted candles.
+// Symbols in the splits file use the splits listed there, which is how
+// detected splits are corrected; the splits of other symbols are detected
+// from their daily candles, or the finest intraday ones if they don't have
+// daily candles, and applied to the candles of every interval. Everything is
+// recomputed so new candles and new splits are both picked up.
+func AdjustSplits(st store.Store, path string) error {
+	entries, err := loadSplits(path)
+	if err != nil {
+		return err
+	}
+	symbols, err := st.Symbols()
+	if err != nil {
+		return err
+	}
+	intervals, err := st.Intervals()
+	if err != nil {
+		return err
+	}
+	daily := dailyInterval(intervals)
+
+	adjusted := 0
+	for _, sym := range symbols {
+		candles, err := st.Candles(sym.SymbolID, "", time.Time{}, time.Now().AddDate(1, 0, 0))
+		if err != nil {
+			return err
+		}
+		splits := symbolSplits(entries, sym, filterInterval(candles, daily))
+		for _, s := range splits {
+			if s.Source == "detected" {
+				slog.Debug("Detected split", "symbol", sym.Symbol, "exchange", sym.Exchange, "date", s.Date.Format(DateFormat), "ratio", s.Ratio)
+			}
+		}
+
+		var adj []store.Candle
+		if len(splits) > 0 {
+			adj = adjustCandles(candles, splits)
+			adjusted++
+		}
+		if err := st.SaveAdjusted(sym.SymbolID, splits, adj); err != nil {
+			return err
+		}
+	}
+	slog.Info("Adjusted candles for splits", "symbols", adjusted)
+	return nil
+}
@@ -0,0 +1,39 @@
+package scraper
+
+import (
+	"errors"
+	"sort"
+	"strings"
+)
+
+// Throttle is a preset of how hard the API is pushed: the most calls per
+// second, the calls that may be made at once after a pause and the number
+// of symbols fetched concurrently.
+type Throttle struct {
+	Rate    float64
+	Burst   int
+	Workers int
+}
+
+// Named throttles. Conservative leaves most of a shared key's limit to
+// other users, normal is the default flags and aggressive gets close to
+// Questrade's limit of 20 market data calls per second.
+var throttles = map[string]Throttle{
+	"conservative": {Rate: 1, Burst: 1, Workers: 1},
+	"normal":       {Rate: 5, Burst: 1, Workers: 4},
+	"aggressive":   {Rate: 20, Burst: 10, Workers: 16},
+}
+
+// Look up a throttle by name.
+func FindThrottle(name string) (Throttle, error) {
+	t, ok := throttles[name]
+	if !ok {
+		var names []string
+		for n := range throttles {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return t, errors.New("Unknown throttle " + name + ", expected one of " + strings.Join(names, ", ") + " or custom")
+	}
+	return t, nil
+}
@@ -0,0 +1,222 @@
+package scraper
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/alexurquhart/sp500scraper/pkg/store"
+)
+
+// End of day and intraday endpoints of the Tiingo API, followed by the
+// ticker and /prices
+const (
+	tiingoDailyURL    = "https://api.tiingo.com/tiingo/daily/"
+	tiingoIntradayURL = "https://api.tiingo.com/iex/"
+)
+
+// Candles are kept in the exchange's time zone, Tiingo stamps them in UTC
+const tiingoZone = "America/New_York"
+
+// Most intraday rows Tiingo returns per request, longer ranges are fetched
+// in windows of at most this many bars
+const tiingoIntradayRows = 10000
+
+// Bars of the regular session, used to size the intraday windows
+const tiingoSessionMinutes = 390
+
+// Minutes of the intraday bars fetched for each interval. Like Polygon.io,
+// hourly and longer intervals are built from half hour bars so none
+// straddle the open.
+var tiingoIntervals = map[string]struct {
+	minutes int
+	source  string
+}{
+	"OneMinute":      {1, "OneMinute"},
+	"TwoMinutes":     {2, "TwoMinutes"},
+	"ThreeMinutes":   {3, "ThreeMinutes"},
+	"FourMinutes":    {4, "FourMinutes"},
+	"FiveMinutes":    {5, "FiveMinutes"},
+	"TenMinutes":     {10, "TenMinutes"},
+	"FifteenMinutes": {15, "FifteenMinutes"},
+	"TwentyMinutes":  {20, "TwentyMinutes"},
+	"HalfHour":       {30, "HalfHour"},
+	"OneHour":        {30, "HalfHour"},
+	"TwoHours":       {30, "HalfHour"},
+	"FourHours":      {30, "HalfHour"},
+}
+
+// Error response from the Tiingo API
+type tiingoError struct {
+	StatusCode int
+	Detail     string
+}
+
+func (e tiingoError) Error() string {
+	return fmt.Sprintf("Tiingo error %d: %s", e.StatusCode, e.Detail)
+}
+
+// Row of an end of day or intraday prices response. Only end of day rows
+// have the adjusted close.
+type tiingoPrice struct {
+	Date     time.Time `json:"date"`
+	Open     float32   `json:"open"`
+	High     float32   `json:"high"`
+	Low      float32   `json:"low"`
+	Close    float32   `json:"close"`
+	Volume   float64   `json:"volume"`
+	AdjClose float32   `json:"adjClose"`
+}
+
+// Provider backed by the Tiingo API, serving daily and longer candles from
+// its end of day prices and intraday candles from its IEX prices. Prices are
+// not adjusted, but daily candles carry Tiingo's close adjusted for splits
+// and dividends. Intraday volume is only that traded on IEX.
+type tiingoProvider struct {
+	key    string
+	client *http.Client
+	rl     *RateLimiter
+	rp     RetryPolicy
+}
+
+func newTiingoProvider(key string, rp RetryPolicy, rate float64, burst int) (*tiingoProvider, error) {
+	if key == "" {
+		return nil, errors.New("Tiingo needs an API key")
+	}
+	if rate <= 0 {
+		return nil, errors.New("The rate limit must be positive")
+	}
+	return &tiingoProvider{
+		key:    key,
+		client: &http.Client{Timeout: 30 * time.Second},
+		rl:     NewRateLimiter(rate, burst),
+		rp:     rp,
+	}, nil
+}
+
+func (p *tiingoProvider) RateLimits() []map[string]RateLimitState {
+	return []map[string]RateLimitState{p.rl.State()}
+}
+
+// Tiingo identifies symbols by ticker, with the share class after a dash
+// like Yahoo, and shares Yahoo's IDs.
+func (p *tiingoProvider) SearchSymbol(ctx context.Context, sym store.Symbol) (int, error) {
+	return tickerID(yahooTicker(sym.Symbol)), nil
+}
+
+func (p *tiingoProvider) GetCandles(ctx context.Context, sym store.Symbol, cr CandleRange) ([]store.Candle, error) {
+	loc, err := time.LoadLocation(tiingoZone)
+	if err != nil {
+		loc = time.UTC
+	}
+	ticker := url.PathEscape(yahooTicker(sym.Symbol))
+
+	switch cr.Interval {
+	case "OneDay", "OneWeek", "OneMonth":
+		from := BucketStart(cr.Start.In(loc), "OneDay")
+		q := url.Values{}
+		q.Set("startDate", from.Format(DateFormat))
+		q.Set("endDate", cr.End.In(loc).Format(DateFormat))
+		var prices []tiingoPrice
+		if err := p.fetch(ctx, tiingoDailyURL+ticker+"/prices?"+q.Encode(), &prices); err != nil {
+			return nil, err
+		}
+
+		var candles []store.Candle
+		for _, bar := range prices {
+			// Days are stamped with midnight UTC
+			y, m, d := bar.Date.UTC().Date()
+			start := time.Date(y, m, d, 0, 0, 0, 0, loc)
+			if start.Before(from) || !start.Before(cr.End) {
+				continue
+			}
+			c := tiingoCandle(bar, start, "OneDay")
+			c.AdjClose = bar.AdjClose
+			candles = append(candles, c)
+		}
+		// Combines the daily candles into weekly or monthly ones
+		return Resample(candles, cr.Interval), nil
+	}
+
+	bars, ok := tiingoIntervals[cr.Interval]
+	if !ok {
+		return nil, fmt.Errorf("Interval %s not supported by Tiingo", cr.Interval)
+	}
+	days := tiingoIntradayRows * bars.minutes / tiingoSessionMinutes
+	if days < 1 {
+		days = 1
+	}
+	var candles []store.Candle
+	for from := BucketStart(cr.Start.In(loc), "OneDay"); from.Before(cr.End); from = from.AddDate(0, 0, days) {
+		q := url.Values{}
+		q.Set("startDate", from.Format(DateFormat))
+		q.Set("endDate", from.AddDate(0, 0, days-1).Format(DateFormat))
+		q.Set("resampleFreq", fmt.Sprintf("%dmin", bars.minutes))
+		q.Set("columns", "open,high,low,close,volume")
+		var prices []tiingoPrice
+		if err := p.fetch(ctx, tiingoIntradayURL+ticker+"/prices?"+q.Encode(), &prices); err != nil {
+			return nil, err
+		}
+		for _, bar := range prices {
+			start := bar.Date.In(loc)
+			if start.Before(cr.Start) || !start.Before(cr.End) {
+				continue
+			}
+			candles = append(candles, tiingoCandle(bar, start, bars.source))
+		}
+	}
+	// Combines the half hour candles fetched for coarser intervals
+	return Resample(candles, cr.Interval), nil
+}
+
+func tiingoCandle(bar tiingoPrice, start time.Time, interval string) store.Candle {
+	return store.Candle{
+		Start:    start,
+		End:      candleEnd(start, interval),
+		Open:     bar.Open,
+		High:     bar.High,
+		Low:      bar.Low,
+		Close:    bar.Close,
+		Volume:   int(bar.Volume),
+		Interval: interval,
+	}
+}
+
+// Request the URL under the rate limit and retry policy.
+func (p *tiingoProvider) fetch(ctx context.Context, u string, out interface{}) error {
+	return p.rp.Do(ctx, func() error {
+		p.rl.waitCandles()
+		return p.get(u, out)
+	})
+}
+
+// Request the URL with the key, decoding the detail Tiingo reports with
+// non-200 responses.
+func (p *tiingoProvider) get(u string, out interface{}) error {
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Token "+p.key)
+	res, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		e := tiingoError{StatusCode: res.StatusCode, Detail: res.Status}
+		var body struct {
+			Detail string `json:"detail"`
+		}
+		if json.NewDecoder(res.Body).Decode(&body) == nil && body.Detail != "" {
+			e.Detail = body.Detail
+		}
+		return e
+	}
+	return json.NewDecoder(res.Body).Decode(out)
+}
@@ -0,0 +1,30 @@
+package scraper
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Spans of a run: the run, each symbol, its search, each request for
+// candles and waits on the rate limiter, and each save to the database. The
+// tracer does nothing until a provider is set with otel.SetTracerProvider.
+var tracer = otel.Tracer("github.com/alexurquhart/sp500scraper/pkg/scraper")
+
+// Start a span with the symbol and any other attributes.
+func startSpan(ctx context.Context, name, symbol, exchange string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	attrs = append(attrs, attribute.String("symbol", symbol), attribute.String("exchange", exchange))
+	return tracer.Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End a span, marking it failed if err isn't nil.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,87 @@
+package scraper
+
+import (
+	"time"
+
+	"github.com/alexurquhart/sp500scraper/pkg/calendar"
+	"github.com/alexurquhart/sp500scraper/pkg/store"
+)
+
+// Check the OHLC sanity of candles fetched for the ranges. The high must be
+// the highest price and the low the lowest, the volume can't be negative, the
+// candle must start within the range of its interval and only the first
+// candle with a given start is kept. Returns the candles that pass and an
+// issue for each that doesn't.
+func validateCandles(candles []store.Candle, ranges []CandleRange) ([]store.Candle, []store.Issue) {
+	windows := make(map[string]CandleRange)
+	for _, cr := range ranges {
+		windows[cr.Interval] = cr
+	}
+
+	now := time.Now()
+	type key struct {
+		interval string
+		start    int64
+	}
+	seen := make(map[key]bool)
+	var valid []store.Candle
+	var issues []store.Issue
+	for _, c := range candles {
+		problem := ""
+		cr, ok := windows[c.Interval]
+		k := key{c.Interval, c.Start.UnixNano()}
+		switch {
+		case c.High < c.Open || c.High < c.Close || c.High < c.Low:
+			problem = "High below open, close or low"
+		case c.Low > c.Open || c.Low > c.Close:
+			problem = "Low above open or close"
+		case c.Volume < 0:
+			problem = "Negative volume"
+		case !ok || c.Start.Before(BucketStart(cr.Start.In(c.Start.Location()), c.Interval)) || !c.Start.Before(cr.End):
+			problem = "Start outside the requested range"
+		case seen[k]:
+			problem = "Duplicate start"
+		}
+		if problem != "" {
+			issues = append(issues, store.Issue{Candle: c, Problem: problem, Detected: now})
+			continue
+		}
+		seen[k] = true
+		valid = append(valid, c)
+	}
+	return valid, issues
+}
+
+// Trading days of the daily ranges without a daily candle, in the time zone
+// of the calendar. Only daily candles can be counted against the calendar,
+// other intervals are not checked. The day of the end of a range is left
+// out as its candle may not be complete yet.
+func missingDays(cal *calendar.Calendar, candles []store.Candle, ranges []CandleRange) []time.Time {
+	have := make(map[time.Time]bool)
+	for _, c := range candles {
+		if c.Interval == "OneDay" {
+			y, m, d := c.Start.In(cal.Location).Date()
+			have[time.Date(y, m, d, 0, 0, 0, 0, cal.Location)] = true
+		}
+	}
+
+	var missing []time.Time
+	for _, cr := range ranges {
+		if cr.Interval != "OneDay" {
+			continue
+		}
+		y, m, d := cr.Start.In(cal.Location).Date()
+		day := time.Date(y, m, d, 0, 0, 0, 0, cal.Location)
+		y, m, d = cr.End.In(cal.Location).Date()
+		last := time.Date(y, m, d, 0, 0, 0, 0, cal.Location)
+		if !cal.IsTradingDay(day) {
+			day = cal.Next(day)
+		}
+		for ; day.Before(last); day = cal.Next(day) {
+			if !have[day] {
+				missing = append(missing, day)
+			}
+		}
+	}
+	return missing
+}
@@ -0,0 +1,195 @@
+package scraper
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/alexurquhart/sp500scraper/pkg/calendar"
+	"github.com/alexurquhart/sp500scraper/pkg/store"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// A symbol to fetch along with the ranges of candles to request, one per
+// interval
+type fetchJob struct {
+	Symbol    store.Symbol
+	Ranges    []CandleRange
+	Dividends bool
+
+	// Fetch fundamentals, dated with the day of the run
+	Fundamentals bool
+	Day          time.Time
+
+	// Fetch the option chain, of the nearest expiries if not zero
+	Options        bool
+	OptionExpiries int
+
+	// Trading days the daily candles are checked against, if set
+	Calendar *calendar.Calendar
+
+	// Converts the candles to USD, if set
+	FX *fxConverter
+
+	// IDs the symbol is already stored under, so candles fetched by the
+	// fallback provider are saved with those of the primary
+	StoredIDs []int
+}
+
+// Starts a pool of n workers that fetch data for the jobs they receive. All
+// workers share the rate limiter so the pool as a whole stays within
+// the API limits. Symbols p can't fetch are tried with the fallback provider,
+// if there is one, and earnings are fetched from ep unless it is nil. Fetched symbols are sent over symChan and those that could
+// not be found are sent over the returned channel, which is closed once jobs
+// is closed and every worker has finished. Symbols abandoned because the
+// context was cancelled are dropped rather than reported as failures.
+func fetchSymbols(ctx context.Context, n int, p, fallback Provider, ep EarningsProvider, prog Progress, jobs chan fetchJob, symChan chan store.Symbol) chan store.Failure {
+	failChan := make(chan store.Failure)
+
+	var wg sync.WaitGroup
+	wg.Add(n)
+	for i := 0; i < n; i++ {
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				began := time.Now()
+				ctx, counter := withCallCounter(ctx)
+				ctx, span := startSpan(ctx, "symbol", job.Symbol.Symbol, job.Symbol.Exchange)
+				sym := job.Symbol
+				prog.Start(sym.Symbol)
+				found := p
+				err := findSymbol(ctx, p, &sym, job.Ranges)
+				var primaryErr error
+				if err != nil && err != context.Canceled && fallback != nil {
+					primaryErr = err
+					slog.Warn("Could not find symbol, trying fallback provider", "symbol", sym.Symbol, "exchange", sym.Exchange, "error", err)
+					// The fallback has IDs of its own
+					sym = job.Symbol
+					sym.SymbolID = 0
+					found = fallback
+					err = findSymbol(ctx, fallback, &sym, job.Ranges)
+				}
+				if err == context.Canceled {
+					// Not a failure, the symbol will be fetched on resume
+					endSpan(span, err)
+					continue
+				} else if err != nil {
+					slog.Warn("Could not find symbol", "symbol", sym.Symbol, "exchange", sym.Exchange, "calls", counter.calls(), "error", err)
+					endSpan(span, err)
+					failChan <- fallbackFailure(sym, primaryErr, err)
+					continue
+				}
+				// Bad candles are recorded as issues rather than saved
+				if sym.Candles, sym.Issues = validateCandles(sym.Candles, job.Ranges); len(sym.Issues) > 0 {
+					candlesRejected.Add(float64(len(sym.Issues)))
+					slog.Warn("Rejected invalid candles", "symbol", sym.Symbol, "exchange", sym.Exchange, "issues", len(sym.Issues), "first", sym.Issues[0].Problem)
+				}
+				tagSessions(job.Calendar, sym.Candles)
+				if job.FX != nil {
+					// Candles that can't be converted are saved in their own currency
+					if err := job.FX.convert(ctx, sym.Candles); err != nil {
+						slog.Warn("Could not convert candles to USD", "symbol", sym.Symbol, "exchange", sym.Exchange, "error", err)
+					}
+				}
+				if job.Calendar != nil {
+					if missing := missingDays(job.Calendar, sym.Candles, job.Ranges); len(missing) > 0 {
+						slog.Warn("Candles missing for trading days", "symbol", sym.Symbol, "exchange", sym.Exchange, "days", len(missing), "first", missing[0].Format(DateFormat))
+					}
+				}
+				if mp, ok := found.(MetadataProvider); ok && sym.SymbolID != job.Symbol.SymbolID {
+					// Details are looked up along with the ID, so only after a search
+					details, err := mp.GetMetadata(ctx, sym)
+					if err != nil {
+						slog.Warn("Could not get symbol metadata", "symbol", sym.Symbol, "exchange", sym.Exchange, "error", err)
+					} else {
+						sym.Details = details
+					}
+				}
+				// Details and options come from the provider that fetched the candles,
+				// as the symbol ID is its own
+				if dp, ok := found.(DetailsProvider); ok && (job.Dividends || job.Fundamentals) {
+					// Missing details don't stop the candles being saved
+					div, fnd, err := dp.GetDetails(ctx, sym, job.Day)
+					if err != nil {
+						slog.Warn("Could not get symbol details", "symbol", sym.Symbol, "exchange", sym.Exchange, "error", err)
+					} else {
+						if job.Dividends {
+							sym.Dividend = div
+						}
+						if job.Fundamentals {
+							sym.Fundamentals = fnd
+						}
+					}
+				}
+				if op, ok := found.(OptionsProvider); ok && job.Options {
+					options, err := op.GetOptions(ctx, sym, job.OptionExpiries, time.Now())
+					if err != nil {
+						slog.Warn("Could not get option chain", "symbol", sym.Symbol, "exchange", sym.Exchange, "error", err)
+					} else {
+						sym.Options = options
+					}
+				}
+				if ep != nil {
+					earnings, err := ep.GetEarnings(ctx, sym)
+					if err != nil {
+						slog.Warn("Could not get earnings", "symbol", sym.Symbol, "exchange", sym.Exchange, "error", err)
+					} else {
+						sym.Earnings = earnings
+					}
+				}
+				if found == fallback {
+					useStoredID(&sym, job)
+				}
+				symbolsFetched.Inc()
+				span.SetAttributes(attribute.Int("candles", len(sym.Candles)), attribute.Int("calls", counter.calls()))
+				span.End()
+				slog.Info("Retrieved candles", "symbol", sym.Symbol, "exchange", sym.Exchange, "candles", len(sym.Candles), "calls", counter.calls(),
+					"duration", time.Since(began))
+				symChan <- sym
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(failChan)
+	}()
+	return failChan
+}
+
+// Failure of a symbol neither provider could fetch, or only the primary if
+// there is no fallback. It is classed by the primary's error, and only
+// counts as not found, which marks it as delisted, if both providers don't
+// know it.
+func fallbackFailure(sym store.Symbol, primaryErr, err error) store.Failure {
+	if primaryErr == nil {
+		return newFailure(sym, err)
+	}
+	f := newFailure(sym, primaryErr)
+	f.Reason += "; fallback: " + err.Error()
+	if f.NotFound && !symbolNotFound(err) {
+		f.NotFound = false
+		f.Class = failureClass(err)
+	}
+	return f
+}
+
+// Save a symbol fetched by the fallback under the ID the primary knows it
+// by, cached or stored before, so its history stays in one series. The
+// fallback's ID is only kept for symbols the primary has never fetched, and
+// isn't cached, so the next run searches the primary again.
+func useStoredID(sym *store.Symbol, job fetchJob) {
+	fallbackID := sym.SymbolID
+	sym.Resolved = time.Time{}
+	if job.Symbol.SymbolID != 0 {
+		sym.SymbolID = job.Symbol.SymbolID
+		return
+	}
+	for _, id := range job.StoredIDs {
+		if id != fallbackID {
+			sym.SymbolID = id
+			return
+		}
+	}
+}
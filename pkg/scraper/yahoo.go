@@ -0,0 +1,253 @@
+package scraper
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/alexurquhart/sp500scraper/pkg/store"
+)
+
+// Chart endpoint of the Yahoo Finance API, which needs no account
+const yahooChartURL = "https://query1.finance.yahoo.com/v8/finance/chart/"
+
+// Yahoo intervals to fetch for each candle interval. Intervals Yahoo doesn't
+// have are fetched at a finer one and resampled.
+var yahooIntervals = map[string]string{
+	"OneMinute":      "1m",
+	"TwoMinutes":     "2m",
+	"ThreeMinutes":   "1m",
+	"FourMinutes":    "2m",
+	"FiveMinutes":    "5m",
+	"TenMinutes":     "5m",
+	"FifteenMinutes": "15m",
+	"TwentyMinutes":  "5m",
+	"HalfHour":       "30m",
+	"OneHour":        "60m",
+	"TwoHours":       "60m",
+	"FourHours":      "60m",
+	"OneDay":         "1d",
+	"OneWeek":        "1wk",
+	"OneMonth":       "1mo",
+}
+
+// Intervals of the candles Yahoo returns for each of its intervals
+var yahooFetched = map[string]string{
+	"1m":  "OneMinute",
+	"2m":  "TwoMinutes",
+	"5m":  "FiveMinutes",
+	"15m": "FifteenMinutes",
+	"30m": "HalfHour",
+	"60m": "OneHour",
+	"1d":  "OneDay",
+	"1wk": "OneWeek",
+	"1mo": "OneMonth",
+}
+
+// Error response from the Yahoo Finance API
+type yahooError struct {
+	StatusCode  int
+	Code        string
+	Description string
+}
+
+func (e yahooError) Error() string {
+	return fmt.Sprintf("Yahoo Finance error %d: %s %s", e.StatusCode, e.Code, e.Description)
+}
+
+// Body of a chart response. Prices are null for periods without trades.
+type yahooChart struct {
+	Chart struct {
+		Result []struct {
+			Meta struct {
+				ExchangeTimezoneName string `json:"exchangeTimezoneName"`
+				Currency             string `json:"currency"`
+			} `json:"meta"`
+			Timestamp  []int64 `json:"timestamp"`
+			Indicators struct {
+				Quote []struct {
+					Open   []*float32 `json:"open"`
+					High   []*float32 `json:"high"`
+					Low    []*float32 `json:"low"`
+					Close  []*float32 `json:"close"`
+					Volume []*int     `json:"volume"`
+				} `json:"quote"`
+			} `json:"indicators"`
+		} `json:"result"`
+		Error *struct {
+			Code        string `json:"code"`
+			Description string `json:"description"`
+		} `json:"error"`
+	} `json:"chart"`
+}
+
+// Provider backed by the Yahoo Finance chart API. Prices are adjusted for
+// splits but not dividends. With extended hours, intraday charts include the
+// pre-market and after-hours sessions.
+type yahooProvider struct {
+	client   *http.Client
+	rl       *RateLimiter
+	rp       RetryPolicy
+	extended bool
+}
+
+func newYahooProvider(rp RetryPolicy, rate float64, burst int, extended bool) *yahooProvider {
+	return &yahooProvider{
+		client:   &http.Client{Timeout: 30 * time.Second},
+		rl:       NewRateLimiter(rate, burst),
+		rp:       rp,
+		extended: extended,
+	}
+}
+
+// Yahoo lists share classes with a dash, e.g. BRK-B
+func yahooTicker(ticker string) string {
+	base, class := splitClass(ticker)
+	if class == "" {
+		return ticker
+	}
+	return base + "-" + class
+}
+
+func (p *yahooProvider) RateLimits() []map[string]RateLimitState {
+	return []map[string]RateLimitState{p.rl.State()}
+}
+
+// Yahoo identifies symbols by ticker alone, so the ID is derived from the
+// ticker. Tickers that don't exist fail when their candles are fetched.
+func (p *yahooProvider) SearchSymbol(ctx context.Context, sym store.Symbol) (int, error) {
+	return tickerID(yahooTicker(sym.Symbol)), nil
+}
+
+// ID of a symbol from a provider that only knows tickers. IDs are negative
+// so they never clash with Questrade IDs.
+func tickerID(ticker string) int {
+	h := fnv.New32a()
+	h.Write([]byte(ticker))
+	return -int(h.Sum32()&0x7fffffff) - 1
+}
+
+func (p *yahooProvider) GetCandles(ctx context.Context, sym store.Symbol, cr CandleRange) ([]store.Candle, error) {
+	interval, ok := yahooIntervals[cr.Interval]
+	if !ok {
+		return nil, fmt.Errorf("Interval %s not supported by Yahoo Finance", cr.Interval)
+	}
+
+	q := url.Values{}
+	q.Set("period1", strconv.FormatInt(cr.Start.Unix(), 10))
+	q.Set("period2", strconv.FormatInt(cr.End.Unix(), 10))
+	q.Set("interval", interval)
+	q.Set("includePrePost", strconv.FormatBool(p.extended))
+	u := yahooChartURL + url.PathEscape(yahooTicker(sym.Symbol)) + "?" + q.Encode()
+
+	var chart yahooChart
+	err := p.rp.Do(ctx, func() error {
+		p.rl.waitCandles()
+		return p.get(u, &chart)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(chart.Chart.Result) == 0 {
+		return nil, yahooError{StatusCode: http.StatusNotFound, Code: "Not Found", Description: "No data for " + sym.Symbol}
+	}
+
+	res := chart.Chart.Result[0]
+	loc, err := time.LoadLocation(res.Meta.ExchangeTimezoneName)
+	if err != nil {
+		loc = time.UTC
+	}
+	var candles []store.Candle
+	if len(res.Indicators.Quote) == 0 {
+		return candles, nil
+	}
+	quote := res.Indicators.Quote[0]
+	// Candles are built at the interval fetched, so their ends are right
+	// once combined into the one requested
+	fetched := yahooFetched[interval]
+	for i, ts := range res.Timestamp {
+		open, high, low, cls := price(quote.Open, i), price(quote.High, i), price(quote.Low, i), price(quote.Close, i)
+		if open == nil || high == nil || low == nil || cls == nil {
+			continue
+		}
+		start := time.Unix(ts, 0).In(loc)
+		if _, ok := intervalDurations[fetched]; !ok {
+			// Daily and longer candles are stamped with the market open
+			start = BucketStart(start, fetched)
+		}
+		c := store.Candle{
+			Start:    start,
+			End:      candleEnd(start, fetched),
+			Open:     *open,
+			High:     *high,
+			Low:      *low,
+			Close:    *cls,
+			Interval: fetched,
+			Currency: res.Meta.Currency,
+		}
+		if i < len(quote.Volume) && quote.Volume[i] != nil {
+			c.Volume = *quote.Volume[i]
+		}
+		candles = append(candles, c)
+	}
+
+	// Combines the finer candles fetched for intervals Yahoo doesn't have,
+	// keeping the sessions apart
+	if p.extended {
+		tagSessions(nil, candles)
+	}
+	return Resample(candles, cr.Interval), nil
+}
+
+// Price at index i, nil if missing or null.
+func price(prices []*float32, i int) *float32 {
+	if i >= len(prices) {
+		return nil
+	}
+	return prices[i]
+}
+
+// Request a chart, decoding the error Yahoo reports with non-200 responses.
+func (p *yahooProvider) get(u string, chart *yahooChart) error {
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return err
+	}
+	// Requests without a user agent are rate limited
+	req.Header.Set("User-Agent", "sp500scraper")
+	res, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if err := json.NewDecoder(res.Body).Decode(chart); err != nil && res.StatusCode == http.StatusOK {
+		return err
+	}
+	if res.StatusCode != http.StatusOK || chart.Chart.Error != nil {
+		e := yahooError{StatusCode: res.StatusCode, Code: res.Status}
+		if chart.Chart.Error != nil {
+			e.Code, e.Description = chart.Chart.Error.Code, chart.Chart.Error.Description
+		}
+		return e
+	}
+	return nil
+}
+
+// End of the candle starting at start.
+func candleEnd(start time.Time, interval string) time.Time {
+	switch interval {
+	case "OneDay":
+		return start.AddDate(0, 0, 1)
+	case "OneWeek":
+		return start.AddDate(0, 0, 7)
+	case "OneMonth":
+		return start.AddDate(0, 1, 0)
+	}
+	return start.Add(intervalDurations[interval])
+}
@@ -0,0 +1,139 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/alexurquhart/sp500scraper/pkg/store"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+)
+
+// Rows sent per streaming insert, well under the API's limit
+const bigQueryBatchSize = 500
+
+// Row of the BigQuery table, one per candle with the symbol, exchange and
+// industry alongside the prices
+type bigQueryCandle struct {
+	Time     time.Time `bigquery:"time"`
+	EndTime  time.Time `bigquery:"endtime"`
+	Symbol   string    `bigquery:"symbol"`
+	Exchange string    `bigquery:"exchange"`
+	Industry string    `bigquery:"industry"`
+	Interval string    `bigquery:"interval"`
+	Open     float64   `bigquery:"open"`
+	High     float64   `bigquery:"high"`
+	Low      float64   `bigquery:"low"`
+	Close    float64   `bigquery:"close"`
+	Volume   int64     `bigquery:"volume"`
+	Currency string    `bigquery:"currency"`
+	Session  string    `bigquery:"session"`
+}
+
+// Sink streaming candles into a BigQuery table, created if it doesn't exist
+// partitioned by day on the start time and clustered by symbol. Each row is
+// sent with an insert ID made of the symbol, exchange, interval and start,
+// so BigQuery drops rows it has just received when a candle is sent again.
+// Its deduplication is best effort and short lived, so queries over candles
+// fetched by several runs should still pick one row per candle.
+type BigQuery struct {
+	client *bigquery.Client
+	table  *bigquery.Table
+}
+
+// Connect to BigQuery in the project, found from the credentials if empty,
+// with the service account key file at credentials, or the application
+// default credentials if empty.
+func NewBigQuery(project, dataset, table, credentials string) (*BigQuery, error) {
+	if dataset == "" || table == "" {
+		return nil, errors.New("BigQuery sink needs a dataset and a table")
+	}
+	if project == "" {
+		project = bigquery.DetectProjectID
+	}
+	var opts []option.ClientOption
+	if credentials != "" {
+		opts = append(opts, option.WithCredentialsFile(credentials))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	client, err := bigquery.NewClient(ctx, project, opts...)
+	if err != nil {
+		return nil, err
+	}
+	t := client.Dataset(dataset).Table(table)
+	if err := createBigQueryTable(ctx, t); err != nil {
+		client.Close()
+		return nil, err
+	}
+	return &BigQuery{client: client, table: t}, nil
+}
+
+// Create the table unless it exists.
+func createBigQueryTable(ctx context.Context, t *bigquery.Table) error {
+	_, err := t.Metadata(ctx)
+	var e *googleapi.Error
+	if err == nil || !errors.As(err, &e) || e.Code != http.StatusNotFound {
+		return err
+	}
+	schema, err := bigquery.InferSchema(bigQueryCandle{})
+	if err != nil {
+		return err
+	}
+	return t.Create(ctx, &bigquery.TableMetadata{
+		Schema:           schema,
+		TimePartitioning: &bigquery.TimePartitioning{Field: "time"},
+		Clustering:       &bigquery.Clustering{Fields: []string{"symbol", "interval"}},
+	})
+}
+
+func (s *BigQuery) Write(sym store.Symbol) error {
+	ins := s.table.Inserter()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	rows := make([]*bigquery.StructSaver, 0, bigQueryBatchSize)
+	for i, c := range sym.Candles {
+		currency, session := c.Currency, c.Session
+		if currency == "" {
+			currency = "USD"
+		}
+		if session == "" {
+			session = store.SessionRegular
+		}
+		rows = append(rows, &bigquery.StructSaver{
+			InsertID: sym.Key() + "|" + c.Interval + "|" + strconv.FormatInt(c.Start.Unix(), 10),
+			Struct: &bigQueryCandle{
+				Time:     c.Start,
+				EndTime:  c.End,
+				Symbol:   sym.Symbol,
+				Exchange: sym.Exchange,
+				Industry: sym.Industry,
+				Interval: c.Interval,
+				Open:     float64(c.Open),
+				High:     float64(c.High),
+				Low:      float64(c.Low),
+				Close:    float64(c.Close),
+				Volume:   int64(c.Volume),
+				Currency: currency,
+				Session:  session,
+			},
+		})
+		if len(rows) == bigQueryBatchSize || i == len(sym.Candles)-1 {
+			if err := ins.Put(ctx, rows); err != nil {
+				return err
+			}
+			rows = rows[:0]
+		}
+	}
+	return nil
+}
+
+func (s *BigQuery) Close() error {
+	return s.client.Close()
+}
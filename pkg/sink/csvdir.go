@@ -0,0 +1,127 @@
+package sink
+
+import (
+	"encoding/csv"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/alexurquhart/sp500scraper/pkg/store"
+)
+
+// Columns of the CSV files
+var csvHeader = []string{"interval", "start", "end", "open", "high", "low", "close", "volume", "currency", "fxrate"}
+
+// Sink writing the candles of each symbol to its own CSV file in a directory.
+// Like JSONDir, candles already in a symbol's file are kept.
+type CSVDir struct {
+	dir string
+}
+
+// Create a sink writing to dir, creating it if needed.
+func NewCSVDir(dir string) (*CSVDir, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &CSVDir{dir: dir}, nil
+}
+
+func (s *CSVDir) Write(sym store.Symbol) error {
+	path := filepath.Join(s.dir, sym.Symbol+".csv")
+	old, err := readCSV(path)
+	if err != nil {
+		return err
+	}
+	candles := mergeCandles(old, sym.Candles)
+
+	// Written to a temporary file first so a crash never leaves half a file
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	w := csv.NewWriter(f)
+	w.Write(csvHeader)
+	for _, c := range candles {
+		fx := ""
+		if c.FXRate != 0 {
+			fx = strconv.FormatFloat(c.FXRate, 'f', -1, 64)
+		}
+		w.Write([]string{
+			c.Interval,
+			c.Start.Format(time.RFC3339),
+			c.End.Format(time.RFC3339),
+			influxFloat(c.Open),
+			influxFloat(c.High),
+			influxFloat(c.Low),
+			influxFloat(c.Close),
+			strconv.Itoa(c.Volume),
+			c.Currency,
+			fx,
+		})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (s *CSVDir) Close() error {
+	return nil
+}
+
+// Candles of a CSV file written by the sink, none if it doesn't exist yet.
+func readCSV(path string) ([]store.Candle, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	rows, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	var candles []store.Candle
+	for i, row := range rows {
+		if i == 0 {
+			continue
+		}
+		if len(row) != len(csvHeader) {
+			return nil, errors.New("Unexpected columns in " + path)
+		}
+		c := store.Candle{Interval: row[0], Currency: row[8]}
+		if c.Start, err = time.Parse(time.RFC3339, row[1]); err != nil {
+			return nil, err
+		}
+		if c.End, err = time.Parse(time.RFC3339, row[2]); err != nil {
+			return nil, err
+		}
+		var prices [4]float64
+		for j := range prices {
+			if prices[j], err = strconv.ParseFloat(row[3+j], 32); err != nil {
+				return nil, err
+			}
+		}
+		c.Open, c.High, c.Low, c.Close = float32(prices[0]), float32(prices[1]), float32(prices[2]), float32(prices[3])
+		if c.Volume, err = strconv.Atoi(row[7]); err != nil {
+			return nil, err
+		}
+		if row[9] != "" {
+			if c.FXRate, err = strconv.ParseFloat(row[9], 64); err != nil {
+				return nil, err
+			}
+		}
+		candles = append(candles, c)
+	}
+	return candles, nil
+}
@@ -0,0 +1,100 @@
+package sink
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alexurquhart/sp500scraper/pkg/store"
+)
+
+// Lines written per request, the batch size recommended by InfluxDB
+const influxBatchSize = 5000
+
+// Sink writing candles to an InfluxDB 2 bucket with the line protocol. Each
+// candle is a point of the candles measurement tagged with the symbol,
+// exchange, industry and interval, timestamped with the start of the candle.
+type Influx struct {
+	url    string
+	token  string
+	client *http.Client
+}
+
+// Create a sink writing to the bucket of the organization on the server at
+// addr. InfluxDB 1.8 accepts the same requests with "user:password" as the
+// token and "database/retention-policy" as the bucket.
+func NewInflux(addr, token, org, bucket string) (*Influx, error) {
+	if addr == "" || bucket == "" {
+		return nil, errors.New("InfluxDB sink needs a URL and a bucket")
+	}
+	q := url.Values{"org": {org}, "bucket": {bucket}, "precision": {"s"}}
+	return &Influx{
+		url:    strings.TrimSuffix(addr, "/") + "/api/v2/write?" + q.Encode(),
+		token:  token,
+		client: &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+func (s *Influx) Write(sym store.Symbol) error {
+	tags := measurement + influxTag("symbol", sym.Symbol) + influxTag("exchange", sym.Exchange) + influxTag("industry", sym.Industry)
+
+	var b bytes.Buffer
+	for i, c := range sym.Candles {
+		b.WriteString(tags + influxTag("interval", c.Interval))
+		b.WriteString(" open=" + influxFloat(c.Open) + ",high=" + influxFloat(c.High) + ",low=" + influxFloat(c.Low) +
+			",close=" + influxFloat(c.Close) + ",volume=" + strconv.Itoa(c.Volume) + "i " +
+			strconv.FormatInt(c.Start.Unix(), 10) + "\n")
+		if (i+1)%influxBatchSize == 0 || i == len(sym.Candles)-1 {
+			if err := s.post(b.Bytes()); err != nil {
+				return err
+			}
+			b.Reset()
+		}
+	}
+	return nil
+}
+
+func (s *Influx) post(lines []byte) error {
+	req, err := http.NewRequest("POST", s.url, bytes.NewReader(lines))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if s.token != "" {
+		req.Header.Set("Authorization", "Token "+s.token)
+	}
+	res, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		body, _ := ioutil.ReadAll(res.Body)
+		return errors.New("InfluxDB write failed: " + res.Status + " " + strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+func (s *Influx) Close() error {
+	return nil
+}
+
+// Tag of a point, escaped for the line protocol. Empty tags are left out as
+// InfluxDB rejects them.
+func influxTag(key, value string) string {
+	if value == "" {
+		return ""
+	}
+	return "," + key + "=" + influxEscaper.Replace(value)
+}
+
+var influxEscaper = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+
+func influxFloat(f float32) string {
+	return strconv.FormatFloat(float64(f), 'f', -1, 32)
+}
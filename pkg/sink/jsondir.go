@@ -0,0 +1,82 @@
+package sink
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/alexurquhart/sp500scraper/pkg/store"
+)
+
+// Sink writing each symbol to its own JSON file in a directory, in the format
+// of the symbols file with the candles added. Candles already in a symbol's
+// file are kept, so incremental runs extend the file rather than replace it.
+type JSONDir struct {
+	dir string
+}
+
+// Create a sink writing to dir, creating it if needed.
+func NewJSONDir(dir string) (*JSONDir, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &JSONDir{dir: dir}, nil
+}
+
+func (s *JSONDir) Write(sym store.Symbol) error {
+	path := filepath.Join(s.dir, sym.Symbol+".json")
+	var old store.Symbol
+	if b, err := ioutil.ReadFile(path); err == nil {
+		if err := json.Unmarshal(b, &old); err != nil {
+			return err
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	sym.Candles = mergeCandles(old.Candles, sym.Candles)
+
+	out, err := json.MarshalIndent(sym, "", "  ")
+	if err != nil {
+		return err
+	}
+	// Written to a temporary file first so a crash never leaves half a file
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, out, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (s *JSONDir) Close() error {
+	return nil
+}
+
+// Combine stored and fetched candles, the fetched one winning when both
+// have a candle of the same interval and start. Sorted by interval, then
+// oldest first.
+func mergeCandles(old, fetched []store.Candle) []store.Candle {
+	type key struct {
+		interval string
+		start    time.Time
+	}
+	seen := make(map[key]bool, len(fetched))
+	for _, c := range fetched {
+		seen[key{c.Interval, c.Start.UTC()}] = true
+	}
+	merged := append([]store.Candle{}, fetched...)
+	for _, c := range old {
+		if !seen[key{c.Interval, c.Start.UTC()}] {
+			merged = append(merged, c)
+		}
+	}
+	sort.SliceStable(merged, func(i, j int) bool {
+		if merged[i].Interval != merged[j].Interval {
+			return merged[i].Interval < merged[j].Interval
+		}
+		return merged[i].Start.Before(merged[j].Start)
+	})
+	return merged
+}
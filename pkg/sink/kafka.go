@@ -0,0 +1,80 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/alexurquhart/sp500scraper/pkg/store"
+	"github.com/segmentio/kafka-go"
+)
+
+// Messages sent to the brokers at once
+const kafkaBatchSize = 1000
+
+// Candle written on its own, with the symbol it belongs to
+type symbolCandle struct {
+	Symbol   string `json:"symbol"`
+	Exchange string `json:"exchange"`
+	store.Candle
+}
+
+// Sink publishing the candles of each saved symbol to a Kafka topic as JSON.
+// By default each symbol is one message in the format of the symbols file with
+// its candles added, or with perCandle one message per candle. Messages are
+// keyed by symbol and exchange so those of a symbol stay in order on one
+// partition.
+type Kafka struct {
+	writer    *kafka.Writer
+	perCandle bool
+}
+
+// Create a sink publishing to the topic on the brokers, host:port addresses.
+func NewKafka(brokers []string, topic string, perCandle bool) (*Kafka, error) {
+	if len(brokers) == 0 || topic == "" {
+		return nil, errors.New("Kafka sink needs brokers and a topic")
+	}
+	return &Kafka{
+		writer: &kafka.Writer{
+			Addr:         kafka.TCP(brokers...),
+			Topic:        topic,
+			Balancer:     &kafka.Hash{},
+			BatchSize:    kafkaBatchSize,
+			RequiredAcks: kafka.RequireAll,
+		},
+		perCandle: perCandle,
+	}, nil
+}
+
+func (s *Kafka) Write(sym store.Symbol) error {
+	key := []byte(sym.Key())
+	var msgs []kafka.Message
+	if s.perCandle {
+		for _, c := range sym.Candles {
+			b, err := json.Marshal(symbolCandle{Symbol: sym.Symbol, Exchange: sym.Exchange, Candle: c})
+			if err != nil {
+				return err
+			}
+			msgs = append(msgs, kafka.Message{Key: key, Value: b, Time: c.Start})
+		}
+	} else {
+		b, err := json.Marshal(sym)
+		if err != nil {
+			return err
+		}
+		msgs = append(msgs, kafka.Message{Key: key, Value: b})
+	}
+	if len(msgs) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	return s.writer.WriteMessages(ctx, msgs...)
+}
+
+// Flush any buffered messages and disconnect.
+func (s *Kafka) Close() error {
+	return s.writer.Close()
+}
@@ -0,0 +1,40 @@
+// Package sink writes the candles of saved symbols to time series databases
+// alongside the store, so tools such as Grafana can chart them natively, or
+// to flat files or stdout.
+package sink
+
+import "github.com/alexurquhart/sp500scraper/pkg/store"
+
+// Sink receives every symbol saved by a run along with its candles. Any
+// number of sinks can be used at once, and each is written to whether or not
+// the others fail.
+type Sink interface {
+	Write(sym store.Symbol) error
+	Close() error
+}
+
+// Measurement or table the candles are written to
+const measurement = "candles"
+
+// Name of the kind of a sink, used to label its errors
+func Name(sk Sink) string {
+	switch sk.(type) {
+	case *Influx:
+		return "influx"
+	case *Timescale:
+		return "timescale"
+	case *JSONDir:
+		return "json"
+	case *CSVDir:
+		return "csv"
+	case *Webhook:
+		return "webhook"
+	case *Kafka:
+		return "kafka"
+	case *BigQuery:
+		return "bigquery"
+	case *Stream:
+		return "stdout"
+	}
+	return "other"
+}
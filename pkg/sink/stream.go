@@ -0,0 +1,49 @@
+package sink
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"sync"
+
+	"github.com/alexurquhart/sp500scraper/pkg/store"
+)
+
+// Sink streaming newline delimited JSON to a writer, usually stdout, so runs
+// can be piped into jq or another process. Each symbol is one line in the
+// format of the symbols file with its candles added, or with perCandle each
+// candle is a line with the symbol and exchange alongside its fields. The
+// lines of a symbol are flushed together once it is saved.
+type Stream struct {
+	mu        sync.Mutex
+	w         *bufio.Writer
+	enc       *json.Encoder
+	perCandle bool
+}
+
+// Create a sink streaming to w.
+func NewStream(w io.Writer, perCandle bool) *Stream {
+	bw := bufio.NewWriter(w)
+	return &Stream{w: bw, enc: json.NewEncoder(bw), perCandle: perCandle}
+}
+
+func (s *Stream) Write(sym store.Symbol) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.perCandle {
+		for _, c := range sym.Candles {
+			if err := s.enc.Encode(symbolCandle{Symbol: sym.Symbol, Exchange: sym.Exchange, Candle: c}); err != nil {
+				return err
+			}
+		}
+	} else if err := s.enc.Encode(sym); err != nil {
+		return err
+	}
+	return s.w.Flush()
+}
+
+func (s *Stream) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.w.Flush()
+}
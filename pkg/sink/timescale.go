@@ -0,0 +1,78 @@
+package sink
+
+import (
+	"database/sql"
+
+	_ "github.com/lib/pq"
+
+	"github.com/alexurquhart/sp500scraper/pkg/store"
+)
+
+// Hypertable the candles are written to, created if it doesn't exist
+const timescaleSchema = `CREATE EXTENSION IF NOT EXISTS timescaledb;
+CREATE TABLE IF NOT EXISTS candles (
+    "time" TIMESTAMPTZ NOT NULL,
+    "endtime" TIMESTAMPTZ NOT NULL,
+    "symbol" TEXT NOT NULL,
+    "exchange" TEXT NOT NULL,
+    "industry" TEXT NOT NULL,
+    "open" DOUBLE PRECISION NOT NULL,
+    "high" DOUBLE PRECISION NOT NULL,
+    "low" DOUBLE PRECISION NOT NULL,
+    "close" DOUBLE PRECISION NOT NULL,
+    "volume" BIGINT NOT NULL
+);
+SELECT create_hypertable('candles', 'time', if_not_exists => TRUE);
+ALTER TABLE candles ADD COLUMN IF NOT EXISTS "interval" TEXT NOT NULL DEFAULT 'OneDay';
+DROP INDEX IF EXISTS "u_candles";
+CREATE UNIQUE INDEX IF NOT EXISTS "u_candles_interval" on candles (symbol, exchange, "interval", time);`
+
+const timescaleInsert = `insert into candles values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+	on conflict (symbol, exchange, "interval", time) do update set endtime = excluded.endtime, industry = excluded.industry,
+	open = excluded.open, high = excluded.high, low = excluded.low, close = excluded.close, volume = excluded.volume`
+
+// Sink writing candles to a TimescaleDB hypertable, one row per candle with
+// the symbol, exchange and industry alongside the prices
+type Timescale struct {
+	db *sql.DB
+}
+
+// Connect to the TimescaleDB database, creating the candles hypertable if
+// needed.
+func NewTimescale(dsn string) (*Timescale, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(timescaleSchema); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Timescale{db: db}, nil
+}
+
+func (s *Timescale) Write(sym store.Symbol) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	stmt, err := tx.Prepare(timescaleInsert)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+
+	for _, c := range sym.Candles {
+		_, err := stmt.Exec(c.Start, c.End, sym.Symbol, sym.Exchange, sym.Industry, c.Open, c.High, c.Low, c.Close, c.Volume, c.Interval)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *Timescale) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,60 @@
+package sink
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/alexurquhart/sp500scraper/pkg/store"
+)
+
+// Sink posting each saved symbol with its candles to a URL as JSON, in the
+// format of the JSON directory sink. Any response other than 2xx is an
+// error.
+type Webhook struct {
+	url    string
+	token  string
+	client *http.Client
+}
+
+// Create a sink posting to url, sending the token as a bearer token unless
+// it is empty.
+func NewWebhook(url, token string) (*Webhook, error) {
+	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+		return nil, errors.New("Webhook URL must be http or https: " + url)
+	}
+	return &Webhook{url: url, token: token, client: &http.Client{Timeout: 30 * time.Second}}, nil
+}
+
+func (s *Webhook) Write(sym store.Symbol) error {
+	body, err := json.Marshal(sym)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.token)
+	}
+	res, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(res.Body)
+		return errors.New("Webhook failed: " + res.Status + " " + strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+func (s *Webhook) Close() error {
+	return nil
+}
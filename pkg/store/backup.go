@@ -0,0 +1,107 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Where the copies of the database taken before destructive changes go and
+// how many are kept
+type BackupPolicy struct {
+	// Directory of the backups, backups next to the database if empty
+	Dir string
+
+	// Number of backups kept, the oldest are removed after each backup. No
+	// backups are taken if zero.
+	Keep int
+}
+
+// Backup policy of the stores opened after it is set. Only SQLite
+// databases, which are a single file, are backed up.
+var Backups = BackupPolicy{Keep: 5}
+
+// Time a backup was taken, added to the name of the database file
+const backupTimeFormat = "20060102T150405"
+
+// Path of the database file of an SQLite data source name, empty for an
+// in-memory database.
+func SQLiteFile(dsn string) string {
+	path := strings.SplitN(strings.TrimPrefix(dsn, "file:"), "?", 2)[0]
+	if path == "" || path == ":memory:" {
+		return ""
+	}
+	return path
+}
+
+// Copy an SQLite database to a timestamped file with vacuum into, which
+// takes a consistent copy while the database is open, and remove the
+// oldest backups past the policy's limit. Returns the path of the backup,
+// empty if none was taken.
+func backupSQLite(db *sql.DB, dsn, reason string, policy BackupPolicy) (string, error) {
+	file := SQLiteFile(dsn)
+	if policy.Keep <= 0 || file == "" {
+		return "", nil
+	}
+	if _, err := os.Stat(file); os.IsNotExist(err) {
+		// Nothing to lose in a new database
+		return "", nil
+	}
+	dir := policy.Dir
+	if dir == "" {
+		dir = filepath.Join(filepath.Dir(file), "backups")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+
+	ext := filepath.Ext(file)
+	base := strings.TrimSuffix(filepath.Base(file), ext)
+	path := filepath.Join(dir, base+"-"+time.Now().Format(backupTimeFormat)+ext)
+	if _, err := db.Exec("vacuum into ?", path); err != nil {
+		return "", err
+	}
+	slog.Info("Backed up database", "reason", reason, "backup", path)
+
+	// The timestamps sort in the order the backups were taken
+	old, err := filepath.Glob(filepath.Join(dir, base+"-*"+ext))
+	if err != nil {
+		return path, err
+	}
+	var backups []string
+	for _, p := range old {
+		stamp := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(p), base+"-"), ext)
+		if _, err := time.Parse(backupTimeFormat, stamp); err == nil {
+			backups = append(backups, p)
+		}
+	}
+	sort.Strings(backups)
+	for len(backups) > policy.Keep {
+		if err := os.Remove(backups[0]); err != nil {
+			return path, err
+		}
+		backups = backups[1:]
+	}
+	return path, nil
+}
+
+func (s *sqlStore) CopyFile(path string) error {
+	if s.dialect.driver != "sqlite3" {
+		return errors.New("Only SQLite databases can be copied to a file")
+	}
+	_, err := s.db.Exec("vacuum into ?", path)
+	return err
+}
+
+func (s *sqlStore) Backup(reason string) (string, error) {
+	if s.dialect.driver != "sqlite3" {
+		slog.Debug("Only SQLite databases are backed up", "driver", s.dialect.driver)
+		return "", nil
+	}
+	return backupSQLite(s.db, s.dsn, reason, s.backups)
+}
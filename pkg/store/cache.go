@@ -0,0 +1,152 @@
+package store
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// Store caching the results of the reads made when serving: candles by
+// symbol ID, interval and range, the symbols and the stored intervals.
+// Entries are dropped once older than the TTL, and the least recently used
+// candles are dropped once more than the size limit are held. Writes go
+// straight to the underlying store and clear the cache, as do writes of
+// other processes once the TTL passes. Safe for concurrent use.
+type CachedStore struct {
+	Store
+	ttl     time.Duration
+	maxSize int // Most candles held, 0 for no limit
+
+	mu        sync.Mutex
+	entries   map[candleKey]*list.Element
+	lru       *list.List // Of *cacheEntry, most recently used first
+	size      int
+	symbols   []Symbol
+	intervals []string
+	loaded    time.Time // When symbols and intervals were read
+}
+
+type candleKey struct {
+	id         int
+	interval   string
+	start, end int64
+}
+
+type cacheEntry struct {
+	key     candleKey
+	candles []Candle
+	loaded  time.Time
+}
+
+// Wrap a store with a cache keeping entries for ttl and holding up to
+// maxSize candles, no limit if 0.
+func NewCachedStore(st Store, ttl time.Duration, maxSize int) *CachedStore {
+	c := &CachedStore{Store: st, ttl: ttl, maxSize: maxSize}
+	c.Flush()
+	return c
+}
+
+// Drop every cached entry.
+func (c *CachedStore) Flush() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = make(map[candleKey]*list.Element)
+	c.lru = list.New()
+	c.size = 0
+	c.symbols, c.intervals, c.loaded = nil, nil, time.Time{}
+}
+
+func (c *CachedStore) Candles(id int, interval string, start, end time.Time) ([]Candle, error) {
+	key := candleKey{id, interval, start.UnixNano(), end.UnixNano()}
+	c.mu.Lock()
+	if el, ok := c.entries[key]; ok {
+		e := el.Value.(*cacheEntry)
+		if time.Since(e.loaded) < c.ttl {
+			c.lru.MoveToFront(el)
+			candles := append([]Candle(nil), e.candles...)
+			c.mu.Unlock()
+			return candles, nil
+		}
+		c.remove(el)
+	}
+	c.mu.Unlock()
+
+	// Read without the lock so slow reads don't hold up other requests
+	candles, err := c.Store.Candles(id, interval, start, end)
+	if err != nil {
+		return candles, err
+	}
+	if c.maxSize > 0 && len(candles) > c.maxSize {
+		return candles, nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[key]; ok {
+		c.remove(el)
+	}
+	c.entries[key] = c.lru.PushFront(&cacheEntry{key: key, candles: append([]Candle(nil), candles...), loaded: time.Now()})
+	c.size += len(candles)
+	for c.maxSize > 0 && c.size > c.maxSize {
+		c.remove(c.lru.Back())
+	}
+	return candles, nil
+}
+
+// Called with the lock held.
+func (c *CachedStore) remove(el *list.Element) {
+	e := c.lru.Remove(el).(*cacheEntry)
+	delete(c.entries, e.key)
+	c.size -= len(e.candles)
+}
+
+func (c *CachedStore) Symbols() ([]Symbol, error) {
+	if err := c.load(); err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Symbol(nil), c.symbols...), nil
+}
+
+func (c *CachedStore) Intervals() ([]string, error) {
+	if err := c.load(); err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.intervals...), nil
+}
+
+// Read the symbols and intervals again if they are older than the TTL.
+func (c *CachedStore) load() error {
+	c.mu.Lock()
+	fresh := !c.loaded.IsZero() && time.Since(c.loaded) < c.ttl
+	c.mu.Unlock()
+	if fresh {
+		return nil
+	}
+
+	symbols, err := c.Store.Symbols()
+	if err != nil {
+		return err
+	}
+	intervals, err := c.Store.Intervals()
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.symbols, c.intervals, c.loaded = symbols, intervals, time.Now()
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *CachedStore) SaveSymbol(sym Symbol) error {
+	defer c.Flush()
+	return c.Store.SaveSymbol(sym)
+}
+
+func (c *CachedStore) DeleteCandles(id int, before time.Time) (int, error) {
+	defer c.Flush()
+	return c.Store.DeleteCandles(id, before)
+}
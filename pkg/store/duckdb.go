@@ -0,0 +1,37 @@
+package store
+
+import (
+	"database/sql"
+
+	_ "github.com/marcboeker/go-duckdb"
+)
+
+var duckdbDialect = dialect{
+	driver:     "duckdb",
+	migrations: "migrations/duckdb",
+	insertSymbol: `insert into symbolids (id, symbol, exchange, name, industry, subindustry, benchmark) values (?, ?, ?, ?, ?, ?, ?)
+		on conflict (id) do update set symbol = excluded.symbol, exchange = excluded.exchange, name = excluded.name,
+		industry = excluded.industry, subindustry = excluded.subindustry, benchmark = excluded.benchmark, delisted_at = null`,
+	insertDividend: `insert into dividends values (?, ?, ?, ?) on conflict (id, exdate) do update set
+		paydate = excluded.paydate, amount = excluded.amount`,
+	insertFundamentals: `insert into fundamentals values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) on conflict (id, snapshot) do update set
+		marketcap = excluded.marketcap, pe = excluded.pe, eps = excluded.eps, yield = excluded.yield,
+		dividend = excluded.dividend, shares = excluded.shares, high52 = excluded.high52,
+		low52 = excluded.low52, avgvolume = excluded.avgvolume`,
+	insertCache: `insert into symbolcache values (?, ?, ?, ?) on conflict (symbol, exchange) do update set
+		id = excluded.id, resolved = excluded.resolved`,
+	insertFailure: "insert into failures values (?, ?, ?, ?)",
+	rebind:        bindQuestion,
+	configure:     configureDuckDB,
+	compact:       "checkpoint",
+	maxWriters:    1,
+	tableExists:   "select count(*) from information_schema.tables where table_name = ?",
+}
+
+// A DuckDB file can only be opened by one process at a time for writing, and
+// the database is shared by every connection of this one, so a single
+// connection avoids write conflicts between transactions like SQLite.
+func configureDuckDB(db *sql.DB) error {
+	db.SetMaxOpenConns(1)
+	return nil
+}
@@ -0,0 +1,42 @@
+package store
+
+import (
+	"database/sql"
+	"log/slog"
+)
+
+// Indexes the queries of the store rely on. Databases created by this build
+// have most of them already, but those created from an older schema or a
+// schema file may not, so missing ones are added whenever a store is opened.
+var requiredIndexes = []struct {
+	name, table, columns string
+}{
+	{"i_symbolids", "symbolids", "symbol, exchange"},
+	{"i_candlestick", "candlestick", "id, starttime"},
+	{"i_quotes", "quotes", `id, "time"`},
+	{"i_data_quality_issues", "data_quality_issues", "id, starttime"},
+}
+
+// Create the required indexes the database is missing. Indexes are only a
+// matter of speed, so failing to create one, such as on a table a schema
+// file left out, is logged rather than returned.
+func ensureIndexes(db *sql.DB, d dialect) error {
+	if d.indexExists == "" {
+		return nil
+	}
+	for _, idx := range requiredIndexes {
+		var n int
+		if err := db.QueryRow(d.rebind(d.indexExists), idx.name).Scan(&n); err != nil {
+			return err
+		}
+		if n > 0 {
+			continue
+		}
+		if _, err := db.Exec(d.rebind(`create index "` + idx.name + `" on ` + idx.table + " (" + idx.columns + ")")); err != nil {
+			slog.Warn("Could not create missing index", "index", idx.name, "table", idx.table, "error", err)
+			continue
+		}
+		slog.Info("Created missing index", "index", idx.name, "table", idx.table)
+	}
+	return nil
+}
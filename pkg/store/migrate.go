@@ -0,0 +1,134 @@
+package store
+
+import (
+	"database/sql"
+	"embed"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Versioned schema changes of each driver, named <version>_<description>.sql
+// and applied in order of version
+//
+//go:embed migrations
+var migrationFiles embed.FS
+
+// Schema change upgrading the database to version
+type migration struct {
+	version int
+	name    string
+	sql     string
+}
+
+// Read the migrations in the directory, sorted by version.
+func loadMigrations(dir string) ([]migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var migrations []migration
+	for _, e := range entries {
+		if e.IsDir() || path.Ext(e.Name()) != ".sql" {
+			continue
+		}
+		name := strings.TrimSuffix(e.Name(), ".sql")
+		v, err := strconv.Atoi(strings.SplitN(name, "_", 2)[0])
+		if err != nil || v <= 0 {
+			return nil, errors.New("Invalid migration name: " + e.Name())
+		}
+		b, err := migrationFiles.ReadFile(path.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, migration{version: v, name: name, sql: string(b)})
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].version < migrations[j].version })
+	for i := 1; i < len(migrations); i++ {
+		if migrations[i].version == migrations[i-1].version {
+			return nil, errors.New("Duplicate migration version: " + migrations[i].name)
+		}
+	}
+	return migrations, nil
+}
+
+// Bring the database up to the latest schema version. Each migration is
+// applied in its own transaction and recorded in schema_migrations, so a
+// failed migration leaves the database at the previous version. Databases
+// at a version newer than the latest migration were written by a newer
+// build, which may have changed tables in ways this one doesn't understand,
+// so they are refused. MySQL commits schema changes as they are made, so a
+// failed MySQL migration may be partly applied. backup is called before the
+// first migration of a database that already has a schema, including those
+// created by the schema file before there were migrations.
+func migrate(db *sql.DB, d dialect, backup func() error) error {
+	migrations, err := loadMigrations(d.migrations)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(d.rebind(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		"version" INTEGER PRIMARY KEY NOT NULL,
+		"name" TEXT NOT NULL,
+		"applied" DATETIME NOT NULL
+	)`))
+	if err != nil {
+		return err
+	}
+
+	var current int
+	if err := db.QueryRow("select coalesce(max(version), 0) from schema_migrations").Scan(&current); err != nil {
+		return err
+	}
+	latest := 0
+	if len(migrations) > 0 {
+		latest = migrations[len(migrations)-1].version
+	}
+	if current > latest {
+		return errors.New("Database schema version " + strconv.Itoa(current) + " is newer than the latest supported version " +
+			strconv.Itoa(latest) + ", upgrade sp500scraper")
+	}
+
+	existing := current > 0
+	if !existing && d.tableExists != "" {
+		// Databases created from schema.sql have tables but no migrations
+		var n int
+		if err := db.QueryRow(d.rebind(d.tableExists), "symbolids").Scan(&n); err != nil {
+			return err
+		}
+		existing = n > 0
+	}
+	if existing && current < latest {
+		if err := backup(); err != nil {
+			return errors.New("Could not back up the database before migrating it: " + err.Error())
+		}
+	}
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(m.sql); err != nil {
+			tx.Rollback()
+			return errors.New("Migration " + m.name + " failed: " + err.Error())
+		}
+		if _, err := tx.Exec(d.rebind("insert into schema_migrations values (?, ?, ?)"), m.version, m.name, time.Now()); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+		slog.Info("Applied schema migration", "version", m.version, "name", m.name)
+	}
+	return nil
+}
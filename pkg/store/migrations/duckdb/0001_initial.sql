@@ -0,0 +1,239 @@
+-- Every table as of the first DuckDB release. There are no foreign keys, as
+-- DuckDB can't upsert rows that other tables reference, and the candle tables
+-- have no index beyond their unique key, which keeps bulk inserts fast.
+CREATE TABLE IF NOT EXISTS symbolids (
+    "id" INTEGER PRIMARY KEY NOT NULL,
+    "symbol" TEXT NOT NULL,
+    "exchange" TEXT NOT NULL,
+    "name" TEXT NOT NULL,
+    "industry" TEXT NOT NULL,
+    "subindustry" TEXT NOT NULL,
+    "delisted_at" TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS "i_symbolids" on symbolids (symbol, exchange);
+-- Scrapes, and the run that fetched each candle
+CREATE SEQUENCE IF NOT EXISTS runs_id;
+CREATE TABLE IF NOT EXISTS runs (
+    "id" INTEGER PRIMARY KEY DEFAULT nextval('runs_id'),
+    "started" TIMESTAMP NOT NULL,
+    "finished" TIMESTAMP,
+    "interval" TEXT NOT NULL,
+    "provider" TEXT NOT NULL,
+    "version" TEXT NOT NULL,
+    "symbols" INTEGER NOT NULL,
+    "failed" INTEGER NOT NULL,
+    "candles" BIGINT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS candlestick (
+    "id" INTEGER NOT NULL,
+    "starttime" TIMESTAMP NOT NULL,
+    "endtime" TIMESTAMP NOT NULL,
+    "open" DOUBLE NOT NULL,
+    "close" DOUBLE NOT NULL,
+    "high" DOUBLE NOT NULL,
+    "low" DOUBLE NOT NULL,
+    "volume" BIGINT NOT NULL,
+    "run" INTEGER,
+    "interval" TEXT NOT NULL DEFAULT 'OneDay',
+    UNIQUE (id, "interval", starttime)
+);
+-- Split adjusted candles of symbols that have split
+CREATE TABLE IF NOT EXISTS adjusted (
+    "id" INTEGER NOT NULL,
+    "starttime" TIMESTAMP NOT NULL,
+    "endtime" TIMESTAMP NOT NULL,
+    "open" DOUBLE NOT NULL,
+    "close" DOUBLE NOT NULL,
+    "high" DOUBLE NOT NULL,
+    "low" DOUBLE NOT NULL,
+    "volume" BIGINT NOT NULL,
+    "run" INTEGER,
+    "interval" TEXT NOT NULL DEFAULT 'OneDay',
+    UNIQUE (id, "interval", starttime)
+);
+CREATE TABLE IF NOT EXISTS dividends (
+    "id" INTEGER NOT NULL,
+    "exdate" TIMESTAMP NOT NULL,
+    "paydate" TIMESTAMP NOT NULL,
+    "amount" DOUBLE NOT NULL,
+    UNIQUE (id, exdate)
+);
+-- Symbol IDs found with the search endpoint, reused until they go stale
+CREATE TABLE IF NOT EXISTS symbolcache (
+    "symbol" TEXT NOT NULL,
+    "exchange" TEXT NOT NULL,
+    "id" INTEGER NOT NULL,
+    "resolved" TIMESTAMP NOT NULL,
+    primary key(symbol, exchange)
+);
+CREATE TABLE IF NOT EXISTS failures (
+    "symbol" TEXT NOT NULL,
+    "exchange" TEXT NOT NULL,
+    "reason" TEXT NOT NULL,
+    "failedat" TIMESTAMP NOT NULL
+);
+-- Daily snapshots of symbol fundamentals
+CREATE TABLE IF NOT EXISTS fundamentals (
+    "id" INTEGER NOT NULL,
+    "snapshot" TIMESTAMP NOT NULL,
+    "marketcap" DOUBLE NOT NULL,
+    "pe" DOUBLE NOT NULL,
+    "eps" DOUBLE NOT NULL,
+    "yield" DOUBLE NOT NULL,
+    "dividend" DOUBLE NOT NULL,
+    "shares" BIGINT NOT NULL,
+    "high52" DOUBLE NOT NULL,
+    "low52" DOUBLE NOT NULL,
+    "avgvolume" BIGINT NOT NULL,
+    UNIQUE (id, snapshot)
+);
+-- Stock splits, ratio is the number of new shares per old share
+CREATE TABLE IF NOT EXISTS splits (
+    "id" INTEGER NOT NULL,
+    "splitdate" TIMESTAMP NOT NULL,
+    "ratio" DOUBLE NOT NULL,
+    "source" TEXT NOT NULL,
+    UNIQUE (id, splitdate)
+);
+-- Split adjusted candles of every symbol
+CREATE OR REPLACE VIEW adjusted_candles AS
+    SELECT * FROM adjusted
+    UNION ALL
+    SELECT * FROM candlestick c WHERE NOT EXISTS (SELECT 1 FROM splits s WHERE s.id = c.id);
+-- Level 1 quotes recorded by the stream subcommand
+CREATE TABLE IF NOT EXISTS quotes (
+    "id" INTEGER NOT NULL,
+    "time" TIMESTAMP NOT NULL,
+    "bid" DOUBLE NOT NULL,
+    "bidsize" INTEGER NOT NULL,
+    "ask" DOUBLE NOT NULL,
+    "asksize" INTEGER NOT NULL,
+    "last" DOUBLE NOT NULL,
+    "lastsize" INTEGER NOT NULL,
+    "volume" BIGINT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS "i_quotes" on quotes (id, "time");
+-- Options on the symbols, and their quotes at each snapshot
+CREATE TABLE IF NOT EXISTS option_chain (
+    "id" INTEGER PRIMARY KEY,
+    "underlying" INTEGER NOT NULL,
+    "symbol" TEXT NOT NULL,
+    "root" TEXT NOT NULL,
+    "type" TEXT NOT NULL,
+    "expiry" TIMESTAMP NOT NULL,
+    "strike" DOUBLE NOT NULL,
+    "multiplier" INTEGER NOT NULL,
+    "exercise" TEXT NOT NULL,
+    "updated" TIMESTAMP NOT NULL
+);
+CREATE INDEX IF NOT EXISTS "i_option_chain" on option_chain (underlying, expiry, strike);
+CREATE TABLE IF NOT EXISTS option_quote (
+    "id" INTEGER NOT NULL,
+    "snapshot" TIMESTAMP NOT NULL,
+    "bid" DOUBLE NOT NULL,
+    "bidsize" INTEGER NOT NULL,
+    "ask" DOUBLE NOT NULL,
+    "asksize" INTEGER NOT NULL,
+    "last" DOUBLE NOT NULL,
+    "volume" INTEGER NOT NULL,
+    "openinterest" INTEGER NOT NULL,
+    "volatility" DOUBLE NOT NULL,
+    "delta" DOUBLE NOT NULL,
+    "gamma" DOUBLE NOT NULL,
+    "theta" DOUBLE NOT NULL,
+    "vega" DOUBLE NOT NULL,
+    "rho" DOUBLE NOT NULL,
+    UNIQUE (id, snapshot)
+);
+-- Daily series of each sector, rebuilt with -sectors
+CREATE TABLE IF NOT EXISTS sector_daily (
+    "sector" TEXT NOT NULL,
+    "day" TIMESTAMP NOT NULL,
+    "symbols" INTEGER NOT NULL,
+    "avgreturn" DOUBLE NOT NULL,
+    "volume" BIGINT NOT NULL,
+    "advancers" INTEGER NOT NULL,
+    "decliners" INTEGER NOT NULL,
+    primary key(sector, day)
+);
+-- Periods each symbol was a member of a universe, a NULL effectivefrom is
+-- before the earliest known change and a NULL effectiveto is still a member
+CREATE TABLE IF NOT EXISTS constituents (
+    "universe" TEXT NOT NULL,
+    "symbol" TEXT NOT NULL,
+    "name" TEXT NOT NULL,
+    "effectivefrom" TIMESTAMP,
+    "effectiveto" TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS "i_constituents" on constituents (universe, symbol);
+-- Candles tagged with the universes the symbol was a member of at the time
+CREATE OR REPLACE VIEW member_candles AS
+    SELECT c.*, s.symbol, m.universe FROM candlestick c
+    JOIN symbolids s ON s.id = c.id
+    JOIN constituents m ON m.symbol = s.symbol
+        AND (m.effectivefrom IS NULL OR c.starttime >= m.effectivefrom)
+        AND (m.effectiveto IS NULL OR c.starttime < m.effectiveto);
+-- Candles rejected by validation, with the problem found, instead of being
+-- stored with the rest
+CREATE TABLE IF NOT EXISTS data_quality_issues (
+    "id" INTEGER NOT NULL,
+    "run" INTEGER,
+    "interval" TEXT NOT NULL,
+    "starttime" TIMESTAMP NOT NULL,
+    "endtime" TIMESTAMP NOT NULL,
+    "open" DOUBLE NOT NULL,
+    "close" DOUBLE NOT NULL,
+    "high" DOUBLE NOT NULL,
+    "low" DOUBLE NOT NULL,
+    "volume" BIGINT NOT NULL,
+    "problem" TEXT NOT NULL,
+    "detected" TIMESTAMP NOT NULL
+);
+CREATE INDEX IF NOT EXISTS "i_data_quality_issues" on data_quality_issues (id, starttime);
+-- Past and upcoming earnings reports of each symbol, the EPS figures are NULL
+-- until reported or when there is no estimate
+CREATE TABLE IF NOT EXISTS earnings (
+    "id" INTEGER NOT NULL,
+    "reportdate" TIMESTAMP NOT NULL,
+    "fiscalend" TIMESTAMP NOT NULL,
+    "reporttime" TEXT NOT NULL,
+    "estimate" DOUBLE,
+    "reported" DOUBLE,
+    "surprise" DOUBLE,
+    "updated" TIMESTAMP NOT NULL,
+    primary key(id, reportdate)
+);
+-- Technical indicators computed from the candles of an interval, one row per
+-- indicator and candle, named after the indicator and its window
+CREATE TABLE IF NOT EXISTS indicators (
+    "id" INTEGER NOT NULL,
+    "interval" TEXT NOT NULL,
+    "starttime" TIMESTAMP NOT NULL,
+    "name" TEXT NOT NULL,
+    "value" DOUBLE NOT NULL,
+    primary key(id, "interval", name, starttime)
+);
+-- Daily returns of each symbol, rebuilt with -returns. The log return is NULL
+-- on the first day and the volatilities until there are enough returns.
+CREATE TABLE IF NOT EXISTS returns (
+    "id" INTEGER NOT NULL,
+    "day" TIMESTAMP NOT NULL,
+    "close" DOUBLE NOT NULL,
+    "logreturn" DOUBLE,
+    "vol30" DOUBLE,
+    "vol90" DOUBLE,
+    "vol252" DOUBLE,
+    "drawdown" DOUBLE NOT NULL,
+    "maxdrawdown" DOUBLE NOT NULL,
+    primary key(id, day)
+);
+-- Correlations of the daily returns of each pair of symbols over a window of
+-- trading days ending on the day, each pair stored once
+CREATE TABLE IF NOT EXISTS correlations (
+    "day" TIMESTAMP NOT NULL,
+    "window" INTEGER NOT NULL,
+    "id_a" INTEGER NOT NULL,
+    "id_b" INTEGER NOT NULL,
+    "value" DOUBLE NOT NULL,
+    primary key(day, "window", id_a, id_b)
+);
@@ -0,0 +1,25 @@
+-- Daily rates converting a currency to USD
+CREATE TABLE IF NOT EXISTS fx_rates (
+    "currency" TEXT NOT NULL,
+    "day" TIMESTAMP NOT NULL,
+    "rate" DOUBLE NOT NULL,
+    primary key(currency, day)
+);
+-- Currency each candle was listed in, and the rate its prices were
+-- converted to USD at, null when they are in the listed currency
+ALTER TABLE candlestick ADD COLUMN "currency" TEXT DEFAULT 'USD';
+ALTER TABLE candlestick ADD COLUMN "fxrate" DOUBLE;
+ALTER TABLE adjusted ADD COLUMN "currency" TEXT DEFAULT 'USD';
+ALTER TABLE adjusted ADD COLUMN "fxrate" DOUBLE;
+-- Views over the candles are bound when created, so they are recreated
+-- with the new columns
+CREATE OR REPLACE VIEW adjusted_candles AS
+    SELECT * FROM adjusted
+    UNION ALL
+    SELECT * FROM candlestick c WHERE NOT EXISTS (SELECT 1 FROM splits s WHERE s.id = c.id);
+CREATE OR REPLACE VIEW member_candles AS
+    SELECT c.*, s.symbol, m.universe FROM candlestick c
+    JOIN symbolids s ON s.id = c.id
+    JOIN constituents m ON m.symbol = s.symbol
+        AND (m.effectivefrom IS NULL OR c.starttime >= m.effectivefrom)
+        AND (m.effectiveto IS NULL OR c.starttime < m.effectiveto);
@@ -0,0 +1,11 @@
+-- Symbols still failing after the retry passes of a run, with the class of
+-- the error, fetched first by the next run
+CREATE TABLE IF NOT EXISTS retry_queue (
+    "symbol" TEXT NOT NULL,
+    "exchange" TEXT NOT NULL,
+    "class" TEXT NOT NULL,
+    "reason" TEXT NOT NULL,
+    "attempts" INTEGER NOT NULL,
+    "failedat" TIMESTAMP NOT NULL,
+    primary key(symbol, exchange)
+);
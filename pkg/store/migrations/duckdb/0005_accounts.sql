@@ -0,0 +1,51 @@
+-- Snapshots of the brokerage accounts of the logged in user
+CREATE TABLE IF NOT EXISTS account_snapshots (
+    "account" TEXT NOT NULL,
+    "type" TEXT NOT NULL,
+    "snapshot" TIMESTAMP NOT NULL,
+    primary key(account, snapshot)
+);
+-- Holdings of each account at each snapshot
+CREATE TABLE IF NOT EXISTS account_positions (
+    "account" TEXT NOT NULL,
+    "snapshot" TIMESTAMP NOT NULL,
+    "symbolid" INTEGER NOT NULL,
+    "symbol" TEXT NOT NULL,
+    "quantity" DOUBLE NOT NULL,
+    "price" DOUBLE NOT NULL,
+    "marketvalue" DOUBLE NOT NULL,
+    "averageprice" DOUBLE NOT NULL,
+    "totalcost" DOUBLE NOT NULL,
+    "openpnl" DOUBLE NOT NULL,
+    "closedpnl" DOUBLE NOT NULL,
+    primary key(account, snapshot, symbolid)
+);
+-- Balances of each account per currency and combined at each snapshot
+CREATE TABLE IF NOT EXISTS account_balances (
+    "account" TEXT NOT NULL,
+    "snapshot" TIMESTAMP NOT NULL,
+    "currency" TEXT NOT NULL,
+    "combined" BOOLEAN NOT NULL,
+    "cash" DOUBLE NOT NULL,
+    "marketvalue" DOUBLE NOT NULL,
+    "totalequity" DOUBLE NOT NULL,
+    "buyingpower" DOUBLE NOT NULL,
+    "maintenanceexcess" DOUBLE NOT NULL,
+    primary key(account, snapshot, currency, combined)
+);
+-- Order fills of each account, kept once however many snapshots see them
+CREATE TABLE IF NOT EXISTS account_executions (
+    "id" BIGINT NOT NULL,
+    "account" TEXT NOT NULL,
+    "orderid" BIGINT NOT NULL,
+    "symbolid" INTEGER NOT NULL,
+    "symbol" TEXT NOT NULL,
+    "side" TEXT NOT NULL,
+    "quantity" DOUBLE NOT NULL,
+    "price" DOUBLE NOT NULL,
+    "commission" DOUBLE NOT NULL,
+    "fees" DOUBLE NOT NULL,
+    "venue" TEXT NOT NULL,
+    "executed" TIMESTAMP NOT NULL,
+    primary key(id)
+);
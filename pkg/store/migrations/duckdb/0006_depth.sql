@@ -0,0 +1,11 @@
+-- Order book ladders of symbols at each snapshot, level 0 being the best
+-- bid or ask
+CREATE TABLE IF NOT EXISTS depth (
+    "id" INTEGER NOT NULL,
+    "snapshot" TIMESTAMP NOT NULL,
+    "side" TEXT NOT NULL,
+    "level" INTEGER NOT NULL,
+    "price" DOUBLE NOT NULL,
+    "size" INTEGER NOT NULL,
+    primary key(id, snapshot, side, level)
+);
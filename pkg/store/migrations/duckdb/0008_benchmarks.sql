@@ -0,0 +1,6 @@
+-- Benchmark series such as SPY and the sector ETFs are stored with the
+-- universe's symbols and flagged. DuckDB can't alter a table with an index
+-- on it, so the index is dropped while the column is added.
+DROP INDEX IF EXISTS "i_symbolids";
+ALTER TABLE symbolids ADD COLUMN "benchmark" BOOLEAN DEFAULT false;
+CREATE INDEX IF NOT EXISTS "i_symbolids" on symbolids (symbol, exchange);
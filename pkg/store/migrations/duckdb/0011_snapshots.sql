@@ -0,0 +1,27 @@
+-- Earlier versions of candles a later run replaced with different values,
+-- and the run that replaced them, so the candles can be read as they were
+-- after any run
+CREATE TABLE IF NOT EXISTS candle_versions (
+    "id" INTEGER NOT NULL,
+    "starttime" TIMESTAMP NOT NULL,
+    "endtime" TIMESTAMP NOT NULL,
+    "open" DOUBLE NOT NULL,
+    "close" DOUBLE NOT NULL,
+    "high" DOUBLE NOT NULL,
+    "low" DOUBLE NOT NULL,
+    "volume" BIGINT NOT NULL,
+    "run" INTEGER,
+    "interval" TEXT NOT NULL,
+    "currency" TEXT,
+    "fxrate" DOUBLE,
+    "session" TEXT,
+    "adjclose" DOUBLE,
+    "replaced" INTEGER NOT NULL,
+    primary key(id, "interval", starttime, replaced)
+);
+-- Names given to the state of the candles after a run
+CREATE TABLE IF NOT EXISTS snapshots (
+    "name" TEXT PRIMARY KEY NOT NULL,
+    "run" INTEGER NOT NULL,
+    "created" TIMESTAMP NOT NULL
+);
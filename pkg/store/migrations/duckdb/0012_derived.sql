@@ -0,0 +1,16 @@
+-- Candles built from the stored ones of a finer interval, such as weekly
+-- candles from daily ones, rather than fetched
+ALTER TABLE candlestick ADD COLUMN "derived" BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE adjusted ADD COLUMN "derived" BOOLEAN NOT NULL DEFAULT false;
+-- Views over the candles are bound when created, so they are recreated
+-- with the new column
+CREATE OR REPLACE VIEW adjusted_candles AS
+    SELECT * FROM adjusted
+    UNION ALL
+    SELECT * FROM candlestick c WHERE NOT EXISTS (SELECT 1 FROM splits s WHERE s.id = c.id);
+CREATE OR REPLACE VIEW member_candles AS
+    SELECT c.*, s.symbol, m.universe FROM candlestick c
+    JOIN symbolids s ON s.id = c.id
+    JOIN constituents m ON m.symbol = s.symbol
+        AND (m.effectivefrom IS NULL OR c.starttime >= m.effectivefrom)
+        AND (m.effectiveto IS NULL OR c.starttime < m.effectiveto);
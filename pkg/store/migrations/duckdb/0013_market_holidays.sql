@@ -0,0 +1,10 @@
+-- Published closures and early closes of each exchange, the closing time
+-- null when it is closed all day
+CREATE TABLE IF NOT EXISTS market_holidays (
+    "exchange" TEXT NOT NULL,
+    "day" TIMESTAMP NOT NULL,
+    "name" TEXT NOT NULL,
+    "close" TIMESTAMP,
+    "updated" TIMESTAMP NOT NULL,
+    primary key(exchange, day)
+);
@@ -0,0 +1,13 @@
+-- Latest regular session daily close of each symbol with the close before
+-- it and the change between them, rebuilt after each run so the latest
+-- prices can be read without scanning the candles
+CREATE TABLE IF NOT EXISTS latest_close (
+    "id" INTEGER PRIMARY KEY NOT NULL,
+    "day" TIMESTAMP NOT NULL,
+    "close" DOUBLE NOT NULL,
+    "prevclose" DOUBLE,
+    "netchange" DOUBLE,
+    "pctchange" DOUBLE,
+    "volume" BIGINT NOT NULL,
+    "updated" TIMESTAMP NOT NULL
+);
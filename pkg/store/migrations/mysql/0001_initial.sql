@@ -0,0 +1,251 @@
+-- Every table as of the first MySQL release. Text columns that are part of a
+-- key are VARCHAR, as MySQL can't index TEXT without a prefix length.
+CREATE TABLE IF NOT EXISTS symbolids (
+    `id` INTEGER PRIMARY KEY NOT NULL,
+    `symbol` VARCHAR(32) NOT NULL,
+    `exchange` VARCHAR(32) NOT NULL,
+    `name` TEXT NOT NULL,
+    `industry` TEXT NOT NULL,
+    `subindustry` TEXT NOT NULL,
+    `delisted_at` DATETIME(6),
+    KEY `i_symbolids` (symbol, exchange)
+) ENGINE=InnoDB;
+-- Scrapes, and the run that fetched each candle
+CREATE TABLE IF NOT EXISTS runs (
+    `id` INTEGER PRIMARY KEY AUTO_INCREMENT,
+    `started` DATETIME(6) NOT NULL,
+    `finished` DATETIME(6),
+    `interval` TEXT NOT NULL,
+    `provider` TEXT NOT NULL,
+    `version` TEXT NOT NULL,
+    `symbols` INTEGER NOT NULL,
+    `failed` INTEGER NOT NULL,
+    `candles` BIGINT NOT NULL
+) ENGINE=InnoDB;
+CREATE TABLE IF NOT EXISTS candlestick (
+    `id` INTEGER NOT NULL,
+    `starttime` DATETIME(6) NOT NULL,
+    `endtime` DATETIME(6) NOT NULL,
+    `open` DOUBLE NOT NULL,
+    `close` DOUBLE NOT NULL,
+    `high` DOUBLE NOT NULL,
+    `low` DOUBLE NOT NULL,
+    `volume` BIGINT NOT NULL,
+    `run` INTEGER,
+    `interval` VARCHAR(32) NOT NULL DEFAULT 'OneDay',
+    UNIQUE KEY `u_candlestick_interval` (id, `interval`, starttime),
+    KEY `i_candlestick` (id, starttime DESC, endtime DESC),
+    foreign key(id) references symbolids(id),
+    foreign key(run) references runs(id)
+) ENGINE=InnoDB;
+-- Split adjusted candles of symbols that have split
+CREATE TABLE IF NOT EXISTS adjusted (
+    `id` INTEGER NOT NULL,
+    `starttime` DATETIME(6) NOT NULL,
+    `endtime` DATETIME(6) NOT NULL,
+    `open` DOUBLE NOT NULL,
+    `close` DOUBLE NOT NULL,
+    `high` DOUBLE NOT NULL,
+    `low` DOUBLE NOT NULL,
+    `volume` BIGINT NOT NULL,
+    `run` INTEGER,
+    `interval` VARCHAR(32) NOT NULL DEFAULT 'OneDay',
+    UNIQUE KEY `u_adjusted_interval` (id, `interval`, starttime),
+    foreign key(id) references symbolids(id),
+    foreign key(run) references runs(id)
+) ENGINE=InnoDB;
+CREATE TABLE IF NOT EXISTS dividends (
+    `id` INTEGER NOT NULL,
+    `exdate` DATETIME(6) NOT NULL,
+    `paydate` DATETIME(6) NOT NULL,
+    `amount` DOUBLE NOT NULL,
+    UNIQUE KEY `u_dividends` (id, exdate),
+    foreign key(id) references symbolids(id)
+) ENGINE=InnoDB;
+-- Symbol IDs found with the search endpoint, reused until they go stale
+CREATE TABLE IF NOT EXISTS symbolcache (
+    `symbol` VARCHAR(32) NOT NULL,
+    `exchange` VARCHAR(32) NOT NULL,
+    `id` INTEGER NOT NULL,
+    `resolved` DATETIME(6) NOT NULL,
+    primary key(symbol, exchange)
+) ENGINE=InnoDB;
+CREATE TABLE IF NOT EXISTS failures (
+    `symbol` VARCHAR(32) NOT NULL,
+    `exchange` VARCHAR(32) NOT NULL,
+    `reason` TEXT NOT NULL,
+    `failedat` DATETIME(6) NOT NULL
+) ENGINE=InnoDB;
+-- Daily snapshots of symbol fundamentals
+CREATE TABLE IF NOT EXISTS fundamentals (
+    `id` INTEGER NOT NULL,
+    `snapshot` DATETIME(6) NOT NULL,
+    `marketcap` DOUBLE NOT NULL,
+    `pe` DOUBLE NOT NULL,
+    `eps` DOUBLE NOT NULL,
+    `yield` DOUBLE NOT NULL,
+    `dividend` DOUBLE NOT NULL,
+    `shares` BIGINT NOT NULL,
+    `high52` DOUBLE NOT NULL,
+    `low52` DOUBLE NOT NULL,
+    `avgvolume` BIGINT NOT NULL,
+    UNIQUE KEY `u_fundamentals` (id, snapshot),
+    foreign key(id) references symbolids(id)
+) ENGINE=InnoDB;
+-- Stock splits, ratio is the number of new shares per old share
+CREATE TABLE IF NOT EXISTS splits (
+    `id` INTEGER NOT NULL,
+    `splitdate` DATETIME(6) NOT NULL,
+    `ratio` DOUBLE NOT NULL,
+    `source` TEXT NOT NULL,
+    UNIQUE KEY `u_splits` (id, splitdate),
+    foreign key(id) references symbolids(id)
+) ENGINE=InnoDB;
+-- Split adjusted candles of every symbol
+CREATE OR REPLACE VIEW adjusted_candles AS
+    SELECT * FROM adjusted
+    UNION ALL
+    SELECT * FROM candlestick c WHERE NOT EXISTS (SELECT 1 FROM splits s WHERE s.id = c.id);
+-- Level 1 quotes recorded by the stream subcommand
+CREATE TABLE IF NOT EXISTS quotes (
+    `id` INTEGER NOT NULL,
+    `time` DATETIME(6) NOT NULL,
+    `bid` DOUBLE NOT NULL,
+    `bidsize` INTEGER NOT NULL,
+    `ask` DOUBLE NOT NULL,
+    `asksize` INTEGER NOT NULL,
+    `last` DOUBLE NOT NULL,
+    `lastsize` INTEGER NOT NULL,
+    `volume` BIGINT NOT NULL,
+    KEY `i_quotes` (id, `time`),
+    foreign key(id) references symbolids(id)
+) ENGINE=InnoDB;
+-- Options on the symbols, and their quotes at each snapshot
+CREATE TABLE IF NOT EXISTS option_chain (
+    `id` INTEGER PRIMARY KEY,
+    `underlying` INTEGER NOT NULL,
+    `symbol` TEXT NOT NULL,
+    `root` TEXT NOT NULL,
+    `type` TEXT NOT NULL,
+    `expiry` DATETIME(6) NOT NULL,
+    `strike` DOUBLE NOT NULL,
+    `multiplier` INTEGER NOT NULL,
+    `exercise` TEXT NOT NULL,
+    `updated` DATETIME(6) NOT NULL,
+    KEY `i_option_chain` (underlying, expiry, strike),
+    foreign key(underlying) references symbolids(id)
+) ENGINE=InnoDB;
+CREATE TABLE IF NOT EXISTS option_quote (
+    `id` INTEGER NOT NULL,
+    `snapshot` DATETIME(6) NOT NULL,
+    `bid` DOUBLE NOT NULL,
+    `bidsize` INTEGER NOT NULL,
+    `ask` DOUBLE NOT NULL,
+    `asksize` INTEGER NOT NULL,
+    `last` DOUBLE NOT NULL,
+    `volume` INTEGER NOT NULL,
+    `openinterest` INTEGER NOT NULL,
+    `volatility` DOUBLE NOT NULL,
+    `delta` DOUBLE NOT NULL,
+    `gamma` DOUBLE NOT NULL,
+    `theta` DOUBLE NOT NULL,
+    `vega` DOUBLE NOT NULL,
+    `rho` DOUBLE NOT NULL,
+    UNIQUE KEY `u_option_quote` (id, snapshot),
+    foreign key(id) references option_chain(id)
+) ENGINE=InnoDB;
+-- Daily series of each sector, rebuilt with -sectors
+CREATE TABLE IF NOT EXISTS sector_daily (
+    `sector` VARCHAR(255) NOT NULL,
+    `day` DATETIME(6) NOT NULL,
+    `symbols` INTEGER NOT NULL,
+    `avgreturn` DOUBLE NOT NULL,
+    `volume` BIGINT NOT NULL,
+    `advancers` INTEGER NOT NULL,
+    `decliners` INTEGER NOT NULL,
+    primary key(sector, day)
+) ENGINE=InnoDB;
+-- Periods each symbol was a member of a universe, a NULL effectivefrom is
+-- before the earliest known change and a NULL effectiveto is still a member
+CREATE TABLE IF NOT EXISTS constituents (
+    `universe` VARCHAR(64) NOT NULL,
+    `symbol` VARCHAR(32) NOT NULL,
+    `name` TEXT NOT NULL,
+    `effectivefrom` DATETIME(6),
+    `effectiveto` DATETIME(6),
+    KEY `i_constituents` (universe, symbol)
+) ENGINE=InnoDB;
+-- Candles tagged with the universes the symbol was a member of at the time
+CREATE OR REPLACE VIEW member_candles AS
+    SELECT c.*, s.symbol, m.universe FROM candlestick c
+    JOIN symbolids s ON s.id = c.id
+    JOIN constituents m ON m.symbol = s.symbol
+        AND (m.effectivefrom IS NULL OR c.starttime >= m.effectivefrom)
+        AND (m.effectiveto IS NULL OR c.starttime < m.effectiveto);
+-- Candles rejected by validation, with the problem found, instead of being
+-- stored with the rest
+CREATE TABLE IF NOT EXISTS data_quality_issues (
+    `id` INTEGER NOT NULL,
+    `run` INTEGER,
+    `interval` TEXT NOT NULL,
+    `starttime` DATETIME(6) NOT NULL,
+    `endtime` DATETIME(6) NOT NULL,
+    `open` DOUBLE NOT NULL,
+    `close` DOUBLE NOT NULL,
+    `high` DOUBLE NOT NULL,
+    `low` DOUBLE NOT NULL,
+    `volume` BIGINT NOT NULL,
+    `problem` TEXT NOT NULL,
+    `detected` DATETIME(6) NOT NULL,
+    KEY `i_data_quality_issues` (id, starttime)
+) ENGINE=InnoDB;
+-- Past and upcoming earnings reports of each symbol, the EPS figures are NULL
+-- until reported or when there is no estimate
+CREATE TABLE IF NOT EXISTS earnings (
+    `id` INTEGER NOT NULL,
+    `reportdate` DATETIME(6) NOT NULL,
+    `fiscalend` DATETIME(6) NOT NULL,
+    `reporttime` TEXT NOT NULL,
+    `estimate` DOUBLE,
+    `reported` DOUBLE,
+    `surprise` DOUBLE,
+    `updated` DATETIME(6) NOT NULL,
+    primary key(id, reportdate),
+    foreign key(id) references symbolids(id)
+) ENGINE=InnoDB;
+-- Technical indicators computed from the candles of an interval, one row per
+-- indicator and candle, named after the indicator and its window
+CREATE TABLE IF NOT EXISTS indicators (
+    `id` INTEGER NOT NULL,
+    `interval` VARCHAR(32) NOT NULL,
+    `starttime` DATETIME(6) NOT NULL,
+    `name` VARCHAR(64) NOT NULL,
+    `value` DOUBLE NOT NULL,
+    primary key(id, `interval`, name, starttime),
+    foreign key(id) references symbolids(id)
+) ENGINE=InnoDB;
+-- Daily returns of each symbol, rebuilt with -returns. The log return is NULL
+-- on the first day and the volatilities until there are enough returns.
+CREATE TABLE IF NOT EXISTS returns (
+    `id` INTEGER NOT NULL,
+    `day` DATETIME(6) NOT NULL,
+    `close` DOUBLE NOT NULL,
+    `logreturn` DOUBLE,
+    `vol30` DOUBLE,
+    `vol90` DOUBLE,
+    `vol252` DOUBLE,
+    `drawdown` DOUBLE NOT NULL,
+    `maxdrawdown` DOUBLE NOT NULL,
+    primary key(id, day),
+    foreign key(id) references symbolids(id)
+) ENGINE=InnoDB;
+-- Correlations of the daily returns of each pair of symbols over a window of
+-- trading days ending on the day, each pair stored once
+CREATE TABLE IF NOT EXISTS correlations (
+    `day` DATETIME(6) NOT NULL,
+    `window` INTEGER NOT NULL,
+    `id_a` INTEGER NOT NULL,
+    `id_b` INTEGER NOT NULL,
+    `value` DOUBLE NOT NULL,
+    primary key(day, `window`, id_a, id_b)
+) ENGINE=InnoDB;
@@ -0,0 +1,14 @@
+-- Windows of a backfill, one per symbol, interval and month, and whether each
+-- has been fetched. Status is pending, done or failed.
+CREATE TABLE IF NOT EXISTS backfill_jobs (
+    `symbol` VARCHAR(32) NOT NULL,
+    `exchange` VARCHAR(32) NOT NULL,
+    `interval` VARCHAR(32) NOT NULL,
+    `windowstart` DATETIME(6) NOT NULL,
+    `windowend` DATETIME(6) NOT NULL,
+    `status` VARCHAR(16) NOT NULL,
+    `attempts` INTEGER NOT NULL,
+    `error` TEXT NOT NULL,
+    `updated` DATETIME(6) NOT NULL,
+    primary key(symbol, exchange, `interval`, windowstart)
+) ENGINE=InnoDB;
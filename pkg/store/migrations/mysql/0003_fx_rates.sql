@@ -0,0 +1,23 @@
+-- Daily rates converting a currency to USD
+CREATE TABLE IF NOT EXISTS fx_rates (
+    `currency` VARCHAR(8) NOT NULL,
+    `day` DATETIME(6) NOT NULL,
+    `rate` DOUBLE NOT NULL,
+    primary key(currency, day)
+) ENGINE=InnoDB;
+-- Currency each candle was listed in, and the rate its prices were
+-- converted to USD at, null when they are in the listed currency
+ALTER TABLE candlestick ADD COLUMN `currency` VARCHAR(8) NOT NULL DEFAULT 'USD', ADD COLUMN `fxrate` DOUBLE;
+ALTER TABLE adjusted ADD COLUMN `currency` VARCHAR(8) NOT NULL DEFAULT 'USD', ADD COLUMN `fxrate` DOUBLE;
+-- Views over the candles are expanded when created, so they are recreated
+-- with the new columns
+CREATE OR REPLACE VIEW adjusted_candles AS
+    SELECT * FROM adjusted
+    UNION ALL
+    SELECT * FROM candlestick c WHERE NOT EXISTS (SELECT 1 FROM splits s WHERE s.id = c.id);
+CREATE OR REPLACE VIEW member_candles AS
+    SELECT c.*, s.symbol, m.universe FROM candlestick c
+    JOIN symbolids s ON s.id = c.id
+    JOIN constituents m ON m.symbol = s.symbol
+        AND (m.effectivefrom IS NULL OR c.starttime >= m.effectivefrom)
+        AND (m.effectiveto IS NULL OR c.starttime < m.effectiveto);
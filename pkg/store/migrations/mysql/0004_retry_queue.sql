@@ -0,0 +1,11 @@
+-- Symbols still failing after the retry passes of a run, with the class of
+-- the error, fetched first by the next run
+CREATE TABLE IF NOT EXISTS retry_queue (
+    `symbol` VARCHAR(32) NOT NULL,
+    `exchange` VARCHAR(32) NOT NULL,
+    `class` VARCHAR(32) NOT NULL,
+    `reason` TEXT NOT NULL,
+    `attempts` INTEGER NOT NULL,
+    `failedat` DATETIME(6) NOT NULL,
+    primary key(symbol, exchange)
+) ENGINE=InnoDB;
@@ -0,0 +1,51 @@
+-- Snapshots of the brokerage accounts of the logged in user
+CREATE TABLE IF NOT EXISTS account_snapshots (
+    `account` VARCHAR(32) NOT NULL,
+    `type` TEXT NOT NULL,
+    `snapshot` DATETIME(6) NOT NULL,
+    primary key(account, snapshot)
+) ENGINE=InnoDB;
+-- Holdings of each account at each snapshot
+CREATE TABLE IF NOT EXISTS account_positions (
+    `account` VARCHAR(32) NOT NULL,
+    `snapshot` DATETIME(6) NOT NULL,
+    `symbolid` INTEGER NOT NULL,
+    `symbol` TEXT NOT NULL,
+    `quantity` DOUBLE NOT NULL,
+    `price` DOUBLE NOT NULL,
+    `marketvalue` DOUBLE NOT NULL,
+    `averageprice` DOUBLE NOT NULL,
+    `totalcost` DOUBLE NOT NULL,
+    `openpnl` DOUBLE NOT NULL,
+    `closedpnl` DOUBLE NOT NULL,
+    primary key(account, snapshot, symbolid)
+) ENGINE=InnoDB;
+-- Balances of each account per currency and combined at each snapshot
+CREATE TABLE IF NOT EXISTS account_balances (
+    `account` VARCHAR(32) NOT NULL,
+    `snapshot` DATETIME(6) NOT NULL,
+    `currency` VARCHAR(8) NOT NULL,
+    `combined` BOOLEAN NOT NULL,
+    `cash` DOUBLE NOT NULL,
+    `marketvalue` DOUBLE NOT NULL,
+    `totalequity` DOUBLE NOT NULL,
+    `buyingpower` DOUBLE NOT NULL,
+    `maintenanceexcess` DOUBLE NOT NULL,
+    primary key(account, snapshot, currency, combined)
+) ENGINE=InnoDB;
+-- Order fills of each account, kept once however many snapshots see them
+CREATE TABLE IF NOT EXISTS account_executions (
+    `id` BIGINT NOT NULL,
+    `account` VARCHAR(32) NOT NULL,
+    `orderid` BIGINT NOT NULL,
+    `symbolid` INTEGER NOT NULL,
+    `symbol` TEXT NOT NULL,
+    `side` TEXT NOT NULL,
+    `quantity` DOUBLE NOT NULL,
+    `price` DOUBLE NOT NULL,
+    `commission` DOUBLE NOT NULL,
+    `fees` DOUBLE NOT NULL,
+    `venue` TEXT NOT NULL,
+    `executed` DATETIME(6) NOT NULL,
+    primary key(id)
+) ENGINE=InnoDB;
@@ -0,0 +1,16 @@
+-- Listing details of each symbol, replaced whenever its ID is resolved
+CREATE TABLE IF NOT EXISTS symbol_details (
+    `id` INTEGER PRIMARY KEY NOT NULL,
+    `currency` VARCHAR(32) NOT NULL,
+    `securitytype` VARCHAR(32) NOT NULL,
+    `description` TEXT NOT NULL,
+    `listingexchange` VARCHAR(32) NOT NULL,
+    `sector` TEXT NOT NULL,
+    `industrygroup` TEXT NOT NULL,
+    `subgroup` TEXT NOT NULL,
+    `tradable` BOOLEAN NOT NULL,
+    `quotable` BOOLEAN NOT NULL,
+    `hasoptions` BOOLEAN NOT NULL,
+    `updated` DATETIME(6) NOT NULL,
+    foreign key(id) references symbolids(id)
+) ENGINE=InnoDB;
@@ -0,0 +1,16 @@
+-- Close adjusted for splits and dividends, for providers that report one,
+-- null otherwise
+ALTER TABLE candlestick ADD COLUMN `adjclose` DOUBLE;
+ALTER TABLE adjusted ADD COLUMN `adjclose` DOUBLE;
+-- Views over the candles are expanded when created, so they are recreated
+-- with the new column
+CREATE OR REPLACE VIEW adjusted_candles AS
+    SELECT * FROM adjusted
+    UNION ALL
+    SELECT * FROM candlestick c WHERE NOT EXISTS (SELECT 1 FROM splits s WHERE s.id = c.id);
+CREATE OR REPLACE VIEW member_candles AS
+    SELECT c.*, s.symbol, m.universe FROM candlestick c
+    JOIN symbolids s ON s.id = c.id
+    JOIN constituents m ON m.symbol = s.symbol
+        AND (m.effectivefrom IS NULL OR c.starttime >= m.effectivefrom)
+        AND (m.effectiveto IS NULL OR c.starttime < m.effectiveto);
@@ -0,0 +1,28 @@
+-- Earlier versions of candles a later run replaced with different values,
+-- and the run that replaced them, so the candles can be read as they were
+-- after any run
+CREATE TABLE IF NOT EXISTS candle_versions (
+    `id` INTEGER NOT NULL,
+    `starttime` DATETIME(6) NOT NULL,
+    `endtime` DATETIME(6) NOT NULL,
+    `open` DOUBLE NOT NULL,
+    `close` DOUBLE NOT NULL,
+    `high` DOUBLE NOT NULL,
+    `low` DOUBLE NOT NULL,
+    `volume` BIGINT NOT NULL,
+    `run` INTEGER,
+    `interval` VARCHAR(32) NOT NULL,
+    `currency` VARCHAR(8) NOT NULL,
+    `fxrate` DOUBLE,
+    `session` VARCHAR(8) NOT NULL,
+    `adjclose` DOUBLE,
+    `replaced` INTEGER NOT NULL,
+    primary key(id, `interval`, starttime, replaced)
+) ENGINE=InnoDB;
+-- Names given to the state of the candles after a run
+CREATE TABLE IF NOT EXISTS snapshots (
+    `name` VARCHAR(191) PRIMARY KEY NOT NULL,
+    `run` INTEGER NOT NULL,
+    `created` DATETIME(6) NOT NULL,
+    foreign key(run) references runs(id)
+) ENGINE=InnoDB;
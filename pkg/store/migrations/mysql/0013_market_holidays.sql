@@ -0,0 +1,10 @@
+-- Published closures and early closes of each exchange, the closing time
+-- null when it is closed all day
+CREATE TABLE IF NOT EXISTS market_holidays (
+    `exchange` VARCHAR(16) NOT NULL,
+    `day` DATETIME(6) NOT NULL,
+    `name` VARCHAR(255) NOT NULL,
+    `close` DATETIME(6),
+    `updated` DATETIME(6) NOT NULL,
+    primary key(exchange, day)
+) ENGINE=InnoDB;
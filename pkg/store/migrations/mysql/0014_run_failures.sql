@@ -0,0 +1,8 @@
+-- Number of symbols of each run that failed with each class of error
+CREATE TABLE IF NOT EXISTS run_failures (
+    `run` INTEGER NOT NULL,
+    `class` VARCHAR(32) NOT NULL,
+    `symbols` INTEGER NOT NULL,
+    primary key(run, class),
+    foreign key(run) references runs(id)
+) ENGINE=InnoDB;
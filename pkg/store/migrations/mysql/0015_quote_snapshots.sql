@@ -0,0 +1,17 @@
+-- Top of the book and last trade of each symbol quoted when a run
+-- finished, with the run
+CREATE TABLE IF NOT EXISTS quote_snapshots (
+    `id` INTEGER NOT NULL,
+    `snapshot` DATETIME(6) NOT NULL,
+    `run` INTEGER,
+    `bid` DOUBLE NOT NULL,
+    `bidsize` INTEGER NOT NULL,
+    `ask` DOUBLE NOT NULL,
+    `asksize` INTEGER NOT NULL,
+    `last` DOUBLE NOT NULL,
+    `lastsize` INTEGER NOT NULL,
+    `volume` BIGINT NOT NULL,
+    `delay` INTEGER NOT NULL,
+    `halted` BOOLEAN NOT NULL,
+    primary key(id, snapshot)
+) ENGINE=InnoDB;
@@ -0,0 +1,104 @@
+-- Tables as created by schema.sql before migrations, safe to run against
+-- databases created by it
+CREATE TABLE IF NOT EXISTS symbolids (
+    "id" INTEGER PRIMARY KEY NOT NULL,
+    "symbol" TEXT NOT NULL,
+    "exchange" TEXT NOT NULL,
+    "name" text not null,
+    "industry" text not null,
+    "subindustry" text not null
+);
+CREATE TABLE IF NOT EXISTS candlestick (
+    "id" INTEGER NOT NULL,
+    "starttime" DATETIME NOT NULL,
+    "endtime" DATETIME NOT NULL,
+    "open" REAL NOT NULL,
+    "close" REAL NOT NULL,
+    "high" REAL NOT NULL,
+    "low" REAL NOT NULL,
+    "volume" INTEGER NOT NULL,
+    foreign key(id) references symbolids(id)
+);
+CREATE INDEX IF NOT EXISTS "i_candlestick" on candlestick (id ASC, starttime DESC, endtime DESC);
+-- Remove duplicate candles saved before candles were unique per symbol and start time
+DELETE FROM candlestick WHERE rowid NOT IN (SELECT max(rowid) FROM candlestick GROUP BY id, starttime);
+CREATE UNIQUE INDEX IF NOT EXISTS "u_candlestick" on candlestick (id, starttime);
+CREATE TABLE IF NOT EXISTS dividends (
+    "id" INTEGER NOT NULL,
+    "exdate" DATETIME NOT NULL,
+    "paydate" DATETIME NOT NULL,
+    "amount" REAL NOT NULL,
+    foreign key(id) references symbolids(id)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "u_dividends" on dividends (id, exdate);
+-- Symbol IDs found with the search endpoint, reused until they go stale
+CREATE TABLE IF NOT EXISTS symbolcache (
+    "symbol" TEXT NOT NULL,
+    "exchange" TEXT NOT NULL,
+    "id" INTEGER NOT NULL,
+    "resolved" DATETIME NOT NULL,
+    primary key(symbol, exchange)
+);
+CREATE TABLE IF NOT EXISTS failures (
+    "symbol" TEXT NOT NULL,
+    "exchange" TEXT NOT NULL,
+    "reason" TEXT NOT NULL,
+    "failedat" DATETIME NOT NULL
+);
+-- Daily snapshots of symbol fundamentals
+CREATE TABLE IF NOT EXISTS fundamentals (
+    "id" INTEGER NOT NULL,
+    "snapshot" DATETIME NOT NULL,
+    "marketcap" REAL NOT NULL,
+    "pe" REAL NOT NULL,
+    "eps" REAL NOT NULL,
+    "yield" REAL NOT NULL,
+    "dividend" REAL NOT NULL,
+    "shares" INTEGER NOT NULL,
+    "high52" REAL NOT NULL,
+    "low52" REAL NOT NULL,
+    "avgvolume" INTEGER NOT NULL,
+    foreign key(id) references symbolids(id)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "u_fundamentals" on fundamentals (id, snapshot);
+-- Stock splits, ratio is the number of new shares per old share
+CREATE TABLE IF NOT EXISTS splits (
+    "id" INTEGER NOT NULL,
+    "splitdate" DATETIME NOT NULL,
+    "ratio" REAL NOT NULL,
+    "source" TEXT NOT NULL,
+    foreign key(id) references symbolids(id)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "u_splits" on splits (id, splitdate);
+-- Split adjusted candles of symbols that have split
+CREATE TABLE IF NOT EXISTS adjusted (
+    "id" INTEGER NOT NULL,
+    "starttime" DATETIME NOT NULL,
+    "endtime" DATETIME NOT NULL,
+    "open" REAL NOT NULL,
+    "close" REAL NOT NULL,
+    "high" REAL NOT NULL,
+    "low" REAL NOT NULL,
+    "volume" INTEGER NOT NULL,
+    foreign key(id) references symbolids(id)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "u_adjusted" on adjusted (id, starttime);
+-- Split adjusted candles of every symbol
+CREATE VIEW IF NOT EXISTS adjusted_candles AS
+    SELECT * FROM adjusted
+    UNION ALL
+    SELECT * FROM candlestick c WHERE NOT EXISTS (SELECT 1 FROM splits s WHERE s.id = c.id);
+-- Level 1 quotes recorded by the stream subcommand
+CREATE TABLE IF NOT EXISTS quotes (
+    "id" INTEGER NOT NULL,
+    "time" DATETIME NOT NULL,
+    "bid" REAL NOT NULL,
+    "bidsize" INTEGER NOT NULL,
+    "ask" REAL NOT NULL,
+    "asksize" INTEGER NOT NULL,
+    "last" REAL NOT NULL,
+    "lastsize" INTEGER NOT NULL,
+    "volume" INTEGER NOT NULL,
+    foreign key(id) references symbolids(id)
+);
+CREATE INDEX IF NOT EXISTS "i_quotes" on quotes (id, time);
@@ -0,0 +1,14 @@
+-- Scrapes, and the run that fetched each candle
+CREATE TABLE IF NOT EXISTS runs (
+    "id" INTEGER PRIMARY KEY NOT NULL,
+    "started" DATETIME NOT NULL,
+    "finished" DATETIME,
+    "interval" TEXT NOT NULL,
+    "provider" TEXT NOT NULL,
+    "version" TEXT NOT NULL,
+    "symbols" INTEGER NOT NULL,
+    "failed" INTEGER NOT NULL,
+    "candles" INTEGER NOT NULL
+);
+ALTER TABLE candlestick ADD COLUMN "run" INTEGER REFERENCES runs(id);
+ALTER TABLE adjusted ADD COLUMN "run" INTEGER REFERENCES runs(id);
@@ -0,0 +1,34 @@
+-- Options on the symbols, and their quotes at each snapshot
+CREATE TABLE IF NOT EXISTS option_chain (
+    "id" INTEGER PRIMARY KEY NOT NULL,
+    "underlying" INTEGER NOT NULL,
+    "symbol" TEXT NOT NULL,
+    "root" TEXT NOT NULL,
+    "type" TEXT NOT NULL,
+    "expiry" DATETIME NOT NULL,
+    "strike" REAL NOT NULL,
+    "multiplier" INTEGER NOT NULL,
+    "exercise" TEXT NOT NULL,
+    "updated" DATETIME NOT NULL,
+    foreign key(underlying) references symbolids(id)
+);
+CREATE INDEX IF NOT EXISTS "i_option_chain" on option_chain (underlying, expiry, strike);
+CREATE TABLE IF NOT EXISTS option_quote (
+    "id" INTEGER NOT NULL,
+    "snapshot" DATETIME NOT NULL,
+    "bid" REAL NOT NULL,
+    "bidsize" INTEGER NOT NULL,
+    "ask" REAL NOT NULL,
+    "asksize" INTEGER NOT NULL,
+    "last" REAL NOT NULL,
+    "volume" INTEGER NOT NULL,
+    "openinterest" INTEGER NOT NULL,
+    "volatility" REAL NOT NULL,
+    "delta" REAL NOT NULL,
+    "gamma" REAL NOT NULL,
+    "theta" REAL NOT NULL,
+    "vega" REAL NOT NULL,
+    "rho" REAL NOT NULL,
+    foreign key(id) references option_chain(id)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "u_option_quote" on option_quote (id, snapshot);
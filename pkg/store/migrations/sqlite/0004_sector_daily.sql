@@ -0,0 +1,11 @@
+-- Daily series of each sector, rebuilt with -sectors
+CREATE TABLE IF NOT EXISTS sector_daily (
+    "sector" TEXT NOT NULL,
+    "day" DATETIME NOT NULL,
+    "symbols" INTEGER NOT NULL,
+    "avgreturn" REAL NOT NULL,
+    "volume" INTEGER NOT NULL,
+    "advancers" INTEGER NOT NULL,
+    "decliners" INTEGER NOT NULL,
+    primary key(sector, day)
+);
@@ -0,0 +1,17 @@
+-- Periods each symbol was a member of a universe, a NULL effectivefrom is
+-- before the earliest known change and a NULL effectiveto is still a member
+CREATE TABLE IF NOT EXISTS constituents (
+    "universe" TEXT NOT NULL,
+    "symbol" TEXT NOT NULL,
+    "name" TEXT NOT NULL,
+    "effectivefrom" DATETIME,
+    "effectiveto" DATETIME
+);
+CREATE INDEX IF NOT EXISTS "i_constituents" on constituents (universe, symbol);
+-- Candles tagged with the universes the symbol was a member of at the time
+CREATE VIEW IF NOT EXISTS member_candles AS
+    SELECT c.*, s.symbol, m.universe FROM candlestick c
+    JOIN symbolids s ON s.id = c.id
+    JOIN constituents m ON m.symbol = s.symbol
+        AND (m.effectivefrom IS NULL OR c.starttime >= m.effectivefrom)
+        AND (m.effectiveto IS NULL OR c.starttime < m.effectiveto);
@@ -0,0 +1,21 @@
+-- Candles of several intervals side by side, unique per symbol, interval and
+-- start time
+ALTER TABLE candlestick ADD COLUMN "interval" TEXT NOT NULL DEFAULT 'OneDay';
+ALTER TABLE adjusted ADD COLUMN "interval" TEXT NOT NULL DEFAULT 'OneDay';
+-- Candles stored before the interval was recorded are tagged from their length
+UPDATE candlestick SET "interval" = CASE CAST(round((julianday(endtime) - julianday(starttime)) * 1440) AS INTEGER)
+    WHEN 1 THEN 'OneMinute' WHEN 2 THEN 'TwoMinutes' WHEN 3 THEN 'ThreeMinutes' WHEN 4 THEN 'FourMinutes'
+    WHEN 5 THEN 'FiveMinutes' WHEN 10 THEN 'TenMinutes' WHEN 15 THEN 'FifteenMinutes' WHEN 20 THEN 'TwentyMinutes'
+    WHEN 30 THEN 'HalfHour' WHEN 60 THEN 'OneHour' WHEN 120 THEN 'TwoHours' WHEN 240 THEN 'FourHours'
+    ELSE CASE
+        WHEN julianday(endtime) - julianday(starttime) >= 25 THEN 'OneMonth'
+        WHEN julianday(endtime) - julianday(starttime) >= 5 THEN 'OneWeek'
+        ELSE 'OneDay'
+    END
+END;
+-- Adjusted candles are rebuilt by the next run with -adjust
+DELETE FROM adjusted;
+DROP INDEX IF EXISTS "u_candlestick";
+DROP INDEX IF EXISTS "u_adjusted";
+CREATE UNIQUE INDEX IF NOT EXISTS "u_candlestick_interval" on candlestick (id, "interval", starttime);
+CREATE UNIQUE INDEX IF NOT EXISTS "u_adjusted_interval" on adjusted (id, "interval", starttime);
@@ -0,0 +1,17 @@
+-- Candles rejected by validation, with the problem found, instead of being
+-- stored with the rest
+CREATE TABLE IF NOT EXISTS data_quality_issues (
+    "id" INTEGER NOT NULL,
+    "run" INTEGER,
+    "interval" TEXT NOT NULL,
+    "starttime" DATETIME NOT NULL,
+    "endtime" DATETIME NOT NULL,
+    "open" REAL NOT NULL,
+    "close" REAL NOT NULL,
+    "high" REAL NOT NULL,
+    "low" REAL NOT NULL,
+    "volume" INTEGER NOT NULL,
+    "problem" TEXT NOT NULL,
+    "detected" DATETIME NOT NULL
+);
+CREATE INDEX IF NOT EXISTS "i_data_quality_issues" on data_quality_issues (id, starttime);
@@ -0,0 +1,14 @@
+-- Past and upcoming earnings reports of each symbol, the EPS figures are NULL
+-- until reported or when there is no estimate
+CREATE TABLE IF NOT EXISTS earnings (
+    "id" INTEGER NOT NULL,
+    "reportdate" DATETIME NOT NULL,
+    "fiscalend" DATETIME NOT NULL,
+    "reporttime" TEXT NOT NULL,
+    "estimate" REAL,
+    "reported" REAL,
+    "surprise" REAL,
+    "updated" DATETIME NOT NULL,
+    primary key(id, reportdate),
+    foreign key(id) references symbolids(id)
+);
@@ -0,0 +1,3 @@
+-- When a symbol stopped being listed, NULL while it still is. Delisted
+-- symbols are skipped by later runs but their candles are kept.
+ALTER TABLE symbolids ADD COLUMN "delisted_at" DATETIME;
@@ -0,0 +1,11 @@
+-- Technical indicators computed from the candles of an interval, one row per
+-- indicator and candle, named after the indicator and its window
+CREATE TABLE IF NOT EXISTS indicators (
+    "id" INTEGER NOT NULL,
+    "interval" TEXT NOT NULL,
+    "starttime" DATETIME NOT NULL,
+    "name" TEXT NOT NULL,
+    "value" REAL NOT NULL,
+    primary key(id, "interval", name, starttime),
+    foreign key(id) references symbolids(id)
+);
@@ -0,0 +1,15 @@
+-- Daily returns of each symbol, rebuilt with -returns. The log return is NULL
+-- on the first day and the volatilities until there are enough returns.
+CREATE TABLE IF NOT EXISTS returns (
+    "id" INTEGER NOT NULL,
+    "day" DATETIME NOT NULL,
+    "close" REAL NOT NULL,
+    "logreturn" REAL,
+    "vol30" REAL,
+    "vol90" REAL,
+    "vol252" REAL,
+    "drawdown" REAL NOT NULL,
+    "maxdrawdown" REAL NOT NULL,
+    primary key(id, day),
+    foreign key(id) references symbolids(id)
+);
@@ -0,0 +1,10 @@
+-- Correlations of the daily returns of each pair of symbols over a window of
+-- trading days ending on the day, each pair stored once
+CREATE TABLE IF NOT EXISTS correlations (
+    "day" DATETIME NOT NULL,
+    "window" INTEGER NOT NULL,
+    "id_a" INTEGER NOT NULL,
+    "id_b" INTEGER NOT NULL,
+    "value" REAL NOT NULL,
+    primary key(day, "window", id_a, id_b)
+);
@@ -0,0 +1,14 @@
+-- Windows of a backfill, one per symbol, interval and month, and whether each
+-- has been fetched. Status is pending, done or failed.
+CREATE TABLE IF NOT EXISTS backfill_jobs (
+    "symbol" TEXT NOT NULL,
+    "exchange" TEXT NOT NULL,
+    "interval" TEXT NOT NULL,
+    "windowstart" DATETIME NOT NULL,
+    "windowend" DATETIME NOT NULL,
+    "status" TEXT NOT NULL,
+    "attempts" INTEGER NOT NULL,
+    "error" TEXT NOT NULL,
+    "updated" DATETIME NOT NULL,
+    primary key(symbol, exchange, "interval", windowstart)
+);
@@ -0,0 +1,13 @@
+-- Daily rates converting a currency to USD
+CREATE TABLE IF NOT EXISTS fx_rates (
+    "currency" TEXT NOT NULL,
+    "day" DATETIME NOT NULL,
+    "rate" REAL NOT NULL,
+    primary key(currency, day)
+);
+-- Currency each candle was listed in, and the rate its prices were
+-- converted to USD at, null when they are in the listed currency
+ALTER TABLE candlestick ADD COLUMN "currency" TEXT NOT NULL DEFAULT 'USD';
+ALTER TABLE candlestick ADD COLUMN "fxrate" REAL;
+ALTER TABLE adjusted ADD COLUMN "currency" TEXT NOT NULL DEFAULT 'USD';
+ALTER TABLE adjusted ADD COLUMN "fxrate" REAL;
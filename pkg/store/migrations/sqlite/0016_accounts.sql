@@ -0,0 +1,51 @@
+-- Snapshots of the brokerage accounts of the logged in user
+CREATE TABLE IF NOT EXISTS account_snapshots (
+    "account" TEXT NOT NULL,
+    "type" TEXT NOT NULL,
+    "snapshot" DATETIME NOT NULL,
+    primary key(account, snapshot)
+);
+-- Holdings of each account at each snapshot
+CREATE TABLE IF NOT EXISTS account_positions (
+    "account" TEXT NOT NULL,
+    "snapshot" DATETIME NOT NULL,
+    "symbolid" INTEGER NOT NULL,
+    "symbol" TEXT NOT NULL,
+    "quantity" REAL NOT NULL,
+    "price" REAL NOT NULL,
+    "marketvalue" REAL NOT NULL,
+    "averageprice" REAL NOT NULL,
+    "totalcost" REAL NOT NULL,
+    "openpnl" REAL NOT NULL,
+    "closedpnl" REAL NOT NULL,
+    primary key(account, snapshot, symbolid)
+);
+-- Balances of each account per currency and combined at each snapshot
+CREATE TABLE IF NOT EXISTS account_balances (
+    "account" TEXT NOT NULL,
+    "snapshot" DATETIME NOT NULL,
+    "currency" TEXT NOT NULL,
+    "combined" BOOLEAN NOT NULL,
+    "cash" REAL NOT NULL,
+    "marketvalue" REAL NOT NULL,
+    "totalequity" REAL NOT NULL,
+    "buyingpower" REAL NOT NULL,
+    "maintenanceexcess" REAL NOT NULL,
+    primary key(account, snapshot, currency, combined)
+);
+-- Order fills of each account, kept once however many snapshots see them
+CREATE TABLE IF NOT EXISTS account_executions (
+    "id" INTEGER NOT NULL,
+    "account" TEXT NOT NULL,
+    "orderid" INTEGER NOT NULL,
+    "symbolid" INTEGER NOT NULL,
+    "symbol" TEXT NOT NULL,
+    "side" TEXT NOT NULL,
+    "quantity" REAL NOT NULL,
+    "price" REAL NOT NULL,
+    "commission" REAL NOT NULL,
+    "fees" REAL NOT NULL,
+    "venue" TEXT NOT NULL,
+    "executed" DATETIME NOT NULL,
+    primary key(id)
+);
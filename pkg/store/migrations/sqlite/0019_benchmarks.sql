@@ -0,0 +1,3 @@
+-- Benchmark series such as SPY and the sector ETFs are stored with the
+-- universe's symbols and flagged
+ALTER TABLE symbolids ADD COLUMN "benchmark" BOOLEAN NOT NULL DEFAULT 0;
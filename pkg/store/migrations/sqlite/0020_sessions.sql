@@ -0,0 +1,4 @@
+-- Trading session each candle falls in: pre, regular or post. Candles
+-- stored before extended hours could be fetched are all regular.
+ALTER TABLE candlestick ADD COLUMN "session" TEXT NOT NULL DEFAULT 'regular';
+ALTER TABLE adjusted ADD COLUMN "session" TEXT NOT NULL DEFAULT 'regular';
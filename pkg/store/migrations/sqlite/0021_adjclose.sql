@@ -0,0 +1,4 @@
+-- Close adjusted for splits and dividends, for providers that report one,
+-- null otherwise
+ALTER TABLE candlestick ADD COLUMN "adjclose" REAL;
+ALTER TABLE adjusted ADD COLUMN "adjclose" REAL;
@@ -0,0 +1,27 @@
+-- Earlier versions of candles a later run replaced with different values,
+-- and the run that replaced them, so the candles can be read as they were
+-- after any run
+CREATE TABLE IF NOT EXISTS candle_versions (
+    "id" INTEGER NOT NULL,
+    "starttime" DATETIME NOT NULL,
+    "endtime" DATETIME NOT NULL,
+    "open" REAL NOT NULL,
+    "close" REAL NOT NULL,
+    "high" REAL NOT NULL,
+    "low" REAL NOT NULL,
+    "volume" INTEGER NOT NULL,
+    "run" INTEGER,
+    "interval" TEXT NOT NULL,
+    "currency" TEXT NOT NULL,
+    "fxrate" REAL,
+    "session" TEXT NOT NULL,
+    "adjclose" REAL,
+    "replaced" INTEGER NOT NULL,
+    primary key(id, "interval", starttime, replaced)
+);
+-- Names given to the state of the candles after a run
+CREATE TABLE IF NOT EXISTS snapshots (
+    "name" TEXT PRIMARY KEY NOT NULL,
+    "run" INTEGER NOT NULL REFERENCES runs(id),
+    "created" DATETIME NOT NULL
+);
@@ -0,0 +1,4 @@
+-- Candles built from the stored ones of a finer interval, such as weekly
+-- candles from daily ones, rather than fetched
+ALTER TABLE candlestick ADD COLUMN "derived" BOOLEAN NOT NULL DEFAULT 0;
+ALTER TABLE adjusted ADD COLUMN "derived" BOOLEAN NOT NULL DEFAULT 0;
@@ -0,0 +1,7 @@
+-- Number of symbols of each run that failed with each class of error
+CREATE TABLE IF NOT EXISTS run_failures (
+    "run" INTEGER NOT NULL REFERENCES runs(id),
+    "class" TEXT NOT NULL,
+    "symbols" INTEGER NOT NULL,
+    primary key(run, class)
+);
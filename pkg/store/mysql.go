@@ -0,0 +1,76 @@
+package store
+
+import (
+	"database/sql"
+	"regexp"
+	"strings"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+)
+
+var mysqlDialect = dialect{
+	driver:     "mysql",
+	migrations: "migrations/mysql",
+	insertSymbol: "insert into symbolids (id, symbol, exchange, name, industry, subindustry, benchmark) values (?, ?, ?, ?, ?, ?, ?)" +
+		` on duplicate key update symbol = values(symbol), exchange = values(exchange), name = values(name),
+		industry = values(industry), subindustry = values(subindustry), benchmark = values(benchmark), delisted_at = null`,
+	insertDividend: `insert into dividends values (?, ?, ?, ?) on duplicate key update
+		paydate = values(paydate), amount = values(amount)`,
+	insertFundamentals: `insert into fundamentals values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) on duplicate key update
+		marketcap = values(marketcap), pe = values(pe), eps = values(eps), yield = values(yield),
+		dividend = values(dividend), shares = values(shares), high52 = values(high52),
+		low52 = values(low52), avgvolume = values(avgvolume)`,
+	insertCache: `insert into symbolcache values (?, ?, ?, ?) on duplicate key update
+		id = values(id), resolved = values(resolved)`,
+	insertFailure: "insert into failures values (?, ?, ?, ?)",
+	rebind:        rebindMySQL,
+	configure:     configureMySQL,
+	lastInsertID:  true,
+	compact:       "optimize table candlestick, adjusted",
+	indexExists:   "select count(*) from information_schema.statistics where table_schema = database() and index_name = ?",
+	tableExists:   "select count(*) from information_schema.tables where table_schema = database() and table_name = ?",
+}
+
+var (
+	conflictUpdate  = regexp.MustCompile(`(?i)\s*on conflict \([^)]*\) do update set`)
+	conflictNothing = regexp.MustCompile(`(?i)\s*on conflict \([^)]*\) do nothing`)
+	excludedColumn  = regexp.MustCompile(`(?i)excluded\.(\w+)`)
+)
+
+// MySQL quotes identifiers with backticks and has its own upserts. Rewrites
+// conflict clauses into on duplicate key update, using values() so MariaDB
+// understands them too, and insert ignore.
+func rebindMySQL(query string) string {
+	query = strings.ReplaceAll(query, `"`, "`")
+	if conflictNothing.MatchString(query) {
+		query = conflictNothing.ReplaceAllString(query, "")
+		query = strings.Replace(query, "insert into", "insert ignore into", 1)
+	}
+	query = conflictUpdate.ReplaceAllString(query, " on duplicate key update")
+	return excludedColumn.ReplaceAllString(query, "values($1)")
+}
+
+// Times are scanned into time.Time and kept in UTC, and the migrations need
+// several statements per call. Parameters the connection string already
+// sets are left alone.
+func mysqlDSN(dsn string) string {
+	for _, param := range []string{"parseTime=true", "loc=UTC", "multiStatements=true"} {
+		if strings.Contains(dsn, strings.SplitN(param, "=", 2)[0]+"=") {
+			continue
+		}
+		if strings.Contains(dsn, "?") {
+			dsn += "&" + param
+		} else {
+			dsn += "?" + param
+		}
+	}
+	return dsn
+}
+
+// MySQL closes connections idle for longer than wait_timeout, 8 hours by
+// default, which daemons would otherwise trip over between runs.
+func configureMySQL(db *sql.DB) error {
+	db.SetConnMaxLifetime(time.Hour)
+	return nil
+}
@@ -0,0 +1,48 @@
+package store
+
+import (
+	"bytes"
+	_ "embed"
+	"strconv"
+
+	_ "github.com/lib/pq"
+)
+
+// Run on every start so it only adds what's missing
+//
+//go:embed schema_postgres.sql
+var postgresSchema string
+
+var postgresDialect = dialect{
+	driver: "postgres",
+	schema: postgresSchema,
+	insertSymbol: `insert into symbolids (id, symbol, exchange, name, industry, subindustry, benchmark) values ($1, $2, $3, $4, $5, $6, $7)
+		on conflict (id) do update set symbol = excluded.symbol, exchange = excluded.exchange, name = excluded.name,
+		industry = excluded.industry, subindustry = excluded.subindustry, benchmark = excluded.benchmark, delisted_at = null`,
+	insertDividend: `insert into dividends values ($1, $2, $3, $4) on conflict (id, exdate) do update set
+		paydate = excluded.paydate, amount = excluded.amount`,
+	insertFundamentals: `insert into fundamentals values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11) on conflict (id, snapshot) do update set
+		marketcap = excluded.marketcap, pe = excluded.pe, eps = excluded.eps, yield = excluded.yield,
+		dividend = excluded.dividend, shares = excluded.shares, high52 = excluded.high52,
+		low52 = excluded.low52, avgvolume = excluded.avgvolume`,
+	insertCache: `insert into symbolcache values ($1, $2, $3, $4) on conflict (symbol, exchange) do update set
+		id = excluded.id, resolved = excluded.resolved`,
+	insertFailure: "insert into failures values ($1, $2, $3, $4)",
+	rebind:        bindDollar,
+	indexExists:   "select count(*) from pg_indexes where schemaname = current_schema() and indexname = ?",
+}
+
+// Postgres uses numbered $n placeholders
+func bindDollar(query string) string {
+	var b bytes.Buffer
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,460 @@
+CREATE TABLE IF NOT EXISTS symbolids (
+    "id" INTEGER PRIMARY KEY NOT NULL,
+    "symbol" TEXT NOT NULL,
+    "exchange" TEXT NOT NULL,
+    "name" text not null,
+    "industry" text not null,
+    "subindustry" text not null
+);
+CREATE TABLE IF NOT EXISTS candlestick (
+    "id" INTEGER NOT NULL,
+    "starttime" TIMESTAMPTZ NOT NULL,
+    "endtime" TIMESTAMPTZ NOT NULL,
+    "open" DOUBLE PRECISION NOT NULL,
+    "close" DOUBLE PRECISION NOT NULL,
+    "high" DOUBLE PRECISION NOT NULL,
+    "low" DOUBLE PRECISION NOT NULL,
+    "volume" BIGINT NOT NULL,
+    foreign key(id) references symbolids(id)
+);
+CREATE INDEX IF NOT EXISTS "i_candlestick" on candlestick (id ASC, starttime DESC, endtime DESC);
+CREATE TABLE IF NOT EXISTS dividends (
+    "id" INTEGER NOT NULL,
+    "exdate" TIMESTAMPTZ NOT NULL,
+    "paydate" TIMESTAMPTZ NOT NULL,
+    "amount" DOUBLE PRECISION NOT NULL,
+    foreign key(id) references symbolids(id)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "u_dividends" on dividends (id, exdate);
+-- Symbol IDs found with the search endpoint, reused until they go stale
+CREATE TABLE IF NOT EXISTS symbolcache (
+    "symbol" TEXT NOT NULL,
+    "exchange" TEXT NOT NULL,
+    "id" INTEGER NOT NULL,
+    "resolved" TIMESTAMPTZ NOT NULL,
+    primary key(symbol, exchange)
+);
+CREATE TABLE IF NOT EXISTS failures (
+    "symbol" TEXT NOT NULL,
+    "exchange" TEXT NOT NULL,
+    "reason" TEXT NOT NULL,
+    "failedat" TIMESTAMPTZ NOT NULL
+);
+-- Daily snapshots of symbol fundamentals
+CREATE TABLE IF NOT EXISTS fundamentals (
+    "id" INTEGER NOT NULL,
+    "snapshot" TIMESTAMPTZ NOT NULL,
+    "marketcap" DOUBLE PRECISION NOT NULL,
+    "pe" DOUBLE PRECISION NOT NULL,
+    "eps" DOUBLE PRECISION NOT NULL,
+    "yield" DOUBLE PRECISION NOT NULL,
+    "dividend" DOUBLE PRECISION NOT NULL,
+    "shares" BIGINT NOT NULL,
+    "high52" DOUBLE PRECISION NOT NULL,
+    "low52" DOUBLE PRECISION NOT NULL,
+    "avgvolume" BIGINT NOT NULL,
+    foreign key(id) references symbolids(id)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "u_fundamentals" on fundamentals (id, snapshot);
+-- Stock splits, ratio is the number of new shares per old share
+CREATE TABLE IF NOT EXISTS splits (
+    "id" INTEGER NOT NULL,
+    "splitdate" TIMESTAMPTZ NOT NULL,
+    "ratio" DOUBLE PRECISION NOT NULL,
+    "source" TEXT NOT NULL,
+    foreign key(id) references symbolids(id)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "u_splits" on splits (id, splitdate);
+-- Split adjusted candles of symbols that have split
+CREATE TABLE IF NOT EXISTS adjusted (
+    "id" INTEGER NOT NULL,
+    "starttime" TIMESTAMPTZ NOT NULL,
+    "endtime" TIMESTAMPTZ NOT NULL,
+    "open" DOUBLE PRECISION NOT NULL,
+    "close" DOUBLE PRECISION NOT NULL,
+    "high" DOUBLE PRECISION NOT NULL,
+    "low" DOUBLE PRECISION NOT NULL,
+    "volume" BIGINT NOT NULL,
+    foreign key(id) references symbolids(id)
+);
+-- Scrapes, and the run that fetched each candle
+CREATE TABLE IF NOT EXISTS runs (
+    "id" SERIAL PRIMARY KEY,
+    "started" TIMESTAMPTZ NOT NULL,
+    "finished" TIMESTAMPTZ,
+    "interval" TEXT NOT NULL,
+    "provider" TEXT NOT NULL,
+    "version" TEXT NOT NULL,
+    "symbols" INTEGER NOT NULL,
+    "failed" INTEGER NOT NULL,
+    "candles" BIGINT NOT NULL
+);
+ALTER TABLE candlestick ADD COLUMN IF NOT EXISTS "run" INTEGER REFERENCES runs(id);
+ALTER TABLE adjusted ADD COLUMN IF NOT EXISTS "run" INTEGER REFERENCES runs(id);
+-- Candles of several intervals side by side, unique per symbol, interval and
+-- start time. Candles stored before the interval was recorded are taken to be
+-- daily.
+ALTER TABLE candlestick ADD COLUMN IF NOT EXISTS "interval" TEXT NOT NULL DEFAULT 'OneDay';
+ALTER TABLE adjusted ADD COLUMN IF NOT EXISTS "interval" TEXT NOT NULL DEFAULT 'OneDay';
+DROP INDEX IF EXISTS "u_candlestick";
+DROP INDEX IF EXISTS "u_adjusted";
+CREATE UNIQUE INDEX IF NOT EXISTS "u_candlestick_interval" on candlestick (id, "interval", starttime);
+CREATE UNIQUE INDEX IF NOT EXISTS "u_adjusted_interval" on adjusted (id, "interval", starttime);
+-- Split adjusted candles of every symbol
+CREATE OR REPLACE VIEW adjusted_candles AS
+    SELECT * FROM adjusted
+    UNION ALL
+    SELECT * FROM candlestick c WHERE NOT EXISTS (SELECT 1 FROM splits s WHERE s.id = c.id);
+-- Level 1 quotes recorded by the stream subcommand
+CREATE TABLE IF NOT EXISTS quotes (
+    "id" INTEGER NOT NULL,
+    "time" TIMESTAMPTZ NOT NULL,
+    "bid" DOUBLE PRECISION NOT NULL,
+    "bidsize" INTEGER NOT NULL,
+    "ask" DOUBLE PRECISION NOT NULL,
+    "asksize" INTEGER NOT NULL,
+    "last" DOUBLE PRECISION NOT NULL,
+    "lastsize" INTEGER NOT NULL,
+    "volume" BIGINT NOT NULL,
+    foreign key(id) references symbolids(id)
+);
+CREATE INDEX IF NOT EXISTS "i_quotes" on quotes (id, time);
+-- Options on the symbols, and their quotes at each snapshot
+CREATE TABLE IF NOT EXISTS option_chain (
+    "id" INTEGER PRIMARY KEY,
+    "underlying" INTEGER NOT NULL,
+    "symbol" TEXT NOT NULL,
+    "root" TEXT NOT NULL,
+    "type" TEXT NOT NULL,
+    "expiry" TIMESTAMPTZ NOT NULL,
+    "strike" DOUBLE PRECISION NOT NULL,
+    "multiplier" INTEGER NOT NULL,
+    "exercise" TEXT NOT NULL,
+    "updated" TIMESTAMPTZ NOT NULL,
+    foreign key(underlying) references symbolids(id)
+);
+CREATE INDEX IF NOT EXISTS "i_option_chain" on option_chain (underlying, expiry, strike);
+CREATE TABLE IF NOT EXISTS option_quote (
+    "id" INTEGER NOT NULL,
+    "snapshot" TIMESTAMPTZ NOT NULL,
+    "bid" DOUBLE PRECISION NOT NULL,
+    "bidsize" INTEGER NOT NULL,
+    "ask" DOUBLE PRECISION NOT NULL,
+    "asksize" INTEGER NOT NULL,
+    "last" DOUBLE PRECISION NOT NULL,
+    "volume" INTEGER NOT NULL,
+    "openinterest" INTEGER NOT NULL,
+    "volatility" DOUBLE PRECISION NOT NULL,
+    "delta" DOUBLE PRECISION NOT NULL,
+    "gamma" DOUBLE PRECISION NOT NULL,
+    "theta" DOUBLE PRECISION NOT NULL,
+    "vega" DOUBLE PRECISION NOT NULL,
+    "rho" DOUBLE PRECISION NOT NULL,
+    foreign key(id) references option_chain(id)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "u_option_quote" on option_quote (id, snapshot);
+-- Daily series of each sector, rebuilt with -sectors
+CREATE TABLE IF NOT EXISTS sector_daily (
+    "sector" TEXT NOT NULL,
+    "day" TIMESTAMPTZ NOT NULL,
+    "symbols" INTEGER NOT NULL,
+    "avgreturn" DOUBLE PRECISION NOT NULL,
+    "volume" BIGINT NOT NULL,
+    "advancers" INTEGER NOT NULL,
+    "decliners" INTEGER NOT NULL,
+    primary key(sector, day)
+);
+-- Periods each symbol was a member of a universe, a NULL effectivefrom is
+-- before the earliest known change and a NULL effectiveto is still a member
+CREATE TABLE IF NOT EXISTS constituents (
+    "universe" TEXT NOT NULL,
+    "symbol" TEXT NOT NULL,
+    "name" TEXT NOT NULL,
+    "effectivefrom" TIMESTAMPTZ,
+    "effectiveto" TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS "i_constituents" on constituents (universe, symbol);
+-- Candles tagged with the universes the symbol was a member of at the time,
+-- recreated each time as its columns follow those of candlestick
+DROP VIEW IF EXISTS member_candles;
+CREATE VIEW member_candles AS
+    SELECT c.*, s.symbol, m.universe FROM candlestick c
+    JOIN symbolids s ON s.id = c.id
+    JOIN constituents m ON m.symbol = s.symbol
+        AND (m.effectivefrom IS NULL OR c.starttime >= m.effectivefrom)
+        AND (m.effectiveto IS NULL OR c.starttime < m.effectiveto);
+-- Candles rejected by validation, with the problem found, instead of being
+-- stored with the rest
+CREATE TABLE IF NOT EXISTS data_quality_issues (
+    "id" INTEGER NOT NULL,
+    "run" INTEGER,
+    "interval" TEXT NOT NULL,
+    "starttime" TIMESTAMPTZ NOT NULL,
+    "endtime" TIMESTAMPTZ NOT NULL,
+    "open" DOUBLE PRECISION NOT NULL,
+    "close" DOUBLE PRECISION NOT NULL,
+    "high" DOUBLE PRECISION NOT NULL,
+    "low" DOUBLE PRECISION NOT NULL,
+    "volume" BIGINT NOT NULL,
+    "problem" TEXT NOT NULL,
+    "detected" TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS "i_data_quality_issues" on data_quality_issues (id, starttime);
+-- Past and upcoming earnings reports of each symbol, the EPS figures are NULL
+-- until reported or when there is no estimate
+CREATE TABLE IF NOT EXISTS earnings (
+    "id" INTEGER NOT NULL,
+    "reportdate" TIMESTAMPTZ NOT NULL,
+    "fiscalend" TIMESTAMPTZ NOT NULL,
+    "reporttime" TEXT NOT NULL,
+    "estimate" DOUBLE PRECISION,
+    "reported" DOUBLE PRECISION,
+    "surprise" DOUBLE PRECISION,
+    "updated" TIMESTAMPTZ NOT NULL,
+    primary key(id, reportdate),
+    foreign key(id) references symbolids(id)
+);
+-- When a symbol stopped being listed, NULL while it still is. Delisted
+-- symbols are skipped by later runs but their candles are kept.
+ALTER TABLE symbolids ADD COLUMN IF NOT EXISTS "delisted_at" TIMESTAMPTZ;
+-- Technical indicators computed from the candles of an interval, one row per
+-- indicator and candle, named after the indicator and its window
+CREATE TABLE IF NOT EXISTS indicators (
+    "id" INTEGER NOT NULL,
+    "interval" TEXT NOT NULL,
+    "starttime" TIMESTAMPTZ NOT NULL,
+    "name" TEXT NOT NULL,
+    "value" DOUBLE PRECISION NOT NULL,
+    primary key(id, "interval", name, starttime),
+    foreign key(id) references symbolids(id)
+);
+-- Daily returns of each symbol, rebuilt with -returns. The log return is NULL
+-- on the first day and the volatilities until there are enough returns.
+CREATE TABLE IF NOT EXISTS returns (
+    "id" INTEGER NOT NULL,
+    "day" TIMESTAMPTZ NOT NULL,
+    "close" DOUBLE PRECISION NOT NULL,
+    "logreturn" DOUBLE PRECISION,
+    "vol30" DOUBLE PRECISION,
+    "vol90" DOUBLE PRECISION,
+    "vol252" DOUBLE PRECISION,
+    "drawdown" DOUBLE PRECISION NOT NULL,
+    "maxdrawdown" DOUBLE PRECISION NOT NULL,
+    primary key(id, day),
+    foreign key(id) references symbolids(id)
+);
+-- Correlations of the daily returns of each pair of symbols over a window of
+-- trading days ending on the day, each pair stored once
+CREATE TABLE IF NOT EXISTS correlations (
+    "day" TIMESTAMPTZ NOT NULL,
+    "window" INTEGER NOT NULL,
+    "id_a" INTEGER NOT NULL,
+    "id_b" INTEGER NOT NULL,
+    "value" DOUBLE PRECISION NOT NULL,
+    primary key(day, "window", id_a, id_b)
+);
+-- Windows of a backfill, one per symbol, interval and month, and whether each
+-- has been fetched. Status is pending, done or failed.
+CREATE TABLE IF NOT EXISTS backfill_jobs (
+    "symbol" TEXT NOT NULL,
+    "exchange" TEXT NOT NULL,
+    "interval" TEXT NOT NULL,
+    "windowstart" TIMESTAMPTZ NOT NULL,
+    "windowend" TIMESTAMPTZ NOT NULL,
+    "status" TEXT NOT NULL,
+    "attempts" INTEGER NOT NULL,
+    "error" TEXT NOT NULL,
+    "updated" TIMESTAMPTZ NOT NULL,
+    primary key(symbol, exchange, "interval", windowstart)
+);
+-- Daily rates converting a currency to USD
+CREATE TABLE IF NOT EXISTS fx_rates (
+    "currency" TEXT NOT NULL,
+    "day" TIMESTAMPTZ NOT NULL,
+    "rate" DOUBLE PRECISION NOT NULL,
+    primary key(currency, day)
+);
+-- Currency each candle was listed in, and the rate its prices were
+-- converted to USD at, null when they are in the listed currency
+ALTER TABLE candlestick ADD COLUMN IF NOT EXISTS "currency" TEXT NOT NULL DEFAULT 'USD';
+ALTER TABLE candlestick ADD COLUMN IF NOT EXISTS "fxrate" DOUBLE PRECISION;
+ALTER TABLE adjusted ADD COLUMN IF NOT EXISTS "currency" TEXT NOT NULL DEFAULT 'USD';
+ALTER TABLE adjusted ADD COLUMN IF NOT EXISTS "fxrate" DOUBLE PRECISION;
+-- Symbols still failing after the retry passes of a run, with the class of
+-- the error, fetched first by the next run
+CREATE TABLE IF NOT EXISTS retry_queue (
+    "symbol" TEXT NOT NULL,
+    "exchange" TEXT NOT NULL,
+    "class" TEXT NOT NULL,
+    "reason" TEXT NOT NULL,
+    "attempts" INTEGER NOT NULL,
+    "failedat" TIMESTAMPTZ NOT NULL,
+    primary key(symbol, exchange)
+);
+-- Snapshots of the brokerage accounts of the logged in user
+CREATE TABLE IF NOT EXISTS account_snapshots (
+    "account" TEXT NOT NULL,
+    "type" TEXT NOT NULL,
+    "snapshot" TIMESTAMPTZ NOT NULL,
+    primary key(account, snapshot)
+);
+-- Holdings of each account at each snapshot
+CREATE TABLE IF NOT EXISTS account_positions (
+    "account" TEXT NOT NULL,
+    "snapshot" TIMESTAMPTZ NOT NULL,
+    "symbolid" INTEGER NOT NULL,
+    "symbol" TEXT NOT NULL,
+    "quantity" DOUBLE PRECISION NOT NULL,
+    "price" DOUBLE PRECISION NOT NULL,
+    "marketvalue" DOUBLE PRECISION NOT NULL,
+    "averageprice" DOUBLE PRECISION NOT NULL,
+    "totalcost" DOUBLE PRECISION NOT NULL,
+    "openpnl" DOUBLE PRECISION NOT NULL,
+    "closedpnl" DOUBLE PRECISION NOT NULL,
+    primary key(account, snapshot, symbolid)
+);
+-- Balances of each account per currency and combined at each snapshot
+CREATE TABLE IF NOT EXISTS account_balances (
+    "account" TEXT NOT NULL,
+    "snapshot" TIMESTAMPTZ NOT NULL,
+    "currency" TEXT NOT NULL,
+    "combined" BOOLEAN NOT NULL,
+    "cash" DOUBLE PRECISION NOT NULL,
+    "marketvalue" DOUBLE PRECISION NOT NULL,
+    "totalequity" DOUBLE PRECISION NOT NULL,
+    "buyingpower" DOUBLE PRECISION NOT NULL,
+    "maintenanceexcess" DOUBLE PRECISION NOT NULL,
+    primary key(account, snapshot, currency, combined)
+);
+-- Order fills of each account, kept once however many snapshots see them
+CREATE TABLE IF NOT EXISTS account_executions (
+    "id" BIGINT NOT NULL,
+    "account" TEXT NOT NULL,
+    "orderid" BIGINT NOT NULL,
+    "symbolid" INTEGER NOT NULL,
+    "symbol" TEXT NOT NULL,
+    "side" TEXT NOT NULL,
+    "quantity" DOUBLE PRECISION NOT NULL,
+    "price" DOUBLE PRECISION NOT NULL,
+    "commission" DOUBLE PRECISION NOT NULL,
+    "fees" DOUBLE PRECISION NOT NULL,
+    "venue" TEXT NOT NULL,
+    "executed" TIMESTAMPTZ NOT NULL,
+    primary key(id)
+);
+-- Order book ladders of symbols at each snapshot, level 0 being the best
+-- bid or ask
+CREATE TABLE IF NOT EXISTS depth (
+    "id" INTEGER NOT NULL,
+    "snapshot" TIMESTAMPTZ NOT NULL,
+    "side" TEXT NOT NULL,
+    "level" INTEGER NOT NULL,
+    "price" DOUBLE PRECISION NOT NULL,
+    "size" INTEGER NOT NULL,
+    primary key(id, snapshot, side, level)
+);
+-- Listing details of each symbol, replaced whenever its ID is resolved
+CREATE TABLE IF NOT EXISTS symbol_details (
+    "id" INTEGER PRIMARY KEY NOT NULL,
+    "currency" TEXT NOT NULL,
+    "securitytype" TEXT NOT NULL,
+    "description" TEXT NOT NULL,
+    "listingexchange" TEXT NOT NULL,
+    "sector" TEXT NOT NULL,
+    "industrygroup" TEXT NOT NULL,
+    "subgroup" TEXT NOT NULL,
+    "tradable" BOOLEAN NOT NULL,
+    "quotable" BOOLEAN NOT NULL,
+    "hasoptions" BOOLEAN NOT NULL,
+    "updated" TIMESTAMPTZ NOT NULL,
+    foreign key(id) references symbolids(id)
+);
+-- Benchmark series such as SPY and the sector ETFs are stored with the
+-- universe's symbols and flagged
+ALTER TABLE symbolids ADD COLUMN IF NOT EXISTS "benchmark" BOOLEAN NOT NULL DEFAULT false;
+-- Trading session each candle falls in: pre, regular or post. Candles
+-- stored before extended hours could be fetched are all regular.
+ALTER TABLE candlestick ADD COLUMN IF NOT EXISTS "session" TEXT NOT NULL DEFAULT 'regular';
+ALTER TABLE adjusted ADD COLUMN IF NOT EXISTS "session" TEXT NOT NULL DEFAULT 'regular';
+-- Close adjusted for splits and dividends, for providers that report one,
+-- null otherwise
+ALTER TABLE candlestick ADD COLUMN IF NOT EXISTS "adjclose" DOUBLE PRECISION;
+ALTER TABLE adjusted ADD COLUMN IF NOT EXISTS "adjclose" DOUBLE PRECISION;
+-- Earlier versions of candles a later run replaced with different values,
+-- and the run that replaced them, so the candles can be read as they were
+-- after any run
+CREATE TABLE IF NOT EXISTS candle_versions (
+    "id" INTEGER NOT NULL,
+    "starttime" TIMESTAMPTZ NOT NULL,
+    "endtime" TIMESTAMPTZ NOT NULL,
+    "open" DOUBLE PRECISION NOT NULL,
+    "close" DOUBLE PRECISION NOT NULL,
+    "high" DOUBLE PRECISION NOT NULL,
+    "low" DOUBLE PRECISION NOT NULL,
+    "volume" BIGINT NOT NULL,
+    "run" INTEGER,
+    "interval" TEXT NOT NULL,
+    "currency" TEXT NOT NULL,
+    "fxrate" DOUBLE PRECISION,
+    "session" TEXT NOT NULL,
+    "adjclose" DOUBLE PRECISION,
+    "replaced" INTEGER NOT NULL,
+    primary key(id, "interval", starttime, replaced)
+);
+-- Names given to the state of the candles after a run
+CREATE TABLE IF NOT EXISTS snapshots (
+    "name" TEXT PRIMARY KEY NOT NULL,
+    "run" INTEGER NOT NULL REFERENCES runs(id),
+    "created" TIMESTAMPTZ NOT NULL
+);
+-- Candles built from the stored ones of a finer interval, such as weekly
+-- candles from daily ones, rather than fetched
+ALTER TABLE candlestick ADD COLUMN IF NOT EXISTS "derived" BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE adjusted ADD COLUMN IF NOT EXISTS "derived" BOOLEAN NOT NULL DEFAULT false;
+-- Published closures and early closes of each exchange, the closing time
+-- null when it is closed all day
+CREATE TABLE IF NOT EXISTS market_holidays (
+    "exchange" TEXT NOT NULL,
+    "day" TIMESTAMPTZ NOT NULL,
+    "name" TEXT NOT NULL,
+    "close" TIMESTAMPTZ,
+    "updated" TIMESTAMPTZ NOT NULL,
+    primary key(exchange, day)
+);
+-- Number of symbols of each run that failed with each class of error
+CREATE TABLE IF NOT EXISTS run_failures (
+    "run" INTEGER NOT NULL REFERENCES runs(id),
+    "class" TEXT NOT NULL,
+    "symbols" INTEGER NOT NULL,
+    primary key(run, class)
+);
+-- Top of the book and last trade of each symbol quoted when a run
+-- finished, with the run
+CREATE TABLE IF NOT EXISTS quote_snapshots (
+    "id" INTEGER NOT NULL,
+    "snapshot" TIMESTAMPTZ NOT NULL,
+    "run" INTEGER,
+    "bid" DOUBLE PRECISION NOT NULL,
+    "bidsize" INTEGER NOT NULL,
+    "ask" DOUBLE PRECISION NOT NULL,
+    "asksize" INTEGER NOT NULL,
+    "last" DOUBLE PRECISION NOT NULL,
+    "lastsize" INTEGER NOT NULL,
+    "volume" BIGINT NOT NULL,
+    "delay" INTEGER NOT NULL,
+    "halted" BOOLEAN NOT NULL,
+    primary key(id, snapshot)
+);
+-- Latest regular session daily close of each symbol with the close before
+-- it and the change between them, rebuilt after each run so the latest
+-- prices can be read without scanning the candles
+CREATE TABLE IF NOT EXISTS latest_close (
+    "id" INTEGER PRIMARY KEY NOT NULL,
+    "day" TIMESTAMPTZ NOT NULL,
+    "close" DOUBLE PRECISION NOT NULL,
+    "prevclose" DOUBLE PRECISION,
+    "netchange" DOUBLE PRECISION,
+    "pctchange" DOUBLE PRECISION,
+    "volume" BIGINT NOT NULL,
+    "updated" TIMESTAMPTZ NOT NULL
+);
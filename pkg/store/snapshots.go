@@ -0,0 +1,218 @@
+package store
+
+import (
+	"database/sql"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Name given to the state of the candles after a run, which can be read
+// back with CandlesAsOf
+type Snapshot struct {
+	Name    string
+	Run     int
+	Created time.Time
+}
+
+// Candle a later run replaced with different values
+type Restatement struct {
+	Symbol   string
+	Exchange string
+
+	// The candle as it was and the run that saved it, the candle as it is
+	// now, and the run that replaced the old one
+	Old    Candle
+	OldRun int
+	New    Candle
+	Run    int
+}
+
+// Columns of the candle and version tables read into a Candle by scanVersion
+const versionColumns = `starttime, endtime, open, close, high, low, volume, "interval", currency, fxrate, session, adjclose, run`
+
+// Copy the stored candles of a symbol that the candles about to be saved by
+// run may replace into candle_versions, stamped with the run replacing them.
+// Those of the intervals being saved between the first and last start are
+// copied, as working out which will change would take a query per candle;
+// dropUnchangedVersions removes the copies the run left as they were.
+// Candles saved without a run aren't versioned.
+func (s *sqlStore) keepVersions(tx *sql.Tx, id, run int, candles []Candle) error {
+	if run == 0 || len(candles) == 0 {
+		return nil
+	}
+	first, last := candles[0].Start, candles[0].Start
+	seen := make(map[string]bool)
+	var intervals []interface{}
+	for _, c := range candles {
+		if c.Start.Before(first) {
+			first = c.Start
+		}
+		if c.Start.After(last) {
+			last = c.Start
+		}
+		if !seen[c.Interval] {
+			seen[c.Interval] = true
+			intervals = append(intervals, c.Interval)
+		}
+	}
+
+	q := `insert into candle_versions select id, starttime, endtime, open, close, high, low, volume, run, "interval",
+		currency, fxrate, session, adjclose, ? from candlestick
+		where id = ? and starttime >= ? and starttime <= ? and (run is null or run <> ?)
+		and "interval" in (` + strings.TrimSuffix(strings.Repeat("?, ", len(intervals)), ", ") + `)
+		on conflict (id, "interval", starttime, replaced) do nothing`
+	args := append([]interface{}{run, id, first, last, run}, intervals...)
+	_, err := tx.Exec(s.dialect.rebind(q), args...)
+	return err
+}
+
+// Remove the versions kept for run that are the same as the candles now
+// stored, leaving only the candles the run restated.
+func (s *sqlStore) dropUnchangedVersions(tx *sql.Tx, id, run int) error {
+	if run == 0 {
+		return nil
+	}
+	_, err := tx.Exec(s.dialect.rebind(`delete from candle_versions where id = ? and replaced = ? and exists (
+		select 1 from candlestick c where c.id = candle_versions.id and c."interval" = candle_versions."interval"
+		and c.starttime = candle_versions.starttime and c.endtime = candle_versions.endtime
+		and c.open = candle_versions.open and c.close = candle_versions.close and c.high = candle_versions.high
+		and c.low = candle_versions.low and c.volume = candle_versions.volume)`), id, run)
+	return err
+}
+
+// Scan a row of versionColumns, followed by dest.
+func scanVersion(rows *sql.Rows, c *Candle, run *int, dest ...interface{}) error {
+	var currency, session sql.NullString
+	var rate, adjClose sql.NullFloat64
+	var r sql.NullInt64
+	args := append([]interface{}{&c.Start, &c.End, &c.Open, &c.Close, &c.High, &c.Low, &c.Volume, &c.Interval, &currency,
+		&rate, &session, &adjClose, &r}, dest...)
+	if err := rows.Scan(args...); err != nil {
+		return err
+	}
+	c.Currency, c.Session = currency.String, session.String
+	c.FXRate, c.AdjClose = rate.Float64, float32(adjClose.Float64)
+	*run = int(r.Int64)
+	return nil
+}
+
+func (s *sqlStore) TagSnapshot(name string, run int) error {
+	_, err := s.db.Exec(s.dialect.rebind("insert into snapshots values (?, ?, ?)"), name, run, time.Now().UTC())
+	return err
+}
+
+func (s *sqlStore) Snapshots() ([]Snapshot, error) {
+	var snapshots []Snapshot
+	rows, err := s.db.Query("select name, run, created from snapshots order by run, name")
+	if err != nil {
+		return snapshots, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var snap Snapshot
+		if err := rows.Scan(&snap.Name, &snap.Run, &snap.Created); err != nil {
+			return snapshots, err
+		}
+		snapshots = append(snapshots, snap)
+	}
+	return snapshots, rows.Err()
+}
+
+func (s *sqlStore) LatestRun() (int, error) {
+	var id sql.NullInt64
+	err := s.db.QueryRow("select max(id) from runs where finished is not null").Scan(&id)
+	return int(id.Int64), err
+}
+
+func (s *sqlStore) CandlesAsOf(id int, interval string, start, end time.Time, run int) ([]Candle, error) {
+	type key struct {
+		interval string
+		start    int64
+	}
+	found := make(map[key]Candle)
+
+	// The earliest version replaced after the run is what the run left,
+	// provided an earlier run saved it
+	rows, err := s.db.Query(s.dialect.rebind(`select `+versionColumns+` from candle_versions
+		where id = ? and (? = '' or "interval" = ?) and starttime >= ? and starttime < ? and replaced > ?
+		and (run is null or run <= ?) order by replaced desc`), id, interval, interval, start, end, run, run)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var c Candle
+		var saved int
+		if err := scanVersion(rows, &c, &saved); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		found[key{c.Interval, c.Start.UnixNano()}] = c
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Stored candles no later run has replaced
+	rows, err = s.db.Query(s.dialect.rebind(`select `+versionColumns+` from candlestick
+		where id = ? and (? = '' or "interval" = ?) and starttime >= ? and starttime < ? and (run is null or run <= ?)`),
+		id, interval, interval, start, end, run)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var c Candle
+		var saved int
+		if err := scanVersion(rows, &c, &saved); err != nil {
+			return nil, err
+		}
+		found[key{c.Interval, c.Start.UnixNano()}] = c
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	candles := make([]Candle, 0, len(found))
+	for _, c := range found {
+		candles = append(candles, c)
+	}
+	sort.Slice(candles, func(i, j int) bool {
+		if candles[i].Interval != candles[j].Interval {
+			return candles[i].Interval < candles[j].Interval
+		}
+		return candles[i].Start.Before(candles[j].Start)
+	})
+	return candles, nil
+}
+
+func (s *sqlStore) Restatements(since int) ([]Restatement, error) {
+	var restated []Restatement
+	rows, err := s.db.Query(s.dialect.rebind(`select v.starttime, v.endtime, v.open, v.close, v.high, v.low, v.volume,
+		v."interval", v.currency, v.fxrate, v.session, v.adjclose, v.run,
+		s.symbol, s.exchange, c.endtime, c.open, c.close, c.high, c.low, c.volume, v.replaced
+		from candle_versions v
+		join symbolids s on s.id = v.id
+		join candlestick c on c.id = v.id and c."interval" = v."interval" and c.starttime = v.starttime
+		where v.replaced > ?
+		order by s.symbol, s.exchange, v."interval", v.starttime, v.replaced`), since)
+	if err != nil {
+		return restated, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var r Restatement
+		n := &r.New
+		err := scanVersion(rows, &r.Old, &r.OldRun, &r.Symbol, &r.Exchange, &n.End, &n.Open, &n.Close, &n.High, &n.Low,
+			&n.Volume, &r.Run)
+		if err != nil {
+			return restated, err
+		}
+		n.Start, n.Interval = r.Old.Start, r.Old.Interval
+		restated = append(restated, r)
+	}
+	return restated, rows.Err()
+}
@@ -0,0 +1,39 @@
+package store
+
+import (
+	"database/sql"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+var sqliteDialect = dialect{
+	driver:     "sqlite3",
+	migrations: "migrations/sqlite",
+	insertSymbol: `insert into symbolids (id, symbol, exchange, name, industry, subindustry, benchmark) values (?, ?, ?, ?, ?, ?, ?)
+		on conflict (id) do update set symbol = excluded.symbol, exchange = excluded.exchange, name = excluded.name,
+		industry = excluded.industry, subindustry = excluded.subindustry, benchmark = excluded.benchmark, delisted_at = null`,
+	insertDividend: `insert into dividends values (?, ?, ?, ?) on conflict (id, exdate) do update set
+		paydate = excluded.paydate, amount = excluded.amount`,
+	insertFundamentals: `insert into fundamentals values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) on conflict (id, snapshot) do update set
+		marketcap = excluded.marketcap, pe = excluded.pe, eps = excluded.eps, yield = excluded.yield,
+		dividend = excluded.dividend, shares = excluded.shares, high52 = excluded.high52,
+		low52 = excluded.low52, avgvolume = excluded.avgvolume`,
+	insertCache: `insert into symbolcache values (?, ?, ?, ?) on conflict (symbol, exchange) do update set
+		id = excluded.id, resolved = excluded.resolved`,
+	insertFailure: "insert into failures values (?, ?, ?, ?)",
+	rebind:        bindQuestion,
+	configure:     configureSQLite,
+	maxWriters:    1,
+	indexExists:   "select count(*) from sqlite_master where type = 'index' and name = ?",
+	tableExists:   "select count(*) from sqlite_master where type = 'table' and name = ?",
+}
+
+// SQLite only allows one writer at a time, so a single connection is used.
+// Write ahead logging with normal syncing makes each commit much cheaper
+// while still being safe against corruption. Foreign keys are only enforced
+// once turned on for the connection; rows already breaking them are kept.
+func configureSQLite(db *sql.DB) error {
+	db.SetMaxOpenConns(1)
+	_, err := db.Exec("PRAGMA journal_mode=WAL; PRAGMA synchronous=NORMAL; PRAGMA foreign_keys=ON;")
+	return err
+}
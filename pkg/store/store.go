@@ -0,0 +1,1472 @@
+// Package store persists symbols, their candles and the other data fetched
+// for them in a SQL database.
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Store persists symbols and their candlestick data
+type Store interface {
+	// Save a symbol and all of its candles in one transaction, rolled back
+	// on the first failed insert so a symbol is never partly saved
+	SaveSymbol(sym Symbol) error
+
+	// End time of the most recent candle of the interval stored for each
+	// symbol, keyed by Symbol.Key
+	LatestCandles(interval string) (map[string]time.Time, error)
+
+	// Symbols whose IDs were resolved after the given time, keyed by
+	// Symbol.Key
+	CachedSymbols(since time.Time) (map[string]Symbol, error)
+
+	// Record symbols that could not be fetched
+	SaveFailures(failures []Failure) error
+
+	// Symbols queued for a retry by earlier runs
+	RetryQueue() ([]Failure, error)
+
+	// Queue failed symbols to be retried by the next run, counting another
+	// attempt for those already queued. With replace the queued symbols
+	// not among the failures are removed.
+	QueueRetries(failures []Failure, replace bool) error
+
+	// Mark a stored symbol as delisted at the given time, returning false if
+	// no listed symbol was stored under the ticker and exchange. Saving the
+	// symbol again marks it as listed.
+	MarkDelisted(symbol, exchange string, at time.Time) (bool, error)
+
+	// When each delisted symbol was marked as delisted, keyed by Symbol.Key
+	Delisted() (map[string]time.Time, error)
+
+	// All stored symbols, without their candles
+	Symbols() ([]Symbol, error)
+
+	// Candles of the interval for a symbol starting within [start, end),
+	// oldest first. An empty interval returns the candles of every interval.
+	Candles(id int, interval string, start, end time.Time) ([]Candle, error)
+
+	// Candles stored for each symbol in the interval, by symbol
+	Coverage(interval string) ([]Coverage, error)
+
+	// Rebuild the latest daily close of every symbol from its candles
+	RefreshLatestCloses() error
+
+	// Latest daily close of every symbol as of the last refresh, by symbol
+	LatestCloses() ([]LatestClose, error)
+
+	// Candles rejected by validation during a run, by symbol and problem
+	RunIssues(run int) ([]IssueCount, error)
+
+	// Intervals of the stored candles, finest first
+	Intervals() ([]string, error)
+
+	// Delete the raw and split adjusted candles of a symbol starting before
+	// the given time, returning the number of raw candles deleted. The
+	// versions later runs replaced are kept.
+	DeleteCandles(id int, before time.Time) (int, error)
+
+	// Reclaim the space left by deleted rows
+	Compact() error
+
+	// Copy the database to a timestamped backup before a destructive
+	// change, following the Backups policy it was opened with, returning
+	// the path of the backup. Only SQLite databases are backed up, others
+	// return an empty path.
+	Backup(reason string) (string, error)
+
+	// Write a consistent copy of an SQLite database to a new file at path
+	// while it is in use
+	CopyFile(path string) error
+
+	// Save candles of a symbol built from its stored ones, replacing those
+	// stored with the same interval and start, recording the run that
+	// built them
+	SaveDerived(id, run int, candles []Candle) error
+
+	// Earliest start of the candles of the interval each symbol added or
+	// changed in the run, by symbol ID. Candles saved again unchanged keep
+	// the run that saved them.
+	RunCandleStarts(run int, interval string) (map[int]time.Time, error)
+
+	// Replace the splits and split adjusted candles of a symbol
+	SaveAdjusted(id int, splits []Split, candles []Candle) error
+
+	// Replace the membership history of a universe
+	SaveMemberships(universe string, memberships []Membership) error
+
+	// Replace the daily series of every sector
+	SaveSectorDaily(days []SectorDay) error
+
+	// Replace the correlations computed over the window of days ending on
+	// the given day
+	SaveCorrelations(end time.Time, window int, pairs []Correlation) error
+
+	// Save daily FX rates, replacing those already stored for the same
+	// currency and day
+	SaveFXRates(rates []FXRate) error
+
+	// FX rates of a currency from start up to end, oldest first
+	FXRates(currency string, start, end time.Time) ([]FXRate, error)
+
+	// Save published closures and early closes, replacing those stored for
+	// the same exchange and day
+	SaveHolidays(holidays []Holiday) error
+
+	// Closures and early closes of an exchange, oldest first
+	Holidays(exchange string) ([]Holiday, error)
+
+	// Replace the daily returns of a symbol
+	SaveReturns(id int, days []Return) error
+
+	// Replace the indicators computed from a symbol's candles of the interval
+	SaveIndicators(id int, interval string, indicators []Indicator) error
+
+	// Append streamed quotes
+	SaveTicks(ticks []Tick) error
+
+	// Append snapshots of order books
+	SaveDepth(levels []DepthLevel) error
+
+	// Append quote snapshots
+	SaveQuotes(quotes []Quote) error
+
+	// Save a snapshot of an account. Executions already stored are left as
+	// they are.
+	SaveAccount(snap AccountSnapshot) error
+
+	// Time of the latest stored execution of each account, keyed by account
+	// number
+	LatestExecutions() (map[string]time.Time, error)
+
+	// Add backfill jobs, leaving those already planned alone, and return the
+	// number added
+	AddBackfillJobs(jobs []BackfillJob) (int, error)
+
+	// Backfill jobs not done yet that have been attempted fewer than
+	// maxAttempts times, by symbol, interval and window
+	PendingBackfillJobs(maxAttempts int) ([]BackfillJob, error)
+
+	// Record the outcome of an attempted backfill job
+	UpdateBackfillJob(job BackfillJob) error
+
+	// Check the database can still be reached
+	Ping() error
+
+	// Record the start of a run, returning its ID
+	StartRun(r Run) (int, error)
+
+	// Record the outcome of a run started with StartRun, with the number of
+	// failures of each class
+	FinishRun(r Run) error
+
+	// ID of the latest finished run, 0 if none has finished
+	LatestRun() (int, error)
+
+	// Name the state of the candles after a run
+	TagSnapshot(name string, run int) error
+
+	// Named snapshots, oldest run first
+	Snapshots() ([]Snapshot, error)
+
+	// Candles like Candles, as they were once the given run and those
+	// before it had saved theirs, leaving out candles later runs added and
+	// undoing the changes they made
+	CandlesAsOf(id int, interval string, start, end time.Time, run int) ([]Candle, error)
+
+	// Candles runs after the given one replaced with different values,
+	// by symbol, interval and start
+	Restatements(since int) ([]Restatement, error)
+
+	Close() error
+}
+
+// Implemented by stores that limit how many symbols can be saved at once
+type WriterLimiter interface {
+	// Most symbols that may be saved concurrently, 0 for no limit
+	MaxWriters() int
+}
+
+// Statements that differ between SQL databases
+type dialect struct {
+	driver             string
+	schema             string // Embedded schema, used when there are no migrations
+	schemaFile         string // Schema file given instead of the built in schema
+	migrations         string // Directory of embedded migrations
+	insertSymbol       string
+	insertDividend     string
+	insertFundamentals string
+	insertCache        string
+	insertFailure      string
+
+	// Rewrite a query written with ? placeholders for the driver
+	rebind func(query string) string
+
+	// Connection settings applied after opening the database
+	configure func(db *sql.DB) error
+
+	// Get the IDs of inserted runs from the result, for databases without
+	// insert ... returning
+	lastInsertID bool
+
+	// Statement reclaiming the space of deleted rows, vacuum if empty
+	compact string
+
+	// Most transactions writing at once, 0 for no limit
+	maxWriters int
+
+	// Query counting the indexes with the name given as its parameter, so
+	// missing ones can be added. Empty to leave the indexes alone.
+	indexExists string
+
+	// Query counting the tables with the name given as its parameter, so
+	// databases created before migrations can be told from new ones
+	tableExists string
+}
+
+// Candles are inserted many rows per statement, which is far faster than a
+// statement per candle
+const (
+	candleRow = "(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+
+	// Default number of candles per insert statement
+	DefaultBatchSize = 500
+
+	// Options are upserted into the chain and quoted once per snapshot
+	insertOptionChain = `insert into option_chain values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?) on conflict (id) do update set
+		symbol = excluded.symbol, multiplier = excluded.multiplier, updated = excluded.updated`
+	insertOptionQuote = `insert into option_quote values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		on conflict (id, snapshot) do nothing`
+
+	// Details are replaced each time a symbol is resolved
+	insertSymbolDetails = `insert into symbol_details values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) on conflict (id) do update set
+		currency = excluded.currency, securitytype = excluded.securitytype, description = excluded.description,
+		listingexchange = excluded.listingexchange, sector = excluded.sector, industrygroup = excluded.industrygroup,
+		subgroup = excluded.subgroup, tradable = excluded.tradable, quotable = excluded.quotable,
+		hasoptions = excluded.hasoptions, updated = excluded.updated`
+
+	insertIssue = `insert into data_quality_issues values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	// Upcoming reports are updated as estimates change and once reported
+	insertEarnings = `insert into earnings values (?, ?, ?, ?, ?, ?, ?, ?) on conflict (id, reportdate) do update set
+		fiscalend = excluded.fiscalend, reporttime = excluded.reporttime, estimate = excluded.estimate,
+		reported = excluded.reported, surprise = excluded.surprise, updated = excluded.updated`
+)
+
+// Placeholders are left as ? for drivers that support them
+func bindQuestion(query string) string {
+	return query
+}
+
+// Store backed by a database/sql driver
+type sqlStore struct {
+	dialect   dialect
+	db        *sql.DB
+	batchSize int
+	symStmt   *sql.Stmt
+	cdlStmt   *sql.Stmt
+	divStmt   *sql.Stmt
+	fndStmt   *sql.Stmt
+	cchStmt   *sql.Stmt
+
+	// Data source name and the policy of the backups taken of it
+	dsn     string
+	backups BackupPolicy
+}
+
+// Open a store using the named driver, sqlite3, postgres, mysql or duckdb. The
+// schema is created from the schema file if one is given. Otherwise SQLite,
+// MySQL and DuckDB databases are migrated to the latest schema version and PostgreSQL ones are
+// created
+// from the schema built into the binary if they don't already exist.
+// Candles are inserted batchSize rows at a time, or DefaultBatchSize if
+// batchSize isn't positive.
+func New(driver, dsn, schema string, batchSize int) (Store, error) {
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+	var d dialect
+	switch driver {
+	case "sqlite3":
+		d = sqliteDialect
+	case "postgres":
+		d = postgresDialect
+	case "mysql":
+		d = mysqlDialect
+		dsn = mysqlDSN(dsn)
+	case "duckdb":
+		d = duckdbDialect
+	default:
+		return nil, errors.New("Unsupported database driver: " + driver)
+	}
+	if schema != "" {
+		d.schemaFile = schema
+		d.migrations = ""
+	}
+	return newSQLStore(d, dsn, batchSize)
+}
+
+func newSQLStore(d dialect, dsn string, batchSize int) (*sqlStore, error) {
+	db, err := sql.Open(d.driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	if d.configure != nil {
+		if err := d.configure(db); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+
+	s := &sqlStore{dialect: d, db: db, batchSize: batchSize, dsn: dsn, backups: Backups}
+	// An existing database is backed up before it is migrated
+	backup := func() error {
+		_, err := s.Backup("migration")
+		return err
+	}
+	if err := createSchema(db, d, backup); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := ensureIndexes(db, d); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	// Prepare statements to insert data into the symbol and candlestick tables
+	if s.symStmt, err = db.Prepare(d.insertSymbol); err != nil {
+		s.Close()
+		return nil, err
+	}
+	if s.cdlStmt, err = db.Prepare(s.candleInsert("candlestick", batchSize)); err != nil {
+		s.Close()
+		return nil, err
+	}
+	if s.divStmt, err = db.Prepare(d.insertDividend); err != nil {
+		s.Close()
+		return nil, err
+	}
+	if s.fndStmt, err = db.Prepare(d.insertFundamentals); err != nil {
+		s.Close()
+		return nil, err
+	}
+	if s.cchStmt, err = db.Prepare(d.insertCache); err != nil {
+		s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Migrate the database, or create it from the schema file or the built in
+// schema.
+func createSchema(db *sql.DB, d dialect, backup func() error) error {
+	if d.migrations != "" {
+		return migrate(db, d, backup)
+	}
+	schema := d.schema
+	if d.schemaFile != "" {
+		file, err := ioutil.ReadFile(d.schemaFile)
+		if err != nil {
+			return err
+		}
+		schema = string(file)
+	}
+	_, err := db.Exec(schema)
+	return err
+}
+
+func (s *sqlStore) SaveSymbol(sym Symbol) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := s.saveSymbol(tx, sym); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *sqlStore) saveSymbol(tx *sql.Tx, sym Symbol) error {
+	_, err := tx.Stmt(s.symStmt).Exec(sym.SymbolID, sym.Symbol, sym.Exchange, sym.Name, sym.Industry, sym.SubIndustry, sym.Benchmark)
+	if err != nil {
+		return err
+	}
+
+	// Candles the run restates are kept as they were
+	if err := s.keepVersions(tx, sym.SymbolID, sym.Run, sym.Candles); err != nil {
+		return err
+	}
+	if err := s.saveCandles(tx, "candlestick", s.cdlStmt, sym.SymbolID, sym.Run, sym.Candles); err != nil {
+		return err
+	}
+	if err := s.dropUnchangedVersions(tx, sym.SymbolID, sym.Run); err != nil {
+		return err
+	}
+
+	if !sym.Resolved.IsZero() {
+		if _, err := tx.Stmt(s.cchStmt).Exec(sym.Symbol, sym.Exchange, sym.SymbolID, sym.Resolved); err != nil {
+			return err
+		}
+	}
+
+	if d := sym.Details; d != nil {
+		_, err := tx.Exec(s.dialect.rebind(insertSymbolDetails), sym.SymbolID, d.Currency, d.SecurityType, d.Description,
+			d.ListingExchange, d.Sector, d.Group, d.SubGroup, d.Tradable, d.Quotable, d.HasOptions, d.Updated)
+		if err != nil {
+			return err
+		}
+	}
+
+	if sym.Dividend != nil {
+		d := sym.Dividend
+		if _, err := tx.Stmt(s.divStmt).Exec(sym.SymbolID, d.ExDate, d.PayDate, d.Amount); err != nil {
+			return err
+		}
+	}
+
+	if sym.Fundamentals != nil {
+		f := sym.Fundamentals
+		_, err := tx.Stmt(s.fndStmt).Exec(sym.SymbolID, f.Date, f.MarketCap, f.PE, f.EPS, f.Yield, f.Dividend,
+			f.OutstandingShares, f.High52, f.Low52, f.AverageVol3Months)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(sym.Options) > 0 {
+		if err := s.saveOptions(tx, sym.Options); err != nil {
+			return err
+		}
+	}
+
+	for _, e := range sym.Earnings {
+		_, err := tx.Exec(s.dialect.rebind(insertEarnings), sym.SymbolID, e.ReportDate, e.FiscalEnd, e.ReportTime,
+			e.Estimate, e.Reported, e.Surprise, e.Updated)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, is := range sym.Issues {
+		c := is.Candle
+		_, err := tx.Exec(s.dialect.rebind(insertIssue), sym.SymbolID, nullRun(sym.Run), c.Interval, c.Start, c.End,
+			c.Open, c.Close, c.High, c.Low, c.Volume, is.Problem, is.Detected)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *sqlStore) saveOptions(tx *sql.Tx, options []Option) error {
+	chain, err := tx.Prepare(s.dialect.rebind(insertOptionChain))
+	if err != nil {
+		return err
+	}
+	defer chain.Close()
+	quote, err := tx.Prepare(s.dialect.rebind(insertOptionQuote))
+	if err != nil {
+		return err
+	}
+	defer quote.Close()
+
+	for _, o := range options {
+		if _, err := chain.Exec(o.ID, o.Underlying, o.Symbol, o.Root, o.Type, o.Expiry, o.Strike, o.Multiplier, o.Exercise, o.Snapshot); err != nil {
+			return err
+		}
+		_, err := quote.Exec(o.ID, o.Snapshot, o.Bid, o.BidSize, o.Ask, o.AskSize, o.Last, o.Volume, o.OpenInterest,
+			o.Volatility, o.Delta, o.Gamma, o.Theta, o.Vega, o.Rho)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *sqlStore) LatestCandles(interval string) (map[string]time.Time, error) {
+	latest := make(map[string]time.Time)
+	rows, err := s.db.Query(s.dialect.rebind(`select s.symbol, s.exchange, c.endtime from symbolids s
+		join candlestick c on c.id = s.id and c."interval" = ?
+		where c.endtime = (select max(endtime) from candlestick where id = s.id and "interval" = c."interval")`), interval)
+	if err != nil {
+		return latest, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var sym Symbol
+		var end time.Time
+		if err := rows.Scan(&sym.Symbol, &sym.Exchange, &end); err != nil {
+			return latest, err
+		}
+		latest[sym.Key()] = end
+	}
+	return latest, rows.Err()
+}
+
+// Insert candles into the table in batches of batchSize rows, recording the
+// run that fetched them if run isn't zero. Full batches use the prepared
+// statement if there is one, the shorter final batch is prepared as needed.
+// Stops at the first failed batch, the transaction is rolled back by the
+// caller.
+func (s *sqlStore) saveCandles(tx *sql.Tx, table string, full *sql.Stmt, id, run int, candles []Candle) error {
+	runID := nullRun(run)
+	for i := 0; i < len(candles); i += s.batchSize {
+		batch := candles[i:]
+		if len(batch) > s.batchSize {
+			batch = batch[:s.batchSize]
+		}
+
+		args := make([]interface{}, 0, 15*len(batch))
+		for _, cdl := range batch {
+			currency := cdl.Currency
+			if currency == "" {
+				currency = "USD"
+			}
+			session := cdl.Session
+			if session == "" {
+				session = SessionRegular
+			}
+			args = append(args, id, cdl.Start, cdl.End, cdl.Open, cdl.Close, cdl.High, cdl.Low, cdl.Volume, runID, cdl.Interval,
+				currency, nullRate(cdl.FXRate), session, nullRate(float64(cdl.AdjClose)), cdl.Derived)
+		}
+
+		var err error
+		if len(batch) == s.batchSize && full != nil {
+			_, err = tx.Stmt(full).Exec(args...)
+		} else {
+			_, err = tx.Exec(s.candleInsert(table, len(batch)), args...)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Statement inserting rows candles into the table at once.
+func (s *sqlStore) candleInsert(table string, rows int) string {
+	values := strings.Repeat(candleRow+", ", rows-1) + candleRow
+	return s.dialect.rebind("insert into " + table + " values " + values + candleConflict(table))
+}
+
+// Upsert of candles stored in table again. A candle saved again with the same
+// values keeps the run that saved it, so reads as of that run still find it
+// once dropUnchangedVersions has removed the copy kept for the new run. The
+// run is set first, as MySQL compares against the columns already updated.
+func candleConflict(table string) string {
+	return ` on conflict (id, "interval", starttime) do update set
+		run = case when ` + table + `.endtime = excluded.endtime and ` + table + `.open = excluded.open
+			and ` + table + `.close = excluded.close and ` + table + `.high = excluded.high
+			and ` + table + `.low = excluded.low and ` + table + `.volume = excluded.volume
+			then ` + table + `.run else excluded.run end,
+		endtime = excluded.endtime, open = excluded.open, close = excluded.close,
+		high = excluded.high, low = excluded.low, volume = excluded.volume,
+		currency = excluded.currency, fxrate = excluded.fxrate, session = excluded.session, adjclose = excluded.adjclose,
+		derived = excluded.derived`
+}
+
+func (s *sqlStore) SaveDerived(id, run int, candles []Candle) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := s.saveCandles(tx, "candlestick", s.cdlStmt, id, run, candles); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *sqlStore) RunCandleStarts(run int, interval string) (map[int]time.Time, error) {
+	starts := make(map[int]time.Time)
+	// The start is read from a row rather than aggregated, which SQLite
+	// would return as text
+	rows, err := s.db.Query(s.dialect.rebind(`select c.id, c.starttime from candlestick c where c.run = ? and c."interval" = ?
+		and c.starttime = (select min(starttime) from candlestick where id = c.id and run = ? and "interval" = ?)`),
+		run, interval, run, interval)
+	if err != nil {
+		return starts, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+		var start time.Time
+		if err := rows.Scan(&id, &start); err != nil {
+			return starts, err
+		}
+		starts[id] = start
+	}
+	return starts, rows.Err()
+}
+
+func (s *sqlStore) SaveAdjusted(id int, splits []Split, candles []Candle) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, q := range []string{"delete from splits where id = ?", "delete from adjusted where id = ?"} {
+		if _, err := tx.Exec(s.dialect.rebind(q), id); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	for _, sp := range splits {
+		if _, err := tx.Exec(s.dialect.rebind("insert into splits values (?, ?, ?, ?)"), id, sp.Date, sp.Ratio, sp.Source); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if err := s.saveCandles(tx, "adjusted", nil, id, 0, candles); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *sqlStore) SaveMemberships(universe string, memberships []Membership) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(s.dialect.rebind("delete from constituents where universe = ?"), universe); err != nil {
+		tx.Rollback()
+		return err
+	}
+	stmt, err := tx.Prepare(s.dialect.rebind("insert into constituents values (?, ?, ?, ?, ?)"))
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+
+	for _, m := range memberships {
+		if _, err := stmt.Exec(universe, m.Symbol, m.Name, nullTime(m.From), nullTime(m.To)); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Zero times are stored as NULL
+func nullTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t
+}
+
+// Data saved outside of a run has a NULL run
+func nullRun(run int) interface{} {
+	if run == 0 {
+		return nil
+	}
+	return run
+}
+
+// Conversion rate of a candle, null when it wasn't converted
+func nullRate(rate float64) interface{} {
+	if rate == 0 {
+		return nil
+	}
+	return rate
+}
+
+func (s *sqlStore) SaveSectorDaily(days []SectorDay) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec("delete from sector_daily"); err != nil {
+		tx.Rollback()
+		return err
+	}
+	stmt, err := tx.Prepare(s.dialect.rebind("insert into sector_daily values (?, ?, ?, ?, ?, ?, ?)"))
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+
+	for _, d := range days {
+		if _, err := stmt.Exec(d.Sector, d.Date, d.Symbols, d.Return, d.Volume, d.Advancers, d.Decliners); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *sqlStore) SaveCorrelations(end time.Time, window int, pairs []Correlation) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(s.dialect.rebind(`delete from correlations where day = ? and "window" = ?`), end, window); err != nil {
+		tx.Rollback()
+		return err
+	}
+	stmt, err := tx.Prepare(s.dialect.rebind("insert into correlations values (?, ?, ?, ?, ?)"))
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+
+	for _, p := range pairs {
+		if _, err := stmt.Exec(end, window, p.A, p.B, p.Value); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *sqlStore) SaveFXRates(rates []FXRate) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	stmt, err := tx.Prepare(s.dialect.rebind(`insert into fx_rates values (?, ?, ?)
+		on conflict (currency, day) do update set rate = excluded.rate`))
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+
+	for _, r := range rates {
+		if _, err := stmt.Exec(r.Currency, r.Date, r.Rate); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *sqlStore) SaveHolidays(holidays []Holiday) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	stmt, err := tx.Prepare(s.dialect.rebind(`insert into market_holidays values (?, ?, ?, ?, ?)
+		on conflict (exchange, day) do update set name = excluded.name, close = excluded.close, updated = excluded.updated`))
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+
+	for _, h := range holidays {
+		if _, err := stmt.Exec(h.Exchange, h.Date, h.Name, nullTime(h.Close), h.Updated); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *sqlStore) Holidays(exchange string) ([]Holiday, error) {
+	var holidays []Holiday
+	rows, err := s.db.Query(s.dialect.rebind(`select exchange, day, name, close, updated from market_holidays
+		where exchange = ? order by day`), exchange)
+	if err != nil {
+		return holidays, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var h Holiday
+		var close sql.NullTime
+		if err := rows.Scan(&h.Exchange, &h.Date, &h.Name, &close, &h.Updated); err != nil {
+			return holidays, err
+		}
+		h.Close = close.Time
+		holidays = append(holidays, h)
+	}
+	return holidays, rows.Err()
+}
+
+func (s *sqlStore) FXRates(currency string, start, end time.Time) ([]FXRate, error) {
+	var rates []FXRate
+	rows, err := s.db.Query(s.dialect.rebind(`select currency, day, rate from fx_rates
+		where currency = ? and day >= ? and day < ? order by day`), currency, start, end)
+	if err != nil {
+		return rates, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var r FXRate
+		if err := rows.Scan(&r.Currency, &r.Date, &r.Rate); err != nil {
+			return rates, err
+		}
+		rates = append(rates, r)
+	}
+	return rates, rows.Err()
+}
+
+func (s *sqlStore) SaveReturns(id int, days []Return) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(s.dialect.rebind("delete from returns where id = ?"), id); err != nil {
+		tx.Rollback()
+		return err
+	}
+	stmt, err := tx.Prepare(s.dialect.rebind("insert into returns values (?, ?, ?, ?, ?, ?, ?, ?, ?)"))
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+
+	for _, d := range days {
+		if _, err := stmt.Exec(id, d.Date, d.Close, d.LogReturn, d.Volatility30, d.Volatility90, d.Volatility252, d.Drawdown, d.MaxDrawdown); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *sqlStore) SaveIndicators(id int, interval string, indicators []Indicator) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(s.dialect.rebind(`delete from indicators where id = ? and "interval" = ?`), id, interval); err != nil {
+		tx.Rollback()
+		return err
+	}
+	stmt, err := tx.Prepare(s.dialect.rebind("insert into indicators values (?, ?, ?, ?, ?)"))
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+
+	for _, ind := range indicators {
+		if _, err := stmt.Exec(id, interval, ind.Time, ind.Name, ind.Value); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *sqlStore) SaveFailures(failures []Failure) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	stmt, err := tx.Prepare(s.dialect.insertFailure)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+
+	for _, f := range failures {
+		if _, err := stmt.Exec(f.Symbol, f.Exchange, f.Reason, f.Time); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *sqlStore) RetryQueue() ([]Failure, error) {
+	var queue []Failure
+	rows, err := s.db.Query(`select symbol, exchange, class, reason, attempts, failedat from retry_queue order by symbol, exchange`)
+	if err != nil {
+		return queue, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var f Failure
+		if err := rows.Scan(&f.Symbol, &f.Exchange, &f.Class, &f.Reason, &f.Attempts, &f.Time); err != nil {
+			return queue, err
+		}
+		queue = append(queue, f)
+	}
+	return queue, rows.Err()
+}
+
+func (s *sqlStore) QueueRetries(failures []Failure, replace bool) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if replace {
+		failed := make(map[string]bool, len(failures))
+		for _, f := range failures {
+			failed[f.Symbol+":"+f.Exchange] = true
+		}
+		rows, err := tx.Query(`select symbol, exchange from retry_queue`)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		var fixed [][2]string
+		for rows.Next() {
+			var k [2]string
+			if err := rows.Scan(&k[0], &k[1]); err != nil {
+				rows.Close()
+				tx.Rollback()
+				return err
+			}
+			if !failed[k[0]+":"+k[1]] {
+				fixed = append(fixed, k)
+			}
+		}
+		rows.Close()
+		for _, k := range fixed {
+			if _, err := tx.Exec(s.dialect.rebind("delete from retry_queue where symbol = ? and exchange = ?"), k[0], k[1]); err != nil {
+				tx.Rollback()
+				return err
+			}
+		}
+	}
+
+	stmt, err := tx.Prepare(s.dialect.rebind(`insert into retry_queue values (?, ?, ?, ?, 1, ?)
+		on conflict (symbol, exchange) do update set class = excluded.class, reason = excluded.reason,
+		attempts = retry_queue.attempts + 1, failedat = excluded.failedat`))
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+
+	for _, f := range failures {
+		if _, err := stmt.Exec(f.Symbol, f.Exchange, f.Class, f.Reason, f.Time); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *sqlStore) MarkDelisted(symbol, exchange string, at time.Time) (bool, error) {
+	res, err := s.db.Exec(s.dialect.rebind(`update symbolids set delisted_at = ?
+		where symbol = ? and exchange = ? and delisted_at is null`), at, symbol, exchange)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (s *sqlStore) Delisted() (map[string]time.Time, error) {
+	delisted := make(map[string]time.Time)
+	rows, err := s.db.Query("select symbol, exchange, delisted_at from symbolids where delisted_at is not null")
+	if err != nil {
+		return delisted, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var sym Symbol
+		var at time.Time
+		if err := rows.Scan(&sym.Symbol, &sym.Exchange, &at); err != nil {
+			return delisted, err
+		}
+		delisted[sym.Key()] = at
+	}
+	return delisted, rows.Err()
+}
+
+func (s *sqlStore) Coverage(interval string) ([]Coverage, error) {
+	var cov []Coverage
+	// The first and last candles are joined rather than selected with min
+	// and max, so their times scan into time.Time with every driver
+	rows, err := s.db.Query(s.dialect.rebind(`select s.symbol, s.exchange, f.starttime, l.endtime, n.candles from symbolids s
+		join (select id, count(*) as candles from candlestick where "interval" = ? group by id) n on n.id = s.id
+		join candlestick f on f.id = s.id and f."interval" = ?
+			and f.starttime = (select min(starttime) from candlestick where id = s.id and "interval" = ?)
+		join candlestick l on l.id = s.id and l."interval" = ?
+			and l.starttime = (select max(starttime) from candlestick where id = s.id and "interval" = ?)
+		order by s.symbol, s.exchange`), interval, interval, interval, interval, interval)
+	if err != nil {
+		return cov, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var c Coverage
+		if err := rows.Scan(&c.Symbol, &c.Exchange, &c.First, &c.Last, &c.Candles); err != nil {
+			return cov, err
+		}
+		cov = append(cov, c)
+	}
+	return cov, rows.Err()
+}
+
+func (s *sqlStore) RefreshLatestCloses() error {
+	// Candles of an unfinished day are replaced by later runs, so the table
+	// is rebuilt rather than updated
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec("delete from latest_close"); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if _, err := tx.Exec(s.dialect.rebind(`insert into latest_close
+		select c.id, c.starttime, c.close, p.close, c.close - p.close, (c.close - p.close) / nullif(p.close, 0) * 100, c.volume, current_timestamp
+		from candlestick c
+		left join candlestick p on p.id = c.id and p."interval" = c."interval"
+			and p.starttime = (select max(starttime) from candlestick
+				where id = c.id and "interval" = ? and session = ? and starttime < c.starttime)
+		where c."interval" = ? and c.session = ?
+			and c.starttime = (select max(starttime) from candlestick where id = c.id and "interval" = ? and session = ?)`),
+		"OneDay", SessionRegular, "OneDay", SessionRegular, "OneDay", SessionRegular); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *sqlStore) LatestCloses() ([]LatestClose, error) {
+	var closes []LatestClose
+	rows, err := s.db.Query(`select s.symbol, s.exchange, l.day, l.close, l.prevclose, l.netchange, l.pctchange, l.volume, l.updated
+		from latest_close l join symbolids s on s.id = l.id
+		order by s.symbol, s.exchange`)
+	if err != nil {
+		return closes, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var c LatestClose
+		var prev, change, pct sql.NullFloat64
+		if err := rows.Scan(&c.Symbol, &c.Exchange, &c.Day, &c.Close, &prev, &change, &pct, &c.Volume, &c.Updated); err != nil {
+			return closes, err
+		}
+		if prev.Valid {
+			c.PrevClose, c.NetChange, c.PctChange = &prev.Float64, &change.Float64, &pct.Float64
+		}
+		closes = append(closes, c)
+	}
+	return closes, rows.Err()
+}
+
+func (s *sqlStore) RunIssues(run int) ([]IssueCount, error) {
+	var issues []IssueCount
+	rows, err := s.db.Query(s.dialect.rebind(`select s.symbol, d.problem, count(*) from data_quality_issues d
+		join symbolids s on s.id = d.id where d.run = ?
+		group by s.symbol, d.problem order by s.symbol, d.problem`), run)
+	if err != nil {
+		return issues, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var i IssueCount
+		if err := rows.Scan(&i.Symbol, &i.Problem, &i.Count); err != nil {
+			return issues, err
+		}
+		issues = append(issues, i)
+	}
+	return issues, rows.Err()
+}
+
+func (s *sqlStore) SaveTicks(ticks []Tick) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	stmt, err := tx.Prepare(s.dialect.rebind("insert into quotes values (?, ?, ?, ?, ?, ?, ?, ?, ?)"))
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+
+	for _, t := range ticks {
+		if _, err := stmt.Exec(t.SymbolID, t.Time, t.Bid, t.BidSize, t.Ask, t.AskSize, t.Last, t.LastSize, t.Volume); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *sqlStore) SaveDepth(levels []DepthLevel) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	stmt, err := tx.Prepare(s.dialect.rebind(`insert into depth values (?, ?, ?, ?, ?, ?)
+		on conflict (id, snapshot, side, level) do nothing`))
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+
+	for _, l := range levels {
+		if _, err := stmt.Exec(l.SymbolID, l.Snapshot, l.Side, l.Level, l.Price, l.Size); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *sqlStore) SaveQuotes(quotes []Quote) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	stmt, err := tx.Prepare(s.dialect.rebind(`insert into quote_snapshots values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		on conflict (id, snapshot) do nothing`))
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+
+	for _, q := range quotes {
+		if _, err := stmt.Exec(q.SymbolID, q.Snapshot, nullRun(q.Run), q.Bid, q.BidSize, q.Ask, q.AskSize, q.Last, q.LastSize,
+			q.Volume, q.Delay, q.Halted); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *sqlStore) SaveAccount(snap AccountSnapshot) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	number := snap.Account.Number
+	if _, err := tx.Exec(s.dialect.rebind(`insert into account_snapshots values (?, ?, ?)
+		on conflict (account, snapshot) do update set type = excluded.type`), number, snap.Account.Type, snap.Time); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	pos, err := tx.Prepare(s.dialect.rebind(`insert into account_positions values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		on conflict (account, snapshot, symbolid) do nothing`))
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer pos.Close()
+	for _, p := range snap.Positions {
+		if _, err := pos.Exec(number, snap.Time, p.SymbolID, p.Symbol, p.Quantity, p.Price, p.MarketValue,
+			p.AveragePrice, p.TotalCost, p.OpenPnL, p.ClosedPnL); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	bal, err := tx.Prepare(s.dialect.rebind(`insert into account_balances values (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		on conflict (account, snapshot, currency, combined) do nothing`))
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer bal.Close()
+	for _, b := range snap.Balances {
+		if _, err := bal.Exec(number, snap.Time, b.Currency, b.Combined, b.Cash, b.MarketValue, b.TotalEquity,
+			b.BuyingPower, b.MaintenanceExcess); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	exe, err := tx.Prepare(s.dialect.rebind(`insert into account_executions values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		on conflict (id) do nothing`))
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer exe.Close()
+	for _, e := range snap.Executions {
+		if _, err := exe.Exec(e.ID, number, e.OrderID, e.SymbolID, e.Symbol, e.Side, e.Quantity, e.Price,
+			e.Commission, e.Fees, e.Venue, e.Time); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *sqlStore) LatestExecutions() (map[string]time.Time, error) {
+	latest := make(map[string]time.Time)
+	rows, err := s.db.Query(`select e.account, e.executed from account_executions e
+		where e.executed = (select max(executed) from account_executions where account = e.account)`)
+	if err != nil {
+		return latest, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var account string
+		var t time.Time
+		if err := rows.Scan(&account, &t); err != nil {
+			return latest, err
+		}
+		latest[account] = t
+	}
+	return latest, rows.Err()
+}
+
+func (s *sqlStore) AddBackfillJobs(jobs []BackfillJob) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	stmt, err := tx.Prepare(s.dialect.rebind(`insert into backfill_jobs values (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		on conflict (symbol, exchange, "interval", windowstart) do nothing`))
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	defer stmt.Close()
+
+	added := 0
+	for _, j := range jobs {
+		res, err := stmt.Exec(j.Symbol, j.Exchange, j.Interval, j.Start, j.End, j.Status, j.Attempts, j.Error, j.Updated)
+		if err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+		if n, err := res.RowsAffected(); err == nil {
+			added += int(n)
+		}
+	}
+	return added, tx.Commit()
+}
+
+func (s *sqlStore) PendingBackfillJobs(maxAttempts int) ([]BackfillJob, error) {
+	var jobs []BackfillJob
+	rows, err := s.db.Query(s.dialect.rebind(`select symbol, exchange, "interval", windowstart, windowend, status, attempts, error, updated
+		from backfill_jobs where status <> ? and attempts < ? order by symbol, exchange, "interval", windowstart`), JobDone, maxAttempts)
+	if err != nil {
+		return jobs, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var j BackfillJob
+		if err := rows.Scan(&j.Symbol, &j.Exchange, &j.Interval, &j.Start, &j.End, &j.Status, &j.Attempts, &j.Error, &j.Updated); err != nil {
+			return jobs, err
+		}
+		jobs = append(jobs, j)
+	}
+	return jobs, rows.Err()
+}
+
+func (s *sqlStore) UpdateBackfillJob(j BackfillJob) error {
+	_, err := s.db.Exec(s.dialect.rebind(`update backfill_jobs set status = ?, attempts = ?, error = ?, updated = ?
+		where symbol = ? and exchange = ? and "interval" = ? and windowstart = ?`),
+		j.Status, j.Attempts, j.Error, j.Updated, j.Symbol, j.Exchange, j.Interval, j.Start)
+	return err
+}
+
+func (s *sqlStore) Ping() error {
+	return s.db.Ping()
+}
+
+func (s *sqlStore) StartRun(r Run) (int, error) {
+	insert := `insert into runs (started, "interval", provider, version, symbols, failed, candles) values (?, ?, ?, ?, ?, 0, 0)`
+	args := []interface{}{r.Started, r.Interval, r.Provider, r.Version, r.Symbols}
+	if s.dialect.lastInsertID {
+		res, err := s.db.Exec(s.dialect.rebind(insert), args...)
+		if err != nil {
+			return 0, err
+		}
+		id, err := res.LastInsertId()
+		return int(id), err
+	}
+	var id int
+	err := s.db.QueryRow(s.dialect.rebind(insert+" returning id"), args...).Scan(&id)
+	return id, err
+}
+
+func (s *sqlStore) FinishRun(r Run) error {
+	_, err := s.db.Exec(s.dialect.rebind("update runs set finished = ?, symbols = ?, failed = ?, candles = ? where id = ?"),
+		r.Finished, r.Symbols, r.Failed, r.Candles, r.ID)
+	if err != nil {
+		return err
+	}
+	insert := s.dialect.rebind(`insert into run_failures (run, class, symbols) values (?, ?, ?)
+		on conflict (run, class) do update set symbols = excluded.symbols`)
+	for class, n := range r.Failures {
+		if _, err := s.db.Exec(insert, r.ID, class, n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *sqlStore) CachedSymbols(since time.Time) (map[string]Symbol, error) {
+	cached := make(map[string]Symbol)
+	rows, err := s.db.Query(s.dialect.rebind("select symbol, exchange, id, resolved from symbolcache where resolved >= ?"), since)
+	if err != nil {
+		return cached, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var sym Symbol
+		if err := rows.Scan(&sym.Symbol, &sym.Exchange, &sym.SymbolID, &sym.Resolved); err != nil {
+			return cached, err
+		}
+		cached[sym.Key()] = sym
+	}
+	return cached, rows.Err()
+}
+
+func (s *sqlStore) Symbols() ([]Symbol, error) {
+	var symbols []Symbol
+	rows, err := s.db.Query("select id, symbol, exchange, name, industry, subindustry, benchmark from symbolids order by symbol")
+	if err != nil {
+		return symbols, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var sym Symbol
+		if err := rows.Scan(&sym.SymbolID, &sym.Symbol, &sym.Exchange, &sym.Name, &sym.Industry, &sym.SubIndustry, &sym.Benchmark); err != nil {
+			return symbols, err
+		}
+		symbols = append(symbols, sym)
+	}
+	return symbols, rows.Err()
+}
+
+func (s *sqlStore) Candles(id int, interval string, start, end time.Time) ([]Candle, error) {
+	var candles []Candle
+	rows, err := s.db.Query(s.dialect.rebind(`select starttime, endtime, open, close, high, low, volume, "interval", currency, fxrate, session, adjclose,
+		derived from candlestick where id = ? and (? = '' or "interval" = ?) and starttime >= ? and starttime < ?
+		order by "interval", starttime`), id, interval, interval, start, end)
+	if err != nil {
+		return candles, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var c Candle
+		var rate, adjClose sql.NullFloat64
+		if err := rows.Scan(&c.Start, &c.End, &c.Open, &c.Close, &c.High, &c.Low, &c.Volume, &c.Interval, &c.Currency, &rate, &c.Session,
+			&adjClose, &c.Derived); err != nil {
+			return candles, err
+		}
+		c.FXRate = rate.Float64
+		c.AdjClose = float32(adjClose.Float64)
+		candles = append(candles, c)
+	}
+	return candles, rows.Err()
+}
+
+func (s *sqlStore) DeleteCandles(id int, before time.Time) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	res, err := tx.Exec(s.dialect.rebind("delete from candlestick where id = ? and starttime < ?"), id, before)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	// The versions runs replaced are kept, archives only hold the current
+	// candles
+	if _, err := tx.Exec(s.dialect.rebind("delete from adjusted where id = ? and starttime < ?"), id, before); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	return int(n), tx.Commit()
+}
+
+// SQLite and Postgres reclaim space with a plain vacuum, which can't run in a
+// transaction, MySQL by rebuilding the candle tables and DuckDB with a
+// checkpoint.
+func (s *sqlStore) Compact() error {
+	compact := s.dialect.compact
+	if compact == "" {
+		compact = "vacuum"
+	}
+	_, err := s.db.Exec(compact)
+	return err
+}
+
+func (s *sqlStore) Intervals() ([]string, error) {
+	rows, err := s.db.Query(s.dialect.rebind(`select distinct "interval" from candlestick`))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var intervals []string
+	for rows.Next() {
+		var i string
+		if err := rows.Scan(&i); err != nil {
+			return nil, err
+		}
+		intervals = append(intervals, i)
+	}
+	sort.Slice(intervals, func(i, j int) bool { return intervalRank(intervals[i]) < intervalRank(intervals[j]) })
+	return intervals, rows.Err()
+}
+
+// Order of the candle intervals from finest to coarsest
+var intervalOrder = []string{
+	"OneMinute", "TwoMinutes", "ThreeMinutes", "FourMinutes", "FiveMinutes",
+	"TenMinutes", "FifteenMinutes", "TwentyMinutes", "HalfHour", "OneHour",
+	"TwoHours", "FourHours", "OneDay", "OneWeek", "OneMonth",
+}
+
+func intervalRank(interval string) int {
+	for i, v := range intervalOrder {
+		if v == interval {
+			return i
+		}
+	}
+	return len(intervalOrder)
+}
+
+func (s *sqlStore) MaxWriters() int {
+	return s.dialect.maxWriters
+}
+
+func (s *sqlStore) Close() error {
+	if s.symStmt != nil {
+		s.symStmt.Close()
+	}
+	if s.cdlStmt != nil {
+		s.cdlStmt.Close()
+	}
+	if s.divStmt != nil {
+		s.divStmt.Close()
+	}
+	if s.cchStmt != nil {
+		s.cchStmt.Close()
+	}
+	if s.fndStmt != nil {
+		s.fndStmt.Close()
+	}
+	return s.db.Close()
+}
@@ -0,0 +1,423 @@
+package store
+
+import "time"
+
+// Symbol is a listed security along with the data fetched for it
+type Symbol struct {
+	Symbol       string         `json:"symbol"`
+	Name         string         `json:"name"`
+	Industry     string         `json:"industry"`
+	SubIndustry  string         `json:"subindustry"`
+	Exchange     string         `json:"exchange"`
+	SymbolID     int            `json:"symbolid,omitempty"`
+	Benchmark    bool           `json:"benchmark,omitempty"` // An ETF or index fetched to compare the universe against
+	Candles      []Candle       `json:"candles,omitempty"`
+	Details      *SymbolDetails `json:"details,omitempty"`
+	Dividend     *Dividend      `json:"dividend,omitempty"`
+	Fundamentals *Fundamentals  `json:"fundamentals,omitempty"`
+	Options      []Option       `json:"options,omitempty"`
+	Earnings     []Earnings     `json:"earnings,omitempty"`
+
+	// Candles that failed validation, saved to the data_quality_issues
+	// table instead of with the candles
+	Issues []Issue `json:"-"`
+
+	// When the symbol ID was last looked up with the search endpoint
+	Resolved time.Time `json:"-"`
+
+	// ID of the run that fetched the candles, recorded with each candle.
+	// Zero when they weren't fetched by a run.
+	Run int `json:"-"`
+}
+
+// Symbols are only unique within an exchange
+func (s Symbol) Key() string {
+	return s.Symbol + ":" + s.Exchange
+}
+
+// Listing details of a symbol, looked up when its ID is resolved
+type SymbolDetails struct {
+	Currency        string    `json:"currency"`
+	SecurityType    string    `json:"securitytype"` // Such as Stock, ETF or Index
+	Description     string    `json:"description"`
+	ListingExchange string    `json:"listingexchange"`
+	Sector          string    `json:"sector"`
+	Group           string    `json:"group"`
+	SubGroup        string    `json:"subgroup"`
+	Tradable        bool      `json:"tradable"`
+	Quotable        bool      `json:"quotable"`
+	HasOptions      bool      `json:"hasoptions"`
+	Updated         time.Time `json:"updated"`
+}
+
+// Candle is the prices and volume traded over an interval
+type Candle struct {
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+	Open     float32   `json:"open"`
+	High     float32   `json:"high"`
+	Low      float32   `json:"low"`
+	Close    float32   `json:"close"`
+	Volume   int       `json:"volume"`
+	Interval string    `json:"interval,omitempty"`
+
+	// Currency the symbol is listed in, USD if empty, and the rate the
+	// prices were converted to USD at. Zero when the prices are in the
+	// listed currency.
+	Currency string  `json:"currency,omitempty"`
+	FXRate   float64 `json:"fxrate,omitempty"`
+
+	// Trading session the candle falls in, regular if empty
+	Session string `json:"session,omitempty"`
+
+	// Close adjusted for splits and dividends, 0 unless the provider reports
+	// one
+	AdjClose float32 `json:"adjclose,omitempty"`
+
+	// Built from the stored candles of a finer interval rather than fetched
+	Derived bool `json:"derived,omitempty"`
+}
+
+// Trading sessions of a day. Intraday candles fetched with extended hours
+// can fall before or after the regular session.
+const (
+	SessionPre     = "pre"
+	SessionRegular = "regular"
+	SessionPost    = "post"
+)
+
+// Candle rejected by validation and the problem found with it
+type Issue struct {
+	Candle   Candle
+	Problem  string
+	Detected time.Time
+}
+
+// Dividend declared for a symbol
+type Dividend struct {
+	ExDate  time.Time `json:"exdate"`
+	PayDate time.Time `json:"paydate"`
+	Amount  float32   `json:"amount"`
+}
+
+// Snapshot of the fundamentals of a symbol on a given day
+type Fundamentals struct {
+	Date              time.Time `json:"date"`
+	MarketCap         float64   `json:"marketcap"`
+	PE                float32   `json:"pe"`
+	EPS               float32   `json:"eps"`
+	Yield             float32   `json:"yield"`
+	Dividend          float32   `json:"dividend"`
+	OutstandingShares int       `json:"outstandingshares"`
+	High52            float32   `json:"high52"`
+	Low52             float32   `json:"low52"`
+	AverageVol3Months int       `json:"averagevol3months"`
+}
+
+// Earnings report of a symbol, past or upcoming. The EPS figures are nil
+// when not known, the reported EPS and surprise until the report is out.
+type Earnings struct {
+	ReportDate time.Time `json:"reportdate"`
+	FiscalEnd  time.Time `json:"fiscalend"`
+	ReportTime string    `json:"reporttime,omitempty"` // pre-market or post-market
+	Estimate   *float64  `json:"estimate,omitempty"`
+	Reported   *float64  `json:"reported,omitempty"`
+	Surprise   *float64  `json:"surprise,omitempty"`
+	Updated    time.Time `json:"updated"`
+}
+
+// Stock split, Ratio is the number of new shares per old share so a 4 for 1
+// split is 4 and a 1 for 10 reverse split is 0.1
+type Split struct {
+	Date   time.Time
+	Ratio  float64
+	Source string
+}
+
+// Option on a symbol and its quote at the snapshot time. The greeks are zero
+// when the provider doesn't report them.
+type Option struct {
+	ID         int       `json:"id"`
+	Underlying int       `json:"underlying"`
+	Symbol     string    `json:"symbol"`
+	Root       string    `json:"root"`
+	Type       string    `json:"type"` // Call or Put
+	Expiry     time.Time `json:"expiry"`
+	Strike     float64   `json:"strike"`
+	Multiplier int       `json:"multiplier"`
+	Exercise   string    `json:"exercise"` // American or European
+
+	Snapshot     time.Time `json:"snapshot"`
+	Bid          float32   `json:"bid"`
+	BidSize      int       `json:"bidsize"`
+	Ask          float32   `json:"ask"`
+	AskSize      int       `json:"asksize"`
+	Last         float32   `json:"last"`
+	Volume       int       `json:"volume"`
+	OpenInterest int       `json:"openinterest"`
+	Volatility   float32   `json:"volatility"`
+	Delta        float32   `json:"delta"`
+	Gamma        float32   `json:"gamma"`
+	Theta        float32   `json:"theta"`
+	Vega         float32   `json:"vega"`
+	Rho          float32   `json:"rho"`
+}
+
+// Period a symbol was a constituent of a universe. From is zero when the
+// symbol was a member before the earliest known change and To is zero while
+// it is still a member.
+type Membership struct {
+	Universe string
+	Symbol   string
+	Name     string
+	From     time.Time
+	To       time.Time
+}
+
+// Daily figures of the symbols of a sector. Return is the equal weighted
+// average of the returns of the Symbols that had one, and the advancers and
+// decliners are those whose close rose or fell.
+type SectorDay struct {
+	Sector    string
+	Date      time.Time
+	Symbols   int
+	Return    float64
+	Volume    int
+	Advancers int
+	Decliners int
+}
+
+// Daily return of a symbol. The log return is nil on the first day and the
+// annualized volatilities until there are enough returns for their window.
+// Drawdowns are fractions below the highest close so far, zero or negative.
+type Return struct {
+	Date          time.Time
+	Close         float64
+	LogReturn     *float64
+	Volatility30  *float64
+	Volatility90  *float64
+	Volatility252 *float64
+	Drawdown      float64
+	MaxDrawdown   float64
+}
+
+// Correlation of the daily returns of the symbols with IDs A and B
+type Correlation struct {
+	A     int
+	B     int
+	Value float64
+}
+
+// Value of a technical indicator at the candle starting at Time
+type Indicator struct {
+	Time  time.Time
+	Name  string
+	Value float64
+}
+
+// Level 1 quote received from the stream
+type Tick struct {
+	SymbolID int
+	Time     time.Time
+	Bid      float32
+	BidSize  int
+	Ask      float32
+	AskSize  int
+	Last     float32
+	LastSize int
+	Volume   int
+}
+
+// Price level of the order book of a symbol at the snapshot time. Levels
+// count from 0 at the best bid or ask.
+type DepthLevel struct {
+	SymbolID int
+	Snapshot time.Time
+	Side     string // bid or ask
+	Level    int
+	Price    float32
+	Size     int
+}
+
+// Top of the book and last trade of a symbol when it was quoted, and the run
+// the quote was taken by
+type Quote struct {
+	SymbolID int
+	Snapshot time.Time
+	Run      int
+	Bid      float32
+	BidSize  int
+	Ask      float32
+	AskSize  int
+	Last     float32
+	LastSize int
+	Volume   int
+	Delay    int // Minutes the quote is delayed by, 0 for real time
+	Halted   bool
+}
+
+// Latest regular session daily close of a symbol, the close of the day
+// before it and the change between them. Symbols with a single daily candle
+// have no previous close or change.
+type LatestClose struct {
+	Symbol    string    `json:"symbol"`
+	Exchange  string    `json:"exchange"`
+	Day       time.Time `json:"day"`
+	Close     float64   `json:"close"`
+	PrevClose *float64  `json:"prevclose,omitempty"`
+	NetChange *float64  `json:"netchange,omitempty"`
+	PctChange *float64  `json:"pctchange,omitempty"`
+	Volume    int64     `json:"volume"`
+	Updated   time.Time `json:"updated"`
+}
+
+// Stored candles of a symbol in an interval, from the start of the first to
+// the end of the last
+type Coverage struct {
+	Symbol   string
+	Exchange string
+	First    time.Time
+	Last     time.Time
+	Candles  int
+}
+
+// Number of candles of a symbol rejected by a run with the same problem
+type IssueCount struct {
+	Symbol  string
+	Problem string
+	Count   int
+}
+
+// A symbol that could not be fetched
+type Failure struct {
+	Symbol   string    `json:"symbol"`
+	Exchange string    `json:"exchange"`
+	Reason   string    `json:"reason"`
+	Time     time.Time `json:"timestamp"`
+
+	// The provider doesn't know the symbol, so it may have been delisted
+	NotFound bool `json:"notfound,omitempty"`
+
+	// Class of the error, one of the Failure constants of pkg/scraper such
+	// as not_found, rate_limited or provider, and the number of runs the
+	// symbol has failed in a row when it is queued for a retry
+	Class    string `json:"class,omitempty"`
+	Attempts int    `json:"attempts,omitempty"`
+}
+
+// Day an exchange is closed or closes early, from its published calendar
+type Holiday struct {
+	Exchange string
+	Date     time.Time
+	Name     string
+
+	// When the exchange closes early, zero if it is closed all day
+	Close time.Time
+
+	// When the calendar the day came from was fetched
+	Updated time.Time
+}
+
+// Rate converting a currency to USD on a day, USD per unit of the currency
+type FXRate struct {
+	Currency string
+	Date     time.Time
+	Rate     float64
+}
+
+// Brokerage account of the logged in user
+type Account struct {
+	Number string
+	Type   string // Such as Margin, TFSA or RRSP
+}
+
+// Positions and balances of an account at the snapshot time, and its
+// executions since the previous snapshot
+type AccountSnapshot struct {
+	Account    Account
+	Time       time.Time
+	Positions  []Position
+	Balances   []Balance
+	Executions []Execution
+}
+
+// Holding of a symbol in an account
+type Position struct {
+	SymbolID     int
+	Symbol       string
+	Quantity     float64
+	Price        float64
+	MarketValue  float64
+	AveragePrice float64 // Average price the position was entered at
+	TotalCost    float64
+	OpenPnL      float64
+	ClosedPnL    float64
+}
+
+// Balance of an account in a currency. Combined balances are of every
+// currency converted to the one given.
+type Balance struct {
+	Currency          string
+	Combined          bool
+	Cash              float64
+	MarketValue       float64
+	TotalEquity       float64
+	BuyingPower       float64
+	MaintenanceExcess float64
+}
+
+// Fill of an order in an account. Fees are those charged on top of the
+// commission.
+type Execution struct {
+	ID         int
+	OrderID    int
+	SymbolID   int
+	Symbol     string
+	Side       string // Such as Buy or Sell
+	Quantity   float64
+	Price      float64
+	Commission float64
+	Fees       float64
+	Venue      string
+	Time       time.Time
+}
+
+// Statuses of a backfill job
+const (
+	JobPending = "pending"
+	JobDone    = "done"
+	JobFailed  = "failed"
+)
+
+// Window of candles of a symbol fetched by a backfill, tracked in the
+// backfill_jobs table so an interrupted backfill carries on where it stopped
+type BackfillJob struct {
+	Symbol   string
+	Exchange string
+	Interval string
+	Start    time.Time
+	End      time.Time
+	Status   string
+	Attempts int
+	Error    string
+	Updated  time.Time
+}
+
+// A scrape, recorded in the runs table so stored candles can be traced back
+// to the run that fetched them
+type Run struct {
+	ID       int
+	Started  time.Time
+	Finished time.Time
+	Interval string
+	Provider string
+	Version  string
+
+	// Symbols attempted, those that failed and candles saved
+	Symbols int
+	Failed  int
+	Candles int
+
+	// Number of the failed symbols by class of error, see Failure
+	Failures map[string]int
+}
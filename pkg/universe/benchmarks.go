@@ -0,0 +1,60 @@
+package universe
+
+import (
+	"strings"
+
+	"github.com/alexurquhart/sp500scraper/pkg/store"
+)
+
+// Exchange of the benchmark ETFs, and of listed benchmarks that don't give
+// one
+const benchmarkExchange = "ARCA"
+
+// Benchmark series fetched alongside a universe: SPY, which stands in for
+// the S&P 500 index, and the Select Sector SPDR ETF of each GICS sector
+var Benchmarks = []store.Symbol{
+	{Symbol: "SPY", Name: "SPDR S&P 500 ETF Trust"},
+	{Symbol: "XLB", Name: "Materials Select Sector SPDR Fund", Industry: "Materials"},
+	{Symbol: "XLC", Name: "Communication Services Select Sector SPDR Fund", Industry: "Communication Services"},
+	{Symbol: "XLE", Name: "Energy Select Sector SPDR Fund", Industry: "Energy"},
+	{Symbol: "XLF", Name: "Financial Select Sector SPDR Fund", Industry: "Financials"},
+	{Symbol: "XLI", Name: "Industrial Select Sector SPDR Fund", Industry: "Industrials"},
+	{Symbol: "XLK", Name: "Technology Select Sector SPDR Fund", Industry: "Information Technology"},
+	{Symbol: "XLP", Name: "Consumer Staples Select Sector SPDR Fund", Industry: "Consumer Staples"},
+	{Symbol: "XLRE", Name: "Real Estate Select Sector SPDR Fund", Industry: "Real Estate"},
+	{Symbol: "XLU", Name: "Utilities Select Sector SPDR Fund", Industry: "Utilities"},
+	{Symbol: "XLV", Name: "Health Care Select Sector SPDR Fund", Industry: "Health Care"},
+	{Symbol: "XLY", Name: "Consumer Discretionary Select Sector SPDR Fund", Industry: "Consumer Discretionary"},
+}
+
+// The benchmarks with the given tickers, each TICKER or TICKER:EXCHANGE, or
+// the built in Benchmarks if there are none. Tickers among the built in
+// benchmarks keep their names.
+func ParseBenchmarks(tickers []string) []store.Symbol {
+	if len(tickers) == 0 {
+		tickers = make([]string, len(Benchmarks))
+		for i, b := range Benchmarks {
+			tickers[i] = b.Symbol
+		}
+	}
+	known := make(map[string]store.Symbol, len(Benchmarks))
+	for _, b := range Benchmarks {
+		known[b.Symbol] = b
+	}
+
+	symbols := make([]store.Symbol, len(tickers))
+	for i, t := range tickers {
+		ticker, exchange := t, benchmarkExchange
+		if j := strings.LastIndex(t, ":"); j > 0 {
+			ticker, exchange = t[:j], t[j+1:]
+		}
+		sym, ok := known[ticker]
+		if !ok {
+			sym = store.Symbol{Symbol: ticker, Name: ticker}
+		}
+		sym.Exchange = exchange
+		sym.Benchmark = true
+		symbols[i] = sym
+	}
+	return symbols
+}
@@ -0,0 +1,132 @@
+package universe
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/alexurquhart/sp500scraper/pkg/store"
+	"golang.org/x/net/html"
+)
+
+// Date format of the change log
+const wikipediaDate = "January 2, 2006"
+
+// Addition to or removal from a universe, from its Wikipedia change log
+type change struct {
+	Date        time.Time
+	Added       string
+	AddedName   string
+	Removed     string
+	RemovedName string
+}
+
+// Reconstruct when each symbol was a member of the universe from the current
+// constituents and the change log on its Wikipedia page. Symbols that have
+// been members the whole time the change log covers have no start date, and
+// current members have no end date.
+func (u Universe) Memberships() ([]store.Membership, error) {
+	if u.URL == "" {
+		return nil, errors.New("Watchlist " + u.Name + " has no membership history")
+	}
+	res, err := http.Get(u.URL)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, errors.New("Unexpected response from Wikipedia: " + res.Status)
+	}
+	doc, err := html.Parse(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	table := findNode(doc, func(n *html.Node) bool {
+		return n.Type == html.ElementNode && n.Data == "table" && attr(n, "id") == "changes"
+	})
+	if table == nil {
+		return nil, errors.New("Change log not found on " + u.URL)
+	}
+	changes := parseChanges(table)
+
+	current := findNode(doc, func(n *html.Node) bool {
+		return n.Type == html.ElementNode && n.Data == "table" && attr(n, "id") == "constituents"
+	})
+	if current == nil {
+		return nil, errors.New("Constituents table not found on " + u.URL)
+	}
+	symbols, err := parseConstituents(current, u.Exchange)
+	if err != nil {
+		return nil, err
+	}
+	return replayChanges(u.Name, symbols, changes), nil
+}
+
+// Parse the rows of the change log, which has the date, added ticker and
+// name, removed ticker and name and the reason. Changes made on the same day
+// may share the date cell.
+func parseChanges(table *html.Node) []change {
+	var changes []change
+	var date time.Time
+	for _, row := range findNodes(table, func(n *html.Node) bool {
+		return n.Type == html.ElementNode && n.Data == "tr"
+	}) {
+		cells := findNodes(row, func(n *html.Node) bool {
+			return n.Type == html.ElementNode && n.Data == "td"
+		})
+		if len(cells) < 5 {
+			continue
+		}
+		if d, err := time.Parse(wikipediaDate, text(cells[0])); err == nil {
+			date = d
+			cells = cells[1:]
+		} else if len(cells) > 5 || date.IsZero() {
+			continue
+		}
+		changes = append(changes, change{
+			Date:        date,
+			Added:       normalizeTicker(text(cells[0])),
+			AddedName:   text(cells[1]),
+			Removed:     normalizeTicker(text(cells[2])),
+			RemovedName: text(cells[3]),
+		})
+	}
+	return changes
+}
+
+// Walk the change log back from the current constituents. An addition opens
+// a symbol's membership on that date and a removal means the symbol was a
+// member until then.
+func replayChanges(universe string, current []store.Symbol, changes []change) []store.Membership {
+	sort.SliceStable(changes, func(i, j int) bool { return changes[i].Date.After(changes[j].Date) })
+
+	var memberships []store.Membership
+	open := make(map[string]int) // Index of the membership of each member as the log is walked back
+	for _, s := range current {
+		open[s.Symbol] = len(memberships)
+		memberships = append(memberships, store.Membership{Universe: universe, Symbol: s.Symbol, Name: s.Name})
+	}
+
+	for _, c := range changes {
+		if i, ok := open[c.Added]; ok && c.Added != "" {
+			memberships[i].From = c.Date
+			delete(open, c.Added)
+		}
+		if c.Removed != "" {
+			if _, ok := open[c.Removed]; !ok {
+				open[c.Removed] = len(memberships)
+				memberships = append(memberships, store.Membership{Universe: universe, Symbol: c.Removed, Name: c.RemovedName, To: c.Date})
+			}
+		}
+	}
+
+	sort.Slice(memberships, func(i, j int) bool {
+		if memberships[i].Symbol != memberships[j].Symbol {
+			return memberships[i].Symbol < memberships[j].Symbol
+		}
+		return memberships[i].From.Before(memberships[j].From)
+	})
+	return memberships
+}
@@ -0,0 +1,145 @@
+// Package universe lists the constituents of stock indices, kept in JSON
+// files and scraped from Wikipedia.
+package universe
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/alexurquhart/sp500scraper/pkg/store"
+)
+
+// Universe is an index whose constituents are scraped. The constituents are
+// kept in a JSON file so they can be edited by hand, and refreshed from the
+// Wikipedia page listing them.
+type Universe struct {
+	Name string
+
+	// JSON file of the constituents
+	File string
+
+	// Wikipedia page with a table of the constituents, empty for a watchlist
+	URL string
+
+	// Exchange to use when the table doesn't give one
+	Exchange string
+}
+
+// Supported universes
+var universes = map[string]Universe{
+	"sp500": {
+		Name:     "sp500",
+		File:     "sp500.json",
+		URL:      "https://en.wikipedia.org/wiki/List_of_S%26P_500_companies",
+		Exchange: "NYSE",
+	},
+	"nasdaq100": {
+		Name:     "nasdaq100",
+		File:     "nasdaq100.json",
+		URL:      "https://en.wikipedia.org/wiki/Nasdaq-100",
+		Exchange: "NASDAQ",
+	},
+	"dow30": {
+		Name:     "dow30",
+		File:     "dow30.json",
+		URL:      "https://en.wikipedia.org/wiki/Dow_Jones_Industrial_Average",
+		Exchange: "NYSE",
+	},
+	"russell1000": {
+		Name:     "russell1000",
+		File:     "russell1000.json",
+		URL:      "https://en.wikipedia.org/wiki/Russell_1000_Index",
+		Exchange: "NYSE",
+	},
+}
+
+// Look up a universe by name.
+func Find(name string) (Universe, error) {
+	u, ok := universes[name]
+	if !ok {
+		var names []string
+		for n := range universes {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return u, errors.New("Unknown universe " + name + ", expected one of " + strings.Join(names, ", "))
+	}
+	return u, nil
+}
+
+// A universe of the symbols listed in a watchlist file, which isn't scraped
+// from Wikipedia. Symbols that don't give an exchange are on exchange.
+func Watchlist(name, file, exchange string) Universe {
+	return Universe{Name: name, File: file, Exchange: exchange}
+}
+
+// Read the constituents of the universe. The file is scraped from Wikipedia
+// first when refresh is set or it doesn't exist yet. If a refresh fails the
+// existing file is used.
+func (u Universe) Load(refresh bool) ([]store.Symbol, error) {
+	if u.URL == "" {
+		return u.loadWatchlist()
+	}
+	_, err := os.Stat(u.File)
+	missing := os.IsNotExist(err)
+	if refresh || missing {
+		if err := refreshSymbols(u); err != nil {
+			if missing {
+				return nil, err
+			}
+			slog.Warn("Could not refresh symbols, using existing file", "universe", u.Name, "error", err)
+		}
+	}
+
+	file, err := ioutil.ReadFile(u.File)
+	if err != nil {
+		return nil, err
+	}
+	var symbols []store.Symbol
+	err = json.Unmarshal(file, &symbols)
+	return symbols, err
+}
+
+// Read a watchlist, a JSON file of symbols like the universe files or a text
+// file with a ticker per line, each TICKER or TICKER:EXCHANGE. Blank lines
+// and lines starting with # are skipped.
+func (u Universe) loadWatchlist() ([]store.Symbol, error) {
+	file, err := ioutil.ReadFile(u.File)
+	if err != nil {
+		return nil, err
+	}
+	var symbols []store.Symbol
+	if strings.EqualFold(filepath.Ext(u.File), ".json") {
+		if err := json.Unmarshal(file, &symbols); err != nil {
+			return nil, err
+		}
+	} else {
+		for _, line := range strings.Split(string(file), "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			sym := store.Symbol{Symbol: line}
+			if i := strings.LastIndex(line, ":"); i > 0 {
+				sym.Symbol, sym.Exchange = line[:i], line[i+1:]
+			}
+			sym.Name = sym.Symbol
+			symbols = append(symbols, sym)
+		}
+	}
+	for i := range symbols {
+		if symbols[i].Exchange == "" {
+			symbols[i].Exchange = u.Exchange
+		}
+	}
+	if len(symbols) == 0 {
+		return nil, errors.New("Watchlist " + u.File + " lists no symbols")
+	}
+	return symbols, nil
+}
@@ -0,0 +1,245 @@
+package universe
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/alexurquhart/sp500scraper/pkg/store"
+	"golang.org/x/net/html"
+)
+
+// Column headings of constituents tables that map onto store.Symbol fields
+var wikipediaColumns = map[string]string{
+	"symbol":            "symbol",
+	"ticker":            "symbol",
+	"ticker symbol":     "symbol",
+	"security":          "name",
+	"company":           "name",
+	"exchange":          "exchange",
+	"gics sector":       "industry",
+	"sector":            "industry",
+	"industry":          "industry",
+	"gics sub-industry": "subindustry",
+	"gics sub industry": "subindustry",
+}
+
+// Download the constituents table of a universe from Wikipedia and parse it
+// into symbols.
+func scrapeSymbols(u Universe) ([]store.Symbol, error) {
+	res, err := http.Get(u.URL)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, errors.New("Unexpected response from Wikipedia: " + res.Status)
+	}
+
+	doc, err := html.Parse(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	// Prefer the table marked as the constituents, falling back to the
+	// first table on the page with a symbol column
+	table := findNode(doc, func(n *html.Node) bool {
+		return n.Type == html.ElementNode && n.Data == "table" && attr(n, "id") == "constituents"
+	})
+	if table != nil {
+		return parseConstituents(table, u.Exchange)
+	}
+	tables := findNodes(doc, func(n *html.Node) bool {
+		return n.Type == html.ElementNode && n.Data == "table"
+	})
+	for _, t := range tables {
+		if symbols, err := parseConstituents(t, u.Exchange); err == nil {
+			return symbols, nil
+		}
+	}
+	return nil, errors.New("Constituents table not found on " + u.URL)
+}
+
+// Walk the rows of the constituents table. The first row holds the headings,
+// which are used to find the columns of interest.
+func parseConstituents(table *html.Node, exchange string) ([]store.Symbol, error) {
+	var symbols []store.Symbol
+	var columns []string
+
+	for _, row := range findNodes(table, func(n *html.Node) bool {
+		return n.Type == html.ElementNode && n.Data == "tr"
+	}) {
+		cells := findNodes(row, func(n *html.Node) bool {
+			return n.Type == html.ElementNode && (n.Data == "td" || n.Data == "th")
+		})
+
+		if columns == nil {
+			for _, c := range cells {
+				columns = append(columns, wikipediaColumns[strings.ToLower(text(c))])
+			}
+			continue
+		}
+
+		var sym store.Symbol
+		for i, c := range cells {
+			if i >= len(columns) {
+				break
+			}
+			switch columns[i] {
+			case "symbol":
+				sym.Symbol = normalizeTicker(text(c))
+				if sym.Exchange == "" {
+					sym.Exchange = exchangeFromLink(c, exchange)
+				}
+			case "exchange":
+				sym.Exchange = normalizeExchange(text(c), exchange)
+			case "name":
+				sym.Name = text(c)
+			case "industry":
+				sym.Industry = text(c)
+			case "subindustry":
+				sym.SubIndustry = text(c)
+			}
+		}
+		if sym.Symbol != "" {
+			symbols = append(symbols, sym)
+		}
+	}
+
+	if len(symbols) == 0 {
+		return nil, errors.New("No symbols found in constituents table")
+	}
+	return symbols, nil
+}
+
+// Tickers are listed on Wikipedia with the share class separated by a dot,
+// which is the same format Questrade uses.
+func normalizeTicker(t string) string {
+	t = strings.ToUpper(strings.TrimSpace(t))
+	return strings.Replace(t, "-", ".", -1)
+}
+
+// When there is no exchange column the ticker cell usually links to the
+// quote page of the listing exchange.
+func exchangeFromLink(cell *html.Node, fallback string) string {
+	a := findNode(cell, func(n *html.Node) bool {
+		return n.Type == html.ElementNode && n.Data == "a"
+	})
+	if a == nil {
+		return fallback
+	}
+	return normalizeExchange(attr(a, "href"), fallback)
+}
+
+// Map an exchange name or URL onto the names used by Questrade.
+func normalizeExchange(e, fallback string) string {
+	e = strings.ToLower(e)
+	switch {
+	case strings.Contains(e, "nasdaq"):
+		return "NASDAQ"
+	case strings.Contains(e, "cboe"), strings.Contains(e, "bats"):
+		return "BATS"
+	case strings.Contains(e, "nyse"):
+		return "NYSE"
+	default:
+		return fallback
+	}
+}
+
+// Replace the symbol file with a freshly scraped copy of the constituents,
+// logging how the universe changed.
+func refreshSymbols(u Universe) error {
+	symbols, err := scrapeSymbols(u)
+	if err != nil {
+		return err
+	}
+
+	var old []store.Symbol
+	if file, err := ioutil.ReadFile(u.File); err == nil {
+		json.Unmarshal(file, &old)
+	}
+	added, removed := diffSymbols(old, symbols)
+
+	out, err := json.MarshalIndent(symbols, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(u.File, out, 0644); err != nil {
+		return err
+	}
+	slog.Info("Scraped symbols from Wikipedia", "universe", u.Name, "symbols", len(symbols), "added", added, "removed", removed)
+	return nil
+}
+
+// Count the symbols added to and removed from a universe.
+func diffSymbols(old, cur []store.Symbol) (int, int) {
+	seen := make(map[string]bool)
+	for _, s := range old {
+		seen[s.Symbol] = true
+	}
+
+	added := 0
+	for _, s := range cur {
+		if !seen[s.Symbol] {
+			added++
+		}
+		delete(seen, s.Symbol)
+	}
+	return added, len(seen)
+}
+
+// Depth first search for the first node matching f.
+func findNode(n *html.Node, f func(*html.Node) bool) *html.Node {
+	if f(n) {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if m := findNode(c, f); m != nil {
+			return m
+		}
+	}
+	return nil
+}
+
+// Find all descendants of n matching f, not descending into matches.
+func findNodes(n *html.Node, f func(*html.Node) bool) []*html.Node {
+	var nodes []*html.Node
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if f(c) {
+			nodes = append(nodes, c)
+			continue
+		}
+		nodes = append(nodes, findNodes(c, f)...)
+	}
+	return nodes
+}
+
+// Value of the named attribute, or an empty string.
+func attr(n *html.Node, name string) string {
+	for _, a := range n.Attr {
+		if a.Key == name {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// Concatenated text content of a node, trimmed of whitespace.
+func text(n *html.Node) string {
+	var b bytes.Buffer
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			b.WriteString(n.Data)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return strings.TrimSpace(b.String())
+}
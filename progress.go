@@ -0,0 +1,221 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/alexurquhart/sp500scraper/pkg/scraper"
+)
+
+// Writer for log output to stderr that keeps the progress bar, when there is
+// one, on the last line of the terminal
+type console struct {
+	mu     sync.Mutex
+	w      io.Writer
+	bar    string
+	paused bool // The bar is hidden while a prompt waits for input
+}
+
+// Log output, shared by the logger and the progress bar
+var stderr = &console{w: os.Stderr}
+
+func (c *console) Write(b []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	drawn := c.bar != "" && !c.paused
+	if drawn {
+		io.WriteString(c.w, "\r\033[K")
+	}
+	n, err := c.w.Write(b)
+	if drawn {
+		io.WriteString(c.w, c.bar)
+	}
+	return n, err
+}
+
+// Replace the progress bar, an empty string removes it.
+func (c *console) setBar(bar string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.paused {
+		io.WriteString(c.w, "\r\033[K"+bar)
+	}
+	c.bar = bar
+}
+
+// Hide the progress bar until resume, so a prompt isn't drawn over.
+func (c *console) pause() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.bar != "" {
+		io.WriteString(c.w, "\r\033[K")
+	}
+	c.paused = true
+}
+
+// Draw the progress bar again after pause.
+func (c *console) resume() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.paused = false
+	if c.bar != "" {
+		io.WriteString(c.w, "\r\033[K"+c.bar)
+	}
+}
+
+// Whether stderr is a terminal rather than a file or pipe
+func isTerminal() bool {
+	fi, err := os.Stderr.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// Progress of a run. On a terminal a progress bar is redrawn a few times a
+// second, otherwise a progress line is logged every interval.
+type progress struct {
+	total     int
+	began     time.Time
+	apiErrors int64
+
+	done    int64 // Symbols saved, skipped or failed
+	worked  int64 // Symbols done that needed API calls
+	candles int64
+	current atomic.Value
+
+	stop    chan bool
+	stopped chan bool
+}
+
+// Start displaying the progress of a run of total symbols. The bar is drawn
+// when bar is set and stderr is a terminal, otherwise progress is logged every
+// interval, or not at all if interval is zero.
+func startProgress(total int, bar bool, interval time.Duration) *progress {
+	p := &progress{
+		total:     total,
+		began:     time.Now(),
+		apiErrors: scraper.APIErrors(),
+		stop:      make(chan bool),
+		stopped:   make(chan bool),
+	}
+	p.current.Store("")
+
+	var tick time.Duration
+	switch {
+	case bar && isTerminal():
+		tick = 200 * time.Millisecond
+	case interval > 0:
+		tick = interval
+		bar = false
+	default:
+		close(p.stopped)
+		return p
+	}
+
+	go func() {
+		defer close(p.stopped)
+		t := time.NewTicker(tick)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				if bar {
+					stderr.setBar(p.line())
+				} else {
+					p.log()
+				}
+			case <-p.stop:
+				if bar {
+					stderr.setBar("")
+				}
+				return
+			}
+		}
+	}()
+	return p
+}
+
+// Record the symbol a worker started on.
+func (p *progress) Start(symbol string) {
+	p.current.Store(symbol)
+}
+
+// Record a symbol that was fetched and saved with the given number of
+// candles, or that failed.
+func (p *progress) Done(candles int) {
+	atomic.AddInt64(&p.worked, 1)
+	atomic.AddInt64(&p.candles, int64(candles))
+	p.Skip()
+}
+
+// Record a symbol that didn't need fetching.
+func (p *progress) Skip() {
+	atomic.AddInt64(&p.done, 1)
+}
+
+// Stop the display, removing the progress bar.
+func (p *progress) Stop() {
+	select {
+	case <-p.stopped:
+	default:
+		close(p.stop)
+		<-p.stopped
+	}
+}
+
+type progressState struct {
+	done, candles, errors int64
+	current               string
+	rate                  float64
+	eta                   time.Duration
+}
+
+func (p *progress) state() progressState {
+	elapsed := time.Since(p.began)
+	s := progressState{
+		done:    atomic.LoadInt64(&p.done),
+		candles: atomic.LoadInt64(&p.candles),
+		errors:  scraper.APIErrors() - p.apiErrors,
+		current: p.current.Load().(string),
+		rate:    float64(atomic.LoadInt64(&p.candles)) / elapsed.Seconds(),
+	}
+	// Skipped symbols take no time, so the estimate is based on the
+	// symbols that were fetched
+	if worked := atomic.LoadInt64(&p.worked); worked > 0 {
+		per := elapsed / time.Duration(worked)
+		s.eta = (per * time.Duration(int64(p.total)-s.done)).Round(time.Second)
+	}
+	return s
+}
+
+// Progress bar and counters, fitting on one line of a terminal.
+func (p *progress) line() string {
+	s := p.state()
+	const width = 30
+	filled := width
+	if p.total > 0 {
+		filled = int(s.done) * width / p.total
+	}
+	bar := make([]byte, width)
+	for i := range bar {
+		if i < filled {
+			bar[i] = '='
+		} else {
+			bar[i] = ' '
+		}
+	}
+	eta := "--"
+	if s.eta > 0 {
+		eta = s.eta.String()
+	}
+	return fmt.Sprintf("[%s] %d/%d %-6s %.0f candles/s %d API errors ETA %s", bar, s.done, p.total, s.current, s.rate, s.errors, eta)
+}
+
+func (p *progress) log() {
+	s := p.state()
+	slog.Info("Progress", "done", s.done, "total", p.total, "current", s.current, "candles_per_second", fmt.Sprintf("%.1f", s.rate),
+		"api_errors", s.errors, "eta", s.eta)
+}
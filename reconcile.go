@@ -0,0 +1,289 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"io/ioutil"
+	"log/slog"
+	"math"
+	"os/signal"
+	"sort"
+	"syscall"
+	"time"
+
+	"github.com/alexurquhart/sp500scraper/pkg/scraper"
+	"github.com/alexurquhart/sp500scraper/pkg/store"
+	"github.com/alexurquhart/sp500scraper/pkg/universe"
+)
+
+// Comparison of the candles two providers returned for a symbol over the
+// same window
+type Reconciliation struct {
+	Symbol   string `json:"symbol"`
+	Exchange string `json:"exchange"`
+
+	// Candles both providers returned, those only the first or second
+	// returned, and those whose prices or volume differ beyond the
+	// tolerances
+	Compared int `json:"compared"`
+	OnlyA    int `json:"only_a"`
+	OnlyB    int `json:"only_b"`
+	Differs  int `json:"differs"`
+
+	// Share of the candles of either provider that are missing from the
+	// other or differ, and the largest relative difference of a price
+	Divergence   float64 `json:"divergence"`
+	MaxDeviation float64 `json:"max_deviation"`
+
+	// Set when the divergence is over the limit or a provider failed
+	Flagged bool         `json:"flagged"`
+	Error   string       `json:"error,omitempty"`
+	Changes []CandleDiff `json:"changes,omitempty"`
+}
+
+// Fetch the same window of candles from two providers without saving them,
+// compare them and report the symbols whose data diverges.
+//
+// Candles are matched by interval and start, daily and longer ones by the
+// day they start on as providers stamp them differently. They differ when a
+// price is further than -tolerance from the first provider's, relative to
+// it, or the volume further than -volume-tolerance, which is looser as
+// providers count volume differently. A symbol is flagged when more than
+// -max-divergence of its candles are missing from one side or differ.
+func runReconcile(args []string) error {
+	fs := flag.NewFlagSet("reconcile", flag.ExitOnError)
+	providerA := fs.String("a", "questrade", "First provider, whose candles the second's are compared to")
+	providerB := fs.String("b", "yahoo", "Second provider")
+	universeName := fs.String("universe", "sp500", "Index of the symbols to compare, one of sp500, nasdaq100, dow30 or russell1000")
+	symbolsFile := fs.String("symbols-file", "", "JSON file of the constituents of the universe, defaults to <universe>.json")
+	only := fs.String("symbols", "", "Comma separated tickers to compare, all of the universe if empty")
+	start := fs.String("start", "", "Compare candles from this date (YYYY-MM-DD), defaults to a month ago")
+	end := fs.String("end", "", "Compare candles before this date (YYYY-MM-DD), defaults to now")
+	interval := fs.String("interval", "OneDay", "Interval of the candles compared")
+	tolerance := fs.Float64("tolerance", 0.005, "Relative difference of a price above which candles differ")
+	volumeTolerance := fs.Float64("volume-tolerance", 0.1, "Relative difference of the volume above which candles differ, negative to ignore volume")
+	maxDivergence := fs.Float64("max-divergence", 0.02, "Share of candles missing or differing above which a symbol is flagged")
+	details := fs.Int("details", 5, "Number of differing candles of each flagged symbol to log and report")
+	report := fs.String("report", "", "JSON file to write the comparison of every symbol to")
+	credentials := fs.String("credentials", "credentials.json", "File the refresh token is saved to between runs, or keyring to keep it in the OS keyring")
+	server := addServerFlags(fs)
+	profiles := fs.String("profiles", "", "Comma separated Questrade credential profiles to spread requests across")
+	rateLimit := fs.Float64("rate-limit", 5, "Maximum number of API calls per second to each provider")
+	alphaVantageRate := fs.Float64("alphavantage-rate-limit", 5, "Maximum number of Alpha Vantage calls per minute")
+	retries := fs.Int("retries", 3, "Maximum number of attempts for each API call")
+	retryDelay := fs.Duration("retry-delay", time.Second, "Initial delay between retries, doubled after each attempt")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *providerA == *providerB {
+		return errors.New("Two different providers are needed, set -a and -b")
+	}
+	live, err := server.isLive()
+	if err != nil {
+		return err
+	}
+	if *start == "" {
+		*start = time.Now().AddDate(0, -1, 0).Format(scraper.DateFormat)
+	}
+	cr, err := scraper.ParseRange(*start, *end, *interval)
+	if err != nil {
+		return err
+	}
+
+	u, err := universe.Find(*universeName)
+	if err != nil {
+		return err
+	}
+	if *symbolsFile != "" {
+		u.File = *symbolsFile
+	}
+	symbols, err := u.Load(false)
+	if err != nil {
+		return err
+	}
+	if tickers := splitList(*only); len(tickers) > 0 {
+		want := make(map[string]bool, len(tickers))
+		for _, t := range tickers {
+			want[t] = true
+		}
+		var picked []store.Symbol
+		for _, s := range symbols {
+			if want[s.Symbol] {
+				picked = append(picked, s)
+			}
+		}
+		symbols = picked
+	}
+
+	pc := scraper.ProviderConfig{
+		Credentials:      *credentials,
+		Live:             live,
+		Profiles:         splitList(*profiles),
+		RateLimit:        *rateLimit,
+		Retry:            scraper.RetryPolicy{MaxAttempts: *retries, BaseDelay: *retryDelay, MaxDelay: time.Minute},
+		AlphaVantageRate: *alphaVantageRate / 60,
+	}
+	readProviderKeys(&pc)
+	a, err := scraper.NewProvider(*providerA, pc)
+	if err != nil {
+		return err
+	}
+	b, err := scraper.NewProvider(*providerB, pc)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	var results []Reconciliation
+	flagged := 0
+	for _, sym := range symbols {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		r := Reconciliation{Symbol: sym.Symbol, Exchange: sym.Exchange}
+		ca, err := fetchWindow(ctx, a, sym, cr)
+		if err == nil {
+			var cb []store.Candle
+			if cb, err = fetchWindow(ctx, b, sym, cr); err == nil {
+				r = reconcileCandles(ca, cb, *tolerance, *volumeTolerance)
+				r.Symbol, r.Exchange = sym.Symbol, sym.Exchange
+				r.Flagged = r.Divergence > *maxDivergence
+			}
+		}
+		if err != nil {
+			if err == context.Canceled {
+				return err
+			}
+			r.Error, r.Flagged = err.Error(), true
+		}
+
+		if len(r.Changes) > *details {
+			r.Changes = r.Changes[:*details]
+		}
+		if !r.Flagged {
+			r.Changes = nil
+		}
+		switch {
+		case r.Error != "":
+			slog.Warn("Could not compare symbol", "symbol", r.Symbol, "exchange", r.Exchange, "error", r.Error)
+		case r.Flagged:
+			slog.Warn("Providers diverge", "symbol", r.Symbol, "exchange", r.Exchange, "compared", r.Compared, "only_a", r.OnlyA,
+				"only_b", r.OnlyB, "differs", r.Differs, "divergence", r.Divergence, "max_deviation", r.MaxDeviation)
+			for _, c := range r.Changes {
+				slog.Info("Candle differs", "symbol", r.Symbol, "interval", c.Interval, "start", c.Start, "a", candleText(c.A), "b", candleText(c.B))
+			}
+		default:
+			slog.Debug("Providers agree", "symbol", r.Symbol, "exchange", r.Exchange, "compared", r.Compared, "max_deviation", r.MaxDeviation)
+		}
+		if r.Flagged {
+			flagged++
+		}
+		results = append(results, r)
+	}
+	slog.Info("Reconciled providers", "a", *providerA, "b", *providerB, "symbols", len(results), "flagged", flagged)
+
+	if *report != "" {
+		if results == nil {
+			results = []Reconciliation{}
+		}
+		out, err := json.MarshalIndent(results, "", "  ")
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(*report, out, 0644)
+	}
+	return nil
+}
+
+// Find the symbol with the provider and fetch its candles over the range.
+func fetchWindow(ctx context.Context, p scraper.Provider, sym store.Symbol, cr scraper.CandleRange) ([]store.Candle, error) {
+	id, err := p.SearchSymbol(ctx, sym)
+	if err != nil {
+		return nil, err
+	}
+	sym.SymbolID = id
+	return p.GetCandles(ctx, sym, cr)
+}
+
+// Compare the candles two providers returned for a symbol.
+func reconcileCandles(a, b []store.Candle, tolerance, volumeTolerance float64) Reconciliation {
+	type key struct {
+		interval string
+		start    int64
+	}
+	keyOf := func(c store.Candle) key {
+		switch c.Interval {
+		case "OneDay", "OneWeek", "OneMonth":
+			y, m, d := c.Start.Date()
+			return key{c.Interval, time.Date(y, m, d, 0, 0, 0, 0, time.UTC).Unix()}
+		}
+		return key{c.Interval, c.Start.Unix()}
+	}
+	inB := make(map[key]store.Candle, len(b))
+	for _, c := range b {
+		inB[keyOf(c)] = c
+	}
+
+	var r Reconciliation
+	for i := range a {
+		ca := a[i]
+		k := keyOf(ca)
+		cb, ok := inB[k]
+		if !ok {
+			r.OnlyA++
+			r.Changes = append(r.Changes, CandleDiff{Interval: ca.Interval, Start: ca.Start, A: &ca})
+			continue
+		}
+		delete(inB, k)
+		r.Compared++
+		dev := priceDeviation(ca, cb)
+		if dev > r.MaxDeviation {
+			r.MaxDeviation = dev
+		}
+		if dev > tolerance || (volumeTolerance >= 0 && relDiff(float64(ca.Volume), float64(cb.Volume)) > volumeTolerance) {
+			r.Differs++
+			r.Changes = append(r.Changes, CandleDiff{Interval: ca.Interval, Start: ca.Start, A: &ca, B: &cb})
+		}
+	}
+	for _, c := range b {
+		if _, ok := inB[keyOf(c)]; ok {
+			cb := c
+			r.OnlyB++
+			r.Changes = append(r.Changes, CandleDiff{Interval: cb.Interval, Start: cb.Start, B: &cb})
+		}
+	}
+	if total := r.Compared + r.OnlyA + r.OnlyB; total > 0 {
+		r.Divergence = float64(r.OnlyA+r.OnlyB+r.Differs) / float64(total)
+	}
+
+	sort.SliceStable(r.Changes, func(i, j int) bool {
+		return r.Changes[i].Start.Before(r.Changes[j].Start)
+	})
+	return r
+}
+
+// Largest relative difference between the prices of two candles.
+func priceDeviation(a, b store.Candle) float64 {
+	var dev float64
+	for _, p := range [][2]float32{{a.Open, b.Open}, {a.High, b.High}, {a.Low, b.Low}, {a.Close, b.Close}} {
+		if d := relDiff(float64(p[0]), float64(p[1])); d > dev {
+			dev = d
+		}
+	}
+	return dev
+}
+
+// Difference of y from x relative to x, 1 if only x is zero.
+func relDiff(x, y float64) float64 {
+	if x == y {
+		return 0
+	}
+	if x == 0 {
+		return 1
+	}
+	return math.Abs(x-y) / math.Abs(x)
+}
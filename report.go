@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/alexurquhart/sp500scraper/pkg/scraper"
+	"github.com/alexurquhart/sp500scraper/pkg/store"
+)
+
+// Contents of a run report
+type runSummaryReport struct {
+	Title     string
+	Generated time.Time
+	Interval  string
+	Summary   scraper.Summary
+	Failed    []store.Failure
+	Classes   []classCount
+	Issues    []store.IssueCount
+	Coverage  []store.Coverage
+}
+
+// Number of the failed symbols of a class
+type classCount struct {
+	Class   string
+	Symbols int
+}
+
+// Write a report of a finished run to path, summarizing the stored candles of
+// each symbol in the interval along with the failures and data quality
+// issues of the run. Paths ending in .html or .htm get an HTML report,
+// anything else Markdown. The report is replaced atomically, so a daemon can
+// rewrite it after every run.
+func writeReport(path string, st store.Store, sum scraper.Summary, interval string) error {
+	rep := runSummaryReport{
+		Title:     fmt.Sprintf("Run %d", sum.Run),
+		Generated: time.Now(),
+		Interval:  interval,
+		Summary:   sum,
+		Failed:    sum.NotFound,
+	}
+	if sum.Interrupted {
+		rep.Title += " (interrupted)"
+	}
+	// The dominant failure mode comes first
+	for _, c := range scraper.FailureClasses(sum.Failures) {
+		rep.Classes = append(rep.Classes, classCount{Class: c, Symbols: sum.Failures[c]})
+	}
+	var err error
+	if rep.Coverage, err = st.Coverage(interval); err != nil {
+		return err
+	}
+	if rep.Issues, err = st.RunIssues(sum.Run); err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".html", ".htm":
+		err = reportHTML.Execute(f, rep)
+	default:
+		err = writeMarkdownReport(f, rep)
+	}
+	if err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func writeMarkdownReport(w io.Writer, rep runSummaryReport) error {
+	sum := rep.Summary
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n", rep.Title)
+	fmt.Fprintf(&b, "Generated %s\n\n", rep.Generated.Format(time.RFC1123))
+	fmt.Fprintf(&b, "| Saved | Total | Failed | Delisted | Skipped | Candles | Duration |\n|---|---|---|---|---|---|---|\n")
+	fmt.Fprintf(&b, "| %d | %d | %d | %d | %d | %d | %s |\n\n", sum.Saved, sum.Total, len(sum.NotFound), len(sum.Delisted),
+		sum.Skipped, sum.Candles, sum.Duration.Round(time.Second))
+
+	fmt.Fprintf(&b, "## Failures\n\n")
+	if len(rep.Failed) == 0 {
+		b.WriteString("None\n\n")
+	} else {
+		b.WriteString("| Class | Symbols |\n|---|---|\n")
+		for _, c := range rep.Classes {
+			fmt.Fprintf(&b, "| %s | %d |\n", c.Class, c.Symbols)
+		}
+		b.WriteString("\n| Symbol | Exchange | Class | Reason |\n|---|---|---|---|\n")
+		for _, f := range rep.Failed {
+			fmt.Fprintf(&b, "| %s | %s | %s | %s |\n", f.Symbol, f.Exchange, f.Class, markdownCell(f.Reason))
+		}
+		b.WriteString("\n")
+	}
+
+	fmt.Fprintf(&b, "## Data Quality Issues\n\n")
+	if len(rep.Issues) == 0 {
+		b.WriteString("None\n\n")
+	} else {
+		b.WriteString("| Symbol | Problem | Candles |\n|---|---|---|\n")
+		for _, i := range rep.Issues {
+			fmt.Fprintf(&b, "| %s | %s | %d |\n", i.Symbol, markdownCell(i.Problem), i.Count)
+		}
+		b.WriteString("\n")
+	}
+
+	fmt.Fprintf(&b, "## Coverage (%s)\n\n", rep.Interval)
+	b.WriteString("| Symbol | Exchange | First | Last | Candles |\n|---|---|---|---|---|\n")
+	for _, c := range rep.Coverage {
+		fmt.Fprintf(&b, "| %s | %s | %s | %s | %d |\n", c.Symbol, c.Exchange, c.First.Format(scraper.DateFormat),
+			c.Last.Format(scraper.DateFormat), c.Candles)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// Escape the pipes of a table cell and keep it on one line
+func markdownCell(s string) string {
+	return strings.NewReplacer("|", `\|`, "\n", " ").Replace(s)
+}
+
+var reportHTML = template.Must(template.New("report").Funcs(template.FuncMap{
+	"date":     func(t time.Time) string { return t.Format(scraper.DateFormat) },
+	"duration": func(d time.Duration) string { return d.Round(time.Second).String() },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; margin-bottom: 1em; }
+th, td { border: 1px solid #ccc; padding: 2px 8px; text-align: left; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p>Generated {{.Generated.Format "Mon, 02 Jan 2006 15:04:05 MST"}}</p>
+<table>
+<tr><th>Saved</th><th>Total</th><th>Failed</th><th>Delisted</th><th>Skipped</th><th>Candles</th><th>Duration</th></tr>
+<tr><td>{{.Summary.Saved}}</td><td>{{.Summary.Total}}</td><td>{{len .Summary.NotFound}}</td><td>{{len .Summary.Delisted}}</td>
+<td>{{.Summary.Skipped}}</td><td>{{.Summary.Candles}}</td><td>{{duration .Summary.Duration}}</td></tr>
+</table>
+<h2>Failures</h2>
+{{if .Failed}}<table>
+<tr><th>Class</th><th>Symbols</th></tr>
+{{range .Classes}}<tr><td>{{.Class}}</td><td>{{.Symbols}}</td></tr>
+{{end}}</table>
+<table>
+<tr><th>Symbol</th><th>Exchange</th><th>Class</th><th>Reason</th></tr>
+{{range .Failed}}<tr><td>{{.Symbol}}</td><td>{{.Exchange}}</td><td>{{.Class}}</td><td>{{.Reason}}</td></tr>
+{{end}}</table>{{else}}<p>None</p>{{end}}
+<h2>Data Quality Issues</h2>
+{{if .Issues}}<table>
+<tr><th>Symbol</th><th>Problem</th><th>Candles</th></tr>
+{{range .Issues}}<tr><td>{{.Symbol}}</td><td>{{.Problem}}</td><td>{{.Count}}</td></tr>
+{{end}}</table>{{else}}<p>None</p>{{end}}
+<h2>Coverage ({{.Interval}})</h2>
+<table>
+<tr><th>Symbol</th><th>Exchange</th><th>First</th><th>Last</th><th>Candles</th></tr>
+{{range .Coverage}}<tr><td>{{.Symbol}}</td><td>{{.Exchange}}</td><td>{{date .First}}</td><td>{{date .Last}}</td><td>{{.Candles}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Suffix added to the name of a log file when it is rotated
+const rotatedFormat = "2006-01-02T15-04-05"
+
+// Log file that is rotated once it grows past maxSize bytes or has been
+// written to for maxAge, keeping the last backups rotated files next to it.
+// A limit of zero disables it.
+type rotatingFile struct {
+	mu      sync.Mutex
+	path    string
+	maxSize int64
+	maxAge  time.Duration
+	backups int
+
+	f      *os.File
+	size   int64
+	opened time.Time
+}
+
+// Open the log file at path, appending to it if it exists so history
+// survives restarts.
+func openRotatingFile(path string, maxSize int64, maxAge time.Duration, backups int) (*rotatingFile, error) {
+	r := &rotatingFile{path: path, maxSize: maxSize, maxAge: maxAge, backups: backups}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *rotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	// The age of a file carried over from an earlier run counts from now
+	r.f, r.size, r.opened = f, info.Size(), time.Now()
+	return nil
+}
+
+func (r *rotatingFile) Write(b []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.size > 0 && ((r.maxSize > 0 && r.size+int64(len(b)) > r.maxSize) || (r.maxAge > 0 && time.Since(r.opened) >= r.maxAge)) {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.f.Write(b)
+	r.size += int64(n)
+	return n, err
+}
+
+// Rename the current file with the time it was rotated, open a new one and
+// remove the oldest backups.
+func (r *rotatingFile) rotate() error {
+	if err := r.f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(r.path, r.path+"."+time.Now().Format(rotatedFormat)); err != nil {
+		return err
+	}
+	if err := r.open(); err != nil {
+		return err
+	}
+
+	if r.backups <= 0 {
+		return nil
+	}
+	old, err := filepath.Glob(r.path + ".*")
+	if err != nil {
+		return err
+	}
+	// The suffix sorts by time
+	var rotated []string
+	for _, p := range old {
+		if _, err := time.Parse(rotatedFormat, strings.TrimPrefix(p, r.path+".")); err == nil {
+			rotated = append(rotated, p)
+		}
+	}
+	sort.Strings(rotated)
+	for len(rotated) > r.backups {
+		os.Remove(rotated[0])
+		rotated = rotated[1:]
+	}
+	return nil
+}
+
+func (r *rotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.f.Close()
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is a parsed five field cron expression: minute, hour, day of
+// month, month and day of week. Fields accept *, lists, ranges and steps,
+// e.g. "0 18 * * 1-5" runs at 18:00 on weekdays.
+type Schedule struct {
+	minute, hour, dom, month, dow map[int]bool
+
+	// Restricted day fields are matched as either/or, as in cron
+	domStar, dowStar bool
+	loc              *time.Location
+}
+
+// Parse a cron expression evaluated in the given location.
+func ParseSchedule(spec string, loc *time.Location) (*Schedule, error) {
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, errors.New("Schedule must have 5 fields: " + spec)
+	}
+
+	s := &Schedule{loc: loc, domStar: fields[2] == "*", dowStar: fields[4] == "*"}
+	var err error
+	if s.minute, err = parseField(fields[0], 0, 59); err != nil {
+		return nil, err
+	}
+	if s.hour, err = parseField(fields[1], 0, 23); err != nil {
+		return nil, err
+	}
+	if s.dom, err = parseField(fields[2], 1, 31); err != nil {
+		return nil, err
+	}
+	if s.month, err = parseField(fields[3], 1, 12); err != nil {
+		return nil, err
+	}
+	if s.dow, err = parseField(fields[4], 0, 7); err != nil {
+		return nil, err
+	}
+	// Sunday can be written as 0 or 7
+	if s.dow[7] {
+		s.dow[0] = true
+	}
+	return s, nil
+}
+
+// Parse a comma separated list of values, ranges and steps.
+func parseField(field string, min, max int) (map[int]bool, error) {
+	values := make(map[int]bool)
+	invalid := errors.New("Invalid schedule field: " + field)
+
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n < 1 {
+				return nil, invalid
+			}
+			step = n
+			part = part[:i]
+		}
+
+		lo, hi := min, max
+		if part != "*" {
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+			if lo, err = strconv.Atoi(bounds[0]); err != nil {
+				return nil, invalid
+			}
+			hi = lo
+			if len(bounds) == 2 {
+				if hi, err = strconv.Atoi(bounds[1]); err != nil {
+					return nil, invalid
+				}
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return nil, invalid
+		}
+
+		for v := lo; v <= hi; v += step {
+			values[v] = true
+		}
+	}
+	return values, nil
+}
+
+// The first time after t matching the schedule, or the zero time if there
+// is none within the next few years. Days and hours that can't match are
+// skipped over whole.
+func (s *Schedule) Next(t time.Time) time.Time {
+	t = t.In(s.loc).Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case !s.month[int(t.Month())] || !s.matchesDay(t):
+			y, m, d := t.Date()
+			t = time.Date(y, m, d+1, 0, 0, 0, 0, s.loc)
+		case !s.hour[t.Hour()]:
+			y, m, d := t.Date()
+			t = time.Date(y, m, d, t.Hour()+1, 0, 0, 0, s.loc)
+		case !s.minute[t.Minute()]:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func (s *Schedule) matchesDay(t time.Time) bool {
+	dom, dow := s.dom[t.Day()], s.dow[int(t.Weekday())]
+	switch {
+	case s.domStar:
+		return dow
+	case s.dowStar:
+		return dom
+	}
+	return dom || dow
+}
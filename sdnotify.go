@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/alexurquhart/sp500scraper/pkg/store"
+)
+
+// Send a state change such as READY=1 to systemd when it started the
+// daemon as a Type=notify service, which sets NOTIFY_SOCKET. Does nothing
+// otherwise.
+func sdNotify(state string) {
+	addr := os.Getenv("NOTIFY_SOCKET")
+	if addr == "" {
+		return
+	}
+	if addr[0] == '@' {
+		// Abstract socket
+		addr = "\x00" + addr[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: addr, Net: "unixgram"})
+	if err != nil {
+		slog.Warn("Could not notify systemd", "state", state, "error", err)
+		return
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(state)); err != nil {
+		slog.Warn("Could not notify systemd", "state", state, "error", err)
+	}
+}
+
+// Interval systemd expects watchdog pings at, set with WatchdogSec in the
+// unit. Zero if the watchdog is off or meant for another process.
+func watchdogInterval() time.Duration {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond
+}
+
+// Ping the systemd watchdog at half its interval, as long as the database
+// can be reached, until the context is cancelled. When the pings stop
+// systemd restarts the daemon.
+func startWatchdog(ctx context.Context, st store.Store) {
+	interval := watchdogInterval()
+	if interval == 0 {
+		return
+	}
+	slog.Debug("Pinging the systemd watchdog", "interval", interval/2)
+	go func() {
+		ticker := time.NewTicker(interval / 2)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := st.Ping(); err != nil {
+					slog.Warn("Database unreachable, not pinging the watchdog", "error", err)
+					continue
+				}
+				sdNotify("WATCHDOG=1")
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/alexurquhart/sp500scraper/pkg/api/sp500pb"
+	"github.com/alexurquhart/sp500scraper/pkg/scraper"
+	"github.com/alexurquhart/sp500scraper/pkg/store"
+	"google.golang.org/grpc"
+)
+
+// Serve the stored data as JSON over HTTP, and over gRPC with the Candles
+// service of pkg/api/sp500pb if -grpc-addr is set.
+//
+//	GET /symbols
+//	GET /latest?symbols=AAPL,MSFT
+//	GET /candles/{symbol}?start=YYYY-MM-DD&end=YYYY-MM-DD&interval=OneWeek&exchange=NYSE
+//
+// The range defaults to all stored candles. Without an interval the daily
+// candles are returned, or the closest finer ones if there are none. Intervals
+// that aren't stored are resampled from the coarsest finer one that is.
+func runServe(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	driver := fs.String("db-driver", "sqlite3", "Database driver to read from, sqlite3, postgres, mysql or duckdb")
+	dsn := fs.String("dsn", "sp500.db", "Data source name of the database, a file path for sqlite3 and duckdb")
+	fs.StringVar(dsn, "db", "sp500.db", "Database file, the same as -dsn")
+	schema := fs.String("schema", "", "Schema file to create the database with instead of the built in SQLite migrations or PostgreSQL schema")
+	addr := fs.String("addr", ":8080", "Address to serve the JSON API on, empty to disable")
+	grpcAddr := fs.String("grpc-addr", "", "Address to serve the gRPC API on, empty to disable")
+	cacheTTL := fs.Duration("cache-ttl", time.Minute, "How long to cache the results of reads, 0 to disable the cache")
+	cacheSize := fs.Int("cache-size", 1000000, "Most candles to cache, 0 for no limit")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	var st store.Store
+	st, err := store.New(*driver, *dsn, *schema, 0)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+	if *cacheTTL > 0 {
+		st = store.NewCachedStore(st, *cacheTTL, *cacheSize)
+	}
+
+	if *addr == "" && *grpcAddr == "" {
+		return errors.New("Nothing to serve, set -addr or -grpc-addr")
+	}
+	errChan := make(chan error, 2)
+	if *grpcAddr != "" {
+		lis, err := net.Listen("tcp", *grpcAddr)
+		if err != nil {
+			return err
+		}
+		srv := grpc.NewServer()
+		sp500pb.RegisterCandlesServer(srv, &grpcServer{st: st})
+		slog.Info("Serving gRPC API", "addr", *grpcAddr)
+		go func() { errChan <- srv.Serve(lis) }()
+	}
+	if *addr != "" {
+		slog.Info("Serving API", "addr", *addr)
+		go func() { errChan <- http.ListenAndServe(*addr, newAPI(st)) }()
+	}
+	return <-errChan
+}
+
+// Candles for a symbol returned by /candles
+type candlesResponse struct {
+	Symbol   string         `json:"symbol"`
+	Exchange string         `json:"exchange"`
+	Interval string         `json:"interval,omitempty"`
+	Candles  []store.Candle `json:"candles"`
+}
+
+// Build the HTTP handler for the API.
+func newAPI(st store.Store) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /symbols", func(w http.ResponseWriter, r *http.Request) {
+		symbols, err := st.Symbols()
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, symbols)
+	})
+
+	mux.HandleFunc("GET /latest", func(w http.ResponseWriter, r *http.Request) {
+		closes, err := st.LatestCloses()
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		closes = filterLatest(closes, r.URL.Query().Get("symbols"))
+		if closes == nil {
+			closes = []store.LatestClose{}
+		}
+		writeJSON(w, http.StatusOK, closes)
+	})
+
+	mux.HandleFunc("GET /candles/{symbol}", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		start, end, err := parseQueryRange(q.Get("start"), q.Get("end"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		interval := q.Get("interval")
+		if interval != "" && !scraper.ValidInterval(interval) {
+			writeError(w, http.StatusBadRequest, errors.New("Invalid interval: "+interval))
+			return
+		}
+
+		sym, err := lookupSymbol(st, r.PathValue("symbol"), q.Get("exchange"))
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		} else if sym == nil {
+			writeError(w, http.StatusNotFound, errors.New("Symbol not found: "+r.PathValue("symbol")))
+			return
+		}
+
+		candles, interval, err := intervalCandles(st, sym.SymbolID, interval, start, end)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		if candles == nil {
+			candles = []store.Candle{}
+		}
+
+		writeJSON(w, http.StatusOK, candlesResponse{
+			Symbol:   sym.Symbol,
+			Exchange: sym.Exchange,
+			Interval: interval,
+			Candles:  candles,
+		})
+	})
+
+	return mux
+}
+
+// Candles of a symbol over the range at the interval, the daily one or the
+// closest finer one if empty. Intervals that aren't stored are resampled from
+// the coarsest finer one that is. Returns the interval of the candles.
+func intervalCandles(st store.Store, id int, interval string, start, end time.Time) ([]store.Candle, string, error) {
+	intervals, err := st.Intervals()
+	if err != nil {
+		return nil, interval, err
+	}
+	if interval == "" {
+		interval = scraper.SourceInterval(intervals, "OneDay")
+	}
+	source := scraper.SourceInterval(intervals, interval)
+
+	candles, err := st.Candles(id, source, start, end)
+	if err != nil {
+		return nil, interval, err
+	}
+	if source != interval {
+		candles = scraper.Resample(candles, interval)
+	}
+	return candles, interval, nil
+}
+
+// End of ranges left open, a year from today. It only changes daily so cached
+// reads of open ranges can be reused.
+func openEnd() time.Time {
+	y, m, d := time.Now().Date()
+	return time.Date(y+1, m, d, 0, 0, 0, 0, time.Local)
+}
+
+// Parse the optional start and end query parameters. Missing dates leave
+// that end of the range open.
+func parseQueryRange(start, end string) (time.Time, time.Time, error) {
+	s, e := time.Time{}, openEnd()
+	var err error
+	if start != "" {
+		if s, err = time.ParseInLocation(scraper.DateFormat, start, time.Local); err != nil {
+			return s, e, errors.New("Invalid start date: " + start)
+		}
+	}
+	if end != "" {
+		if e, err = time.ParseInLocation(scraper.DateFormat, end, time.Local); err != nil {
+			return s, e, errors.New("Invalid end date: " + end)
+		}
+	}
+	return s, e, nil
+}
+
+// Find a stored symbol by ticker, and exchange if given. Returns nil if
+// there is no match.
+func lookupSymbol(st store.Store, symbol, exchange string) (*store.Symbol, error) {
+	symbols, err := st.Symbols()
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range symbols {
+		if strings.EqualFold(s.Symbol, symbol) && (exchange == "" || strings.EqualFold(s.Exchange, exchange)) {
+			return &s, nil
+		}
+	}
+	return nil, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("Could not write response", "error", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
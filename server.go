@@ -0,0 +1,35 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"log/slog"
+)
+
+// Flags choosing the Questrade server, shared by the commands that log in
+type serverFlags struct {
+	live, practice, confirm *bool
+}
+
+func addServerFlags(fs *flag.FlagSet) serverFlags {
+	return serverFlags{
+		live:     fs.Bool("live", false, "Log in to the Questrade live server, needs -confirm-live"),
+		practice: fs.Bool("practice", false, "Log in to the Questrade practice server, the default"),
+		confirm:  fs.Bool("confirm-live", false, "Confirm that -live should use the live server and its real accounts"),
+	}
+}
+
+// Whether the live server was chosen. The practice server is the default,
+// and the live one is refused unless confirmed, so a config file or a stray
+// flag can't point a run at real accounts by accident.
+func (f serverFlags) isLive() (bool, error) {
+	switch {
+	case *f.live && *f.practice:
+		return false, errors.New("Only one of -live and -practice can be given")
+	case *f.live && !*f.confirm:
+		return false, errors.New("The live server needs -confirm-live as well as -live")
+	case *f.live:
+		slog.Warn("Using the Questrade live server")
+	}
+	return *f.live, nil
+}
@@ -0,0 +1,8 @@
+//go:build !windows
+
+package main
+
+// Windows services only exist on Windows.
+func startService(name string, stop func()) (func(), error) {
+	return func() {}, nil
+}
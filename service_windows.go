@@ -0,0 +1,62 @@
+//go:build windows
+
+package main
+
+import (
+	"log/slog"
+
+	"golang.org/x/sys/windows/svc"
+)
+
+// Handles the requests of the Windows service control manager, stopping the
+// daemon when the service is stopped or the machine shuts down
+type serviceHandler struct {
+	stop func()
+	done chan struct{} // Closed once the daemon has returned
+}
+
+func (h *serviceHandler) Execute(args []string, req <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	status <- svc.Status{State: svc.StartPending}
+	status <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+	for {
+		select {
+		case c := <-req:
+			switch c.Cmd {
+			case svc.Interrogate:
+				status <- c.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				status <- svc.Status{State: svc.StopPending}
+				h.stop()
+				<-h.done
+				return false, 0
+			}
+		case <-h.done:
+			// The daemon stopped by itself, which the service manager can
+			// act on with its recovery settings
+			return false, 1
+		}
+	}
+}
+
+// Report to the service control manager under name when the program was
+// started as a Windows service, calling stop when the service is stopped.
+// The returned function tells it the daemon has finished.
+func startService(name string, stop func()) (func(), error) {
+	isService, err := svc.IsWindowsService()
+	if err != nil || !isService {
+		return func() {}, err
+	}
+	h := &serviceHandler{stop: stop, done: make(chan struct{})}
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		if err := svc.Run(name, h); err != nil {
+			slog.Error("Windows service failed", "service", name, "error", err)
+		}
+	}()
+	slog.Info("Running as a Windows service", "service", name)
+	return func() {
+		close(h.done)
+		<-exited
+	}, nil
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"io/ioutil"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/alexurquhart/sp500scraper/pkg/store"
+)
+
+// Candle a run after the snapshot replaced with different values, as
+// written to the restatements report
+type restatementReport struct {
+	Symbol   string       `json:"symbol"`
+	Exchange string       `json:"exchange"`
+	Interval string       `json:"interval"`
+	Start    time.Time    `json:"start"`
+	Old      store.Candle `json:"old"`
+	OldRun   int          `json:"old_run"`
+	New      store.Candle `json:"new"`
+	Run      int          `json:"run"`
+}
+
+// Tag the state of the candles after a run, list the tags, or report the
+// candles later runs restated.
+//
+// Every run is a snapshot: candles a run replaces with different values
+// are kept as they were, so the candles can be read as of any run by its
+// ID, or by a name given to it with -tag. Export reads them with -as-of.
+func runSnapshot(args []string) error {
+	fs := flag.NewFlagSet("snapshot", flag.ExitOnError)
+	driver := fs.String("db-driver", "sqlite3", "Database driver, sqlite3, postgres, mysql or duckdb")
+	dsn := fs.String("dsn", "sp500.db", "Data source name of the database, a file path for sqlite3 and duckdb")
+	fs.StringVar(dsn, "db", "sp500.db", "Database file, the same as -dsn")
+	schema := fs.String("schema", "", "Schema file to create the database with instead of the built in SQLite migrations or PostgreSQL schema")
+	tag := fs.String("tag", "", "Name to give the state of the candles after -run")
+	run := fs.Int("run", 0, "Run to tag, the latest finished run if 0")
+	list := fs.Bool("list", false, "List the tagged snapshots")
+	since := fs.String("restatements", "", "Report the candles restated by runs after this snapshot, a tag or run ID")
+	report := fs.String("report", "", "JSON file to write the restatements to")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *tag == "" && !*list && *since == "" {
+		return errors.New("Nothing to do, set -tag, -list or -restatements")
+	}
+
+	st, err := store.New(*driver, *dsn, *schema, 0)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+
+	if *tag != "" {
+		if _, err := strconv.Atoi(*tag); err == nil {
+			return errors.New("Snapshot tags can't be numbers, which are taken as run IDs")
+		}
+		if *run == 0 {
+			if *run, err = st.LatestRun(); err != nil {
+				return err
+			}
+			if *run == 0 {
+				return errors.New("No finished run to tag")
+			}
+		}
+		if err := st.TagSnapshot(*tag, *run); err != nil {
+			return err
+		}
+		slog.Info("Tagged snapshot", "tag", *tag, "run", *run)
+	}
+
+	if *list {
+		snapshots, err := st.Snapshots()
+		if err != nil {
+			return err
+		}
+		for _, s := range snapshots {
+			slog.Info("Snapshot", "tag", s.Name, "run", s.Run, "created", s.Created)
+		}
+	}
+
+	if *since != "" {
+		from, err := resolveSnapshot(st, *since)
+		if err != nil {
+			return err
+		}
+		restated, err := st.Restatements(from)
+		if err != nil {
+			return err
+		}
+		out := make([]restatementReport, len(restated))
+		for i, r := range restated {
+			slog.Info("Candle restated", "symbol", r.Symbol, "exchange", r.Exchange, "interval", r.Old.Interval, "start", r.Old.Start,
+				"run", r.Run, "old", candleText(&r.Old), "new", candleText(&r.New))
+			out[i] = restatementReport{Symbol: r.Symbol, Exchange: r.Exchange, Interval: r.Old.Interval, Start: r.Old.Start,
+				Old: r.Old, OldRun: r.OldRun, New: r.New, Run: r.Run}
+		}
+		slog.Info("Found restatements", "since", *since, "run", from, "candles", len(restated))
+		if *report != "" {
+			b, err := json.MarshalIndent(out, "", "  ")
+			if err != nil {
+				return err
+			}
+			return ioutil.WriteFile(*report, b, 0644)
+		}
+	}
+	return nil
+}
+
+// Run ID of a snapshot given by tag or run ID.
+func resolveSnapshot(st store.Store, ref string) (int, error) {
+	if id, err := strconv.Atoi(ref); err == nil {
+		return id, nil
+	}
+	snapshots, err := st.Snapshots()
+	if err != nil {
+		return 0, err
+	}
+	for _, s := range snapshots {
+		if s.Name == ref {
+			return s.Run, nil
+		}
+	}
+	return 0, errors.New("Unknown snapshot " + ref)
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/alexurquhart/sp500scraper/pkg/calendar"
+	"github.com/alexurquhart/sp500scraper/pkg/scraper"
+	"github.com/alexurquhart/sp500scraper/pkg/store"
+)
+
+// State of the daemon, reported by the status endpoints
+type daemonStatus struct {
+	mu          sync.Mutex
+	started     time.Time
+	running     bool
+	nextRun     time.Time
+	lastRun     time.Time
+	lastSuccess time.Time
+	lastError   string
+	lastSummary *scraper.Summary
+	behind      []string
+}
+
+// Body of a /status response
+type statusReport struct {
+	Started     time.Time                           `json:"started"`
+	Running     bool                                `json:"running"`
+	NextRun     *time.Time                          `json:"next_run,omitempty"`
+	LastRun     *time.Time                          `json:"last_run,omitempty"`
+	LastSuccess *time.Time                          `json:"last_success,omitempty"`
+	LastError   string                              `json:"last_error,omitempty"`
+	LastSummary *runReport                          `json:"last_summary,omitempty"`
+	Behind      []string                            `json:"behind"`
+	RateLimits  []map[string]scraper.RateLimitState `json:"rate_limits,omitempty"`
+	Database    string                              `json:"database"`
+}
+
+// Outcome of the last successful run
+type runReport struct {
+	Run         int    `json:"run"`
+	Total       int    `json:"total"`
+	Saved       int    `json:"saved"`
+	Failed      int    `json:"failed"`
+	Candles     int    `json:"candles"`
+	Duration    string `json:"duration"`
+	Interrupted bool   `json:"interrupted"`
+}
+
+func newDaemonStatus() *daemonStatus {
+	return &daemonStatus{started: time.Now()}
+}
+
+func (ds *daemonStatus) scheduled(next time.Time) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	ds.nextRun = next
+}
+
+func (ds *daemonStatus) runStarted() {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	ds.running = true
+	ds.lastRun = time.Now()
+}
+
+func (ds *daemonStatus) runFailed(err error) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	ds.running = false
+	ds.lastError = err.Error()
+}
+
+func (ds *daemonStatus) runFinished(sum scraper.Summary, behind []string) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	ds.running = false
+	ds.lastSuccess = time.Now()
+	ds.lastError = ""
+	ds.lastSummary = &sum
+	ds.behind = behind
+}
+
+// Symbols whose latest candle of the interval ended before the start of the
+// last trading day before now, so are more than a day behind. Without a
+// calendar every weekday is a trading day.
+func behindSchedule(st store.Store, symbols []store.Symbol, interval string, cal *calendar.Calendar, now time.Time) ([]string, error) {
+	latest, err := st.LatestCandles(interval)
+	if err != nil {
+		return nil, err
+	}
+
+	var due time.Time
+	if cal != nil {
+		due = cal.Previous(now)
+	} else {
+		y, m, d := now.Date()
+		due = time.Date(y, m, d-1, 0, 0, 0, 0, now.Location())
+		for due.Weekday() == time.Saturday || due.Weekday() == time.Sunday {
+			due = due.AddDate(0, 0, -1)
+		}
+	}
+
+	behind := []string{}
+	for _, sym := range symbols {
+		if end, ok := latest[sym.Key()]; !ok || end.Before(due) {
+			behind = append(behind, sym.Symbol)
+		}
+	}
+	sort.Strings(behind)
+	return behind, nil
+}
+
+// Serve the daemon's health at /healthz and its status at /status on addr in
+// the background. /healthz responds 503 when the database can't be reached
+// or the last run failed, so orchestrators can restart the daemon.
+func serveStatus(addr string, ds *daemonStatus, st store.Store, p scraper.Provider) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		body := map[string]string{"status": "ok"}
+		code := http.StatusOK
+		if err := st.Ping(); err != nil {
+			body = map[string]string{"status": "error", "error": "Database unreachable: " + err.Error()}
+			code = http.StatusServiceUnavailable
+		} else {
+			ds.mu.Lock()
+			if ds.lastError != "" {
+				body = map[string]string{"status": "error", "error": ds.lastError}
+				code = http.StatusServiceUnavailable
+			}
+			ds.mu.Unlock()
+		}
+		writeJSON(w, code, body)
+	})
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		ds.mu.Lock()
+		rep := statusReport{
+			Started:     ds.started,
+			Running:     ds.running,
+			NextRun:     optionalTime(ds.nextRun),
+			LastRun:     optionalTime(ds.lastRun),
+			LastSuccess: optionalTime(ds.lastSuccess),
+			LastError:   ds.lastError,
+			Behind:      ds.behind,
+			Database:    "ok",
+		}
+		if sum := ds.lastSummary; sum != nil {
+			rep.LastSummary = &runReport{Run: sum.Run, Total: sum.Total, Saved: sum.Saved, Failed: len(sum.NotFound),
+				Candles: sum.Candles, Duration: sum.Duration.String(), Interrupted: sum.Interrupted}
+		}
+		ds.mu.Unlock()
+
+		if rep.Behind == nil {
+			rep.Behind = []string{}
+		}
+		if rl, ok := p.(scraper.RateLimitReporter); ok {
+			rep.RateLimits = rl.RateLimits()
+		}
+		if err := st.Ping(); err != nil {
+			rep.Database = err.Error()
+		}
+		writeJSON(w, http.StatusOK, rep)
+	})
+
+	go func() {
+		slog.Info("Serving status", "addr", addr)
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			slog.Error("Status server stopped", "error", err)
+		}
+	}()
+}
+
+// Nil for the zero time, so it is left out of the JSON
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/alexurquhart/qapi"
+	"github.com/alexurquhart/sp500scraper/pkg/scraper"
+	"github.com/alexurquhart/sp500scraper/pkg/store"
+	"github.com/gorilla/websocket"
+)
+
+// Symbols subscribed to per stream connection, keeping the request for the
+// stream port short
+const maxStreamSymbols = 100
+
+// Quote as sent over the stream
+type streamQuote struct {
+	SymbolID       int     `json:"symbolId"`
+	BidPrice       float32 `json:"bidPrice"`
+	BidSize        int     `json:"bidSize"`
+	AskPrice       float32 `json:"askPrice"`
+	AskSize        int     `json:"askSize"`
+	LastTradePrice float32 `json:"lastTradePrice"`
+	LastTradeSize  int     `json:"lastTradeSize"`
+	LastTradeTime  string  `json:"lastTradeTime"`
+	Volume         int     `json:"volume"`
+}
+
+// Convert a quote to a tick, stamped with the last trade time if there is
+// one or the time it was received.
+func (q streamQuote) tick(received time.Time) store.Tick {
+	t := received
+	if lt, err := time.Parse(time.RFC3339Nano, q.LastTradeTime); err == nil {
+		t = lt
+	}
+	return store.Tick{
+		SymbolID: q.SymbolID,
+		Time:     t,
+		Bid:      q.BidPrice,
+		BidSize:  q.BidSize,
+		Ask:      q.AskPrice,
+		AskSize:  q.AskSize,
+		Last:     q.LastTradePrice,
+		LastSize: q.LastTradeSize,
+		Volume:   q.Volume,
+	}
+}
+
+// Record Level 1 quotes of the stored symbols in real time.
+//
+// Questrade streams quotes over a WebSocket on a port handed out by the
+// quotes endpoint. Symbols are split across connections of up to
+// maxStreamSymbols, and dropped connections are reopened, logging in again
+// once the session has expired. Ticks are written to the quotes table in
+// batches.
+func runStream(args []string) error {
+	fs := flag.NewFlagSet("stream", flag.ExitOnError)
+	driver := fs.String("db-driver", "sqlite3", "Database driver to store quotes with, sqlite3, postgres, mysql or duckdb")
+	dsn := fs.String("dsn", "sp500.db", "Data source name of the database, a file path for sqlite3 and duckdb")
+	fs.StringVar(dsn, "db", "sp500.db", "Database file, the same as -dsn")
+	schema := fs.String("schema", "", "Schema file to create the database with instead of the built in SQLite migrations or PostgreSQL schema")
+	credentials := fs.String("credentials", "credentials.json", "File the refresh token is saved to between runs, or keyring to keep it in the OS keyring")
+	server := addServerFlags(fs)
+	flush := fs.Duration("flush-interval", time.Second, "How often received quotes are written to the database")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	live, err := server.isLive()
+	if err != nil {
+		return err
+	}
+
+	st, err := store.New(*driver, *dsn, *schema, 0)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+
+	symbols, err := st.Symbols()
+	if err != nil {
+		return err
+	}
+
+	// Only listed symbols with a Questrade ID can be streamed
+	delisted, err := st.Delisted()
+	if err != nil {
+		return err
+	}
+	var listed []store.Symbol
+	for _, sym := range symbols {
+		if _, ok := delisted[sym.Key()]; sym.SymbolID > 0 && !ok {
+			listed = append(listed, sym)
+		}
+	}
+	symbols = listed
+	if len(symbols) == 0 {
+		return errors.New("No stored symbols to stream, run a scrape first")
+	}
+
+	client, err := scraper.NewClient(*credentials, "REFRESH_TOKEN", live)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	ticks := make(chan store.Tick, 1000)
+	done := make(chan bool)
+	go func() {
+		writeTicks(st, ticks, *flush)
+		close(done)
+	}()
+
+	s := &streamer{client: client, credentials: *credentials, live: live, ticks: ticks}
+	var ids []int
+	for i, sym := range symbols {
+		ids = append(ids, sym.SymbolID)
+		if len(ids) == maxStreamSymbols || i == len(symbols)-1 {
+			s.sessions.Add(1)
+			go s.run(ctx, ids)
+			ids = nil
+		}
+	}
+	slog.Info("Streaming quotes", "symbols", len(symbols))
+
+	s.sessions.Wait()
+	close(ticks)
+	<-done
+	slog.Info("Stream stopped")
+	return nil
+}
+
+// Connections to the quote stream sharing one session
+type streamer struct {
+	client      *qapi.Client
+	credentials string
+	live        bool
+	ticks       chan<- store.Tick
+
+	// Guards logging in again
+	mu       sync.Mutex
+	sessions sync.WaitGroup
+}
+
+// Access token and API server of the session, logging in again first if it
+// has expired.
+func (s *streamer) session() (string, string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	select {
+	case <-s.client.SessionTimer.C:
+		if err := scraper.Relogin(s.client, s.credentials, s.live); err != nil {
+			return "", "", err
+		}
+	default:
+	}
+	return s.client.Credentials.AccessToken, s.client.Credentials.ApiServer, nil
+}
+
+// Keep a stream of the symbols open until the context is cancelled,
+// reconnecting with backoff when it drops.
+func (s *streamer) run(ctx context.Context, ids []int) {
+	defer s.sessions.Done()
+	rp := scraper.RetryPolicy{BaseDelay: time.Second, MaxDelay: time.Minute}
+	for attempt := 1; ; attempt++ {
+		began := time.Now()
+		err := s.stream(ctx, ids)
+		if ctx.Err() != nil {
+			return
+		}
+		// A stream that stayed up for a while starts backing off afresh
+		if time.Since(began) > time.Minute {
+			attempt = 1
+		}
+		delay := rp.Backoff(attempt)
+		slog.Warn("Quote stream dropped, reconnecting", "symbols", len(ids), "delay", delay, "error", err)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Open a stream of the symbols and send the ticks received until it drops.
+func (s *streamer) stream(ctx context.Context, ids []int) error {
+	token, server, err := s.session()
+	if err != nil {
+		return err
+	}
+	port, err := streamPort(server, token, ids)
+	if err != nil {
+		return err
+	}
+	u, err := url.Parse(server)
+	if err != nil {
+		return err
+	}
+
+	conn, _, err := websocket.DefaultDialer.Dial("wss://"+u.Hostname()+":"+strconv.Itoa(port), nil)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	stop := make(chan bool)
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-stop:
+		}
+	}()
+
+	// The stream is authenticated by sending the access token
+	if err := conn.WriteMessage(websocket.TextMessage, []byte(token)); err != nil {
+		return err
+	}
+	for {
+		// Heartbeats are sent while no quotes change, so a silent stream
+		// is dead
+		conn.SetReadDeadline(time.Now().Add(5 * time.Minute))
+		_, msg, err := conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+		var m struct {
+			Quotes []streamQuote `json:"quotes"`
+		}
+		if err := json.Unmarshal(msg, &m); err != nil {
+			slog.Debug("Unexpected stream message", "message", string(msg))
+			continue
+		}
+		now := time.Now()
+		for _, q := range m.Quotes {
+			s.ticks <- q.tick(now)
+		}
+	}
+}
+
+// Ask the quotes endpoint for the port streaming the symbols.
+func streamPort(server, token string, ids []int) (int, error) {
+	var list []string
+	for _, id := range ids {
+		list = append(list, strconv.Itoa(id))
+	}
+	u := strings.TrimSuffix(server, "/") + "/v1/markets/quotes?ids=" + strings.Join(list, ",") + "&stream=true&mode=WebSocket"
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return 0, qapi.QuestradeError{StatusCode: res.StatusCode, Message: "Could not open quote stream: " + res.Status}
+	}
+
+	var body struct {
+		StreamPort int `json:"streamPort"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		return 0, err
+	}
+	return body.StreamPort, nil
+}
+
+// Save ticks in batches every interval until the channel is closed.
+func writeTicks(st store.Store, ticks <-chan store.Tick, interval time.Duration) {
+	var batch []store.Tick
+	save := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := st.SaveTicks(batch); err != nil {
+			scraper.DBErrors.Inc()
+			slog.Error("DB error", "error", err)
+		}
+		batch = batch[:0]
+	}
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case tick, ok := <-ticks:
+			if !ok {
+				save()
+				return
+			}
+			batch = append(batch, tick)
+		case <-t.C:
+			save()
+		}
+	}
+}
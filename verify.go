@@ -0,0 +1,249 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"io/ioutil"
+	"log/slog"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/alexurquhart/sp500scraper/pkg/calendar"
+	"github.com/alexurquhart/sp500scraper/pkg/scraper"
+	"github.com/alexurquhart/sp500scraper/pkg/store"
+)
+
+// Trading days missing from the stored candles of a symbol, from the start of
+// the first missing day up to the start of the next day with candles
+type Gap struct {
+	Symbol   string    `json:"symbol"`
+	Exchange string    `json:"exchange"`
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+	Days     int       `json:"days"`
+}
+
+// Check the stored candles for missing trading days and optionally fetch
+// the missing windows.
+//
+// Trading days are the days the exchange of -calendar was open. With
+// -calendar none every weekday is a trading day, except weekdays without
+// candles for any symbol which are taken to be market holidays, so gaps are
+// only found in databases of more than one symbol. Only days between a
+// symbol's first and last candle are checked, -update fills in days after
+// the last one.
+func runVerify(args []string) error {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	driver := fs.String("db-driver", "sqlite3", "Database driver to read from, sqlite3, postgres, mysql or duckdb")
+	dsn := fs.String("dsn", "sp500.db", "Data source name of the database, a file path for sqlite3 and duckdb")
+	fs.StringVar(dsn, "db", "sp500.db", "Database file, the same as -dsn")
+	schema := fs.String("schema", "", "Schema file to create the database with instead of the built in SQLite migrations or PostgreSQL schema")
+	start := fs.String("start", "", "Only check days from this date (YYYY-MM-DD)")
+	end := fs.String("end", "", "Only check days before this date (YYYY-MM-DD)")
+	timezone := fs.String("timezone", "America/New_York", "Time zone of the exchange's trading days")
+	calendarName := fs.String("calendar", "NYSE", "Exchange whose trading days are checked, none to take weekdays without any candles as holidays")
+	report := fs.String("report", "", "JSON file to write the gaps found to")
+	fix := fs.Bool("fix", false, "Fetch the candles of the missing windows")
+	interval := fs.String("interval", "OneDay", "Interval of the candles fetched with -fix")
+	provider := fs.String("provider", "questrade", "Source of the candles fetched with -fix, questrade or yahoo")
+	credentials := fs.String("credentials", "credentials.json", "File the refresh token is saved to between runs, or keyring to keep it in the OS keyring")
+	server := addServerFlags(fs)
+	profiles := fs.String("profiles", "", "Comma separated Questrade credential profiles to spread requests across")
+	rateLimit := fs.Float64("rate-limit", 5, "Maximum number of API calls per second")
+	retries := fs.Int("retries", 3, "Maximum number of attempts for each API call")
+	retryDelay := fs.Duration("retry-delay", time.Second, "Initial delay between retries, doubled after each attempt")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	live, err := server.isLive()
+	if err != nil {
+		return err
+	}
+
+	loc, err := time.LoadLocation(*timezone)
+	if err != nil {
+		return err
+	}
+	var cal *calendar.Calendar
+	if *calendarName != "none" {
+		if cal, err = calendar.Find(*calendarName); err != nil {
+			return err
+		}
+	}
+	cr := scraper.CandleRange{Start: time.Time{}, End: time.Now().AddDate(1, 0, 0), Interval: *interval}
+	if *start != "" || *end != "" {
+		if cr, err = scraper.ParseRange(*start, *end, *interval); err != nil {
+			return err
+		}
+	} else if !scraper.ValidInterval(*interval) {
+		return errors.New("Invalid interval: " + *interval)
+	}
+
+	st, err := store.New(*driver, *dsn, *schema, 0)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+	if cal != nil {
+		// Only the stored holidays, the scrape keeps them up to date
+		if err := loadHolidays(st, cal, "", 0); err != nil {
+			return err
+		}
+	}
+
+	gaps, expected, err := findGaps(st, cr, loc, cal)
+	if err != nil {
+		return err
+	}
+	for _, g := range gaps {
+		slog.Info("Missing candles", "symbol", g.Symbol, "exchange", g.Exchange, "start", g.Start.Format(scraper.DateFormat), "end", g.End.Format(scraper.DateFormat), "days", g.Days)
+	}
+	missing := 0
+	for _, g := range gaps {
+		missing += g.Days
+	}
+	slog.Info("Verified candles", "gaps", len(gaps), "expected", expected, "missing", missing)
+	if *report != "" {
+		if gaps == nil {
+			gaps = []Gap{}
+		}
+		out, err := json.MarshalIndent(gaps, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(*report, out, 0644); err != nil {
+			return err
+		}
+	}
+	if !*fix || len(gaps) == 0 {
+		return nil
+	}
+
+	p, err := scraper.NewProvider(*provider, scraper.ProviderConfig{
+		Credentials: *credentials,
+		Live:        live,
+		Profiles:    splitList(*profiles),
+		RateLimit:   *rateLimit,
+		Retry:       scraper.RetryPolicy{MaxAttempts: *retries, BaseDelay: *retryDelay, MaxDelay: time.Minute},
+	})
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+	return fillGaps(ctx, p, st, gaps, *interval)
+}
+
+// Find the gaps in the candles of every stored symbol within the range, and
+// the number of trading days checked across all symbols. Without a calendar
+// weekdays with candles of any symbol are the trading days.
+func findGaps(st store.Store, cr scraper.CandleRange, loc *time.Location, cal *calendar.Calendar) ([]Gap, int, error) {
+	symbols, err := st.Symbols()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// Days with candles for each symbol, and for any symbol
+	days := make(map[int]map[time.Time]bool)
+	open := make(map[time.Time]bool)
+	for _, sym := range symbols {
+		candles, err := st.Candles(sym.SymbolID, cr.Interval, cr.Start, cr.End)
+		if err != nil {
+			return nil, 0, err
+		}
+		days[sym.SymbolID] = make(map[time.Time]bool)
+		for _, c := range candles {
+			d := scraper.BucketStart(c.Start.In(loc), "OneDay")
+			days[sym.SymbolID][d] = true
+			open[d] = true
+		}
+	}
+
+	trading := func(d time.Time) bool {
+		if cal != nil {
+			return cal.IsTradingDay(d)
+		}
+		return open[d] && d.Weekday() != time.Saturday && d.Weekday() != time.Sunday
+	}
+
+	var gaps []Gap
+	expected := 0
+	for _, sym := range symbols {
+		var first, last time.Time
+		for d := range days[sym.SymbolID] {
+			if first.IsZero() || d.Before(first) {
+				first = d
+			}
+			if d.After(last) {
+				last = d
+			}
+		}
+
+		var gap *Gap
+		for d := first; d.Before(last); d = d.AddDate(0, 0, 1) {
+			if days[sym.SymbolID][d] {
+				expected++
+				if gap != nil {
+					gap.End = d
+					gaps = append(gaps, *gap)
+					gap = nil
+				}
+				continue
+			}
+			if !trading(d) {
+				continue
+			}
+			expected++
+			if gap == nil {
+				gap = &Gap{Symbol: sym.Symbol, Exchange: sym.Exchange, Start: d}
+			}
+			gap.Days++
+		}
+		if gap != nil {
+			gap.End = last
+			gaps = append(gaps, *gap)
+		}
+	}
+	return gaps, expected, nil
+}
+
+// Fetch and save the candles missing from the gaps.
+func fillGaps(ctx context.Context, p scraper.Provider, st store.Store, gaps []Gap, interval string) error {
+	symbols, err := st.Symbols()
+	if err != nil {
+		return err
+	}
+	byKey := make(map[string]store.Symbol)
+	for _, s := range symbols {
+		byKey[s.Key()] = s
+	}
+
+	filled := 0
+	for _, g := range gaps {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		sym := byKey[g.Symbol+":"+g.Exchange]
+		candles, err := p.GetCandles(ctx, sym, scraper.CandleRange{Start: g.Start, End: g.End, Interval: interval})
+		if err != nil {
+			slog.Warn("Could not fetch missing candles", "symbol", g.Symbol, "exchange", g.Exchange, "start", g.Start.Format(scraper.DateFormat), "error", err)
+			continue
+		}
+		if len(candles) == 0 {
+			slog.Warn("No candles for missing days", "symbol", g.Symbol, "exchange", g.Exchange, "start", g.Start.Format(scraper.DateFormat), "end", g.End.Format(scraper.DateFormat))
+			continue
+		}
+		sym.Candles = candles
+		if err := st.SaveSymbol(sym); err != nil {
+			return err
+		}
+		filled++
+		slog.Info("Filled gap", "symbol", g.Symbol, "exchange", g.Exchange, "start", g.Start.Format(scraper.DateFormat), "candles", len(candles))
+	}
+	slog.Info("Filled gaps", "filled", filled, "gaps", len(gaps))
+	return nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/alexurquhart/sp500scraper/pkg/store"
+	"github.com/alexurquhart/sp500scraper/pkg/universe"
+)
+
+// Universes of the comma separated watchlists given with -watchlist, each
+// NAME=FILE or a FILE named after its base name. Symbols that don't give an
+// exchange are on exchange.
+func parseWatchlists(list, exchange string) ([]universe.Universe, error) {
+	var us []universe.Universe
+	names := make(map[string]bool)
+	for _, item := range splitList(list) {
+		name, file := "", item
+		if i := strings.Index(item, "="); i >= 0 {
+			name, file = strings.TrimSpace(item[:i]), strings.TrimSpace(item[i+1:])
+		}
+		if name == "" {
+			name = strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+		}
+		if file == "" {
+			return nil, errors.New("Watchlist " + name + " has no file")
+		}
+		if names[name] {
+			return nil, errors.New("Watchlist " + name + " is given twice")
+		}
+		names[name] = true
+		us = append(us, universe.Watchlist(name, file, exchange))
+	}
+	return us, nil
+}
+
+// Symbols of a universe as of the last time its file was read
+type watchedFile struct {
+	mod     time.Time
+	symbols []store.Symbol
+}
+
+// Files of the universes loaded by the daemon. A file is only read again
+// once it has changed, and the symbols added to or removed from it are
+// logged, so edits are picked up by the next run without a restart.
+type watchedFiles map[string]*watchedFile
+
+// Symbols of the universe, read from its file if it changed since the last
+// call. Universes that are refreshed from Wikipedia or whose membership
+// history is rebuilt are always loaded.
+func (w watchedFiles) load(st store.Store, u universe.Universe, refresh, membership, former bool, start time.Time) ([]store.Symbol, error) {
+	info, err := os.Stat(u.File)
+	if err != nil || refresh || membership {
+		return loadSymbols(st, u, refresh, membership, former, start)
+	}
+	last, ok := w[u.File]
+	if ok && info.ModTime().Equal(last.mod) {
+		return last.symbols, nil
+	}
+
+	symbols, err := loadSymbols(st, u, false, false, false, start)
+	if err != nil {
+		if ok {
+			// Keep using the symbols read before, it may be mid edit
+			slog.Warn("Could not reload symbols, using the previous list", "universe", u.Name, "file", u.File, "error", err)
+			return last.symbols, nil
+		}
+		return nil, err
+	}
+	if ok {
+		added, removed := diffSymbols(last.symbols, symbols)
+		slog.Info("Symbol file changed", "universe", u.Name, "file", u.File, "added", added, "removed", removed)
+	}
+	w[u.File] = &watchedFile{mod: info.ModTime(), symbols: symbols}
+	return symbols, nil
+}
+
+// Keys of the symbols in b that aren't in a, and of those in a that aren't
+// in b.
+func diffSymbols(a, b []store.Symbol) (added, removed []string) {
+	in := func(symbols []store.Symbol) map[string]bool {
+		m := make(map[string]bool, len(symbols))
+		for _, s := range symbols {
+			m[s.Key()] = true
+		}
+		return m
+	}
+	inA, inB := in(a), in(b)
+	for _, s := range b {
+		if !inA[s.Key()] {
+			added = append(added, s.Key())
+		}
+	}
+	for _, s := range a {
+		if !inB[s.Key()] {
+			removed = append(removed, s.Key())
+		}
+	}
+	return added, removed
+}